@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+const usage = `Usage: simple-idm [command]
+
+Without a command, the HTTP server is started.
+
+Commands:
+  keys list                List signing keys in the key ring
+  keys stage [algorithm]   Generate a key that verifies and is published, but does not sign yet
+  keys promote <kid>       Start signing with a key; the previous key verifies until retired
+  keys retire <kid>        Stop accepting tokens signed with a key
+  cleanup                  Delete expired sessions, verification tokens and used recovery codes
+  clients list             List registered OAuth clients
+  clients create <name>    Register an OAuth client and print its secret
+  clients revoke <id>      Stop a client from authenticating
+  clients redirect-uris <id> [uri...]
+                           Set where the authorization endpoint may return the client's users
+  clients scopes <id> [scope...]
+                           Set the scopes the client may request for its own tokens
+  clients roles <id> [role...]
+                           Set the roles put in the client's own tokens
+  clients exchange-audiences <id> [audience...]
+                           Set the services the client may exchange user tokens for
+`
+
+// runCommand runs a one-shot subcommand and returns the process exit code.
+func runCommand(ctx context.Context, args []string, keyRing *auth.KeyRing, janitor *auth.Janitor, clients *auth.ClientService) int {
+	switch args[0] {
+	case "clients":
+		return runClients(ctx, args[1:], clients)
+	case "cleanup":
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		return runCleanup(ctx, janitor)
+	case "keys":
+		if keyRing == nil {
+			fmt.Fprintln(os.Stderr, "key ring is not configured (set JWT_KEY_RING_ENCRYPTION_KEY)")
+			return 1
+		}
+		return runKeys(ctx, args[1:], keyRing)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runKeys(ctx context.Context, args []string, keyRing *auth.KeyRing) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		err = listKeys(ctx, keyRing)
+	case args[0] == "stage" && len(args) <= 2:
+		algorithm := ""
+		if len(args) == 2 {
+			algorithm = args[1]
+		}
+		var key *auth.SigningKey
+		if key, err = keyRing.Stage(ctx, algorithm); err == nil {
+			fmt.Printf("staged %s (%s)\n", key.ID, key.Algorithm())
+		}
+	case args[0] == "promote" && len(args) == 2:
+		if err = keyRing.Promote(ctx, args[1]); err == nil {
+			fmt.Printf("promoted %s\n", args[1])
+		}
+	case args[0] == "retire" && len(args) == 2:
+		if err = keyRing.Retire(ctx, args[1]); err == nil {
+			fmt.Printf("retired %s\n", args[1])
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keys %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func runClients(ctx context.Context, args []string, clients *auth.ClientService) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		err = listClients(ctx, clients)
+	case args[0] == "create" && len(args) == 2:
+		var client *domain.OAuthClient
+		var secret string
+		if client, secret, err = clients.CreateClient(ctx, args[1]); err == nil {
+			fmt.Printf("client_id:     %s\nclient_secret: %s\n", client.ID, secret)
+			fmt.Println("Store the secret now; it cannot be shown again.")
+		}
+	case args[0] == "revoke" && len(args) == 2:
+		if err = clients.RevokeClient(ctx, args[1]); err == nil {
+			fmt.Printf("revoked %s\n", args[1])
+		}
+	case args[0] == "redirect-uris" && len(args) >= 2:
+		if err = clients.SetRedirectURIs(ctx, args[1], args[2:]); err == nil {
+			fmt.Printf("set %d redirect URIs for %s\n", len(args)-2, args[1])
+		}
+	case args[0] == "scopes" && len(args) >= 2:
+		if err = clients.SetScopes(ctx, args[1], args[2:]); err == nil {
+			fmt.Printf("set %d scopes for %s\n", len(args)-2, args[1])
+		}
+	case args[0] == "roles" && len(args) >= 2:
+		if err = clients.SetRoles(ctx, args[1], args[2:]); err == nil {
+			fmt.Printf("set %d roles for %s\n", len(args)-2, args[1])
+		}
+	case args[0] == "exchange-audiences" && len(args) >= 2:
+		if err = clients.SetExchangeAudiences(ctx, args[1], args[2:]); err == nil {
+			fmt.Printf("set %d exchange audiences for %s\n", len(args)-2, args[1])
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clients %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func listClients(ctx context.Context, clients *auth.ClientService) error {
+	list, err := clients.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENT ID\tNAME\tCREATED\tREVOKED\tSCOPES\tROLES\tEXCHANGE AUDIENCES\tREDIRECT URIS")
+	for _, client := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			client.ID,
+			client.Name,
+			client.CreatedAt.Format(time.RFC3339),
+			formatTime(client.RevokedAt),
+			formatList(client.Scopes),
+			formatList(client.Roles),
+			formatList(client.ExchangeAudiences),
+			formatList(client.RedirectURIs),
+		)
+	}
+	return w.Flush()
+}
+
+func runCleanup(ctx context.Context, janitor *auth.Janitor) int {
+	deleted, err := janitor.RunOnce(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cleanup: %v\n", err)
+		return 1
+	}
+	if deleted == nil {
+		fmt.Println("cleanup skipped: another replica is cleaning up")
+		return 0
+	}
+
+	names := make([]string, 0, len(deleted))
+	for name := range deleted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %d deleted\n", name, deleted[name])
+	}
+	return 0
+}
+
+func listKeys(ctx context.Context, keyRing *auth.KeyRing) error {
+	keys, err := keyRing.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATUS\tCREATED\tACTIVATED\tRETIRE AT")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			key.ID,
+			key.Algorithm,
+			key.Status(now),
+			key.CreatedAt.Format(time.RFC3339),
+			formatTime(key.ActivatedAt),
+			formatTime(key.RetireAt),
+		)
+	}
+	return w.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, " ")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -15,7 +16,10 @@ import (
 	"github.com/tendant/simple-idm-slim/pkg/auth"
 	"github.com/tendant/simple-idm-slim/internal/config"
 	httpserver "github.com/tendant/simple-idm-slim/internal/http"
+	"github.com/tendant/simple-idm-slim/internal/http/features/external"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
 	"github.com/tendant/simple-idm-slim/internal/notification"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
 	"github.com/tendant/simple-idm-slim/pkg/repository"
 )
 
@@ -61,6 +65,9 @@ func main() {
 	verificationTokensRepo := repository.NewVerificationTokensRepository(db)
 	mfaSecretsRepo := repository.NewMFASecretsRepository(db)
 	mfaRecoveryCodesRepo := repository.NewMFARecoveryCodesRepository(db)
+	oauthClientsRepo := repository.NewOAuthClientsRepository(db)
+	oauthStatesRepo := repository.NewOAuthStatesRepository(db)
+	deviceCodesRepo := repository.NewOAuthDeviceCodesRepository(db)
 
 	// Initialize services
 	passwordPolicy := auth.NewPasswordPolicy(cfg.PasswordPolicy)
@@ -72,14 +79,133 @@ func main() {
 		cfg.Validation.StrictEmailValidation,
 		cfg.Validation.BlockDisposableEmail,
 	)
-	sessionService := auth.NewSessionService(auth.SessionConfig{
+
+	// Load asymmetric signing key if configured (published via /.well-known/jwks.json)
+	var signingKey *auth.SigningKey
+	if cfg.JWTSigningKeyFile != "" {
+		pemData, err := os.ReadFile(cfg.JWTSigningKeyFile)
+		if err != nil {
+			logger.Error("failed to read JWT signing key", "path", cfg.JWTSigningKeyFile, "error", err)
+			os.Exit(1)
+		}
+		signingKey, err = auth.ParseSigningKeyPEM(cfg.JWTSigningKeyID, pemData)
+		if err != nil {
+			logger.Error("invalid JWT signing key", "path", cfg.JWTSigningKeyFile, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("JWT asymmetric signing enabled", "alg", signingKey.Algorithm(), "kid", signingKey.ID)
+	}
+
+	// Initialize signing key ring if configured (rotating keys shared across replicas)
+	var keyRing *auth.KeyRing
+	if cfg.HasKeyRing() {
+		encryptionKey, err := hex.DecodeString(cfg.KeyRing.EncryptionKey)
+		if err != nil || len(encryptionKey) != 32 {
+			logger.Error("JWT_KEY_RING_ENCRYPTION_KEY must be 64-char hex (32 bytes)")
+			os.Exit(1)
+		}
+
+		// Tokens issued with JWT_SECRET before the ring was enabled carry no kid
+		var fallbackKey *auth.SigningKey
+		if cfg.JWTSecret != "" {
+			fallbackKey = auth.NewHMACSigningKey("", []byte(cfg.JWTSecret))
+		}
+
+		keyRing, err = auth.NewKeyRing(auth.KeyRingConfig{
+			EncryptionKey:   encryptionKey,
+			Algorithm:       cfg.KeyRing.Algorithm,
+			RefreshInterval: cfg.KeyRing.RefreshInterval,
+			RetireAfter:     cfg.KeyRing.RetireAfter,
+			FallbackKey:     fallbackKey,
+		}, repository.NewSigningKeysRepository(db))
+		if err != nil {
+			logger.Error("failed to create signing key ring", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Deletes expired rows, in the background or via "simple-idm cleanup"
+	janitor := auth.NewJanitor(auth.JanitorConfig{
+		Interval:                   cfg.Janitor.Interval,
+		BatchSize:                  cfg.Janitor.BatchSize,
+		SessionRetention:           cfg.Janitor.SessionRetention,
+		VerificationTokenRetention: cfg.Janitor.VerificationTokenRetention,
+		RecoveryCodeRetention:      cfg.Janitor.RecoveryCodeRetention,
+	}, db, sessionsRepo, verificationTokensRepo, mfaRecoveryCodesRepo)
+	if cfg.OAuthStateStore == "database" {
+		// Rows of abandoned logins are deleted once expired
+		janitor.AddTask("oauth_states", 0, oauthStatesRepo.DeleteExpired)
+	}
+	// Device codes nobody approved or redeemed in time
+	janitor.AddTask("oauth_device_codes", 0, deviceCodesRepo.DeleteExpired)
+
+	// Registered backends calling the OAuth endpoints
+	clientService := auth.NewClientService(oauthClientsRepo)
+
+	// Login methods of signed-in users: listing, linking and unlinking
+	identityService := auth.NewIdentityService(identitiesRepo, credsRepo)
+
+	// Confirms links of external logins to existing users, if the policy asks for it
+	var accountLinkService *auth.AccountLinkService
+	if cfg.AccountLinkPolicy == string(auth.AccountLinkRequireConfirmation) {
+		accountLinkService = auth.NewAccountLinkService(db, usersRepo, identitiesRepo, verificationTokensRepo, passwordService)
+	}
+
+	// Subcommands (e.g. "simple-idm keys list") run once and exit
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(context.Background(), os.Args[1:], keyRing, janitor, clientService))
+	}
+
+	if keyRing != nil {
+		if err := keyRing.Load(context.Background()); err != nil {
+			logger.Error("failed to load signing key ring", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("JWT signing key ring enabled")
+	}
+
+	sessionConfig := auth.SessionConfig{
 		AccessTokenTTL:     cfg.AccessTokenTTL,
 		RefreshTokenTTL:    cfg.RefreshTokenTTL,
+		RefreshReuseGrace:  cfg.RefreshReuseGrace,
 		JWTSecret:          []byte(cfg.JWTSecret),
+		SigningKey:         signingKey,
 		Issuer:             cfg.JWTIssuer,
 		FingerprintEnabled: cfg.SessionSecurity.FingerprintEnabled,
 		DetectReuseEnabled: cfg.SessionSecurity.DetectReuse,
-	}, sessionsRepo, usersRepo)
+		RevocationCheck:    cfg.SessionSecurity.RevocationCheck,
+		RevocationCacheTTL: cfg.SessionSecurity.RevocationCacheTTL,
+		IdleTimeout:        cfg.SessionSecurity.IdleTimeout,
+		MaxLifetime:        cfg.SessionSecurity.MaxLifetime,
+	}
+	if len(cfg.SessionSecurity.RolePolicies) > 0 {
+		sessionConfig.RolePolicies = make(map[string]auth.SessionPolicy, len(cfg.SessionSecurity.RolePolicies))
+		for role, policy := range cfg.SessionSecurity.RolePolicies {
+			sessionConfig.RolePolicies[role] = auth.SessionPolicy{
+				IdleTimeout: policy.IdleTimeout,
+				MaxLifetime: policy.MaxLifetime,
+			}
+		}
+	}
+	if keyRing != nil {
+		sessionConfig.Keys = keyRing
+	}
+	// Roles go into access tokens and userinfo, and select role-based session limits
+	rolesRepo := repository.NewRolesRepository(db)
+	sessionService := auth.NewSessionServiceWithRoles(sessionConfig, sessionsRepo, usersRepo, rolesRepo)
+
+	// Apps logging users in through the authorization endpoint (OpenID Connect).
+	// Their ID tokens must be verifiable through the JWKS, so HS256 disables it.
+	authorizationService, err := auth.NewAuthorizationService(oauthClientsRepo, verificationTokensRepo, usersRepo, sessionService)
+	if errors.Is(err, domain.ErrSymmetricSigningKey) {
+		logger.Warn("OpenID Connect provider disabled; set an RS256, ES256 or EdDSA signing key to enable /v1/oauth/authorize", "error", err)
+	} else if err != nil {
+		logger.Error("failed to create authorization service", "error", err)
+		os.Exit(1)
+	}
+
+	// Command line tools signing users in with a code approved in the browser
+	deviceService := auth.NewDeviceService(deviceCodesRepo, oauthClientsRepo, sessionService)
 
 	verificationService := auth.NewVerificationService(auth.VerificationConfig{
 		EmailVerificationTTL: cfg.EmailVerificationTTL,
@@ -100,6 +226,9 @@ func main() {
 		logger.Info("email service enabled")
 	}
 
+	// What external logins do when their email belongs to an existing user
+	linkPolicy := auth.AccountLinkPolicy(cfg.AccountLinkPolicy)
+
 	// Initialize Google service if configured
 	var googleService *auth.GoogleService
 	if cfg.HasGoogleOAuth() {
@@ -108,6 +237,9 @@ func main() {
 				ClientID:     cfg.GoogleClientID,
 				ClientSecret: cfg.GoogleClientSecret,
 				RedirectURI:  cfg.GoogleRedirectURI,
+
+				HostedDomains:  cfg.GoogleHostedDomains,
+				AccountLinking: linkPolicy,
 			},
 			db,
 			usersRepo,
@@ -116,6 +248,117 @@ func main() {
 		logger.Info("Google OAuth enabled")
 	}
 
+	// Initialize GitHub service if configured
+	var githubService *auth.GitHubService
+	if cfg.HasGitHubOAuth() {
+		githubService = auth.NewGitHubService(
+			auth.GitHubConfig{
+				ClientID:     cfg.GitHubClientID,
+				ClientSecret: cfg.GitHubClientSecret,
+				RedirectURI:  cfg.GitHubRedirectURI,
+
+				AccountLinking: linkPolicy,
+			},
+			db,
+			usersRepo,
+			identitiesRepo,
+		)
+		logger.Info("GitHub OAuth enabled")
+	}
+
+	// Initialize Sign in with Apple if configured
+	var appleService *auth.AppleService
+	if cfg.HasAppleSignIn() {
+		pemData, err := os.ReadFile(cfg.ApplePrivateKeyFile)
+		if err != nil {
+			logger.Error("failed to read Apple private key", "path", cfg.ApplePrivateKeyFile, "error", err)
+			os.Exit(1)
+		}
+		appleService, err = auth.NewAppleService(
+			auth.AppleConfig{
+				ClientID:    cfg.AppleClientID,
+				TeamID:      cfg.AppleTeamID,
+				KeyID:       cfg.AppleKeyID,
+				PrivateKey:  pemData,
+				RedirectURI: cfg.AppleRedirectURI,
+				BundleIDs:   cfg.AppleBundleIDs,
+
+				AccountLinking: linkPolicy,
+			},
+			db,
+			usersRepo,
+			identitiesRepo,
+		)
+		if err != nil {
+			logger.Error("invalid Apple configuration", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Sign in with Apple enabled")
+	}
+
+	// Initialize OpenID Connect providers
+	var oidcProviders []*auth.OIDCProvider
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, auth.NewOIDCProvider(
+			auth.OIDCConfig{
+				Name:         p.Name,
+				Issuer:       p.Issuer,
+				DiscoveryURL: p.DiscoveryURL,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURI:  p.RedirectURI,
+				Scopes:       p.Scopes,
+				ClaimMappings: auth.OIDCClaimMappings{
+					Subject:       p.ClaimSubject,
+					Email:         p.ClaimEmail,
+					EmailVerified: p.ClaimEmailVerified,
+					Name:          p.ClaimName,
+				},
+				AccountLinking: linkPolicy,
+			},
+			db,
+			usersRepo,
+			identitiesRepo,
+		))
+		logger.Info("OpenID Connect provider enabled", "provider", p.Name, "issuer", p.Issuer)
+	}
+
+	// Initialize SAML identity providers
+	var samlProviders []*auth.SAMLProvider
+	for _, p := range cfg.SAMLProviders {
+		certs, err := auth.ParseSAMLCertificates(p.IdPCertificate)
+		if err != nil {
+			logger.Error("invalid SAML IdP certificate", "provider", p.Name, "error", err)
+			os.Exit(1)
+		}
+		provider, err := auth.NewSAMLProvider(
+			auth.SAMLConfig{
+				Name:            p.Name,
+				EntityID:        p.EntityID,
+				ACSURL:          p.ACSURL,
+				IdPEntityID:     p.IdPEntityID,
+				IdPSSOURL:       p.IdPSSOURL,
+				IdPCertificates: certs,
+				AttributeMappings: auth.SAMLAttributeMappings{
+					Subject: p.AttrSubject,
+					Email:   p.AttrEmail,
+					Name:    p.AttrName,
+				},
+				TrustEmail:     p.TrustEmail,
+				AccountLinking: linkPolicy,
+			},
+			db,
+			usersRepo,
+			identitiesRepo,
+		)
+		if err != nil {
+			logger.Error("invalid SAML configuration", "provider", p.Name, "error", err)
+			os.Exit(1)
+		}
+		samlProviders = append(samlProviders, provider)
+		logger.Info("SAML identity provider enabled", "provider", p.Name, "idp_entity_id", p.IdPEntityID)
+	}
+
 	// Initialize MFA service if configured
 	var mfaService *auth.MFAService
 	if cfg.HasMFA() {
@@ -148,7 +391,26 @@ func main() {
 			logger.Error("OAUTH_STATE_SIGN_KEY must be 64-char hex (32 bytes)")
 			os.Exit(1)
 		}
-		logger.Info("OAuth state cookie signing enabled (multi-replica safe)")
+	}
+
+	// Where OAuth state is kept between the redirect to a provider and its callback
+	var oauthStateStore external.StateStore
+	switch cfg.OAuthStateStore {
+	case "cookie":
+		oauthStateStore = external.NewCookieStateStore(oauthStateSignKey, true)
+		logger.Info("OAuth state: using signed cookies (multi-replica safe)")
+	case "database":
+		oauthStateStore = external.NewDBStateStore(oauthStatesRepo)
+		logger.Info("OAuth state: using database (multi-replica safe)")
+	default:
+		oauthStateStore = external.NewMemoryStateStore()
+		logger.Warn("OAuth state: using in-memory storage (not safe for multi-replica)")
+	}
+
+	redirectAllowlist, err := httputil.NewRedirectAllowlist(cfg.RedirectAllowlist, cfg.RedirectAllowRelative)
+	if err != nil {
+		logger.Error("invalid REDIRECT_ALLOWLIST", "error", err)
+		os.Exit(1)
 	}
 
 	// Create router
@@ -156,21 +418,33 @@ func main() {
 		Logger:                    logger,
 		PasswordService:           passwordService,
 		GoogleService:             googleService,
+		GitHubService:             githubService,
+		AppleService:              appleService,
+		OIDCProviders:             oidcProviders,
+		SAMLProviders:             samlProviders,
 		SessionService:            sessionService,
 		VerificationService:       verificationService,
 		EmailService:              emailService,
 		MFAService:                mfaService,
+		ClientService:             clientService,
+		AuthorizationService:      authorizationService,
+		DeviceService:             deviceService,
+		IdentityService:           identityService,
+		AccountLinkService:        accountLinkService,
 		UsersRepo:                 usersRepo,
 		AppBaseURL:                cfg.AppBaseURL,
 		ServeUI:                   cfg.ServeUI,
+		LoginURL:                  cfg.LoginURL,
+		DeviceVerificationURL:     cfg.DeviceVerificationURL,
 		TemplatesDir:              "web/templates",
 		RateLimitConfig:           cfg.RateLimit,
 		SecurityHeaders:           cfg.SecurityHeaders,
 		Validation:                cfg.Validation,
 		SessionSecurity:           cfg.SessionSecurity,
 		EmailVerificationRequired: cfg.EmailVerificationRequired,
-		OAuthStateSignKey:         oauthStateSignKey,
+		OAuthStateStore:           oauthStateStore,
 		CookieSecure:              true, // Should be true for production (HTTPS)
+		RedirectAllowlist:         redirectAllowlist,
 	})
 
 	// Create HTTP server
@@ -183,6 +457,14 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Clean up expired rows in the background until shutdown
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	if cfg.Janitor.Enabled {
+		go janitor.Run(janitorCtx)
+		logger.Info("janitor enabled", "interval", cfg.Janitor.Interval)
+	}
+
 	// Start server in goroutine
 	go func() {
 		logger.Info("starting server", "addr", addr)
@@ -198,6 +480,7 @@ func main() {
 	<-quit
 
 	logger.Info("shutting down server")
+	stopJanitor()
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -1,5 +1,5 @@
 // Package idm provides a minimal identity management library with
-// password and Google OAuth authentication.
+// password, Google, GitHub, Apple, OpenID Connect and SAML authentication.
 //
 // Setup:
 //
@@ -37,6 +37,7 @@ package idm
 
 import (
 	"context"
+	"crypto/x509"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -48,10 +49,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/features/accountlink"
+	"github.com/tendant/simple-idm-slim/internal/http/features/apple"
+	"github.com/tendant/simple-idm-slim/internal/http/features/external"
 	"github.com/tendant/simple-idm-slim/internal/http/features/google"
+	"github.com/tendant/simple-idm-slim/internal/http/features/identity"
 	"github.com/tendant/simple-idm-slim/internal/http/features/me"
+	"github.com/tendant/simple-idm-slim/internal/http/features/oauth"
 	"github.com/tendant/simple-idm-slim/internal/http/features/password"
+	"github.com/tendant/simple-idm-slim/internal/http/features/saml"
 	"github.com/tendant/simple-idm-slim/internal/http/features/session"
+	"github.com/tendant/simple-idm-slim/internal/http/features/wellknown"
 	"github.com/tendant/simple-idm-slim/internal/http/middleware"
 	"github.com/tendant/simple-idm-slim/internal/httputil"
 	"github.com/tendant/simple-idm-slim/pkg/auth"
@@ -64,9 +72,33 @@ type Config struct {
 	// DB is the database connection (required).
 	DB *sql.DB
 
-	// JWTSecret is the secret key for signing JWT tokens (required, min 32 chars).
+	// JWTSecret is the secret key for signing JWT tokens with HS256
+	// (required unless JWTSigningKey is set, min 32 chars).
 	JWTSecret string
 
+	// JWTSigningKey is a PEM-encoded private key (RSA, ECDSA or Ed25519) for
+	// signing JWT tokens with RS256, ES256 or EdDSA (optional). When set, the
+	// public key is served from /.well-known/jwks.json and JWTSecret is not used.
+	JWTSigningKey []byte
+
+	// JWTSigningKeyID is the "kid" header for JWTSigningKey
+	// (default: the RFC 7638 thumbprint of the key).
+	JWTSigningKeyID string
+
+	// KeyRing stores signing keys in the database so they can be rotated
+	// across replicas without downtime (optional). When set, JWTSecret is only
+	// used to verify tokens issued before the key ring was enabled.
+	KeyRing *KeyRingConfig
+
+	// Janitor enables cleanup of expired sessions, verification tokens and used
+	// MFA recovery codes via RunJanitor and Cleanup (optional).
+	Janitor *JanitorConfig
+
+	// OAuthClients enables the token introspection and revocation endpoints,
+	// which registered backends call with a client ID and secret (optional).
+	// Requires the oauth_clients table; register clients with CreateOAuthClient.
+	OAuthClients bool
+
 	// JWTIssuer is the issuer claim in JWT tokens (default: "simple-idm").
 	JWTIssuer string
 
@@ -76,10 +108,44 @@ type Config struct {
 	// RefreshTokenTTL is the lifetime of refresh tokens (default: 7 days).
 	RefreshTokenTTL time.Duration
 
+	// RefreshReuseGrace is how long a rotated refresh token is still accepted
+	// from the same client, to tolerate concurrent refreshes (default: 10 seconds).
+	RefreshReuseGrace time.Duration
+
 	// Google enables Google OAuth authentication (optional).
 	Google *GoogleConfig
 
-	// AccessTokenIssuer overrides access token signing (optional).
+	// GitHub enables GitHub OAuth authentication (optional).
+	GitHub *GitHubConfig
+
+	// Apple enables Sign in with Apple (optional).
+	Apple *AppleConfig
+
+	// OIDCProviders enables login with OpenID Connect providers such as Okta,
+	// Keycloak or Auth0 (optional). Each is served under /oidc/{Name}/.
+	OIDCProviders []OIDCProviderConfig
+
+	// SAMLProviders enables enterprise SSO with SAML 2.0 identity providers
+	// (optional). Each is served under /saml/{Name}/.
+	SAMLProviders []SAMLProviderConfig
+
+	// RedirectAllowlist lists where browsers may be sent after an external
+	// login: origins ("https://app.example.com") or path prefixes
+	// ("https://app.example.com/oauth/", "/app/"). Relative paths are
+	// always allowed unless DisallowRelativeRedirects is set.
+	RedirectAllowlist         []string
+	DisallowRelativeRedirects bool
+
+	// AccountLinking decides what an external login does when the provider
+	// verified the email of an existing user whose account does not have the
+	// identity yet (default: auth.AccountLinkAuto, link it). Set
+	// auth.AccountLinkRequireConfirmation to have the user confirm with their
+	// password first, or auth.AccountLinkNever to refuse such logins. Applies
+	// to every provider. Confirmation requires the verification_tokens table.
+	AccountLinking auth.AccountLinkPolicy
+
+	// AccessTokenIssuer overrides access token signing (optional), including
+	// client credentials tokens, for which the input's User is nil.
 	AccessTokenIssuer auth.AccessTokenIssuer
 
 	// Logger is the structured logger (default: slog.Default()).
@@ -111,8 +177,65 @@ type PasswordPolicyConfig struct {
 type SessionSecurityConfig struct {
 	FingerprintEnabled bool
 	DetectReuse        bool
+
+	// RevocationCheck makes the auth middleware reject access tokens whose
+	// session was revoked (logout, logout-all, password reset) before they expire.
+	RevocationCheck bool
+	// RevocationCacheTTL is how long a session's status is cached in process (default: 30s).
+	RevocationCacheTTL time.Duration
+
+	// IdleTimeout ends sessions that have not been refreshed for this long (0 = no limit).
+	IdleTimeout time.Duration
+	// MaxLifetime ends sessions this long after login, however active they are (0 = no limit).
+	MaxLifetime time.Duration
+	// RolePolicies sets stricter limits for users with a role, e.g. shorter
+	// sessions for "admin". The strictest applicable limit wins.
+	RolePolicies map[string]auth.SessionPolicy
 }
 
+// KeyRingConfig configures the database-backed signing key ring.
+type KeyRingConfig struct {
+	// EncryptionKey is a 32-byte key protecting stored keys (required).
+	// Generate with: openssl rand -hex 32
+	EncryptionKey []byte
+	// Algorithm for generated keys: HS256, RS256, ES256 or EdDSA (default: HS256).
+	Algorithm string
+	// RefreshInterval is how often each replica reloads the ring (default: 1 minute).
+	RefreshInterval time.Duration
+	// RetireAfter is how long a replaced signing key keeps verifying (default: 1 hour).
+	RetireAfter time.Duration
+}
+
+// JanitorConfig configures cleanup of expired rows.
+// Zero values use the defaults from the auth package.
+type JanitorConfig struct {
+	// Interval between runs of RunJanitor (default: 1 hour).
+	Interval time.Duration
+	// BatchSize is how many rows are deleted per statement (default: 1000).
+	BatchSize int
+	// SessionRetention is how long expired or revoked sessions are kept (default: 7 days).
+	SessionRetention time.Duration
+	// VerificationTokenRetention is how long expired or consumed tokens are kept (default: 7 days).
+	VerificationTokenRetention time.Duration
+	// RecoveryCodeRetention is how long used MFA recovery codes are kept (default: 30 days).
+	RecoveryCodeRetention time.Duration
+}
+
+// OAuthStateStore selects where a login provider keeps OAuth state between
+// the redirect to the provider and its callback.
+type OAuthStateStore string
+
+const (
+	// OAuthStateMemory keeps state in memory. Callbacks must reach the
+	// replica that started the login.
+	OAuthStateMemory OAuthStateStore = "memory"
+	// OAuthStateCookie keeps state in a cookie signed with StateSignKey.
+	OAuthStateCookie OAuthStateStore = "cookie"
+	// OAuthStateDatabase keeps state in the oauth_states table. Each row is
+	// deleted by the callback that uses it, so state cannot be replayed.
+	OAuthStateDatabase OAuthStateStore = "database"
+)
+
 // GoogleConfig holds Google OAuth configuration.
 type GoogleConfig struct {
 	ClientID     string
@@ -124,8 +247,119 @@ type GoogleConfig struct {
 	// StateSignKey is a 32-byte key for signing OAuth state cookies.
 	// Required for multi-replica deployments. Generate with: openssl rand -hex 32
 	StateSignKey []byte
+	// StateStore is where OAuth state is kept (default: OAuthStateCookie if
+	// StateSignKey is set, otherwise OAuthStateMemory).
+	StateStore OAuthStateStore
 	// CookieSecure sets the Secure flag on OAuth state cookies (default: true for HTTPS).
 	CookieSecure bool
+	// JWKSURL is where the keys verifying Google ID tokens are fetched from
+	// (default: Google's). Point it at a local stand-in in tests.
+	JWKSURL string
+	// HostedDomains limits sign-in to Google Workspace accounts of these
+	// domains, by the ID token's "hd" claim. Empty allows any Google account.
+	HostedDomains []string
+}
+
+// GitHubConfig holds GitHub OAuth configuration.
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	// BaseURL and APIURL point at a GitHub Enterprise Server
+	// (default: https://github.com and https://api.github.com).
+	BaseURL string
+	APIURL  string
+	// StateSignKey is a 32-byte key for signing OAuth state cookies.
+	// Required for multi-replica deployments. Generate with: openssl rand -hex 32
+	StateSignKey []byte
+	// StateStore is where OAuth state is kept, as in GoogleConfig.
+	StateStore OAuthStateStore
+	// CookieSecure sets the Secure flag on OAuth state cookies.
+	CookieSecure bool
+}
+
+// AppleConfig holds Sign in with Apple configuration.
+type AppleConfig struct {
+	// ClientID is the Services ID of the web flow.
+	ClientID string
+	TeamID   string
+	KeyID    string
+	// PrivateKey is the PEM (.p8) key downloaded from the Apple Developer
+	// portal. It signs the client secret sent to Apple.
+	PrivateKey []byte
+	// RedirectURI must be HTTPS; Apple posts the callback to it.
+	RedirectURI string
+	// BundleIDs are the native app bundle IDs whose identity tokens are
+	// accepted at /apple/token.
+	BundleIDs []string
+	// StateSignKey is a 32-byte key for signing OAuth state cookies.
+	// Required for multi-replica deployments. Generate with: openssl rand -hex 32
+	StateSignKey []byte
+	// StateStore is where OAuth state is kept, as in GoogleConfig.
+	StateStore OAuthStateStore
+	// CookieSecure sets the Secure flag on OAuth state cookies. Apple posts
+	// the callback cross-site, so cookie state only works with it set.
+	CookieSecure bool
+	// JWKSURL is where the keys verifying identity tokens are fetched from
+	// (default: Apple's). Point it at a local stand-in in tests.
+	JWKSURL string
+}
+
+// OIDCProviderConfig holds the configuration of an OpenID Connect login provider.
+type OIDCProviderConfig struct {
+	// Name identifies the provider in routes and linked identities, e.g. "okta".
+	// Lowercase letters, digits and '-' only; "google", "github" and "apple" are reserved.
+	Name   string
+	Issuer string
+	// DiscoveryURL overrides where the provider metadata is fetched from
+	// (default: Issuer + "/.well-known/openid-configuration").
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	// Scopes requested at login (default: openid email profile).
+	Scopes []string
+	// ClaimMappings names non-standard claims holding the user's attributes.
+	ClaimMappings auth.OIDCClaimMappings
+	// StateSignKey is a 32-byte key for signing OAuth state cookies.
+	// Required for multi-replica deployments. Generate with: openssl rand -hex 32
+	StateSignKey []byte
+	// StateStore is where OAuth state is kept, as in GoogleConfig.
+	StateStore OAuthStateStore
+	// CookieSecure sets the Secure flag on OAuth state cookies.
+	CookieSecure bool
+}
+
+// SAMLProviderConfig holds the configuration of a SAML 2.0 identity provider.
+type SAMLProviderConfig struct {
+	// Name identifies the provider in routes, e.g. "acme". Lowercase
+	// letters, digits and '-' only. Linked identities are stored under
+	// "saml:" + IdPEntityID instead.
+	Name string
+	// EntityID is our entity ID at the IdP, usually the metadata URL.
+	EntityID string
+	// ACSURL is where the IdP posts responses: the /saml/{Name}/acs route.
+	ACSURL      string
+	IdPEntityID string
+	// IdPSSOURL is the IdP's single sign-on service (HTTP-Redirect binding).
+	IdPSSOURL string
+	// IdPCertificates verify the IdP's signed assertions. See
+	// auth.ParseSAMLCertificates.
+	IdPCertificates []*x509.Certificate
+	// AttributeMappings names the attributes holding the user's subject,
+	// email and name, if the IdP does not use common ones.
+	AttributeMappings auth.SAMLAttributeMappings
+	// TrustEmail treats emails from the IdP as verified, so first logins
+	// link to existing users with the same email.
+	TrustEmail bool
+	// StateSignKey is a 32-byte key for signing OAuth state cookies.
+	// Required for multi-replica deployments. Generate with: openssl rand -hex 32
+	StateSignKey []byte
+	// StateStore is where login state is kept, as in GoogleConfig.
+	StateStore OAuthStateStore
+	// CookieSecure sets the Secure flag on state cookies. IdPs post the
+	// response cross-site, so cookie state only works with it set.
+	CookieSecure bool
 }
 
 // IDM is the main identity management instance.
@@ -140,6 +374,18 @@ type IDM struct {
 	passwordService *auth.PasswordService
 	sessionService  *auth.SessionService
 	googleService   *auth.GoogleService
+	githubService   *auth.GitHubService
+	appleService    *auth.AppleService
+	oidcProviders   []*auth.OIDCProvider // In the order of Config.OIDCProviders
+	samlProviders   []*auth.SAMLProvider // In the order of Config.SAMLProviders
+	redirects       *httputil.RedirectAllowlist
+	memoryStates    *external.MemoryStateStore // Shared by providers using OAuthStateMemory
+	dbStates        *external.DBStateStore     // Set if a provider uses OAuthStateDatabase
+	keyRing         *auth.KeyRing
+	janitor         *auth.Janitor
+	clientService   *auth.ClientService
+	identityService *auth.IdentityService
+	linkService     *auth.AccountLinkService // Set under auth.AccountLinkRequireConfirmation
 }
 
 // New creates a new IDM instance with the given configuration.
@@ -156,6 +402,31 @@ func New(cfg Config) (*IDM, error) {
 	if err := validateSchema(cfg.DB); err != nil {
 		return nil, err
 	}
+	if cfg.KeyRing != nil {
+		if err := validateTables(cfg.DB, "signing_keys"); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Janitor != nil {
+		if err := validateTables(cfg.DB, "verification_tokens", "mfa_recovery_codes"); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.OAuthClients {
+		if err := validateTables(cfg.DB, "oauth_clients"); err != nil {
+			return nil, err
+		}
+	}
+	if usesStateStore(&cfg, OAuthStateDatabase) {
+		if err := validateTables(cfg.DB, "oauth_states"); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AccountLinking == auth.AccountLinkRequireConfirmation {
+		if err := validateTables(cfg.DB, "verification_tokens"); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize repositories
 	usersRepo := repository.NewUsersRepository(cfg.DB)
@@ -187,22 +458,62 @@ func New(cfg Config) (*IDM, error) {
 		cfg.BlockDisposableEmail,
 	)
 
-	fingerprintEnabled := false
-	detectReuse := false
+	var signingKey *auth.SigningKey
+	if len(cfg.JWTSigningKey) > 0 {
+		key, err := auth.ParseSigningKeyPEM(cfg.JWTSigningKeyID, cfg.JWTSigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("idm: invalid JWTSigningKey: %w", err)
+		}
+		signingKey = key
+	}
+
+	var keyRing *auth.KeyRing
+	if cfg.KeyRing != nil {
+		var fallbackKey *auth.SigningKey
+		if cfg.JWTSecret != "" {
+			fallbackKey = auth.NewHMACSigningKey("", []byte(cfg.JWTSecret))
+		}
+		ring, err := auth.NewKeyRing(auth.KeyRingConfig{
+			EncryptionKey:   cfg.KeyRing.EncryptionKey,
+			Algorithm:       cfg.KeyRing.Algorithm,
+			RefreshInterval: cfg.KeyRing.RefreshInterval,
+			RetireAfter:     cfg.KeyRing.RetireAfter,
+			FallbackKey:     fallbackKey,
+		}, repository.NewSigningKeysRepository(cfg.DB))
+		if err != nil {
+			return nil, fmt.Errorf("idm: %w", err)
+		}
+		if err := ring.Load(context.Background()); err != nil {
+			return nil, fmt.Errorf("idm: failed to load signing keys: %w", err)
+		}
+		keyRing = ring
+	}
+
+	var security SessionSecurityConfig
 	if cfg.SessionSecurity != nil {
-		fingerprintEnabled = cfg.SessionSecurity.FingerprintEnabled
-		detectReuse = cfg.SessionSecurity.DetectReuse
+		security = *cfg.SessionSecurity
 	}
 
-	sessionService := auth.NewSessionServiceWithRoles(auth.SessionConfig{
+	sessionConfig := auth.SessionConfig{
 		AccessTokenTTL:     cfg.AccessTokenTTL,
 		RefreshTokenTTL:    cfg.RefreshTokenTTL,
+		RefreshReuseGrace:  cfg.RefreshReuseGrace,
 		JWTSecret:          []byte(cfg.JWTSecret),
+		SigningKey:         signingKey,
 		Issuer:             cfg.JWTIssuer,
 		AccessTokenIssuer:  cfg.AccessTokenIssuer,
-		FingerprintEnabled: fingerprintEnabled,
-		DetectReuseEnabled: detectReuse,
-	}, sessionsRepo, usersRepo, rolesRepo)
+		FingerprintEnabled: security.FingerprintEnabled,
+		DetectReuseEnabled: security.DetectReuse,
+		RevocationCheck:    security.RevocationCheck,
+		RevocationCacheTTL: security.RevocationCacheTTL,
+		IdleTimeout:        security.IdleTimeout,
+		MaxLifetime:        security.MaxLifetime,
+		RolePolicies:       security.RolePolicies,
+	}
+	if keyRing != nil {
+		sessionConfig.Keys = keyRing
+	}
+	sessionService := auth.NewSessionServiceWithRoles(sessionConfig, sessionsRepo, usersRepo, rolesRepo)
 
 	var googleService *auth.GoogleService
 	if cfg.Google != nil {
@@ -212,11 +523,139 @@ func New(cfg Config) (*IDM, error) {
 				ClientSecret:    cfg.Google.ClientSecret,
 				RedirectURI:     cfg.Google.RedirectURI,
 				MobileClientIDs: cfg.Google.MobileClientIDs,
+				JWKSURL:         cfg.Google.JWKSURL,
+				HostedDomains:   cfg.Google.HostedDomains,
+				AccountLinking:  cfg.AccountLinking,
+			},
+			cfg.DB,
+			usersRepo,
+			identitiesRepo,
+		)
+	}
+
+	var githubService *auth.GitHubService
+	if cfg.GitHub != nil {
+		githubService = auth.NewGitHubService(
+			auth.GitHubConfig{
+				ClientID:     cfg.GitHub.ClientID,
+				ClientSecret: cfg.GitHub.ClientSecret,
+				RedirectURI:  cfg.GitHub.RedirectURI,
+				BaseURL:      cfg.GitHub.BaseURL,
+				APIURL:       cfg.GitHub.APIURL,
+
+				AccountLinking: cfg.AccountLinking,
+			},
+			cfg.DB,
+			usersRepo,
+			identitiesRepo,
+		)
+	}
+
+	redirects, err := httputil.NewRedirectAllowlist(cfg.RedirectAllowlist, !cfg.DisallowRelativeRedirects)
+	if err != nil {
+		return nil, fmt.Errorf("idm: %w", err)
+	}
+
+	var appleService *auth.AppleService
+	if cfg.Apple != nil {
+		appleService, err = auth.NewAppleService(
+			auth.AppleConfig{
+				ClientID:    cfg.Apple.ClientID,
+				TeamID:      cfg.Apple.TeamID,
+				KeyID:       cfg.Apple.KeyID,
+				PrivateKey:  cfg.Apple.PrivateKey,
+				RedirectURI: cfg.Apple.RedirectURI,
+				BundleIDs:   cfg.Apple.BundleIDs,
+				JWKSURL:     cfg.Apple.JWKSURL,
+
+				AccountLinking: cfg.AccountLinking,
+			},
+			cfg.DB,
+			usersRepo,
+			identitiesRepo,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("idm: %w", err)
+		}
+	}
+
+	var oidcProviders []*auth.OIDCProvider
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, auth.NewOIDCProvider(
+			auth.OIDCConfig{
+				Name:          p.Name,
+				Issuer:        p.Issuer,
+				DiscoveryURL:  p.DiscoveryURL,
+				ClientID:      p.ClientID,
+				ClientSecret:  p.ClientSecret,
+				RedirectURI:   p.RedirectURI,
+				Scopes:        p.Scopes,
+				ClaimMappings: p.ClaimMappings,
+
+				AccountLinking: cfg.AccountLinking,
+			},
+			cfg.DB,
+			usersRepo,
+			identitiesRepo,
+		))
+	}
+
+	var samlProviders []*auth.SAMLProvider
+	for _, p := range cfg.SAMLProviders {
+		provider, err := auth.NewSAMLProvider(
+			auth.SAMLConfig{
+				Name:              p.Name,
+				EntityID:          p.EntityID,
+				ACSURL:            p.ACSURL,
+				IdPEntityID:       p.IdPEntityID,
+				IdPSSOURL:         p.IdPSSOURL,
+				IdPCertificates:   p.IdPCertificates,
+				AttributeMappings: p.AttributeMappings,
+				TrustEmail:        p.TrustEmail,
+
+				AccountLinking: cfg.AccountLinking,
 			},
 			cfg.DB,
 			usersRepo,
 			identitiesRepo,
 		)
+		if err != nil {
+			return nil, fmt.Errorf("idm: SAML provider %q: %w", p.Name, err)
+		}
+		samlProviders = append(samlProviders, provider)
+	}
+
+	var janitor *auth.Janitor
+	if cfg.Janitor != nil {
+		janitorConfig := auth.JanitorConfig{
+			Interval:                   cfg.Janitor.Interval,
+			BatchSize:                  cfg.Janitor.BatchSize,
+			SessionRetention:           cfg.Janitor.SessionRetention,
+			VerificationTokenRetention: cfg.Janitor.VerificationTokenRetention,
+			RecoveryCodeRetention:      cfg.Janitor.RecoveryCodeRetention,
+		}
+		verificationTokensRepo := repository.NewVerificationTokensRepository(cfg.DB)
+		recoveryCodesRepo := repository.NewMFARecoveryCodesRepository(cfg.DB)
+		janitor = auth.NewJanitor(janitorConfig, cfg.DB, sessionsRepo, verificationTokensRepo, recoveryCodesRepo)
+	}
+
+	var dbStates *external.DBStateStore
+	if usesStateStore(&cfg, OAuthStateDatabase) {
+		oauthStatesRepo := repository.NewOAuthStatesRepository(cfg.DB)
+		dbStates = external.NewDBStateStore(oauthStatesRepo)
+		if janitor != nil {
+			janitor.AddTask("oauth_states", 0, oauthStatesRepo.DeleteExpired)
+		}
+	}
+
+	var accountLinkService *auth.AccountLinkService
+	if cfg.AccountLinking == auth.AccountLinkRequireConfirmation {
+		accountLinkService = auth.NewAccountLinkService(cfg.DB, usersRepo, identitiesRepo, repository.NewVerificationTokensRepository(cfg.DB), passwordService)
+	}
+
+	var clientService *auth.ClientService
+	if cfg.OAuthClients {
+		clientService = auth.NewClientService(repository.NewOAuthClientsRepository(cfg.DB))
 	}
 
 	return &IDM{
@@ -230,6 +669,18 @@ func New(cfg Config) (*IDM, error) {
 		passwordService: passwordService,
 		sessionService:  sessionService,
 		googleService:   googleService,
+		githubService:   githubService,
+		appleService:    appleService,
+		oidcProviders:   oidcProviders,
+		samlProviders:   samlProviders,
+		redirects:       redirects,
+		memoryStates:    external.NewMemoryStateStore(),
+		dbStates:        dbStates,
+		keyRing:         keyRing,
+		janitor:         janitor,
+		clientService:   clientService,
+		identityService: auth.NewIdentityService(identitiesRepo, credsRepo),
+		linkService:     accountLinkService,
 	}, nil
 }
 
@@ -248,8 +699,29 @@ func New(cfg Config) (*IDM, error) {
 //	POST /logout/all        - Logout all sessions (protected)
 //	GET  /me                - Get current user (protected)
 //	PATCH /me               - Update current user (protected)
+//	GET  /me/sessions       - List signed-in devices (protected)
+//	DELETE /me/sessions/{id} - Sign out one device (protected)
+//	DELETE /me/sessions?except=current - Sign out all other devices (protected)
+//	GET  /me/identities     - List password and linked logins (protected)
+//	DELETE /me/identities/{id} - Unlink a login, except the last one (protected)
 //	GET  /google/start      - Start Google OAuth (if configured)
 //	GET  /google/callback   - Google OAuth callback (if configured)
+//	GET  /me/identities/google/link - Link Google to the current user (protected, if configured)
+//	GET  /github/start      - Start GitHub OAuth (if configured)
+//	GET  /github/callback   - GitHub OAuth callback (if configured)
+//	GET  /apple/start       - Start Sign in with Apple (if configured)
+//	POST /apple/callback    - Sign in with Apple callback (if configured)
+//	POST /apple/token       - Exchange an Apple identity token from a native app (if configured)
+//	GET  /oidc/{name}/start - Start login with an OpenID Connect provider (if configured)
+//	GET  /oidc/{name}/callback - OpenID Connect provider callback (if configured)
+//	GET  /saml/{name}/start - Start login with a SAML identity provider (if configured)
+//	POST /saml/{name}/acs   - SAML assertion consumer service (if configured)
+//	GET  /saml/{name}/metadata - SAML service provider metadata (if configured)
+//	POST /link/confirm      - Link a pending external login with the account's password (if AccountLinking requires confirmation)
+//	POST /link/verify       - Link a pending external login with an emailed token (if AccountLinking requires confirmation)
+//	POST /oauth/introspect  - Token introspection for registered clients (if enabled)
+//	POST /oauth/revoke      - Token revocation for registered clients (if enabled)
+//	GET  /.well-known/jwks.json - Public keys for verifying access tokens
 func (i *IDM) Router() chi.Router {
 	r := chi.NewRouter()
 
@@ -267,6 +739,16 @@ func (i *IDM) Router() chi.Router {
 	r.Post("/refresh", sessionHandler.Refresh)
 	r.Post("/logout", sessionHandler.Logout)
 
+	// Public keys for verifying access tokens
+	r.Get("/.well-known/jwks.json", i.JWKSHandler())
+
+	// Token introspection and revocation (if enabled)
+	if i.clientService != nil {
+		oauthHandler := oauth.NewHandler(i.clientService, i.sessionService)
+		r.Post("/oauth/introspect", oauthHandler.Introspect)
+		r.Post("/oauth/revoke", oauthHandler.Revoke)
+	}
+
 	// Protected routes
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.Auth(i.sessionService))
@@ -277,22 +759,32 @@ func (i *IDM) Router() chi.Router {
 		meHandler := me.NewHandler(slog.Default(), i.usersRepo, i.passwordService, i.sessionService, nil, nil, "")
 		r.Get("/me", meHandler.GetMe)
 		r.Patch("/me", meHandler.UpdateMe)
+
+		// Session management routes
+		r.Get("/me/sessions", sessionHandler.ListSessions)
+		r.Delete("/me/sessions", sessionHandler.RevokeSessions)
+		r.Delete("/me/sessions/{id}", sessionHandler.RevokeSession)
+
+		// Login method routes
+		identityHandler := identity.NewHandler(i.identityService)
+		r.Get("/me/identities", identityHandler.ListIdentities)
+		r.Delete("/me/identities/{id}", identityHandler.DeleteIdentity)
 	})
 
 	// Google OAuth routes (if configured)
 	if i.googleService != nil {
-		var googleHandler *google.Handler
-		if i.config.Google != nil && len(i.config.Google.StateSignKey) > 0 {
-			googleHandler = google.NewHandlerWithCookieState(i.googleService, i.sessionService, i.config.Google.StateSignKey, i.config.Google.CookieSecure)
-		} else {
-			googleHandler = google.NewHandler(i.googleService, i.sessionService)
-		}
+		googleHandler := i.googleHandler()
 		r.Get("/google/start", googleHandler.Start)
 		r.Get("/google/callback", googleHandler.Callback)
 		// Token endpoint for native mobile apps
 		r.Post("/google/token", googleHandler.HandleToken)
+		// Link Google to the signed-in user's account
+		r.With(middleware.Auth(i.sessionService)).Get("/me/identities/google/link", googleHandler.StartLink)
 	}
 
+	// GitHub, Apple, OpenID Connect and SAML provider routes (if configured)
+	i.mountExternalLogins(r)
+
 	return r
 }
 
@@ -301,6 +793,8 @@ func (i *IDM) Router() chi.Router {
 //
 //	r.Mount("/user", auth.MeRouter())      // GET/PATCH /user
 //	r.Mount("/profile", auth.MeRouter())   // GET/PATCH /profile
+//
+// Session management is mounted under it at /sessions.
 func (i *IDM) MeRouter() chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Auth(i.sessionService))
@@ -310,6 +804,18 @@ func (i *IDM) MeRouter() chi.Router {
 	r.Patch("/", meHandler.UpdateMe)
 	r.Delete("/", meHandler.DeleteMe)
 
+	sessionHandler := session.NewHandler(i.sessionService)
+	r.Get("/sessions", sessionHandler.ListSessions)
+	r.Delete("/sessions", sessionHandler.RevokeSessions)
+	r.Delete("/sessions/{id}", sessionHandler.RevokeSession)
+
+	identityHandler := identity.NewHandler(i.identityService)
+	r.Get("/identities", identityHandler.ListIdentities)
+	r.Delete("/identities/{id}", identityHandler.DeleteIdentity)
+	if i.googleService != nil {
+		r.Get("/identities/google/link", i.googleHandler().StartLink)
+	}
+
 	return r
 }
 
@@ -334,6 +840,16 @@ func (i *IDM) AuthRouter() chi.Router {
 	r.Post("/refresh", sessionHandler.Refresh)
 	r.Post("/logout", sessionHandler.Logout)
 
+	// Public keys for verifying access tokens
+	r.Get("/.well-known/jwks.json", i.JWKSHandler())
+
+	// Token introspection and revocation (if enabled)
+	if i.clientService != nil {
+		oauthHandler := oauth.NewHandler(i.clientService, i.sessionService)
+		r.Post("/oauth/introspect", oauthHandler.Introspect)
+		r.Post("/oauth/revoke", oauthHandler.Revoke)
+	}
+
 	// Protected logout all
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.Auth(i.sessionService))
@@ -342,26 +858,198 @@ func (i *IDM) AuthRouter() chi.Router {
 
 	// Google OAuth routes (if configured)
 	if i.googleService != nil {
-		var googleHandler *google.Handler
-		if i.config.Google != nil && len(i.config.Google.StateSignKey) > 0 {
-			googleHandler = google.NewHandlerWithCookieState(i.googleService, i.sessionService, i.config.Google.StateSignKey, i.config.Google.CookieSecure)
-		} else {
-			googleHandler = google.NewHandler(i.googleService, i.sessionService)
-		}
+		googleHandler := i.googleHandler()
 		r.Get("/google/start", googleHandler.Start)
 		r.Get("/google/callback", googleHandler.Callback)
 		// Token endpoint for native mobile apps
 		r.Post("/google/token", googleHandler.HandleToken)
 	}
 
+	// GitHub, Apple, OpenID Connect and SAML provider routes (if configured)
+	i.mountExternalLogins(r)
+
 	return r
 }
 
+// googleHandler returns a handler for Google logins and links.
+func (i *IDM) googleHandler() *google.Handler {
+	g := i.config.Google
+	h := google.NewHandlerWithStateStore(i.googleService, i.sessionService, i.stateStore(g.StateStore, g.StateSignKey, g.CookieSecure), g.CookieSecure)
+	h.SetRedirectAllowlist(i.redirects)
+	h.SetIdentityService(i.identityService)
+	return h
+}
+
+// mountExternalLogins registers the login routes of GitHub, Apple and each
+// OpenID Connect and SAML provider.
+func (i *IDM) mountExternalLogins(r chi.Router) {
+	if i.githubService != nil {
+		gh := i.config.GitHub
+		githubHandler := external.NewHandlerWithStateStore(i.githubService, i.sessionService, i.stateStore(gh.StateStore, gh.StateSignKey, gh.CookieSecure), gh.CookieSecure)
+		githubHandler.SetRedirectAllowlist(i.redirects)
+		r.Get("/github/start", githubHandler.Start)
+		r.Get("/github/callback", githubHandler.Callback)
+	}
+
+	if i.appleService != nil {
+		a := i.config.Apple
+		appleHandler := apple.NewHandlerWithStateStore(i.appleService, i.sessionService, i.stateStore(a.StateStore, a.StateSignKey, a.CookieSecure), a.CookieSecure)
+		appleHandler.SetRedirectAllowlist(i.redirects)
+		r.Get("/apple/start", appleHandler.Start)
+		r.Post("/apple/callback", appleHandler.Callback)
+		// Token endpoint for native apps
+		r.Post("/apple/token", appleHandler.HandleToken)
+	}
+
+	for j, provider := range i.oidcProviders {
+		p := i.config.OIDCProviders[j]
+		oidcHandler := external.NewHandlerWithStateStore(provider, i.sessionService, i.stateStore(p.StateStore, p.StateSignKey, p.CookieSecure), p.CookieSecure)
+		oidcHandler.SetRedirectAllowlist(i.redirects)
+		r.Get("/oidc/"+p.Name+"/start", oidcHandler.Start)
+		r.Get("/oidc/"+p.Name+"/callback", oidcHandler.Callback)
+	}
+
+	for j, provider := range i.samlProviders {
+		p := i.config.SAMLProviders[j]
+		samlHandler := saml.NewHandlerWithStateStore(provider, i.sessionService, i.stateStore(p.StateStore, p.StateSignKey, p.CookieSecure), p.CookieSecure)
+		samlHandler.SetRedirectAllowlist(i.redirects)
+		r.Get("/saml/"+p.Name+"/start", samlHandler.Start)
+		r.Post("/saml/"+p.Name+"/acs", samlHandler.ACS)
+		r.Get("/saml/"+p.Name+"/metadata", samlHandler.Metadata)
+	}
+
+	// Pending links need the user to confirm the existing account. There
+	// is no email service in library mode; hosts that email confirmations
+	// use AccountLinkService and post the token to /link/verify.
+	if i.linkService != nil {
+		linkHandler := accountlink.NewHandler(i.config.Logger, i.linkService, nil, "")
+		r.Post("/link/confirm", linkHandler.Confirm)
+		r.Post("/link/verify", linkHandler.Verify)
+	}
+}
+
+// stateStore returns the OAuth state store a provider is configured with.
+func (i *IDM) stateStore(store OAuthStateStore, signKey []byte, cookieSecure bool) external.StateStore {
+	switch store {
+	case OAuthStateCookie:
+		return external.NewCookieStateStore(signKey, cookieSecure)
+	case OAuthStateDatabase:
+		return i.dbStates
+	default:
+		return i.memoryStates
+	}
+}
+
+// JWKSHandler returns a handler that publishes the public keys verifying access tokens.
+// Resource servers usually expect it at the site root:
+//
+//	identity, _ := idm.New(cfg)
+//	r.Get("/.well-known/jwks.json", identity.JWKSHandler())
+func (i *IDM) JWKSHandler() http.HandlerFunc {
+	return wellknown.NewHandler(i.sessionService).JWKS
+}
+
 // SessionService returns the session service for advanced usage.
 func (i *IDM) SessionService() *auth.SessionService {
 	return i.sessionService
 }
 
+// AccountLinkService returns the service confirming pending account links,
+// or nil unless AccountLinking is auth.AccountLinkRequireConfirmation. Use
+// its RequestEmailConfirmation to email a confirmation link yourself.
+func (i *IDM) AccountLinkService() *auth.AccountLinkService {
+	return i.linkService
+}
+
+// errNoJanitor is returned by cleanup methods when Config.Janitor is not set.
+var errNoJanitor = errors.New("idm: janitor is not configured")
+
+// RunJanitor deletes expired rows every JanitorConfig.Interval until ctx is
+// cancelled. A Postgres advisory lock ensures only one replica cleans up at a time.
+//
+//	go auth.RunJanitor(ctx)
+func (i *IDM) RunJanitor(ctx context.Context) error {
+	if i.janitor == nil {
+		return errNoJanitor
+	}
+	i.janitor.Run(ctx)
+	return nil
+}
+
+// Cleanup deletes expired rows once and returns the number deleted per table,
+// e.g. from a cron job. The map is nil if another replica was cleaning up.
+func (i *IDM) Cleanup(ctx context.Context) (map[string]int64, error) {
+	if i.janitor == nil {
+		return nil, errNoJanitor
+	}
+	return i.janitor.RunOnce(ctx)
+}
+
+// errNoKeyRing is returned by key management methods when Config.KeyRing is not set.
+var errNoKeyRing = errors.New("idm: key ring is not configured")
+
+// StageSigningKey generates a signing key that verifies tokens and is published
+// in JWKS, but does not sign until promoted. An empty algorithm uses the configured default.
+func (i *IDM) StageSigningKey(ctx context.Context, algorithm string) (*auth.SigningKey, error) {
+	if i.keyRing == nil {
+		return nil, errNoKeyRing
+	}
+	return i.keyRing.Stage(ctx, algorithm)
+}
+
+// PromoteSigningKey starts signing with a key on all replicas. The previous
+// signing key keeps verifying tokens until KeyRingConfig.RetireAfter has passed.
+func (i *IDM) PromoteSigningKey(ctx context.Context, kid string) error {
+	if i.keyRing == nil {
+		return errNoKeyRing
+	}
+	return i.keyRing.Promote(ctx, kid)
+}
+
+// RetireSigningKey stops accepting tokens signed with a key.
+func (i *IDM) RetireSigningKey(ctx context.Context, kid string) error {
+	if i.keyRing == nil {
+		return errNoKeyRing
+	}
+	return i.keyRing.Retire(ctx, kid)
+}
+
+// ListSigningKeys returns all keys in the key ring, including retired ones.
+func (i *IDM) ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error) {
+	if i.keyRing == nil {
+		return nil, errNoKeyRing
+	}
+	return i.keyRing.List(ctx)
+}
+
+// errNoOAuthClients is returned by client management methods when Config.OAuthClients is not set.
+var errNoOAuthClients = errors.New("idm: OAuth clients are not enabled")
+
+// CreateOAuthClient registers a backend allowed to introspect and revoke tokens.
+// The returned secret is only stored hashed; hand it to the backend now.
+func (i *IDM) CreateOAuthClient(ctx context.Context, name string) (*domain.OAuthClient, string, error) {
+	if i.clientService == nil {
+		return nil, "", errNoOAuthClients
+	}
+	return i.clientService.CreateClient(ctx, name)
+}
+
+// ListOAuthClients returns all registered clients, including revoked ones.
+func (i *IDM) ListOAuthClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	if i.clientService == nil {
+		return nil, errNoOAuthClients
+	}
+	return i.clientService.ListClients(ctx)
+}
+
+// RevokeOAuthClient stops a client from authenticating.
+func (i *IDM) RevokeOAuthClient(ctx context.Context, clientID string) error {
+	if i.clientService == nil {
+		return errNoOAuthClients
+	}
+	return i.clientService.RevokeClient(ctx, clientID)
+}
+
 // CreateRole creates a coarse platform role by name.
 func (i *IDM) CreateRole(ctx context.Context, name string) (*domain.Role, error) {
 	return i.rolesRepo.Create(ctx, name)
@@ -437,6 +1125,15 @@ func (i *IDM) AuthMiddleware() func(http.Handler) http.Handler {
 	return middleware.Auth(i.sessionService)
 }
 
+// AuthMiddlewareAllowClients is AuthMiddleware for routes that registered
+// clients may also call on their own behalf, with client credentials tokens.
+// AuthMiddleware rejects those tokens. Tell the callers apart with GetClientID:
+//
+//	r.With(identity.AuthMiddlewareAllowClients()).Post("/jobs", handler)
+func (i *IDM) AuthMiddlewareAllowClients() func(http.Handler) http.Handler {
+	return middleware.AuthAllowClients(i.sessionService)
+}
+
 // GetUserID extracts the user ID from a request.
 // Use after AuthMiddleware:
 //
@@ -457,6 +1154,16 @@ func GetUserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 	return middleware.GetUserID(ctx)
 }
 
+// GetClientID extracts the client ID from a request made with a client
+// credentials token, which has no user. Use after AuthMiddlewareAllowClients:
+//
+//	if clientID, ok := idm.GetClientID(r); ok {
+//	    // a registered backend is calling on its own behalf
+//	}
+func GetClientID(r *http.Request) (string, bool) {
+	return middleware.GetClientID(r.Context())
+}
+
 // User represents basic user info returned by GetUser.
 type User struct {
 	ID            string
@@ -525,20 +1232,134 @@ func validateConfig(cfg *Config) error {
 	if cfg.DB == nil {
 		return errors.New("idm: DB is required")
 	}
-	if cfg.JWTSecret == "" {
-		return errors.New("idm: JWTSecret is required")
+	if cfg.JWTSecret == "" && len(cfg.JWTSigningKey) == 0 && cfg.KeyRing == nil {
+		return errors.New("idm: JWTSecret, JWTSigningKey or KeyRing is required")
+	}
+	if len(cfg.JWTSigningKey) > 0 && cfg.KeyRing != nil {
+		return errors.New("idm: JWTSigningKey and KeyRing cannot be used together")
 	}
-	if len(cfg.JWTSecret) < 32 {
+	if cfg.JWTSecret != "" && len(cfg.JWTSecret) < 32 {
 		return errors.New("idm: JWTSecret must be at least 32 characters")
 	}
 	if cfg.Google != nil {
 		if cfg.Google.ClientID == "" || cfg.Google.ClientSecret == "" {
 			return errors.New("idm: Google ClientID and ClientSecret are required when Google is configured")
 		}
+		if err := validateStateStore("Google", &cfg.Google.StateStore, cfg.Google.StateSignKey); err != nil {
+			return err
+		}
+	}
+	if cfg.GitHub != nil {
+		if cfg.GitHub.ClientID == "" || cfg.GitHub.ClientSecret == "" {
+			return errors.New("idm: GitHub ClientID and ClientSecret are required when GitHub is configured")
+		}
+		if err := validateStateStore("GitHub", &cfg.GitHub.StateStore, cfg.GitHub.StateSignKey); err != nil {
+			return err
+		}
+	}
+	if cfg.Apple != nil {
+		if cfg.Apple.ClientID == "" || cfg.Apple.TeamID == "" || cfg.Apple.KeyID == "" || len(cfg.Apple.PrivateKey) == 0 {
+			return errors.New("idm: Apple ClientID, TeamID, KeyID and PrivateKey are required when Apple is configured")
+		}
+		if err := validateStateStore("Apple", &cfg.Apple.StateStore, cfg.Apple.StateSignKey); err != nil {
+			return err
+		}
+	}
+	switch cfg.AccountLinking {
+	case "", auth.AccountLinkAuto, auth.AccountLinkRequireConfirmation, auth.AccountLinkNever:
+	default:
+		return fmt.Errorf("idm: unknown AccountLinking policy %q", cfg.AccountLinking)
+	}
+	names := make(map[string]bool)
+	for j, p := range cfg.OIDCProviders {
+		if !validProviderName(p.Name) || p.Name == domain.ProviderGoogle || p.Name == domain.ProviderGitHub || p.Name == domain.ProviderApple {
+			return fmt.Errorf("idm: invalid OIDC provider name %q", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("idm: OIDC provider %q is configured twice", p.Name)
+		}
+		names[p.Name] = true
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURI == "" {
+			return fmt.Errorf("idm: OIDC provider %q requires Issuer, ClientID and RedirectURI", p.Name)
+		}
+		if err := validateStateStore("OIDC provider "+p.Name, &cfg.OIDCProviders[j].StateStore, p.StateSignKey); err != nil {
+			return err
+		}
+	}
+	samlNames := make(map[string]bool)
+	for j, p := range cfg.SAMLProviders {
+		if !validProviderName(p.Name) {
+			return fmt.Errorf("idm: invalid SAML provider name %q", p.Name)
+		}
+		if samlNames[p.Name] {
+			return fmt.Errorf("idm: SAML provider %q is configured twice", p.Name)
+		}
+		samlNames[p.Name] = true
+		if p.EntityID == "" || p.ACSURL == "" || p.IdPEntityID == "" || p.IdPSSOURL == "" || len(p.IdPCertificates) == 0 {
+			return fmt.Errorf("idm: SAML provider %q requires EntityID, ACSURL, IdPEntityID, IdPSSOURL and IdPCertificates", p.Name)
+		}
+		if err := validateStateStore("SAML provider "+p.Name, &cfg.SAMLProviders[j].StateStore, p.StateSignKey); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// validateStateStore defaults a provider's state store and checks it can be used.
+func validateStateStore(provider string, store *OAuthStateStore, signKey []byte) error {
+	if *store == "" {
+		*store = OAuthStateMemory
+		if len(signKey) > 0 {
+			*store = OAuthStateCookie
+		}
+	}
+	switch *store {
+	case OAuthStateMemory, OAuthStateDatabase:
+		return nil
+	case OAuthStateCookie:
+		if len(signKey) == 0 {
+			return fmt.Errorf("idm: %s StateSignKey is required for cookie state", provider)
+		}
+		return nil
+	default:
+		return fmt.Errorf("idm: %s has unknown StateStore %q", provider, *store)
+	}
+}
+
+// usesStateStore reports whether any configured provider uses store.
+func usesStateStore(cfg *Config, store OAuthStateStore) bool {
+	if (cfg.Google != nil && cfg.Google.StateStore == store) ||
+		(cfg.GitHub != nil && cfg.GitHub.StateStore == store) ||
+		(cfg.Apple != nil && cfg.Apple.StateStore == store) {
+		return true
+	}
+	for _, p := range cfg.OIDCProviders {
+		if p.StateStore == store {
+			return true
+		}
+	}
+	for _, p := range cfg.SAMLProviders {
+		if p.StateStore == store {
+			return true
+		}
+	}
+	return false
+}
+
+// validProviderName reports whether name is non-empty and only has lowercase
+// letters, digits and '-', so it is safe as a route segment.
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
 func applyDefaults(cfg *Config) {
 	if cfg.JWTIssuer == "" {
 		cfg.JWTIssuer = "simple-idm"
@@ -549,6 +1370,9 @@ func applyDefaults(cfg *Config) {
 	if cfg.RefreshTokenTTL == 0 {
 		cfg.RefreshTokenTTL = 7 * 24 * time.Hour
 	}
+	if cfg.RefreshReuseGrace == 0 {
+		cfg.RefreshReuseGrace = auth.DefaultRefreshReuseGrace
+	}
 	if cfg.Logger == nil {
 		cfg.Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	}
@@ -556,8 +1380,11 @@ func applyDefaults(cfg *Config) {
 
 // validateSchema checks that required database tables exist.
 func validateSchema(db *sql.DB) error {
-	requiredTables := []string{"users", "user_password", "user_identities", "sessions", "roles", "user_roles"}
+	return validateTables(db, "users", "user_password", "user_identities", "sessions", "roles", "user_roles")
+}
 
+// validateTables checks that the given tables exist.
+func validateTables(db *sql.DB, requiredTables ...string) error {
 	query := `
 		SELECT table_name
 		FROM information_schema.tables
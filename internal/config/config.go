@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,16 +23,47 @@ type Config struct {
 	DBSSLMode  string
 
 	// JWT
-	JWTSecret       string
-	JWTIssuer       string
-	AccessTokenTTL  time.Duration
-	RefreshTokenTTL time.Duration
+	JWTSecret         string
+	JWTIssuer         string
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+	RefreshReuseGrace time.Duration // Window in which a just-rotated refresh token is still accepted
+	JWTSigningKeyFile string        // PEM private key (RSA, ECDSA or Ed25519); replaces JWTSecret for signing
+	JWTSigningKeyID   string        // Optional "kid"; defaults to the key's RFC 7638 thumbprint
+	KeyRing           KeyRingConfig
 
 	// Google OAuth
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURI  string
-	OAuthStateSignKey  string // Hex-encoded 32-byte key for signing OAuth state cookies (enables multi-replica)
+	GoogleClientID      string
+	GoogleClientSecret  string
+	GoogleRedirectURI   string
+	GoogleHostedDomains []string // Google Workspace domains allowed to sign in; empty allows any account
+	OAuthStateSignKey   string   // Hex-encoded 32-byte key for signing OAuth state cookies (enables multi-replica)
+	OAuthStateStore     string   // "memory", "cookie" or "database"; applies to every external login provider
+	AccountLinkPolicy   string   // "auto", "require-confirmation" or "never"; applies to every external login provider
+
+	// GitHub OAuth
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubRedirectURI  string
+
+	// Sign in with Apple
+	AppleClientID       string // Services ID for the web flow
+	AppleTeamID         string
+	AppleKeyID          string
+	ApplePrivateKeyFile string // .p8 key downloaded from the Apple Developer portal
+	AppleRedirectURI    string
+	AppleBundleIDs      []string // Native app bundle IDs allowed to post identity tokens
+
+	// Where browsers may be sent after login: origins ("https://app.example.com")
+	// or path prefixes ("https://app.example.com/oauth/", "/app/")
+	RedirectAllowlist     []string
+	RedirectAllowRelative bool // Allow any relative path on this server
+
+	// OpenID Connect login providers (Okta, Keycloak, Auth0, ...)
+	OIDCProviders []OIDCProviderConfig
+
+	// SAML 2.0 identity providers for enterprise SSO
+	SAMLProviders []SAMLProviderConfig
 
 	// SMTP Email
 	SMTPHost     string
@@ -42,8 +74,10 @@ type Config struct {
 	SMTPFromName string
 
 	// Application
-	AppBaseURL string
-	ServeUI    bool
+	AppBaseURL            string
+	ServeUI               bool
+	LoginURL              string // Where the OAuth authorization endpoint sends users to sign in
+	DeviceVerificationURL string // Where devices tell users to enter their code (default: APP_BASE_URL/auth/device)
 
 	// Verification
 	EmailVerificationTTL     time.Duration
@@ -62,6 +96,56 @@ type Config struct {
 	// MFA
 	MFAEnabled       bool
 	MFAEncryptionKey string
+
+	// Cleanup of expired rows
+	Janitor JanitorConfig
+}
+
+// KeyRingConfig holds configuration for rotating signing keys stored in the database.
+type KeyRingConfig struct {
+	EncryptionKey   string // Hex-encoded 32-byte key protecting stored keys; enables the key ring
+	Algorithm       string // HS256, RS256, ES256 or EdDSA for newly generated keys
+	RefreshInterval time.Duration
+	RetireAfter     time.Duration // How long a replaced signing key keeps verifying
+}
+
+// OIDCProviderConfig holds the configuration of one OpenID Connect login provider.
+type OIDCProviderConfig struct {
+	Name               string // Route segment and user_identities.provider, e.g. "okta"
+	Issuer             string
+	DiscoveryURL       string // Optional; defaults to the issuer's /.well-known/openid-configuration
+	ClientID           string
+	ClientSecret       string
+	RedirectURI        string
+	Scopes             []string
+	ClaimSubject       string // ID token claim names; empty uses the standard claim
+	ClaimEmail         string
+	ClaimEmailVerified string
+	ClaimName          string
+}
+
+// SAMLProviderConfig holds the configuration of one SAML identity provider.
+type SAMLProviderConfig struct {
+	Name           string // Route segment, e.g. "acme" for /v1/auth/saml/acme
+	EntityID       string // Our entity ID at this IdP (default: the metadata URL)
+	ACSURL         string // Where the IdP posts responses (default: APP_BASE_URL/v1/auth/saml/<name>/acs)
+	IdPEntityID    string // Issuer of responses; user_identities.provider is "saml:<IdPEntityID>"
+	IdPSSOURL      string // HTTP-Redirect single sign-on service
+	IdPCertificate string // PEM or base64 DER signing certificates
+	AttrSubject    string // Attribute names; empty uses the NameID and common email/name attributes
+	AttrEmail      string
+	AttrName       string
+	TrustEmail     bool // Treat emails from the IdP as verified
+}
+
+// JanitorConfig holds configuration for the background cleanup of expired rows.
+type JanitorConfig struct {
+	Enabled                    bool // Run cleanup in the server; disable when using "simple-idm cleanup" from cron
+	Interval                   time.Duration
+	BatchSize                  int
+	SessionRetention           time.Duration
+	VerificationTokenRetention time.Duration
+	RecoveryCodeRetention      time.Duration
 }
 
 // RateLimitConfig holds rate limiting configuration.
@@ -116,6 +200,17 @@ type SessionSecurityConfig struct {
 	CookieSameSite        string // Strict, Lax, None
 	FingerprintEnabled    bool
 	DetectReuse           bool
+	RevocationCheck       bool
+	RevocationCacheTTL    time.Duration
+	IdleTimeout           time.Duration
+	MaxLifetime           time.Duration
+	RolePolicies          map[string]SessionPolicyConfig
+}
+
+// SessionPolicyConfig holds per-role session limits (0 = no limit).
+type SessionPolicyConfig struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
 }
 
 // ValidationConfig holds input validation configuration.
@@ -141,16 +236,47 @@ func Load() (*Config, error) {
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 
 		// JWT defaults
-		JWTSecret:       getEnv("JWT_SECRET", ""),
-		JWTIssuer:       getEnv("JWT_ISSUER", "simple-idm"),
-		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
-		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		JWTSecret:         getEnv("JWT_SECRET", ""),
+		JWTIssuer:         getEnv("JWT_ISSUER", "simple-idm"),
+		AccessTokenTTL:    getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:   getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		RefreshReuseGrace: getEnvDuration("REFRESH_REUSE_GRACE", 10*time.Second),
+		JWTSigningKeyFile: getEnv("JWT_SIGNING_KEY_FILE", ""),
+		JWTSigningKeyID:   getEnv("JWT_SIGNING_KEY_ID", ""),
+
+		// Signing key ring (optional, replaces JWT_SECRET / JWT_SIGNING_KEY_FILE)
+		KeyRing: KeyRingConfig{
+			EncryptionKey:   getEnv("JWT_KEY_RING_ENCRYPTION_KEY", ""),
+			Algorithm:       getEnv("JWT_KEY_RING_ALGORITHM", "HS256"),
+			RefreshInterval: getEnvDuration("JWT_KEY_RING_REFRESH_INTERVAL", time.Minute),
+			RetireAfter:     getEnvDuration("JWT_KEY_RING_RETIRE_AFTER", time.Hour),
+		},
 
 		// Google OAuth (optional)
-		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-		GoogleRedirectURI:  getEnv("GOOGLE_REDIRECT_URI", ""),
-		OAuthStateSignKey:  getEnv("OAUTH_STATE_SIGN_KEY", ""), // 64-char hex (32 bytes) for multi-replica support
+		GoogleClientID:      getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:  getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GoogleRedirectURI:   getEnv("GOOGLE_REDIRECT_URI", ""),
+		GoogleHostedDomains: strings.Fields(strings.ReplaceAll(getEnv("GOOGLE_HOSTED_DOMAINS", ""), ",", " ")),
+		OAuthStateSignKey:   getEnv("OAUTH_STATE_SIGN_KEY", ""), // 64-char hex (32 bytes) for multi-replica support
+		OAuthStateStore:     getEnv("OAUTH_STATE_STORE", ""),
+		AccountLinkPolicy:   getEnv("ACCOUNT_LINK_POLICY", "auto"),
+
+		// GitHub OAuth (optional)
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		GitHubRedirectURI:  getEnv("GITHUB_REDIRECT_URI", ""),
+
+		// Post-login redirect targets
+		RedirectAllowlist:     strings.Fields(strings.ReplaceAll(getEnv("REDIRECT_ALLOWLIST", ""), ",", " ")),
+		RedirectAllowRelative: getEnvBool("REDIRECT_ALLOW_RELATIVE", true),
+
+		// Sign in with Apple (optional)
+		AppleClientID:       getEnv("APPLE_CLIENT_ID", ""),
+		AppleTeamID:         getEnv("APPLE_TEAM_ID", ""),
+		AppleKeyID:          getEnv("APPLE_KEY_ID", ""),
+		ApplePrivateKeyFile: getEnv("APPLE_PRIVATE_KEY_FILE", ""),
+		AppleRedirectURI:    getEnv("APPLE_REDIRECT_URI", ""),
+		AppleBundleIDs:      strings.Fields(strings.ReplaceAll(getEnv("APPLE_BUNDLE_IDS", ""), ",", " ")),
 
 		// SMTP Email (optional)
 		SMTPHost:     getEnv("SMTP_HOST", ""),
@@ -161,8 +287,10 @@ func Load() (*Config, error) {
 		SMTPFromName: getEnv("SMTP_FROM_NAME", "Simple IDM"),
 
 		// Application
-		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:8080"),
-		ServeUI:    getEnvBool("SERVE_UI", true),
+		AppBaseURL:            getEnv("APP_BASE_URL", "http://localhost:8080"),
+		ServeUI:               getEnvBool("SERVE_UI", true),
+		LoginURL:              getEnv("LOGIN_URL", "/auth/login"),
+		DeviceVerificationURL: getEnv("DEVICE_VERIFICATION_URL", ""),
 
 		// Verification
 		EmailVerificationTTL:      getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
@@ -211,6 +339,10 @@ func Load() (*Config, error) {
 			CookieSameSite:     getEnv("COOKIE_SAMESITE", "Lax"),
 			FingerprintEnabled: getEnvBool("SESSION_FINGERPRINT_ENABLED", true),
 			DetectReuse:        getEnvBool("SESSION_DETECT_REUSE", true),
+			RevocationCheck:    getEnvBool("SESSION_REVOCATION_CHECK", false),
+			RevocationCacheTTL: getEnvDuration("SESSION_REVOCATION_CACHE_TTL", 30*time.Second),
+			IdleTimeout:        getEnvDuration("SESSION_IDLE_TIMEOUT", 0),
+			MaxLifetime:        getEnvDuration("SESSION_MAX_LIFETIME", 0),
 		},
 
 		// Validation (sensible defaults)
@@ -223,11 +355,65 @@ func Load() (*Config, error) {
 		// MFA
 		MFAEnabled:       getEnvBool("MFA_ENABLED", true),
 		MFAEncryptionKey: getEnv("MFA_ENCRYPTION_KEY", ""),
+
+		// Janitor (deletes expired sessions, verification tokens and used recovery codes)
+		Janitor: JanitorConfig{
+			Enabled:                    getEnvBool("JANITOR_ENABLED", true),
+			Interval:                   getEnvDuration("JANITOR_INTERVAL", time.Hour),
+			BatchSize:                  getEnvInt("JANITOR_BATCH_SIZE", 1000),
+			SessionRetention:           getEnvDuration("JANITOR_SESSION_RETENTION", 7*24*time.Hour),
+			VerificationTokenRetention: getEnvDuration("JANITOR_VERIFICATION_TOKEN_RETENTION", 7*24*time.Hour),
+			RecoveryCodeRetention:      getEnvDuration("JANITOR_RECOVERY_CODE_RETENTION", 30*24*time.Hour),
+		},
 	}
 
 	// Validate required fields
-	if cfg.JWTSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET is required")
+	if cfg.JWTSecret == "" && cfg.JWTSigningKeyFile == "" && !cfg.HasKeyRing() {
+		return nil, fmt.Errorf("JWT_SECRET, JWT_SIGNING_KEY_FILE or JWT_KEY_RING_ENCRYPTION_KEY is required")
+	}
+
+	// Parse per-role session limits, e.g. "admin:idle=30m,max=8h;support:idle=1h"
+	rolePolicies, err := parseSessionRolePolicies(getEnv("SESSION_ROLE_POLICIES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SESSION_ROLE_POLICIES: %w", err)
+	}
+	cfg.SessionSecurity.RolePolicies = rolePolicies
+
+	// Load OpenID Connect providers named in OIDC_PROVIDERS, e.g. "okta,keycloak"
+	oidcProviders, err := loadOIDCProviders(getEnv("OIDC_PROVIDERS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+	}
+	cfg.OIDCProviders = oidcProviders
+
+	// Load SAML identity providers named in SAML_PROVIDERS, e.g. "acme"
+	samlProviders, err := loadSAMLProviders(getEnv("SAML_PROVIDERS", ""), cfg.AppBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML_PROVIDERS: %w", err)
+	}
+	cfg.SAMLProviders = samlProviders
+
+	// OAuth state defaults to signed cookies when a key is set, as before
+	if cfg.OAuthStateStore == "" {
+		cfg.OAuthStateStore = "memory"
+		if cfg.OAuthStateSignKey != "" {
+			cfg.OAuthStateStore = "cookie"
+		}
+	}
+	switch cfg.OAuthStateStore {
+	case "memory", "database":
+	case "cookie":
+		if cfg.OAuthStateSignKey == "" {
+			return nil, fmt.Errorf("OAUTH_STATE_SIGN_KEY is required when OAUTH_STATE_STORE is cookie")
+		}
+	default:
+		return nil, fmt.Errorf("invalid OAUTH_STATE_STORE %q: must be memory, cookie or database", cfg.OAuthStateStore)
+	}
+
+	switch cfg.AccountLinkPolicy {
+	case "auto", "require-confirmation", "never":
+	default:
+		return nil, fmt.Errorf("invalid ACCOUNT_LINK_POLICY %q: must be auto, require-confirmation or never", cfg.AccountLinkPolicy)
 	}
 
 	// Validate MFA encryption key if MFA is enabled
@@ -243,6 +429,21 @@ func (c *Config) HasGoogleOAuth() bool {
 	return c.GoogleClientID != "" && c.GoogleClientSecret != ""
 }
 
+// HasGitHubOAuth returns true if GitHub OAuth is configured.
+func (c *Config) HasGitHubOAuth() bool {
+	return c.GitHubClientID != "" && c.GitHubClientSecret != ""
+}
+
+// HasAppleSignIn returns true if Sign in with Apple is configured.
+func (c *Config) HasAppleSignIn() bool {
+	return c.AppleClientID != "" && c.AppleTeamID != "" && c.AppleKeyID != "" && c.ApplePrivateKeyFile != ""
+}
+
+// HasKeyRing returns true if signing keys are managed in the database key ring.
+func (c *Config) HasKeyRing() bool {
+	return c.KeyRing.EncryptionKey != ""
+}
+
 // HasSMTP returns true if SMTP is configured.
 func (c *Config) HasSMTP() bool {
 	return c.SMTPHost != ""
@@ -253,6 +454,144 @@ func (c *Config) HasMFA() bool {
 	return c.MFAEnabled && c.MFAEncryptionKey != ""
 }
 
+// parseSessionRolePolicies parses "role:idle=30m,max=8h;role2:max=24h".
+func parseSessionRolePolicies(value string) (map[string]SessionPolicyConfig, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	policies := make(map[string]SessionPolicyConfig)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, limits, ok := strings.Cut(entry, ":")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			return nil, fmt.Errorf("%q: expected role:idle=<duration>,max=<duration>", entry)
+		}
+
+		var policy SessionPolicyConfig
+		for _, limit := range strings.Split(limits, ",") {
+			name, raw, ok := strings.Cut(strings.TrimSpace(limit), "=")
+			if !ok {
+				return nil, fmt.Errorf("role %s: %q: expected idle=<duration> or max=<duration>", role, limit)
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(raw))
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("role %s: invalid duration %q", role, raw)
+			}
+			switch strings.TrimSpace(name) {
+			case "idle":
+				policy.IdleTimeout = d
+			case "max":
+				policy.MaxLifetime = d
+			default:
+				return nil, fmt.Errorf("role %s: unknown limit %q", role, name)
+			}
+		}
+		policies[role] = policy
+	}
+	return policies, nil
+}
+
+// oidcReservedNames are provider names with their own login implementation.
+var oidcReservedNames = map[string]bool{"google": true, "github": true, "apple": true}
+
+// loadOIDCProviders reads the settings of each provider in names from
+// OIDC_<NAME>_* variables, where NAME is upper-cased with "-" replaced by "_".
+func loadOIDCProviders(names string) ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validOIDCProviderName(name) {
+			return nil, fmt.Errorf("%q: names may only contain lowercase letters, digits and '-'", name)
+		}
+		if oidcReservedNames[name] {
+			return nil, fmt.Errorf("%q is reserved", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%q is listed twice", name)
+		}
+		seen[name] = true
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProviderConfig{
+			Name:               name,
+			Issuer:             getEnv(prefix+"ISSUER", ""),
+			DiscoveryURL:       getEnv(prefix+"DISCOVERY_URL", ""),
+			ClientID:           getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret:       getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURI:        getEnv(prefix+"REDIRECT_URI", ""),
+			Scopes:             strings.Fields(strings.ReplaceAll(getEnv(prefix+"SCOPES", ""), ",", " ")),
+			ClaimSubject:       getEnv(prefix+"CLAIM_SUBJECT", ""),
+			ClaimEmail:         getEnv(prefix+"CLAIM_EMAIL", ""),
+			ClaimEmailVerified: getEnv(prefix+"CLAIM_EMAIL_VERIFIED", ""),
+			ClaimName:          getEnv(prefix+"CLAIM_NAME", ""),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURI == "" {
+			return nil, fmt.Errorf("%s: %sISSUER, %sCLIENT_ID and %sREDIRECT_URI are required", name, prefix, prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// loadSAMLProviders reads the settings of each identity provider in names
+// from SAML_<NAME>_* variables, named like OIDC providers. Our endpoints
+// default to routes under appBaseURL.
+func loadSAMLProviders(names, appBaseURL string) ([]SAMLProviderConfig, error) {
+	var providers []SAMLProviderConfig
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validOIDCProviderName(name) {
+			return nil, fmt.Errorf("%q: names may only contain lowercase letters, digits and '-'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%q is listed twice", name)
+		}
+		seen[name] = true
+
+		prefix := "SAML_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		base := strings.TrimSuffix(appBaseURL, "/") + "/v1/auth/saml/" + name
+		provider := SAMLProviderConfig{
+			Name:           name,
+			EntityID:       getEnv(prefix+"ENTITY_ID", base+"/metadata"),
+			ACSURL:         getEnv(prefix+"ACS_URL", base+"/acs"),
+			IdPEntityID:    getEnv(prefix+"IDP_ENTITY_ID", ""),
+			IdPSSOURL:      getEnv(prefix+"IDP_SSO_URL", ""),
+			IdPCertificate: getEnv(prefix+"IDP_CERTIFICATE", ""),
+			AttrSubject:    getEnv(prefix+"ATTR_SUBJECT", ""),
+			AttrEmail:      getEnv(prefix+"ATTR_EMAIL", ""),
+			AttrName:       getEnv(prefix+"ATTR_NAME", ""),
+			TrustEmail:     getEnvBool(prefix+"TRUST_EMAIL", false),
+		}
+		if provider.IdPEntityID == "" || provider.IdPSSOURL == "" || provider.IdPCertificate == "" {
+			return nil, fmt.Errorf("%s: %sIDP_ENTITY_ID, %sIDP_SSO_URL and %sIDP_CERTIFICATE are required", name, prefix, prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func validOIDCProviderName(name string) bool {
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
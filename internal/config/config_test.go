@@ -53,6 +53,47 @@ func TestLoad_RequiredJWTSecret(t *testing.T) {
 	}
 }
 
+func TestLoad_SigningKeyFileWithoutJWTSecret(t *testing.T) {
+	os.Unsetenv("JWT_SECRET")
+	t.Setenv("JWT_SIGNING_KEY_FILE", "/etc/simple-idm/signing.pem")
+	t.Setenv("JWT_SIGNING_KEY_ID", "key-1")
+	t.Setenv("MFA_ENCRYPTION_KEY", "test-mfa-encryption-key")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.JWTSigningKeyFile != "/etc/simple-idm/signing.pem" {
+		t.Errorf("JWTSigningKeyFile = %q, want %q", cfg.JWTSigningKeyFile, "/etc/simple-idm/signing.pem")
+	}
+	if cfg.JWTSigningKeyID != "key-1" {
+		t.Errorf("JWTSigningKeyID = %q, want %q", cfg.JWTSigningKeyID, "key-1")
+	}
+}
+
+func TestLoad_KeyRingWithoutJWTSecret(t *testing.T) {
+	os.Unsetenv("JWT_SECRET")
+	os.Unsetenv("JWT_SIGNING_KEY_FILE")
+	t.Setenv("JWT_KEY_RING_ENCRYPTION_KEY", "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff")
+	t.Setenv("MFA_ENCRYPTION_KEY", "test-mfa-encryption-key")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !cfg.HasKeyRing() {
+		t.Error("HasKeyRing() should be true when JWT_KEY_RING_ENCRYPTION_KEY is set")
+	}
+	if cfg.KeyRing.Algorithm != "HS256" {
+		t.Errorf("KeyRing.Algorithm = %q, want %q", cfg.KeyRing.Algorithm, "HS256")
+	}
+	if cfg.KeyRing.RetireAfter != time.Hour {
+		t.Errorf("KeyRing.RetireAfter = %v, want %v", cfg.KeyRing.RetireAfter, time.Hour)
+	}
+}
+
 func TestLoad_CustomValues(t *testing.T) {
 	t.Setenv("JWT_SECRET", "custom-secret")
 	t.Setenv("MFA_ENCRYPTION_KEY", "custom-mfa-encryption-key")
@@ -76,6 +117,63 @@ func TestLoad_CustomValues(t *testing.T) {
 	}
 }
 
+func TestLoad_OAuthStateStore(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-key")
+	t.Setenv("MFA_ENCRYPTION_KEY", "test-mfa-encryption-key")
+
+	tests := []struct {
+		store   string
+		signKey string
+		want    string
+		wantErr bool
+	}{
+		{store: "", signKey: "", want: "memory"},
+		{store: "", signKey: "00112233", want: "cookie"},
+		{store: "database", signKey: "", want: "database"},
+		{store: "cookie", signKey: "", wantErr: true},
+		{store: "redis", signKey: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("OAUTH_STATE_STORE", tt.store)
+		t.Setenv("OAUTH_STATE_SIGN_KEY", tt.signKey)
+
+		cfg, err := Load()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("store=%q key=%q: Load should fail", tt.store, tt.signKey)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("store=%q key=%q: Load failed: %v", tt.store, tt.signKey, err)
+		}
+		if cfg.OAuthStateStore != tt.want {
+			t.Errorf("store=%q key=%q: OAuthStateStore = %q, want %q", tt.store, tt.signKey, cfg.OAuthStateStore, tt.want)
+		}
+	}
+}
+
+func TestLoad_AccountLinkPolicy(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-key")
+	t.Setenv("MFA_ENCRYPTION_KEY", "test-mfa-encryption-key")
+
+	for _, policy := range []string{"auto", "require-confirmation", "never"} {
+		t.Setenv("ACCOUNT_LINK_POLICY", policy)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("policy=%q: Load failed: %v", policy, err)
+		}
+		if cfg.AccountLinkPolicy != policy {
+			t.Errorf("AccountLinkPolicy = %q, want %q", cfg.AccountLinkPolicy, policy)
+		}
+	}
+
+	t.Setenv("ACCOUNT_LINK_POLICY", "sometimes")
+	if _, err := Load(); err == nil {
+		t.Error("Load should fail for an unknown policy")
+	}
+}
+
 func TestHasGoogleOAuth(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -122,6 +220,28 @@ func TestHasGoogleOAuth(t *testing.T) {
 	}
 }
 
+func TestHasGitHubOAuth(t *testing.T) {
+	cfg := &Config{GitHubClientID: "client-id"}
+	if cfg.HasGitHubOAuth() {
+		t.Error("HasGitHubOAuth() = true without a client secret")
+	}
+	cfg.GitHubClientSecret = "client-secret"
+	if !cfg.HasGitHubOAuth() {
+		t.Error("HasGitHubOAuth() = false with client ID and secret")
+	}
+}
+
+func TestHasAppleSignIn(t *testing.T) {
+	cfg := &Config{AppleClientID: "com.example.web", AppleTeamID: "TEAM123456", AppleKeyID: "KEY1234567"}
+	if cfg.HasAppleSignIn() {
+		t.Error("HasAppleSignIn() = true without a private key")
+	}
+	cfg.ApplePrivateKeyFile = "/etc/simple-idm/apple.p8"
+	if !cfg.HasAppleSignIn() {
+		t.Error("HasAppleSignIn() = false with all settings")
+	}
+}
+
 func TestGetEnvInt_InvalidValue(t *testing.T) {
 	os.Setenv("TEST_INT", "not-a-number")
 	defer os.Unsetenv("TEST_INT")
@@ -141,3 +261,115 @@ func TestGetEnvDuration_InvalidValue(t *testing.T) {
 		t.Errorf("getEnvDuration should return default for invalid value, got %v", result)
 	}
 }
+
+func TestParseSessionRolePolicies(t *testing.T) {
+	policies, err := parseSessionRolePolicies("admin:idle=30m,max=8h; support:idle=1h")
+	if err != nil {
+		t.Fatalf("parseSessionRolePolicies failed: %v", err)
+	}
+
+	want := map[string]SessionPolicyConfig{
+		"admin":   {IdleTimeout: 30 * time.Minute, MaxLifetime: 8 * time.Hour},
+		"support": {IdleTimeout: time.Hour},
+	}
+	if len(policies) != len(want) {
+		t.Fatalf("got %d policies, want %d", len(policies), len(want))
+	}
+	for role, policy := range want {
+		if policies[role] != policy {
+			t.Errorf("policies[%q] = %+v, want %+v", role, policies[role], policy)
+		}
+	}
+}
+
+func TestParseSessionRolePolicies_Invalid(t *testing.T) {
+	for _, value := range []string{"admin", ":idle=1h", "admin:idle", "admin:idle=soon", "admin:idle=-1h", "admin:ttl=1h"} {
+		if _, err := parseSessionRolePolicies(value); err == nil {
+			t.Errorf("parseSessionRolePolicies(%q) should fail", value)
+		}
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_OKTA_ISSUER", "https://example.okta.com/oauth2/default")
+	t.Setenv("OIDC_OKTA_CLIENT_ID", "okta-client")
+	t.Setenv("OIDC_OKTA_CLIENT_SECRET", "okta-secret")
+	t.Setenv("OIDC_OKTA_REDIRECT_URI", "http://localhost:8080/v1/auth/oidc/okta/callback")
+	t.Setenv("OIDC_CORP_SSO_ISSUER", "https://sso.example.com/realms/corp")
+	t.Setenv("OIDC_CORP_SSO_CLIENT_ID", "idm")
+	t.Setenv("OIDC_CORP_SSO_REDIRECT_URI", "http://localhost:8080/v1/auth/oidc/corp-sso/callback")
+	t.Setenv("OIDC_CORP_SSO_SCOPES", "openid,email")
+	t.Setenv("OIDC_CORP_SSO_CLAIM_EMAIL", "upn")
+
+	providers, err := loadOIDCProviders("okta, corp-sso")
+	if err != nil {
+		t.Fatalf("loadOIDCProviders failed: %v", err)
+	}
+	if len(providers) != 2 {
+		t.Fatalf("got %d providers, want 2", len(providers))
+	}
+	if providers[0].Name != "okta" || providers[0].ClientSecret != "okta-secret" || len(providers[0].Scopes) != 0 {
+		t.Errorf("providers[0] = %+v", providers[0])
+	}
+	corp := providers[1]
+	if corp.Name != "corp-sso" || corp.Issuer != "https://sso.example.com/realms/corp" || corp.ClaimEmail != "upn" {
+		t.Errorf("providers[1] = %+v", corp)
+	}
+	if len(corp.Scopes) != 2 || corp.Scopes[0] != "openid" || corp.Scopes[1] != "email" {
+		t.Errorf("Scopes = %v, want [openid email]", corp.Scopes)
+	}
+}
+
+func TestLoadOIDCProviders_Invalid(t *testing.T) {
+	t.Setenv("OIDC_OKTA_ISSUER", "https://example.okta.com")
+	t.Setenv("OIDC_OKTA_CLIENT_ID", "okta-client")
+	t.Setenv("OIDC_OKTA_REDIRECT_URI", "http://localhost:8080/v1/auth/oidc/okta/callback")
+
+	for _, names := range []string{"Okta", "okta/admin", "google", "github", "apple", "okta,okta", "keycloak"} {
+		if _, err := loadOIDCProviders(names); err == nil {
+			t.Errorf("loadOIDCProviders(%q) should fail", names)
+		}
+	}
+}
+
+func TestLoadSAMLProviders(t *testing.T) {
+	t.Setenv("SAML_ACME_IDP_ENTITY_ID", "https://idp.acme.com/saml")
+	t.Setenv("SAML_ACME_IDP_SSO_URL", "https://idp.acme.com/saml/sso")
+	t.Setenv("SAML_ACME_IDP_CERTIFICATE", "MIIC...")
+	t.Setenv("SAML_ACME_ATTR_EMAIL", "mail")
+	t.Setenv("SAML_ACME_TRUST_EMAIL", "true")
+	t.Setenv("SAML_CORP_SSO_IDP_ENTITY_ID", "urn:corp:idp")
+	t.Setenv("SAML_CORP_SSO_IDP_SSO_URL", "https://sso.corp.example/sso")
+	t.Setenv("SAML_CORP_SSO_IDP_CERTIFICATE", "MIIC...")
+	t.Setenv("SAML_CORP_SSO_ENTITY_ID", "urn:corp:idm")
+
+	providers, err := loadSAMLProviders("acme, corp-sso", "https://idm.example.com/")
+	if err != nil {
+		t.Fatalf("loadSAMLProviders failed: %v", err)
+	}
+	if len(providers) != 2 {
+		t.Fatalf("got %d providers, want 2", len(providers))
+	}
+	acme := providers[0]
+	if acme.EntityID != "https://idm.example.com/v1/auth/saml/acme/metadata" || acme.ACSURL != "https://idm.example.com/v1/auth/saml/acme/acs" {
+		t.Errorf("acme endpoints = %q, %q", acme.EntityID, acme.ACSURL)
+	}
+	if acme.AttrEmail != "mail" || !acme.TrustEmail {
+		t.Errorf("providers[0] = %+v", acme)
+	}
+	corp := providers[1]
+	if corp.Name != "corp-sso" || corp.EntityID != "urn:corp:idm" || corp.IdPEntityID != "urn:corp:idp" || corp.TrustEmail {
+		t.Errorf("providers[1] = %+v", corp)
+	}
+}
+
+func TestLoadSAMLProviders_Invalid(t *testing.T) {
+	t.Setenv("SAML_ACME_IDP_ENTITY_ID", "https://idp.acme.com/saml")
+	t.Setenv("SAML_ACME_IDP_SSO_URL", "https://idp.acme.com/saml/sso")
+
+	for _, names := range []string{"Acme", "acme/admin", "acme", "acme,acme"} {
+		if _, err := loadSAMLProviders(names, "http://localhost:8080"); err == nil {
+			t.Errorf("loadSAMLProviders(%q) should fail", names)
+		}
+	}
+}
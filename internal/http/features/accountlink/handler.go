@@ -0,0 +1,184 @@
+package accountlink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/internal/notification"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Handler confirms pending account links. An external login creates one,
+// and returns its link token, when the account link policy requires the
+// owner of an existing account with the same email to confirm the link.
+type Handler struct {
+	logger       *slog.Logger
+	linkService  *auth.AccountLinkService
+	emailService *notification.EmailService // nil disables emailed confirmations
+	appBaseURL   string
+}
+
+// NewHandler creates a new account link handler.
+func NewHandler(
+	logger *slog.Logger,
+	linkService *auth.AccountLinkService,
+	emailService *notification.EmailService,
+	appBaseURL string,
+) *Handler {
+	return &Handler{
+		logger:       logger,
+		linkService:  linkService,
+		emailService: emailService,
+		appBaseURL:   appBaseURL,
+	}
+}
+
+// ConfirmRequest confirms a pending link with the existing account's password.
+type ConfirmRequest struct {
+	LinkToken string `json:"link_token"`
+	Password  string `json:"password"`
+}
+
+// EmailRequest asks for a pending link to be confirmed by email.
+type EmailRequest struct {
+	LinkToken string `json:"link_token"`
+}
+
+// VerifyRequest confirms a pending link with the token from the email.
+type VerifyRequest struct {
+	Token string `json:"token"`
+}
+
+// LinkedResponse reports a confirmed link.
+type LinkedResponse struct {
+	Message  string `json:"message"`
+	Provider string `json:"provider"`
+}
+
+// MessageResponse represents a simple message response.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// Confirm links the pending identity after checking the existing account's
+// password. The user then signs in with the provider again.
+// POST /v1/auth/link/confirm
+func (h *Handler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.LinkToken == "" || req.Password == "" {
+		httputil.Error(w, http.StatusBadRequest, "link_token and password are required")
+		return
+	}
+
+	identity, err := h.linkService.ConfirmWithPassword(r.Context(), req.LinkToken, req.Password)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	h.logger.Info("account link confirmed with password",
+		"user_id", identity.UserID,
+		"provider", identity.Provider,
+		"client_ip", r.RemoteAddr,
+	)
+	httputil.JSON(w, http.StatusOK, LinkedResponse{
+		Message:  "Account linked. Sign in again to continue.",
+		Provider: identity.Provider,
+	})
+}
+
+// RequestEmail emails the existing account a link that confirms the pending link.
+// POST /v1/auth/link/email
+func (h *Handler) RequestEmail(w http.ResponseWriter, r *http.Request) {
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.LinkToken == "" {
+		httputil.Error(w, http.StatusBadRequest, "link_token is required")
+		return
+	}
+	if h.emailService == nil {
+		httputil.Error(w, http.StatusServiceUnavailable, "email service not configured")
+		return
+	}
+
+	confirmation, err := h.linkService.RequestEmailConfirmation(r.Context(), req.LinkToken)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	confirmURL := fmt.Sprintf("%s/auth/confirm-link?token=%s", h.appBaseURL, url.QueryEscape(confirmation.Token))
+	if err := h.emailService.SendAccountLinkEmail(confirmation.To, confirmation.Provider, confirmURL); err != nil {
+		h.logger.Error("failed to send account link email", "error", err, "provider", confirmation.Provider)
+		httputil.Error(w, http.StatusInternalServerError, "failed to send confirmation email")
+		return
+	}
+
+	httputil.JSON(w, http.StatusOK, MessageResponse{
+		Message: "A confirmation link has been sent to the email address of your account",
+	})
+}
+
+// Verify links the pending identity with the token from the confirmation
+// email. The user then signs in with the provider again.
+// POST /v1/auth/link/verify
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Token == "" {
+		httputil.Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	identity, err := h.linkService.ConfirmByEmail(r.Context(), req.Token)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	h.logger.Info("account link confirmed by email",
+		"user_id", identity.UserID,
+		"provider", identity.Provider,
+		"client_ip", r.RemoteAddr,
+	)
+	httputil.JSON(w, http.StatusOK, LinkedResponse{
+		Message:  "Account linked. You can now sign in with it.",
+		Provider: identity.Provider,
+	})
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, domain.ErrVerificationTokenInvalid):
+		httputil.Error(w, http.StatusBadRequest, "invalid link token")
+	case errors.Is(err, domain.ErrVerificationTokenExpired):
+		httputil.Error(w, http.StatusBadRequest, "link token has expired; sign in with the provider again")
+	case errors.Is(err, domain.ErrVerificationTokenConsumed):
+		httputil.Error(w, http.StatusBadRequest, "link token has already been used")
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		httputil.Error(w, http.StatusUnauthorized, "invalid password")
+	case errors.Is(err, domain.ErrAccountLocked):
+		httputil.Error(w, http.StatusForbidden, "account temporarily locked due to too many failed login attempts. Please try again in 15 minutes.")
+	case errors.Is(err, domain.ErrIdentityAlreadyLinked):
+		httputil.Error(w, http.StatusConflict, "this account is already linked to another user")
+	default:
+		h.logger.Error("account link failed", "error", err, "client_ip", r.RemoteAddr)
+		httputil.Error(w, http.StatusInternalServerError, "failed to link account")
+	}
+}
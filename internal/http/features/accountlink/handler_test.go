@@ -0,0 +1,97 @@
+package accountlink
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountLink_Validation(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		linkService: nil,
+	}
+	handler.RegisterRoutes(mux)
+
+	tests := []struct {
+		name           string
+		target         string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "confirm invalid json",
+			target:         "/v1/auth/link/confirm",
+			body:           `{invalid}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid request body",
+		},
+		{
+			name:           "confirm without password",
+			target:         "/v1/auth/link/confirm",
+			body:           `{"link_token": "abc"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "link_token and password are required",
+		},
+		{
+			name:           "confirm without link token",
+			target:         "/v1/auth/link/confirm",
+			body:           `{"password": "secret"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "link_token and password are required",
+		},
+		{
+			name:           "email without link token",
+			target:         "/v1/auth/link/email",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "link_token is required",
+		},
+		{
+			name:           "email without email service",
+			target:         "/v1/auth/link/email",
+			body:           `{"link_token": "abc"}`,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedError:  "email service not configured",
+		},
+		{
+			name:           "verify without token",
+			target:         "/v1/auth/link/verify",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "token is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Validation should have failed before reaching service")
+				}
+			}()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Status code = %d, want %d", rec.Code, tt.expectedStatus)
+			}
+
+			var response map[string]string
+			json.NewDecoder(rec.Body).Decode(&response)
+			if response["error"] != tt.expectedError {
+				t.Errorf("Error = %q, want %q", response["error"], tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package accountlink
+
+import (
+	"net/http"
+)
+
+// RegisterRoutes registers account link confirmation routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /v1/auth/link/confirm", h.Confirm)
+	mux.HandleFunc("POST /v1/auth/link/email", h.RequestEmail)
+	mux.HandleFunc("POST /v1/auth/link/verify", h.Verify)
+}
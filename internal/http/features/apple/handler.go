@@ -0,0 +1,192 @@
+package apple
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/tendant/simple-idm-slim/internal/http/features/external"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+// Handler handles Sign in with Apple endpoints. The browser flow is the
+// external login with a form-posted callback; native apps post identity
+// tokens to HandleToken.
+type Handler struct {
+	appleService   *auth.AppleService
+	sessionService *auth.SessionService
+	login          *external.Handler
+}
+
+// NewHandler creates a new Apple handler.
+func NewHandler(appleService *auth.AppleService, sessionService *auth.SessionService) *Handler {
+	return &Handler{
+		appleService:   appleService,
+		sessionService: sessionService,
+		login:          external.NewHandler(appleService, sessionService),
+	}
+}
+
+// NewHandlerWithCookieState creates a handler that stores OAuth state in signed cookies.
+// Apple posts the callback cross-site, so the cookies need cookieSecure.
+func NewHandlerWithCookieState(appleService *auth.AppleService, sessionService *auth.SessionService, stateSignKey []byte, cookieSecure bool) *Handler {
+	return &Handler{
+		appleService:   appleService,
+		sessionService: sessionService,
+		login:          external.NewHandlerWithCookieState(appleService, sessionService, stateSignKey, cookieSecure),
+	}
+}
+
+// NewHandlerWithStateStore creates a handler that keeps OAuth state in stateStore.
+func NewHandlerWithStateStore(appleService *auth.AppleService, sessionService *auth.SessionService, stateStore external.StateStore, cookieSecure bool) *Handler {
+	return &Handler{
+		appleService:   appleService,
+		sessionService: sessionService,
+		login:          external.NewHandlerWithStateStore(appleService, sessionService, stateStore, cookieSecure),
+	}
+}
+
+// SetRedirectAllowlist sets where browsers may be returned to after login.
+func (h *Handler) SetRedirectAllowlist(redirects *httputil.RedirectAllowlist) {
+	h.login.SetRedirectAllowlist(redirects)
+}
+
+// SetMFAService makes users who enabled MFA verify a second factor after
+// signing in with Apple, in the browser and with HandleToken.
+func (h *Handler) SetMFAService(mfa *auth.MFAService) {
+	h.login.SetMFAService(mfa)
+}
+
+// Start initiates the Sign in with Apple flow.
+// GET /v1/auth/apple?redirect_uri=<app_return_uri>
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	h.login.Start(w, r)
+}
+
+// Callback handles the callback Apple posts as a form.
+// POST /v1/auth/apple/callback (code, state, id_token, user)
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	h.login.Callback(w, r)
+}
+
+// TokenRequest represents a request to exchange an Apple identity token for
+// session tokens. Used by native apps that sign in with AuthenticationServices.
+// Apple only gives the app the user's name on the first sign in, so the app
+// passes it along; it is ignored for existing users.
+type TokenRequest struct {
+	IDToken   string `json:"id_token"`
+	Nonce     string `json:"nonce,omitempty"` // Raw nonce whose SHA-256 the app sent Apple
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+}
+
+// HandleToken handles token exchange for native apps.
+// POST /v1/auth/apple/token
+// Request body: {"id_token": "...", "nonce": "...", "first_name": "...", "last_name": "..."}
+// Response: {"access_token": "...", "refresh_token": "...", "token_type": "Bearer", "expires_in": ...}
+func (h *Handler) HandleToken(w http.ResponseWriter, r *http.Request) {
+	clientIP := r.RemoteAddr
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.Error("Apple token: failed to parse request",
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.IDToken == "" {
+		httputil.Error(w, http.StatusBadRequest, "id_token is required")
+		return
+	}
+
+	identity, err := h.appleService.ValidateIdentityToken(r.Context(), req.IDToken, req.Nonce)
+	if err != nil {
+		slog.Error("Apple token: invalid identity token",
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusUnauthorized, "invalid identity token")
+		return
+	}
+	if identity.Name == "" {
+		identity.Name = strings.TrimSpace(req.FirstName + " " + req.LastName)
+	}
+
+	// Authenticate (find or create user)
+	userID, err := h.appleService.Authenticate(r.Context(), &identity.ExternalIdentity)
+	if err != nil {
+		slog.Error("Apple token: authentication failed",
+			"client_ip", clientIP,
+			"email", identity.Email,
+			"error", err,
+		)
+		if external.WriteAccountLinkError(w, err) {
+			return
+		}
+		httputil.Error(w, http.StatusInternalServerError, "authentication failed")
+		return
+	}
+
+	challengeToken, err := h.login.MFAChallenge(r, userID)
+	if err != nil {
+		slog.Error("Apple token: failed to create MFA challenge",
+			"client_ip", clientIP,
+			"user_id", userID,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "authentication failed")
+		return
+	}
+	if challengeToken != "" {
+		slog.Info("Apple token: login requires MFA",
+			"client_ip", clientIP,
+			"user_id", userID,
+		)
+		httputil.JSON(w, http.StatusOK, external.MFARequiredResponse{
+			MFARequired:    true,
+			ChallengeToken: challengeToken,
+			Message:        "MFA verification required",
+		})
+		return
+	}
+
+	// Issue session
+	opts := auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	tokens, err := h.sessionService.IssueSession(r.Context(), userID, opts)
+	if err != nil {
+		slog.Error("Apple token: failed to issue session",
+			"client_ip", clientIP,
+			"user_id", userID,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "failed to issue session")
+		return
+	}
+
+	slog.Info("Apple token: login successful",
+		"client_ip", clientIP,
+		"user_id", userID,
+	)
+
+	// private_email tells the app the address is an Apple relay, which
+	// forwards to the user but should not be shown as their real address
+	httputil.JSON(w, http.StatusOK, map[string]interface{}{
+		"authenticated": true,
+		"user_id":       userID,
+		"email":         identity.Email,
+		"private_email": auth.IsPrivateRelayEmail(identity.Email),
+		"display_name":  identity.Name,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
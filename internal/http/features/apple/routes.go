@@ -0,0 +1,12 @@
+package apple
+
+import (
+	"net/http"
+)
+
+// RegisterRoutes registers Sign in with Apple routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/auth/apple", h.Start)
+	mux.HandleFunc("POST /v1/auth/apple/callback", h.Callback)
+	mux.HandleFunc("POST /v1/auth/apple/token", h.HandleToken)
+}
@@ -0,0 +1,152 @@
+package external
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// CookieStateStore keeps OAuth state in an HMAC-signed cookie, so any replica
+// can handle the callback. This is recommended for multi-replica deployments.
+type CookieStateStore struct {
+	signKey  []byte
+	secure   bool
+	sameSite http.SameSite
+}
+
+// NewCookieStateStore creates a state store that signs cookies with signKey.
+func NewCookieStateStore(signKey []byte, secure bool) *CookieStateStore {
+	return &CookieStateStore{
+		signKey:  signKey,
+		secure:   secure,
+		sameSite: http.SameSiteLaxMode,
+	}
+}
+
+// crossSite returns a copy of the store for providers that post their
+// callback. Browsers do not send Lax cookies with a cross-site POST, so the
+// cookie needs SameSite=None, which browsers only accept on Secure cookies.
+func (s *CookieStateStore) crossSite() *CookieStateStore {
+	c := *s
+	if c.secure {
+		c.sameSite = http.SameSiteNoneMode
+	}
+	return &c
+}
+
+// stateCookieName returns the cookie holding a signed state.
+func stateCookieName(state string) string {
+	return "oauth_state_" + state[:16]
+}
+
+// sign creates an HMAC signature for state data.
+func (s *CookieStateStore) sign(data string) string {
+	mac := hmac.New(sha256.New, s.signKey)
+	mac.Write([]byte(data))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Save stores the state in a signed cookie.
+func (s *CookieStateStore) Save(w http.ResponseWriter, r *http.Request, state *auth.OAuthState) error {
+	// Format: provider|link_user_id|nonce|code_verifier|expiry|redirect_uri|signature
+	// The provider is signed, so state issued for one provider is not accepted
+	// by another. link_user_id is empty for logins. The redirect URI comes
+	// last as the only field that may contain '|'.
+	var linkUserID string
+	if state.LinkUserID != uuid.Nil {
+		linkUserID = state.LinkUserID.String()
+	}
+	expiryStr := state.ExpiresAt.Format(time.RFC3339)
+	stateData := state.Provider + "|" + linkUserID + "|" + state.Nonce + "|" + state.CodeVerifier + "|" + expiryStr + "|" + state.RedirectURI
+	cookieValue := base64.URLEncoding.EncodeToString([]byte(stateData + "|" + s.sign(stateData)))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName(state.State),
+		Value:    cookieValue,
+		Path:     "/",
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: s.sameSite,
+	})
+	return nil
+}
+
+// Take reads the state from its cookie and clears the cookie.
+func (s *CookieStateStore) Take(w http.ResponseWriter, r *http.Request, state string) (*auth.OAuthState, error) {
+	if len(state) < 16 {
+		return nil, domain.ErrOAuthStateNotFound
+	}
+	oauthState, ok := s.fromCookie(r, state)
+
+	// Clear the cookie regardless
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName(state),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: s.sameSite,
+	})
+	if !ok {
+		return nil, domain.ErrOAuthStateNotFound
+	}
+	return oauthState, nil
+}
+
+func (s *CookieStateStore) fromCookie(r *http.Request, state string) (*auth.OAuthState, bool) {
+	cookie, err := r.Cookie(stateCookieName(state))
+	if err != nil {
+		return nil, false
+	}
+	decoded, err := base64.URLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+	i := strings.LastIndex(string(decoded), "|")
+	if i < 0 {
+		return nil, false
+	}
+	stateData, signature := string(decoded[:i]), string(decoded[i+1:])
+	if !hmac.Equal([]byte(s.sign(stateData)), []byte(signature)) {
+		slog.Warn("External login: cookie signature verification failed",
+			"client_ip", r.RemoteAddr,
+			"state_prefix", statePrefix(state),
+		)
+		return nil, false
+	}
+
+	parts := strings.SplitN(stateData, "|", 6)
+	if len(parts) != 6 {
+		return nil, false
+	}
+	provider, linkUserIDStr, nonce, codeVerifier, expiryStr, redirectURI := parts[0], parts[1], parts[2], parts[3], parts[4], parts[5]
+	expiry, err := time.Parse(time.RFC3339, expiryStr)
+	if err != nil {
+		return nil, false
+	}
+	var linkUserID uuid.UUID
+	if linkUserIDStr != "" {
+		if linkUserID, err = uuid.Parse(linkUserIDStr); err != nil {
+			return nil, false
+		}
+	}
+	return &auth.OAuthState{
+		State:        state,
+		Provider:     provider,
+		LinkUserID:   linkUserID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RedirectURI:  redirectURI,
+		ExpiresAt:    expiry,
+	}, true
+}
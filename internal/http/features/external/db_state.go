@@ -0,0 +1,61 @@
+package external
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// DBStateStore keeps OAuth state in the oauth_states table. The callback
+// deletes the row it uses, so a state cannot be replayed on another replica.
+// Expired rows of abandoned logins are removed by the janitor.
+type DBStateStore struct {
+	states *repository.OAuthStatesRepository
+}
+
+// NewDBStateStore creates a database-backed state store.
+func NewDBStateStore(states *repository.OAuthStatesRepository) *DBStateStore {
+	return &DBStateStore{states: states}
+}
+
+// Save stores the state under the hash of the state parameter.
+func (s *DBStateStore) Save(w http.ResponseWriter, r *http.Request, state *auth.OAuthState) error {
+	var linkUserID *uuid.UUID
+	if state.LinkUserID != uuid.Nil {
+		linkUserID = &state.LinkUserID
+	}
+	return s.states.Create(r.Context(), &domain.OAuthState{
+		StateHash:    auth.HashToken(state.State),
+		LinkUserID:   linkUserID,
+		Provider:     state.Provider,
+		Nonce:        state.Nonce,
+		CodeVerifier: state.CodeVerifier,
+		RedirectURI:  state.RedirectURI,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    state.ExpiresAt,
+	})
+}
+
+// Take deletes the state's row and returns it.
+func (s *DBStateStore) Take(w http.ResponseWriter, r *http.Request, state string) (*auth.OAuthState, error) {
+	row, err := s.states.Take(r.Context(), auth.HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	oauthState := &auth.OAuthState{
+		State:        state,
+		Provider:     row.Provider,
+		Nonce:        row.Nonce,
+		CodeVerifier: row.CodeVerifier,
+		RedirectURI:  row.RedirectURI,
+		ExpiresAt:    row.ExpiresAt,
+	}
+	if row.LinkUserID != nil {
+		oauthState.LinkUserID = *row.LinkUserID
+	}
+	return oauthState, nil
+}
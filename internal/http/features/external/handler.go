@@ -0,0 +1,642 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Provider is an external login provider, such as an OpenID Connect provider
+// or GitHub, that the Handler sends browsers to.
+type Provider interface {
+	// Name identifies the provider in logs and state cookies.
+	Name() string
+	// AuthURL returns the provider's login page for the state and nonce,
+	// with the S256 challenge of the PKCE code verifier.
+	AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	// Identify redeems the callback's code with the code verifier and
+	// returns who logged in.
+	Identify(ctx context.Context, code, nonce, codeVerifier string) (*auth.ExternalIdentity, error)
+	// Authenticate finds, links or creates the local user for an identity.
+	Authenticate(ctx context.Context, identity *auth.ExternalIdentity) (uuid.UUID, error)
+}
+
+// FormPostProvider is a Provider that posts its callback as a form
+// (response_mode=form_post), such as Sign in with Apple.
+type FormPostProvider interface {
+	Provider
+	// ApplyCallbackUser completes the identity with the user field of the
+	// posted callback form, which may be empty.
+	ApplyCallbackUser(identity *auth.ExternalIdentity, user string)
+}
+
+// CallbackFieldsProvider is a FormPostProvider whose callback carries the
+// code and state in other form fields, such as the SAMLResponse and
+// RelayState a SAML identity provider posts.
+type CallbackFieldsProvider interface {
+	FormPostProvider
+	// CallbackFields returns the names of the code and state fields.
+	CallbackFields() (code, state string)
+}
+
+// Handler handles browser logins through an external login provider.
+type Handler struct {
+	provider       Provider
+	formPost       FormPostProvider // Set if provider posts its callback
+	codeField      string           // Callback field holding the code
+	stateField     string           // Callback field holding the state
+	sessionService *auth.SessionService
+	stateStore     StateStore
+	cookieSecure   bool                        // Whether to use Secure flag on cookies
+	redirects      *httputil.RedirectAllowlist // nil allows relative paths only
+	identities     *auth.IdentityService       // nil disables account linking
+	mfa            *auth.MFAService            // nil skips MFA challenges
+}
+
+// NewHandler creates a new login handler that keeps OAuth state in memory.
+func NewHandler(provider Provider, sessionService *auth.SessionService) *Handler {
+	return NewHandlerWithStateStore(provider, sessionService, NewMemoryStateStore(), true)
+}
+
+// NewHandlerWithCookieState creates a handler that stores OAuth state in signed cookies.
+// This is recommended for multi-replica deployments.
+func NewHandlerWithCookieState(provider Provider, sessionService *auth.SessionService, stateSignKey []byte, cookieSecure bool) *Handler {
+	return NewHandlerWithStateStore(provider, sessionService, NewCookieStateStore(stateSignKey, cookieSecure), cookieSecure)
+}
+
+// NewHandlerWithStateStore creates a handler that keeps OAuth state in stateStore.
+func NewHandlerWithStateStore(provider Provider, sessionService *auth.SessionService, stateStore StateStore, cookieSecure bool) *Handler {
+	formPost, _ := provider.(FormPostProvider)
+	if cookies, ok := stateStore.(*CookieStateStore); ok && formPost != nil {
+		stateStore = cookies.crossSite()
+	}
+	codeField, stateField := "code", "state"
+	if fields, ok := provider.(CallbackFieldsProvider); ok {
+		codeField, stateField = fields.CallbackFields()
+	}
+	return &Handler{
+		provider:       provider,
+		formPost:       formPost,
+		codeField:      codeField,
+		stateField:     stateField,
+		sessionService: sessionService,
+		stateStore:     stateStore,
+		cookieSecure:   cookieSecure,
+	}
+}
+
+// SetRedirectAllowlist sets where browsers may be returned to after login.
+func (h *Handler) SetRedirectAllowlist(redirects *httputil.RedirectAllowlist) {
+	h.redirects = redirects
+}
+
+// SetIdentityService enables linking the provider to signed-in users with StartLink.
+func (h *Handler) SetIdentityService(identities *auth.IdentityService) {
+	h.identities = identities
+}
+
+// SetMFAService makes users who enabled MFA complete their login with
+// POST /v1/auth/mfa/verify instead of getting a session from the callback.
+func (h *Handler) SetMFAService(mfa *auth.MFAService) {
+	h.mfa = mfa
+}
+
+// MFAChallenge returns a challenge token for POST /v1/auth/mfa/verify if the
+// user enabled MFA, or an empty string if the login needs no second factor.
+func (h *Handler) MFAChallenge(r *http.Request, userID uuid.UUID) (string, error) {
+	if h.mfa == nil {
+		return "", nil
+	}
+	enabled, _, err := h.mfa.GetMFAStatus(r.Context(), userID)
+	if err != nil || !enabled {
+		return "", err
+	}
+	return h.mfa.CreateMFAChallenge(r.Context(), userID, r.RemoteAddr, r.UserAgent())
+}
+
+// MFARequiredResponse tells a native app to finish the login with
+// POST /v1/auth/mfa/verify, as after a password login.
+type MFARequiredResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	Message        string `json:"message"`
+}
+
+// Start initiates the login flow by redirecting to the provider.
+// GET /v1/auth/{provider}?redirect_uri=<app_return_uri>
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, uuid.Nil)
+}
+
+// StartLink sends a signed-in user to the provider to link the identity they
+// log in with to their account, whatever its email. The callback returns to
+// redirect_uri with link=success. Requires authentication, and the callback
+// must carry the same user's access token cookie, so it is for browsers only.
+// GET /v1/me/identities/{provider}/link?redirect_uri=<app_return_uri>
+func (h *Handler) StartLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	// Form-post callbacks are cross-site POSTs, which do not carry the
+	// user's Lax auth cookies
+	if h.identities == nil || h.formPost != nil {
+		httputil.Error(w, http.StatusNotFound, "account linking is not available for this provider")
+		return
+	}
+	h.start(w, r, userID)
+}
+
+// start redirects to the provider to log in, or to link an identity to
+// linkUserID if it is set.
+func (h *Handler) start(w http.ResponseWriter, r *http.Request, linkUserID uuid.UUID) {
+	clientIP := r.RemoteAddr
+
+	// Accept both redirect_uri and redirect_url for compatibility
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	if redirectURI == "" {
+		redirectURI = r.URL.Query().Get("redirect_url")
+	}
+	if redirectURI == "" {
+		redirectURI = "/"
+	}
+	if !h.redirects.Allowed(redirectURI) {
+		slog.Warn("External login: redirect URI not allowed",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"redirect_uri", redirectURI,
+		)
+		httputil.Error(w, http.StatusBadRequest, "redirect_uri is not allowed")
+		return
+	}
+
+	// Generate state, nonce and PKCE code verifier
+	state := generateRandomString(32)
+	nonce := generateRandomString(32)
+	codeVerifier, err := auth.GenerateCodeVerifier()
+	if err != nil {
+		slog.Error("External login: failed to generate code verifier",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+
+	authURL, err := h.provider.AuthURL(r.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		slog.Error("External login: failed to build authorization URL",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	slog.Info("External login: starting auth flow",
+		"provider", h.provider.Name(),
+		"client_ip", clientIP,
+		"redirect_uri", redirectURI,
+		"state_prefix", statePrefix(state),
+		"link", linkUserID != uuid.Nil,
+	)
+
+	err = h.stateStore.Save(w, r, &auth.OAuthState{
+		State:        state,
+		Provider:     h.provider.Name(),
+		LinkUserID:   linkUserID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RedirectURI:  redirectURI,
+		ExpiresAt:    time.Now().Add(stateTTL),
+	})
+	if err != nil {
+		slog.Error("External login: failed to save state",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles the provider's redirect back, signs the user in with
+// cookies and returns to the app. Form-post providers send the same
+// parameters in a POST body.
+// GET /v1/auth/{provider}/callback?code=...&state=...
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	clientIP := r.RemoteAddr
+	code := r.FormValue(h.codeField)
+	state := r.FormValue(h.stateField)
+	errorParam := r.FormValue("error")
+
+	slog.Info("External login: callback received",
+		"provider", h.provider.Name(),
+		"client_ip", clientIP,
+		"state_prefix", statePrefix(state),
+		"has_code", code != "",
+		"error", errorParam,
+	)
+
+	// Check for OAuth error
+	if errorParam != "" {
+		slog.Warn("External login: error from provider",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"error", errorParam,
+		)
+		httputil.Error(w, http.StatusBadRequest, errorParam)
+		return
+	}
+
+	oauthState, err := h.takeState(w, r, state)
+	if errors.Is(err, domain.ErrOAuthStateNotFound) {
+		slog.Warn("External login: state not found (possible pod restart or multi-replica issue)",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"state_prefix", statePrefix(state),
+		)
+		httputil.Error(w, http.StatusBadRequest, "invalid or expired state")
+		return
+	}
+	if err != nil {
+		slog.Error("External login: failed to load state",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if time.Now().After(oauthState.ExpiresAt) {
+		slog.Warn("External login: state expired",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"state_prefix", statePrefix(state),
+			"expired_at", oauthState.ExpiresAt,
+		)
+		httputil.Error(w, http.StatusBadRequest, "state expired")
+		return
+	}
+
+	if oauthState.LinkUserID != uuid.Nil {
+		h.finishLink(w, r, code, oauthState)
+		return
+	}
+
+	userID, loginErr := h.login(r, code, oauthState)
+	if loginErr != nil && loginErr.linkToken != "" {
+		// The app sends the user to confirm the link, e.g. /auth/link-account
+		http.Redirect(w, r, returnURI(oauthState.RedirectURI, "auth=link_required&link_token="+url.QueryEscape(loginErr.linkToken)), http.StatusFound)
+		return
+	}
+	if loginErr != nil {
+		httputil.Error(w, loginErr.status, loginErr.message)
+		return
+	}
+
+	challengeToken, err := h.MFAChallenge(r, userID)
+	if err != nil {
+		slog.Error("External login: failed to create MFA challenge",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"user_id", userID,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "authentication failed")
+		return
+	}
+	if challengeToken != "" {
+		slog.Info("External login: login requires MFA",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"user_id", userID,
+		)
+		// No cookies yet: the app sends the user to the MFA step, e.g. /auth/mfa
+		http.Redirect(w, r, mfaRequiredURI(oauthState.RedirectURI, challengeToken), http.StatusFound)
+		return
+	}
+
+	// Issue session
+	opts := auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	tokens, err := h.sessionService.IssueSession(r.Context(), userID, opts)
+	if err != nil {
+		slog.Error("External login: failed to issue session",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"user_id", userID,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "failed to issue session")
+		return
+	}
+
+	slog.Info("External login: login successful",
+		"provider", h.provider.Name(),
+		"client_ip", clientIP,
+		"user_id", userID,
+	)
+
+	// Set auth cookies for web clients
+	httputil.SetAuthCookies(
+		w,
+		tokens.AccessToken,
+		tokens.RefreshToken,
+		h.sessionService.AccessTokenTTL(),
+		h.sessionService.RefreshTokenTTL(),
+		httputil.CookieConfig{
+			Path:     "/",
+			Secure:   h.cookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		},
+	)
+
+	// Redirect to the original redirect URI with auth=success param
+	// for the frontend to detect successful login
+	http.Redirect(w, r, returnURI(oauthState.RedirectURI, "auth=success"), http.StatusFound)
+}
+
+// finishLink links the identity from the callback to the user who started
+// the link and returns to the app.
+func (h *Handler) finishLink(w http.ResponseWriter, r *http.Request, code string, oauthState *auth.OAuthState) {
+	clientIP := r.RemoteAddr
+	userID := oauthState.LinkUserID
+
+	// A link started in one browser must not complete in another, or a link
+	// URL sent to a victim would attach the victim's identity to the sender.
+	if !h.signedInAs(r, userID) {
+		slog.Warn("External login: link callback from a different or signed-out user",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"user_id", userID,
+		)
+		httputil.Error(w, http.StatusUnauthorized, "sign in again to link this account")
+		return
+	}
+
+	identity, loginErr := h.identify(r, code, oauthState)
+	if loginErr != nil {
+		httputil.Error(w, loginErr.status, loginErr.message)
+		return
+	}
+
+	if _, err := h.identities.Link(r.Context(), userID, identity); err != nil {
+		if errors.Is(err, domain.ErrIdentityAlreadyLinked) {
+			slog.Warn("External login: identity is linked to another user",
+				"provider", h.provider.Name(),
+				"client_ip", clientIP,
+				"user_id", userID,
+			)
+			httputil.Error(w, http.StatusConflict, "this account is already linked to another user")
+			return
+		}
+		slog.Error("External login: failed to link identity",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"user_id", userID,
+			"error", err,
+		)
+		httputil.Error(w, http.StatusInternalServerError, "failed to link identity")
+		return
+	}
+
+	http.Redirect(w, r, returnURI(oauthState.RedirectURI, "link=success"), http.StatusFound)
+}
+
+// signedInAs reports whether the request's access token cookie belongs to userID.
+func (h *Handler) signedInAs(r *http.Request, userID uuid.UUID) bool {
+	token, ok := httputil.GetAccessTokenFromCookie(r)
+	if !ok || h.sessionService == nil {
+		return false
+	}
+	claims, err := h.sessionService.ValidateAccessToken(token)
+	if err != nil || claims.Subject != userID.String() {
+		return false
+	}
+	return h.sessionService.CheckSession(r.Context(), claims) == nil
+}
+
+// returnURI adds param to the app URI to return to after the callback.
+func returnURI(redirectURI, param string) string {
+	if redirectURI == "" {
+		redirectURI = "/"
+	}
+	if strings.Contains(redirectURI, "?") {
+		return redirectURI + "&" + param
+	}
+	return redirectURI + "?" + param
+}
+
+// mfaRequiredURI sends a login that needs MFA back to redirectURI. The
+// challenge token goes in the fragment, which browsers do not send to
+// servers or in the Referer header, so it stays out of access logs.
+func mfaRequiredURI(redirectURI, challengeToken string) string {
+	return returnURI(redirectURI, "auth=mfa_required") + "#challenge_token=" + url.QueryEscape(challengeToken)
+}
+
+// takeState takes the state from the store. State started with another
+// provider is treated as not found.
+func (h *Handler) takeState(w http.ResponseWriter, r *http.Request, state string) (*auth.OAuthState, error) {
+	oauthState, err := h.stateStore.Take(w, r, state)
+	if err != nil {
+		return nil, err
+	}
+	if oauthState.Provider != h.provider.Name() {
+		return nil, domain.ErrOAuthStateNotFound
+	}
+	return oauthState, nil
+}
+
+// loginError describes a failed login to the browser.
+type loginError struct {
+	status    int
+	message   string // For JSON responses
+	code      string // For popup responses
+	linkToken string // Pending link to confirm, with code "link_required"
+}
+
+// identify redeems the code with the provider and returns who logged in.
+func (h *Handler) identify(r *http.Request, code string, oauthState *auth.OAuthState) (*auth.ExternalIdentity, *loginError) {
+	identity, err := h.provider.Identify(r.Context(), code, oauthState.Nonce, oauthState.CodeVerifier)
+	if errors.Is(err, domain.ErrHostedDomainNotAllowed) {
+		slog.Warn("External login: rejected account outside the allowed domains",
+			"audit", "login_rejected",
+			"provider", h.provider.Name(),
+			"client_ip", r.RemoteAddr,
+			"error", err,
+		)
+		return nil, &loginError{http.StatusForbidden, "this account's domain is not allowed to sign in", "domain_not_allowed", ""}
+	}
+	if err != nil {
+		slog.Error("External login: failed to identify user",
+			"provider", h.provider.Name(),
+			"client_ip", r.RemoteAddr,
+			"error", err,
+		)
+		switch {
+		case errors.Is(err, domain.ErrCodeExchangeFailed):
+			return nil, &loginError{http.StatusInternalServerError, "failed to exchange code", "token_exchange_failed", ""}
+		case errors.Is(err, domain.ErrEmailNotVerified):
+			return nil, &loginError{http.StatusBadRequest, "no verified email address", "email_not_verified", ""}
+		default:
+			return nil, &loginError{http.StatusUnauthorized, "invalid login response", "invalid_token", ""}
+		}
+	}
+	if h.formPost != nil {
+		h.formPost.ApplyCallbackUser(identity, r.PostFormValue("user"))
+	}
+	return identity, nil
+}
+
+// login redeems the code with the provider and finds or creates the user.
+func (h *Handler) login(r *http.Request, code string, oauthState *auth.OAuthState) (uuid.UUID, *loginError) {
+	clientIP := r.RemoteAddr
+
+	identity, loginErr := h.identify(r, code, oauthState)
+	if loginErr != nil {
+		return uuid.Nil, loginErr
+	}
+
+	// Authenticate (find or create user)
+	userID, err := h.provider.Authenticate(r.Context(), identity)
+	if err != nil {
+		slog.Error("External login: authentication failed",
+			"provider", h.provider.Name(),
+			"client_ip", clientIP,
+			"email", identity.Email,
+			"error", err,
+		)
+		var confirm *auth.LinkConfirmationRequiredError
+		switch {
+		case errors.As(err, &confirm):
+			return uuid.Nil, &loginError{http.StatusConflict, "confirm this account before it is linked", "link_required", confirm.Token}
+		case errors.Is(err, domain.ErrAccountLinkNotAllowed):
+			return uuid.Nil, &loginError{http.StatusConflict, "an account with this email already exists; sign in and link this provider from your account", "account_exists", ""}
+		case errors.Is(err, domain.ErrInvalidEmail):
+			return uuid.Nil, &loginError{http.StatusBadRequest, "identity provider did not return an email address", "auth_failed", ""}
+		}
+		return uuid.Nil, &loginError{http.StatusInternalServerError, "authentication failed", "auth_failed", ""}
+	}
+
+	return userID, nil
+}
+
+// LinkRequiredResponse tells a native app that the login's identity must be
+// confirmed by the owner of the existing account before it is linked.
+type LinkRequiredResponse struct {
+	Error     string `json:"error"`
+	LinkToken string `json:"link_token"` // For POST /v1/auth/link/confirm or /v1/auth/link/email
+}
+
+// WriteAccountLinkError writes the response to a token login that the
+// account link policy refused, and reports whether err was such a refusal.
+func WriteAccountLinkError(w http.ResponseWriter, err error) bool {
+	var confirm *auth.LinkConfirmationRequiredError
+	switch {
+	case errors.As(err, &confirm):
+		httputil.JSON(w, http.StatusConflict, LinkRequiredResponse{Error: "link_required", LinkToken: confirm.Token})
+		return true
+	case errors.Is(err, domain.ErrAccountLinkNotAllowed):
+		httputil.Error(w, http.StatusConflict, "an account with this email already exists; sign in and link this provider from your account")
+		return true
+	}
+	return false
+}
+
+// CallbackHTML handles the callback and returns an HTML page that posts tokens to the parent window.
+// This is useful for popup-based OAuth flows.
+func (h *Handler) CallbackHTML(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue(h.codeField)
+	state := r.FormValue(h.stateField)
+	errorParam := r.FormValue("error")
+
+	// Check for OAuth error
+	if errorParam != "" {
+		errorJSON, _ := json.Marshal(errorParam)
+		writePopupResult(w, http.StatusBadRequest, `{error:`+string(errorJSON)+`}`)
+		return
+	}
+
+	// Validate state
+	// Links complete in the main window, not in popups
+	oauthState, err := h.takeState(w, r, state)
+	if errors.Is(err, domain.ErrOAuthStateNotFound) || (err == nil && (time.Now().After(oauthState.ExpiresAt) || oauthState.LinkUserID != uuid.Nil)) {
+		writePopupResult(w, http.StatusBadRequest, `{error:"invalid_state"}`)
+		return
+	}
+	if err != nil {
+		writePopupResult(w, http.StatusInternalServerError, `{error:"server_error"}`)
+		return
+	}
+
+	userID, loginErr := h.login(r, code, oauthState)
+	if loginErr != nil && loginErr.linkToken != "" {
+		linkJSON, _ := json.Marshal(map[string]string{"error": loginErr.code, "link_token": loginErr.linkToken})
+		writePopupResult(w, loginErr.status, string(linkJSON))
+		return
+	}
+	if loginErr != nil {
+		writePopupResult(w, loginErr.status, `{error:"`+loginErr.code+`"}`)
+		return
+	}
+
+	challengeToken, err := h.MFAChallenge(r, userID)
+	if err != nil {
+		writePopupResult(w, http.StatusInternalServerError, `{error:"auth_failed"}`)
+		return
+	}
+	if challengeToken != "" {
+		challengeJSON, _ := json.Marshal(map[string]interface{}{"mfa_required": true, "challenge_token": challengeToken})
+		writePopupResult(w, http.StatusOK, string(challengeJSON))
+		return
+	}
+
+	// Issue session
+	opts := auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	tokens, err := h.sessionService.IssueSession(r.Context(), userID, opts)
+	if err != nil {
+		writePopupResult(w, http.StatusInternalServerError, `{error:"session_failed"}`)
+		return
+	}
+
+	// Return HTML that posts tokens to parent window
+	tokenJSON, _ := json.Marshal(map[string]interface{}{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+	})
+	writePopupResult(w, http.StatusOK, string(tokenJSON))
+}
+
+// writePopupResult writes a page that posts message to the window that
+// opened the popup and closes it.
+func writePopupResult(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	w.Write([]byte(`<html><body><script>window.opener.postMessage(` + message + `,"*");window.close();</script></body></html>`))
+}
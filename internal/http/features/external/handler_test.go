@@ -0,0 +1,406 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// newTestProvider returns a provider whose discovery document is served locally.
+func newTestProvider(t *testing.T, name string) *auth.OIDCProvider {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(auth.OIDCProviderMetadata{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/keys",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return auth.NewOIDCProvider(auth.OIDCConfig{
+		Name:        name,
+		Issuer:      server.URL,
+		ClientID:    name + "-client",
+		RedirectURI: "https://idm.example.com/v1/auth/oidc/" + name + "/callback",
+	}, nil, nil, nil)
+}
+
+func TestStart_RedirectsToProvider(t *testing.T) {
+	h := NewHandlerWithCookieState(newTestProvider(t, "okta"), nil, []byte("0123456789abcdef0123456789abcdef"), true)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, "/v1/auth/oidc/okta")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta?redirect_uri=/dashboard", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	if !strings.HasSuffix(location.Path, "/authorize") || location.Query().Get("client_id") != "okta-client" {
+		t.Errorf("unexpected redirect %s", location)
+	}
+
+	state := location.Query().Get("state")
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookieName(state) || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly state cookie for %q, got %+v", state, cookies)
+	}
+}
+
+func TestCallback_RejectsStateFromOtherProvider(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	okta := NewHandlerWithCookieState(newTestProvider(t, "okta"), nil, key, true)
+	keycloak := NewHandlerWithCookieState(newTestProvider(t, "keycloak"), nil, key, true)
+
+	rec := httptest.NewRecorder()
+	okta.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta", nil))
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	state := location.Query().Get("state")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/keycloak/callback?code=abc&state="+url.QueryEscape(state), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	keycloak.Callback(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp["error"] != "invalid or expired state" {
+		t.Errorf("error = %q, want %q", resp["error"], "invalid or expired state")
+	}
+}
+
+func TestCallback_RejectsStateFromOtherProviderInSharedStore(t *testing.T) {
+	store := NewMemoryStateStore()
+	okta := NewHandlerWithStateStore(newTestProvider(t, "okta"), nil, store, true)
+	keycloak := NewHandlerWithStateStore(newTestProvider(t, "keycloak"), nil, store, true)
+
+	rec := httptest.NewRecorder()
+	okta.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta", nil))
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	state := location.Query().Get("state")
+
+	rec = httptest.NewRecorder()
+	keycloak.Callback(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/keycloak/callback?code=abc&state="+url.QueryEscape(state), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallback_ProviderError(t *testing.T) {
+	h := NewHandler(newTestProvider(t, "okta"), nil)
+
+	rec := httptest.NewRecorder()
+	h.Callback(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta/callback?error=access_denied", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStart_ProviderUnavailable(t *testing.T) {
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{
+		Name:   "okta",
+		Issuer: "http://127.0.0.1:0",
+	}, nil, nil, nil)
+	h := NewHandler(provider, nil)
+
+	rec := httptest.NewRecorder()
+	h.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+// formPostProvider is a provider that posts its callback, like Apple.
+type formPostProvider struct {
+	*auth.OIDCProvider
+}
+
+func (formPostProvider) ApplyCallbackUser(identity *auth.ExternalIdentity, user string) {}
+
+func TestFormPostProvider_CrossSiteStateCookieAndPostCallback(t *testing.T) {
+	h := NewHandlerWithCookieState(formPostProvider{newTestProvider(t, "apple")}, nil, []byte("0123456789abcdef0123456789abcdef"), true)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, "/v1/auth/apple")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/apple", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].SameSite != http.SameSiteNoneMode || !cookies[0].Secure {
+		t.Fatalf("expected a Secure SameSite=None state cookie, got %+v", cookies)
+	}
+
+	// The callback arrives as a form POST; a state without its cookie is rejected
+	form := url.Values{"code": {"abc"}, "state": {"unknown-state-0123456789"}}
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/apple/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp["error"] != "invalid or expired state" {
+		t.Errorf("error = %q, want %q", resp["error"], "invalid or expired state")
+	}
+}
+
+func TestStart_StoresCodeVerifierWithState(t *testing.T) {
+	provider := newTestProvider(t, "okta")
+	for name, h := range map[string]*Handler{
+		"cookie":    NewHandlerWithCookieState(provider, nil, []byte("0123456789abcdef0123456789abcdef"), true),
+		"in-memory": NewHandler(provider, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta?redirect_uri="+url.QueryEscape("/app?tab=a|b"), nil))
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("parse Location: %v", err)
+			}
+			q := location.Query()
+			if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+				t.Fatalf("missing PKCE challenge in %v", q)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta/callback", nil)
+			for _, cookie := range rec.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+			oauthState, err := h.takeState(httptest.NewRecorder(), req, q.Get("state"))
+			if err != nil {
+				t.Fatalf("takeState() error = %v", err)
+			}
+			if auth.CodeChallengeS256(oauthState.CodeVerifier) != q.Get("code_challenge") {
+				t.Errorf("stored verifier %q does not match the challenge", oauthState.CodeVerifier)
+			}
+			if oauthState.RedirectURI != "/app?tab=a|b" {
+				t.Errorf("RedirectURI = %q, want %q", oauthState.RedirectURI, "/app?tab=a|b")
+			}
+		})
+	}
+}
+
+func TestStart_RejectsRedirectOutsideAllowlist(t *testing.T) {
+	h := NewHandler(newTestProvider(t, "okta"), nil)
+	allowlist, err := httputil.NewRedirectAllowlist([]string{"https://app.example.com"}, true)
+	if err != nil {
+		t.Fatalf("NewRedirectAllowlist: %v", err)
+	}
+	h.SetRedirectAllowlist(allowlist)
+
+	for target, want := range map[string]int{
+		"/dashboard":                      http.StatusFound,
+		"https://app.example.com/welcome": http.StatusFound,
+		"https://evil.example.com/":       http.StatusBadRequest,
+		"//evil.example.com/":             http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta?redirect_uri="+url.QueryEscape(target), nil))
+		if rec.Code != want {
+			t.Errorf("redirect_uri=%s: status = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestStartLink(t *testing.T) {
+	userID := uuid.New()
+	withUser := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+	}
+
+	h := NewHandler(newTestProvider(t, "okta"), nil)
+	rec := httptest.NewRecorder()
+	h.StartLink(rec, withUser(httptest.NewRequest(http.MethodGet, "/v1/me/identities/okta/link", nil)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("without identity service: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	h.SetIdentityService(auth.NewIdentityService(nil, nil))
+	rec = httptest.NewRecorder()
+	h.StartLink(rec, httptest.NewRequest(http.MethodGet, "/v1/me/identities/okta/link", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without user: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = httptest.NewRecorder()
+	h.StartLink(rec, withUser(httptest.NewRequest(http.MethodGet, "/v1/me/identities/okta/link?redirect_uri=/settings", nil)))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	state := location.Query().Get("state")
+
+	// The callback must come from the same signed-in user
+	rec = httptest.NewRecorder()
+	h.Callback(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta/callback?code=abc&state="+url.QueryEscape(state), nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("callback without access token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	apple := NewHandler(formPostProvider{newTestProvider(t, "apple")}, nil)
+	apple.SetIdentityService(auth.NewIdentityService(nil, nil))
+	rec = httptest.NewRecorder()
+	apple.StartLink(rec, withUser(httptest.NewRequest(http.MethodGet, "/v1/me/identities/apple/link", nil)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("form-post provider: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// stubLoginProvider identifies every callback as the same user and fails
+// Authenticate with err.
+type stubLoginProvider struct {
+	*auth.OIDCProvider
+	err error
+}
+
+func (p stubLoginProvider) Identify(ctx context.Context, code, nonce, codeVerifier string) (*auth.ExternalIdentity, error) {
+	return &auth.ExternalIdentity{Provider: p.Name(), Subject: "123", Email: "ada@example.com", EmailVerified: true}, nil
+}
+
+func (p stubLoginProvider) Authenticate(ctx context.Context, identity *auth.ExternalIdentity) (uuid.UUID, error) {
+	return uuid.Nil, p.err
+}
+
+func TestCallback_AccountLinkPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "confirmation required",
+			err:          &auth.LinkConfirmationRequiredError{Provider: "okta", Token: "tok+en"},
+			wantStatus:   http.StatusFound,
+			wantLocation: "/app?auth=link_required&link_token=tok%2Ben",
+		},
+		{
+			name:       "linking not allowed",
+			err:        domain.ErrAccountLinkNotAllowed,
+			wantStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(stubLoginProvider{newTestProvider(t, "okta"), tt.err}, nil)
+
+			rec := httptest.NewRecorder()
+			h.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta?redirect_uri=/app", nil))
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("parse Location: %v", err)
+			}
+
+			rec = httptest.NewRecorder()
+			h.Callback(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/okta/callback?code=abc&state="+location.Query().Get("state"), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+
+			// Native apps get the same outcome as JSON
+			rec = httptest.NewRecorder()
+			if !WriteAccountLinkError(rec, tt.err) {
+				t.Fatal("WriteAccountLinkError did not handle the error")
+			}
+			if rec.Code != http.StatusConflict {
+				t.Errorf("token status = %d, want %d", rec.Code, http.StatusConflict)
+			}
+		})
+	}
+
+	if WriteAccountLinkError(httptest.NewRecorder(), domain.ErrInvalidToken) {
+		t.Error("WriteAccountLinkError handled an unrelated error")
+	}
+}
+
+func TestMFARequiredURI(t *testing.T) {
+	tests := []struct {
+		redirectURI string
+		want        string
+	}{
+		{"", "/?auth=mfa_required#challenge_token=tok%2Ben"},
+		{"/app", "/app?auth=mfa_required#challenge_token=tok%2Ben"},
+		{"/app?tab=1", "/app?tab=1&auth=mfa_required#challenge_token=tok%2Ben"},
+	}
+	for _, tt := range tests {
+		if got := mfaRequiredURI(tt.redirectURI, "tok+en"); got != tt.want {
+			t.Errorf("mfaRequiredURI(%q) = %q, want %q", tt.redirectURI, got, tt.want)
+		}
+	}
+}
+
+// samlLikeProvider posts its callback in SAMLResponse and RelayState and
+// records the response it was asked to identify.
+type samlLikeProvider struct {
+	stubLoginProvider
+	identified *string
+}
+
+func (p samlLikeProvider) ApplyCallbackUser(identity *auth.ExternalIdentity, user string) {}
+
+func (p samlLikeProvider) CallbackFields() (code, state string) {
+	return "SAMLResponse", "RelayState"
+}
+
+func (p samlLikeProvider) Identify(ctx context.Context, code, nonce, codeVerifier string) (*auth.ExternalIdentity, error) {
+	*p.identified = code
+	return p.stubLoginProvider.Identify(ctx, code, nonce, codeVerifier)
+}
+
+func TestCallback_CallbackFields(t *testing.T) {
+	var identified string
+	provider := samlLikeProvider{stubLoginProvider{newTestProvider(t, "acme"), domain.ErrAccountLinkNotAllowed}, &identified}
+	h := NewHandler(provider, nil)
+
+	rec := httptest.NewRecorder()
+	h.Start(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/saml/acme", nil))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+
+	form := url.Values{"SAMLResponse": {"PHNhbWxwOlJlc3BvbnNlLz4="}, "RelayState": {location.Query().Get("state")}}
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/saml/acme/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	h.Callback(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if identified != "PHNhbWxwOlJlc3BvbnNlLz4=" {
+		t.Errorf("identified %q, want the posted SAMLResponse", identified)
+	}
+}
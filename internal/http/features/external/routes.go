@@ -0,0 +1,16 @@
+package external
+
+import (
+	"net/http"
+)
+
+// RegisterRoutes registers the login routes under path, e.g. "/v1/auth/oidc/okta".
+// Form-post providers get a POST callback instead of a GET one.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux, path string) {
+	mux.HandleFunc("GET "+path, h.Start)
+	if h.formPost != nil {
+		mux.HandleFunc("POST "+path+"/callback", h.Callback)
+	} else {
+		mux.HandleFunc("GET "+path+"/callback", h.Callback)
+	}
+}
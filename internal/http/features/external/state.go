@@ -0,0 +1,101 @@
+package external
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// stateTTL is how long a user has to complete a login at the provider.
+const stateTTL = 10 * time.Minute
+
+// StateStore keeps OAuth state for CSRF protection between the redirect to
+// the provider and its callback.
+type StateStore interface {
+	// Save stores the state of a login that is starting. Stores that keep
+	// state in the browser set a cookie on w.
+	Save(w http.ResponseWriter, r *http.Request, state *auth.OAuthState) error
+	// Take returns the state and removes it, so each state is used once. It
+	// returns domain.ErrOAuthStateNotFound for unknown or used states.
+	Take(w http.ResponseWriter, r *http.Request, state string) (*auth.OAuthState, error)
+}
+
+// MemoryStateStore keeps OAuth state in memory. The callback must reach the
+// replica that started the login, so it only suits single-replica deployments.
+type MemoryStateStore struct {
+	mu        sync.Mutex
+	states    map[string]*auth.OAuthState
+	lastSweep time.Time
+}
+
+// NewMemoryStateStore creates a new in-memory state store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		states:    make(map[string]*auth.OAuthState),
+		lastSweep: time.Now(),
+	}
+}
+
+// Save stores the state. Expired states of abandoned logins are swept out
+// here, at most once per stateTTL, rather than by a background goroutine.
+func (s *MemoryStateStore) Save(w http.ResponseWriter, r *http.Request, state *auth.OAuthState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > stateTTL {
+		for key, st := range s.states {
+			if now.After(st.ExpiresAt) {
+				delete(s.states, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.states[state.State] = state
+	slog.Debug("MemoryStateStore.Save: stored OAuth state",
+		"state_prefix", statePrefix(state.State),
+		"expires_at", state.ExpiresAt,
+		"total_states", len(s.states),
+	)
+	return nil
+}
+
+// Take returns the state and removes it.
+func (s *MemoryStateStore) Take(w http.ResponseWriter, r *http.Request, state string) (*auth.OAuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.states[state]
+	slog.Debug("MemoryStateStore.Take: looking up OAuth state",
+		"state_prefix", statePrefix(state),
+		"found", ok,
+		"total_states", len(s.states),
+	)
+	if !ok {
+		return nil, domain.ErrOAuthStateNotFound
+	}
+	delete(s.states, state)
+	return st, nil
+}
+
+// generateRandomString generates a cryptographically secure random string.
+func generateRandomString(length int) string {
+	b := make([]byte, length)
+	rand.Read(b)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// statePrefix shortens a state value for logging.
+func statePrefix(state string) string {
+	if len(state) > 10 {
+		return state[:10] + "..."
+	}
+	return state
+}
@@ -0,0 +1,79 @@
+package external
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestMemoryStateStore_TakeIsSingleUse(t *testing.T) {
+	store := NewMemoryStateStore()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	state := &auth.OAuthState{State: "state-0123456789abcdef", Provider: "okta", ExpiresAt: time.Now().Add(stateTTL)}
+	if err := store.Save(httptest.NewRecorder(), req, state); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := store.Take(httptest.NewRecorder(), req, state.State)
+	if err != nil || got.Provider != "okta" {
+		t.Fatalf("Take() = %+v, %v", got, err)
+	}
+	if _, err := store.Take(httptest.NewRecorder(), req, state.State); !errors.Is(err, domain.ErrOAuthStateNotFound) {
+		t.Errorf("second Take() error = %v, want ErrOAuthStateNotFound", err)
+	}
+}
+
+func TestMemoryStateStore_SweepsExpiredStates(t *testing.T) {
+	store := NewMemoryStateStore()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	_ = store.Save(httptest.NewRecorder(), req, &auth.OAuthState{State: "abandoned-0123456789", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	store.lastSweep = time.Now().Add(-2 * stateTTL)
+	_ = store.Save(httptest.NewRecorder(), req, &auth.OAuthState{State: "current-0123456789ab", ExpiresAt: time.Now().Add(stateTTL)})
+
+	if _, ok := store.states["abandoned-0123456789"]; ok {
+		t.Error("expired state was not swept")
+	}
+	if _, ok := store.states["current-0123456789ab"]; !ok {
+		t.Error("current state was swept")
+	}
+}
+
+func TestCookieStateStore_RejectsTamperedCookie(t *testing.T) {
+	store := NewCookieStateStore([]byte("0123456789abcdef0123456789abcdef"), true)
+	state := &auth.OAuthState{
+		State:       "state-0123456789abcdef",
+		Provider:    "okta",
+		Nonce:       "nonce",
+		RedirectURI: "/app",
+		ExpiresAt:   time.Now().Add(stateTTL).Truncate(time.Second),
+	}
+	rec := httptest.NewRecorder()
+	if err := store.Save(rec, httptest.NewRequest(http.MethodGet, "/", nil), state); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	cookie := rec.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	got, err := store.Take(httptest.NewRecorder(), req, state.State)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if got.Provider != state.Provider || got.Nonce != state.Nonce || got.RedirectURI != state.RedirectURI || !got.ExpiresAt.Equal(state.ExpiresAt) {
+		t.Errorf("Take() = %+v, want %+v", got, state)
+	}
+
+	cookie.Value = strings.ToUpper(cookie.Value[:4]) + cookie.Value[4:]
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if _, err := store.Take(httptest.NewRecorder(), req, state.State); !errors.Is(err, domain.ErrOAuthStateNotFound) {
+		t.Errorf("Take() with tampered cookie error = %v, want ErrOAuthStateNotFound", err)
+	}
+}
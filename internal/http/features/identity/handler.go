@@ -0,0 +1,103 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Handler handles the current user's login methods: their password and
+// linked external identities. Linking is started at each provider's
+// StartLink route.
+type Handler struct {
+	identityService *auth.IdentityService
+}
+
+// NewHandler creates a new identity handler.
+func NewHandler(identityService *auth.IdentityService) *Handler {
+	return &Handler{identityService: identityService}
+}
+
+// IdentityResponse represents one linked external identity.
+type IdentityResponse struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentitiesResponse represents the ways the user can log in.
+type IdentitiesResponse struct {
+	HasPassword bool               `json:"has_password"`
+	Identities  []IdentityResponse `json:"identities"`
+}
+
+// ListIdentities lists the current user's password status and linked identities.
+// GET /v1/me/identities
+// Requires authentication
+func (h *Handler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	methods, err := h.identityService.ListLoginMethods(r.Context(), userID)
+	if err != nil {
+		httputil.Error(w, http.StatusInternalServerError, "failed to list identities")
+		return
+	}
+
+	resp := IdentitiesResponse{
+		HasPassword: methods.HasPassword,
+		Identities:  make([]IdentityResponse, 0, len(methods.Identities)),
+	}
+	for _, identity := range methods.Identities {
+		resp.Identities = append(resp.Identities, IdentityResponse{
+			ID:        identity.ID.String(),
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	httputil.JSON(w, http.StatusOK, resp)
+}
+
+// DeleteIdentity unlinks one of the current user's identities. The last
+// remaining login method cannot be removed.
+// DELETE /v1/me/identities/{id}
+// Requires authentication
+func (h *Handler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid identity id")
+		return
+	}
+
+	if err := h.identityService.Unlink(r.Context(), userID, id); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrIdentityNotFound), errors.Is(err, domain.ErrUserNotFound):
+			httputil.Error(w, http.StatusNotFound, "identity not found")
+		case errors.Is(err, domain.ErrLastLoginMethod):
+			httputil.Error(w, http.StatusConflict, "cannot remove the last login method")
+		default:
+			httputil.Error(w, http.StatusInternalServerError, "failed to remove identity")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+)
+
+func TestIdentities_Validation(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{identityService: nil}
+	mux.HandleFunc("GET /v1/me/identities", handler.ListIdentities)
+	mux.HandleFunc("DELETE /v1/me/identities/{id}", handler.DeleteIdentity)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		authenticated  bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "list without user",
+			method:         http.MethodGet,
+			target:         "/v1/me/identities",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "delete without user",
+			method:         http.MethodDelete,
+			target:         "/v1/me/identities/" + uuid.NewString(),
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "delete invalid id",
+			method:         http.MethodDelete,
+			target:         "/v1/me/identities/password",
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid identity id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+			}
+			rec := httptest.NewRecorder()
+
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Validation should have failed before reaching service")
+				}
+			}()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Status code = %d, want %d", rec.Code, tt.expectedStatus)
+			}
+
+			var response map[string]string
+			json.NewDecoder(rec.Body).Decode(&response)
+			if response["error"] != tt.expectedError {
+				t.Errorf("Error = %q, want %q", response["error"], tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package identity
+
+import (
+	"net/http"
+
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+// RegisterRoutes registers identity routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux, sessionService *auth.SessionService) {
+	authMiddleware := middleware.Auth(sessionService)
+	mux.Handle("GET /v1/me/identities", authMiddleware(http.HandlerFunc(h.ListIdentities)))
+	mux.Handle("DELETE /v1/me/identities/{id}", authMiddleware(http.HandlerFunc(h.DeleteIdentity)))
+}
@@ -17,6 +17,7 @@ type Handler struct {
 	mfaService      *auth.MFAService
 	passwordService *auth.PasswordService
 	sessionService  *auth.SessionService
+	cookieConfig    httputil.CookieConfig
 }
 
 // NewHandler creates a new MFA handler
@@ -31,6 +32,7 @@ func NewHandler(
 		mfaService:      mfaService,
 		passwordService: passwordService,
 		sessionService:  sessionService,
+		cookieConfig:    httputil.DefaultCookieConfig(),
 	}
 }
 
@@ -325,5 +327,18 @@ func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Browsers finishing a login from the login pages or an external
+	// login's callback are signed in with cookies, as by the password login
+	if !httputil.IsMobileClient(r) {
+		httputil.SetAuthCookies(
+			w,
+			tokens.AccessToken,
+			tokens.RefreshToken,
+			h.sessionService.AccessTokenTTL(),
+			h.sessionService.RefreshTokenTTL(),
+			h.cookieConfig,
+		)
+	}
+
 	httputil.JSON(w, http.StatusOK, tokens)
 }
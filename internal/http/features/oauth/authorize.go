@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Authorize is the authorization endpoint of the authorization code grant
+// (OpenID Connect). A user signed in with the access token cookie is sent
+// back to the client's redirect URI with a code; other users are sent to the
+// login page first, which returns here. PKCE with S256 is required.
+// GET /v1/oauth/authorize?response_type=code&client_id=...&redirect_uri=...&scope=openid&state=...&nonce=...&code_challenge=...&code_challenge_method=S256
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if h.authorization == nil {
+		httputil.Error(w, http.StatusNotFound, "authorization endpoint is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	clientID := query.Get("client_id")
+	redirectURI := query.Get("redirect_uri")
+	if clientID == "" || redirectURI == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "client_id and redirect_uri are required")
+		return
+	}
+
+	// Until the client and redirect URI are known to be valid, errors are
+	// shown here instead of redirecting to a URI an attacker may have chosen
+	_, err := h.authorization.ValidateClient(r.Context(), clientID, redirectURI)
+	switch {
+	case errors.Is(err, domain.ErrInvalidClient):
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_client", "unknown client")
+		return
+	case errors.Is(err, domain.ErrInvalidRedirectURI):
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+		return
+	case err != nil:
+		slog.Error("Handler.Authorize: failed to load client", "client_id", clientID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	state := query.Get("state")
+	if query.Get("response_type") != "code" {
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {"unsupported_response_type"}, "state": {state}})
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		redirectWithParams(w, r, redirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"PKCE with code_challenge_method=S256 is required"},
+			"state":             {state},
+		})
+		return
+	}
+
+	claims, authTime, ok := h.signedInUser(r)
+	if !ok {
+		if query.Get("prompt") == "none" {
+			redirectWithParams(w, r, redirectURI, url.Values{"error": {"login_required"}, "state": {state}})
+			return
+		}
+		http.Redirect(w, r, h.loginURL+"?return_to="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	userID, _ := uuid.Parse(claims.Subject)
+
+	code, err := h.authorization.CreateCode(r.Context(), userID, auth.AuthorizationRequest{
+		ClientID:      clientID,
+		RedirectURI:   redirectURI,
+		Scope:         query.Get("scope"),
+		Nonce:         query.Get("nonce"),
+		CodeChallenge: query.Get("code_challenge"),
+	}, authTime, claims.MFAVerified)
+	if err != nil {
+		slog.Error("Handler.Authorize: failed to create code",
+			"client_id", clientID,
+			"user_id", userID,
+			"error", err,
+		)
+		redirectWithParams(w, r, redirectURI, url.Values{"error": {"server_error"}, "state": {state}})
+		return
+	}
+
+	redirectWithParams(w, r, redirectURI, url.Values{"code": {code}, "state": {state}})
+}
+
+// signedInUser returns the claims of the browser's access token cookie, if
+// it belongs to a live session that completed MFA where the user enabled it,
+// along with when the user signed in to that session.
+func (h *Handler) signedInUser(r *http.Request) (*auth.AccessTokenClaims, time.Time, bool) {
+	token, ok := httputil.GetAccessTokenFromCookie(r)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	claims, err := h.sessionService.ValidateAccessToken(token)
+	if err != nil || claims.IsClient() || !claims.MFAVerified || !h.sessionService.IntendedForIDM(claims) {
+		return nil, time.Time{}, false
+	}
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, time.Time{}, false
+	}
+	if err := h.sessionService.CheckSession(r.Context(), claims); err != nil {
+		return nil, time.Time{}, false
+	}
+	// The token's iat moves with every refresh; auth_time must not
+	authTime, err := h.sessionService.AuthTime(r.Context(), claims)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return claims, authTime, true
+}
+
+// redirectWithParams redirects to uri with params added to its query. Empty
+// params are left out.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	query := u.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
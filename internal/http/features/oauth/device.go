@@ -0,0 +1,201 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// GrantTypeDeviceCode is the grant_type devices poll the token endpoint with
+// (RFC 8628 section 3.4).
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorizationResponse represents a device authorization response
+// (RFC 8628 section 3.2).
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceRequestResponse describes a pending device authorization to the user
+// approving it.
+type DeviceRequestResponse struct {
+	ClientName string `json:"client_name"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+// UserCodeRequest carries the user code shown on a device.
+type UserCodeRequest struct {
+	UserCode string `json:"user_code"`
+}
+
+// DeviceCode starts the device authorization grant for a registered client.
+// The device shows the user code and verification URI, and polls Token with
+// the device code until the user approves it.
+// POST /v1/oauth/device/code
+func (h *Handler) DeviceCode(w http.ResponseWriter, r *http.Request) {
+	if h.devices == nil {
+		httputil.Error(w, http.StatusNotFound, "device authorization is not enabled")
+		return
+	}
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	start, err := h.devices.Start(r.Context(), client, r.PostForm.Get("scope"))
+	if err != nil {
+		slog.Error("Handler.DeviceCode: failed to start device authorization", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              start.DeviceCode,
+		UserCode:                start.UserCode,
+		VerificationURI:         h.verificationURI,
+		VerificationURIComplete: h.verificationURI + "?user_code=" + url.QueryEscape(start.UserCode),
+		ExpiresIn:               start.ExpiresIn,
+		Interval:                start.Interval,
+	})
+}
+
+// DeviceLookup shows the signed-in user which client a user code belongs to.
+// It must be mounted behind middleware.Auth.
+// GET /v1/oauth/device?user_code=...
+func (h *Handler) DeviceLookup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.approvingUser(w, r); !ok {
+		return
+	}
+
+	req, err := h.devices.Lookup(r.Context(), r.URL.Query().Get("user_code"))
+	if err != nil {
+		h.deviceError(w, "Handler.DeviceLookup", err)
+		return
+	}
+	httputil.JSON(w, http.StatusOK, DeviceRequestResponse{ClientName: req.ClientName, Scope: req.Scope})
+}
+
+// DeviceApprove signs the device waiting on a user code in as the current
+// user. It must be mounted behind middleware.Auth.
+// POST /v1/oauth/device/approve
+func (h *Handler) DeviceApprove(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.approvingUser(w, r)
+	if !ok {
+		return
+	}
+	var req UserCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, _ := middleware.GetUserID(r.Context())
+	if err := h.devices.Approve(r.Context(), req.UserCode, userID, claims.MFAVerified); err != nil {
+		h.deviceError(w, "Handler.DeviceApprove", err)
+		return
+	}
+	httputil.JSON(w, http.StatusOK, map[string]string{"message": "Device approved"})
+}
+
+// DeviceDeny rejects the device waiting on a user code. It must be mounted
+// behind middleware.Auth.
+// POST /v1/oauth/device/deny
+func (h *Handler) DeviceDeny(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.approvingUser(w, r); !ok {
+		return
+	}
+	var req UserCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.devices.Deny(r.Context(), req.UserCode); err != nil {
+		h.deviceError(w, "Handler.DeviceDeny", err)
+		return
+	}
+	httputil.JSON(w, http.StatusOK, map[string]string{"message": "Device denied"})
+}
+
+// approvingUser returns the claims of the user acting on a device code. Users
+// who enabled MFA must have completed it, since the device gets a session of
+// its own.
+func (h *Handler) approvingUser(w http.ResponseWriter, r *http.Request) (*auth.AccessTokenClaims, bool) {
+	if h.devices == nil {
+		httputil.Error(w, http.StatusNotFound, "device authorization is not enabled")
+		return nil, false
+	}
+	claims, ok := middleware.GetClaims(r.Context())
+	if !ok || middleware.IsClient(r.Context()) {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	if !claims.MFAVerified {
+		httputil.Error(w, http.StatusForbidden, "mfa_required")
+		return nil, false
+	}
+	return claims, true
+}
+
+// deviceError writes the response for an error acting on a user code.
+func (h *Handler) deviceError(w http.ResponseWriter, op string, err error) {
+	if errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		httputil.ErrorWithMessage(w, http.StatusNotFound, "invalid_user_code", "The code is invalid or has expired")
+		return
+	}
+	slog.Error(op+": device authorization failed", "error", err)
+	httputil.Error(w, http.StatusInternalServerError, "server_error")
+}
+
+// exchangeDeviceCode answers a device polling the token endpoint.
+func (h *Handler) exchangeDeviceCode(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	if h.devices == nil {
+		httputil.Error(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "device_code is required")
+		return
+	}
+
+	tokens, err := h.devices.Exchange(r.Context(), client, deviceCode, auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	})
+	switch {
+	case errors.Is(err, domain.ErrAuthorizationPending):
+		httputil.Error(w, http.StatusBadRequest, "authorization_pending")
+	case errors.Is(err, domain.ErrSlowDown):
+		httputil.Error(w, http.StatusBadRequest, "slow_down")
+	case errors.Is(err, domain.ErrAccessDenied):
+		httputil.Error(w, http.StatusBadRequest, "access_denied")
+	case errors.Is(err, domain.ErrExpiredToken):
+		httputil.Error(w, http.StatusBadRequest, "expired_token")
+	case errors.Is(err, domain.ErrInvalidGrant):
+		httputil.Error(w, http.StatusBadRequest, "invalid_grant")
+	case err != nil:
+		slog.Error("Handler.Token: device code exchange failed", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+	default:
+		httputil.JSON(w, http.StatusOK, TokenResponse{
+			AccessToken:  tokens.AccessToken,
+			TokenType:    tokens.TokenType,
+			ExpiresIn:    tokens.ExpiresIn,
+			RefreshToken: tokens.RefreshToken,
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Handler handles OAuth 2.0 endpoints for registered clients.
+type Handler struct {
+	clientService   *auth.ClientService
+	sessionService  *auth.SessionService
+	authorization   *auth.AuthorizationService // nil disables the authorization code grant
+	loginURL        string                     // Where Authorize sends users who are not signed in
+	devices         *auth.DeviceService        // nil disables the device authorization grant
+	verificationURI string                     // Page where users enter device user codes
+}
+
+// NewHandler creates a new OAuth handler.
+func NewHandler(clientService *auth.ClientService, sessionService *auth.SessionService) *Handler {
+	return &Handler{
+		clientService:  clientService,
+		sessionService: sessionService,
+	}
+}
+
+// SetAuthorizationService enables the authorization endpoint and the
+// authorization code grant. Users who are not signed in are sent to loginURL
+// with a return_to parameter, e.g. "/auth/login".
+func (h *Handler) SetAuthorizationService(authorization *auth.AuthorizationService, loginURL string) {
+	h.authorization = authorization
+	h.loginURL = loginURL
+}
+
+// SetDeviceService enables the device authorization grant. Devices tell
+// users to enter their user code at verificationURI, e.g.
+// "https://idm.example.com/auth/device".
+func (h *Handler) SetDeviceService(devices *auth.DeviceService, verificationURI string) {
+	h.devices = devices
+	h.verificationURI = verificationURI
+}
+
+// IntrospectionResponse represents a token introspection response (RFC 7662).
+// Only "active" is set for tokens that are invalid or unknown.
+type IntrospectionResponse struct {
+	Active        bool             `json:"active"`
+	TokenUse      string           `json:"token_use,omitempty"` // access_token or refresh_token
+	Subject       string           `json:"sub,omitempty"`
+	Issuer        string           `json:"iss,omitempty"`
+	IssuedAt      int64            `json:"iat,omitempty"`
+	ExpiresAt     int64            `json:"exp,omitempty"`
+	Roles         []string         `json:"roles,omitempty"`
+	SessionID     string           `json:"sid,omitempty"`
+	SessionStatus string           `json:"session_status,omitempty"` // active, revoked, expired or rotated
+	ClientID      string           `json:"client_id,omitempty"`      // Client credentials tokens only
+	Scope         string           `json:"scope,omitempty"`
+	Audience      []string         `json:"aud,omitempty"` // Exchanged tokens only
+	Actor         *auth.ActorClaim `json:"act,omitempty"` // Exchanged tokens only
+}
+
+// Introspect reports whether an access or refresh token is active.
+// POST /v1/oauth/introspect
+//
+// The form parameter token_type_hint is accepted but not needed: access tokens
+// are JWTs and refresh tokens are opaque.
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	client, token, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.sessionService.IntrospectToken(r.Context(), token, client.ID)
+	if err != nil {
+		slog.Error("Handler.Introspect: introspection failed", "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	resp := IntrospectionResponse{
+		Active:        result.Active,
+		TokenUse:      result.TokenType,
+		Subject:       result.Subject,
+		Issuer:        result.Issuer,
+		Roles:         result.Roles,
+		SessionStatus: result.SessionStatus,
+		ClientID:      result.ClientID,
+		Scope:         result.Scope,
+		Audience:      result.Audience,
+		Actor:         result.Actor,
+	}
+	if !result.IssuedAt.IsZero() {
+		resp.IssuedAt = result.IssuedAt.Unix()
+	}
+	if !result.ExpiresAt.IsZero() {
+		resp.ExpiresAt = result.ExpiresAt.Unix()
+	}
+	if result.SessionID != uuid.Nil {
+		resp.SessionID = result.SessionID.String()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, resp)
+}
+
+// Revoke revokes the session an access or refresh token belongs to (RFC 7009).
+// POST /v1/oauth/revoke
+//
+// Responds 200 even if the token was invalid, already revoked or issued to
+// another client.
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, token, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.RevokeToken(r.Context(), token, client.ID); err != nil {
+		slog.Error("Handler.Revoke: revocation failed", "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorize authenticates the calling client and returns it along with the
+// "token" form parameter. It writes an error response and returns false on
+// failure.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (*domain.OAuthClient, string, bool) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return nil, "", false
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return nil, "", false
+	}
+	return client, token, true
+}
+
+// authenticateClient parses the form body and authenticates the calling
+// client. It writes an error response and returns false on failure.
+func (h *Handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*domain.OAuthClient, bool) {
+	if err := r.ParseForm(); err != nil {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return nil, false
+	}
+
+	clientID, secret := clientCredentials(r)
+	client, err := h.clientService.AuthenticateClient(r.Context(), clientID, secret)
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidClient) {
+			slog.Error("Handler.authenticateClient: client authentication failed", "error", err)
+			httputil.Error(w, http.StatusInternalServerError, "server_error")
+			return nil, false
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="simple-idm"`)
+		httputil.Error(w, http.StatusUnauthorized, "invalid_client")
+		return nil, false
+	}
+
+	slog.Debug("Handler.authenticateClient: client authenticated", "client_id", client.ID)
+	return client, true
+}
+
+// clientCredentials reads client credentials from HTTP Basic authentication or,
+// failing that, the client_id and client_secret form parameters.
+func clientCredentials(r *http.Request) (string, string) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding
+	if id, err := url.QueryUnescape(clientID); err == nil {
+		clientID = id
+	}
+	if s, err := url.QueryUnescape(secret); err == nil {
+		secret = s
+	}
+	return clientID, secret
+}
@@ -0,0 +1,352 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestOAuth_RequiresClientAuthentication(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{clientService: nil, sessionService: nil}
+	handler.RegisterRoutes(mux)
+
+	for _, target := range []string{"/v1/oauth/introspect", "/v1/oauth/revoke"} {
+		t.Run(target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("token=abc"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+			var resp map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp["error"] != "invalid_client" {
+				t.Errorf("error = %q, want %q", resp["error"], "invalid_client")
+			}
+		})
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		basicID    string
+		basicPass  string
+		form       url.Values
+		wantID     string
+		wantSecret string
+	}{
+		{
+			name:       "basic auth",
+			basicID:    "billing",
+			basicPass:  "s3cret",
+			wantID:     "billing",
+			wantSecret: "s3cret",
+		},
+		{
+			name:       "basic auth is form-decoded",
+			basicID:    "billing",
+			basicPass:  url.QueryEscape("a+b/c="),
+			wantID:     "billing",
+			wantSecret: "a+b/c=",
+		},
+		{
+			name:       "form parameters",
+			form:       url.Values{"client_id": {"billing"}, "client_secret": {"s3cret"}},
+			wantID:     "billing",
+			wantSecret: "s3cret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/oauth/introspect", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicID != "" {
+				req.SetBasicAuth(tt.basicID, tt.basicPass)
+			}
+			if err := req.ParseForm(); err != nil {
+				t.Fatalf("parse form: %v", err)
+			}
+
+			id, secret := clientCredentials(req)
+			if id != tt.wantID || secret != tt.wantSecret {
+				t.Errorf("clientCredentials() = (%q, %q), want (%q, %q)", id, secret, tt.wantID, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestAuthorize_Validation(t *testing.T) {
+	handler := &Handler{}
+
+	rec := httptest.NewRecorder()
+	handler.Authorize(rec, httptest.NewRequest(http.MethodGet, "/v1/oauth/authorize?client_id=web", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without authorization service: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// Nothing is looked up until client_id and redirect_uri are given
+	handler.authorization = &auth.AuthorizationService{}
+	for _, target := range []string{
+		"/v1/oauth/authorize?client_id=web",
+		"/v1/oauth/authorize?redirect_uri=https%3A%2F%2Fapp.example.com%2Fcallback",
+	} {
+		rec := httptest.NewRecorder()
+		handler.Authorize(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+		var resp map[string]string
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp["error"] != "invalid_request" {
+			t.Errorf("%s: error = %q, want %q", target, resp["error"], "invalid_request")
+		}
+	}
+}
+
+func TestToken_RequiresClientAuthentication(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{clientService: nil, sessionService: nil}
+	handler.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader("grant_type=authorization_code&code=abc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRedirectWithParams(t *testing.T) {
+	rec := httptest.NewRecorder()
+	redirectWithParams(rec, httptest.NewRequest(http.MethodGet, "/v1/oauth/authorize", nil),
+		"https://app.example.com/callback?tenant=1",
+		url.Values{"code": {"a+b"}, "state": {""}},
+	)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	query := location.Query()
+	if location.Host != "app.example.com" || query.Get("tenant") != "1" || query.Get("code") != "a+b" {
+		t.Errorf("Location = %s", location)
+	}
+	if query.Has("state") {
+		t.Error("empty state was added to the redirect")
+	}
+}
+
+func TestUserInfo_RequiresBearerToken(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{sessionService: auth.NewSessionService(auth.SessionConfig{JWTSecret: []byte("test-secret")}, nil, nil)}
+	handler.RegisterRoutes(mux)
+
+	for name, authorization := range map[string]string{
+		"missing": "",
+		"invalid": "Bearer not-a-jwt",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/oauth/userinfo", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestDevice_NotEnabled(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{sessionService: auth.NewSessionService(auth.SessionConfig{JWTSecret: []byte("test-secret")}, nil, nil)}
+	handler.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/oauth/device/code", strings.NewReader("client_id=cli"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("device code: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.exchangeDeviceCode(rec, httptest.NewRequest(http.MethodPost, "/v1/oauth/token", nil), nil)
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest || resp["error"] != "unsupported_grant_type" {
+		t.Errorf("token: status = %d, error = %q, want %d unsupported_grant_type", rec.Code, resp["error"], http.StatusBadRequest)
+	}
+}
+
+func TestDeviceApproval_RequiresBearerToken(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{
+		sessionService: auth.NewSessionService(auth.SessionConfig{JWTSecret: []byte("test-secret")}, nil, nil),
+		devices:        &auth.DeviceService{},
+	}
+	handler.RegisterRoutes(mux)
+
+	for _, target := range []string{"GET /v1/oauth/device?user_code=WDJB-MJHT", "POST /v1/oauth/device/approve", "POST /v1/oauth/device/deny"} {
+		t.Run(target, func(t *testing.T) {
+			method, path, _ := strings.Cut(target, " ")
+			req := httptest.NewRequest(method, path, strings.NewReader(`{"user_code":"WDJB-MJHT"}`))
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	secret := []byte("test-secret-key-32-characters-lo")
+	handler := &Handler{sessionService: auth.NewSessionService(auth.SessionConfig{JWTSecret: secret}, nil, nil)}
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read"}, ExchangeAudiences: []string{"orders-api"}}
+	userToken, err := auth.NewHMACSigningKey("", secret).SignAccessToken(auth.AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        uuid.NewString(),
+		},
+		Roles: []string{"admin"},
+	})
+	if err != nil {
+		t.Fatalf("sign user token: %v", err)
+	}
+
+	form := url.Values{
+		"subject_token":      {userToken},
+		"subject_token_type": {tokenTypeAccessToken},
+		"audience":           {"orders-api"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := req.ParseForm(); err != nil {
+		t.Fatalf("parse form: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.exchangeToken(rec, req, gateway)
+
+	var resp TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || resp.IssuedTokenType != tokenTypeAccessToken || resp.TokenType != "Bearer" || resp.Scope != "orders:read" {
+		t.Fatalf("status = %d, response = %+v", rec.Code, resp)
+	}
+	claims, err := handler.sessionService.ValidateAccessToken(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "gateway" || len(claims.Audience) != 1 || claims.Audience[0] != "orders-api" {
+		t.Errorf("act = %+v, aud = %v", claims.Actor, claims.Audience)
+	}
+	if len(claims.Roles) != 0 {
+		t.Errorf("Roles = %v; the user's admin role should not be passed on", claims.Roles)
+	}
+}
+
+func TestTokenExchange_InvalidRequest(t *testing.T) {
+	handler := &Handler{sessionService: auth.NewSessionService(auth.SessionConfig{JWTSecret: []byte("test-secret-key-32-characters-lo")}, nil, nil)}
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read"}, ExchangeAudiences: []string{"orders-api"}}
+	subjectToken, err := handler.sessionService.IssueClientToken(context.Background(), &domain.OAuthClient{ID: "billing"}, nil)
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		client    *domain.OAuthClient
+		form      url.Values
+		wantError string
+	}{
+		{
+			name:      "missing subject token",
+			form:      url.Values{"subject_token_type": {tokenTypeAccessToken}, "audience": {"orders-api"}},
+			wantError: "invalid_request",
+		},
+		{
+			name:      "refresh token as subject",
+			form:      url.Values{"subject_token": {"opaque"}, "subject_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}, "audience": {"orders-api"}},
+			wantError: "invalid_request",
+		},
+		{
+			name:      "actor token",
+			form:      url.Values{"subject_token": {subjectToken.AccessToken}, "subject_token_type": {tokenTypeAccessToken}, "actor_token": {"x"}, "audience": {"orders-api"}},
+			wantError: "invalid_request",
+		},
+		{
+			name:      "missing audience",
+			form:      url.Values{"subject_token": {subjectToken.AccessToken}, "subject_token_type": {tokenTypeAccessToken}},
+			wantError: "invalid_request",
+		},
+		{
+			name:      "client token as subject",
+			form:      url.Values{"subject_token": {subjectToken.AccessToken}, "subject_token_type": {tokenTypeJWT}, "resource": {"https://orders.example.com"}},
+			wantError: "invalid_request",
+		},
+		{
+			name:      "client not allowed to exchange",
+			client:    &domain.OAuthClient{ID: "billing", Scopes: []string{"orders:read"}},
+			form:      url.Values{"subject_token": {subjectToken.AccessToken}, "subject_token_type": {tokenTypeAccessToken}, "audience": {"orders-api"}},
+			wantError: "unauthorized_client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if err := req.ParseForm(); err != nil {
+				t.Fatalf("parse form: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			client := tt.client
+			if client == nil {
+				client = gateway
+			}
+
+			handler.exchangeToken(rec, req, client)
+
+			var resp map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if rec.Code != http.StatusBadRequest || resp["error"] != tt.wantError {
+				t.Errorf("status = %d, error = %q, want %d %s", rec.Code, resp["error"], http.StatusBadRequest, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package oauth
+
+import (
+	"net/http"
+
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+)
+
+// RegisterRoutes registers OAuth routes. Callers authenticate as registered
+// clients, except at the userinfo and device approval endpoints.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /v1/oauth/introspect", h.Introspect)
+	mux.HandleFunc("POST /v1/oauth/revoke", h.Revoke)
+	mux.HandleFunc("GET /v1/oauth/authorize", h.Authorize)
+	mux.HandleFunc("POST /v1/oauth/token", h.Token)
+	mux.HandleFunc("POST /v1/oauth/device/code", h.DeviceCode)
+
+	// Endpoints taking a bearer access token
+	authMiddleware := middleware.Auth(h.sessionService)
+	mux.Handle("GET /v1/oauth/userinfo", authMiddleware(http.HandlerFunc(h.UserInfo)))
+	mux.Handle("GET /v1/oauth/device", authMiddleware(http.HandlerFunc(h.DeviceLookup)))
+	mux.Handle("POST /v1/oauth/device/approve", authMiddleware(http.HandlerFunc(h.DeviceApprove)))
+	mux.Handle("POST /v1/oauth/device/deny", authMiddleware(http.HandlerFunc(h.DeviceDeny)))
+}
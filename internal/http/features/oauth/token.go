@@ -0,0 +1,152 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// TokenResponse represents a token endpoint response (RFC 6749 section 5.1).
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// Set by the token exchange grant (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// Token is the token endpoint. Registered clients redeem authorization codes
+// from Authorize and device codes from DeviceCode, refresh the sessions they
+// got from them, get access tokens for themselves with the client
+// credentials grant, and exchange users' access tokens for narrower ones to
+// call other services with.
+// POST /v1/oauth/token
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		h.exchangeCode(w, r, client)
+	case "refresh_token":
+		h.refresh(w, r, client)
+	case "client_credentials":
+		h.issueClientToken(w, r, client)
+	case GrantTypeDeviceCode:
+		h.exchangeDeviceCode(w, r, client)
+	case GrantTypeTokenExchange:
+		h.exchangeToken(w, r, client)
+	case "":
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		httputil.Error(w, http.StatusBadRequest, "unsupported_grant_type")
+	}
+}
+
+// exchangeCode redeems an authorization code for a session and, with the
+// openid scope, an ID token.
+func (h *Handler) exchangeCode(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	if h.authorization == nil {
+		httputil.Error(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	redirectURI := r.PostForm.Get("redirect_uri")
+	codeVerifier := r.PostForm.Get("code_verifier")
+	if code == "" || redirectURI == "" || codeVerifier == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+		return
+	}
+
+	result, err := h.authorization.ExchangeCode(r.Context(), client, code, redirectURI, codeVerifier, auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	})
+	if errors.Is(err, domain.ErrInvalidGrant) {
+		httputil.Error(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if err != nil {
+		slog.Error("Handler.Token: code exchange failed", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	httputil.JSON(w, http.StatusOK, TokenResponse{
+		AccessToken:  result.Tokens.AccessToken,
+		TokenType:    result.Tokens.TokenType,
+		ExpiresIn:    result.Tokens.ExpiresIn,
+		RefreshToken: result.Tokens.RefreshToken,
+		IDToken:      result.IDToken,
+		Scope:        result.Scope,
+	})
+}
+
+// issueClientToken issues a short-lived access token whose subject is the
+// client itself. There is no refresh token; clients ask again instead.
+func (h *Handler) issueClientToken(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	token, err := h.sessionService.IssueClientToken(r.Context(), client, strings.Fields(r.PostForm.Get("scope")))
+	if errors.Is(err, domain.ErrInvalidScope) {
+		httputil.Error(w, http.StatusBadRequest, "invalid_scope")
+		return
+	}
+	if err != nil {
+		slog.Error("Handler.Token: failed to issue client token", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	slog.Info("Handler.Token: client token issued", "client_id", client.ID, "scope", token.Scope)
+	httputil.JSON(w, http.StatusOK, TokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.ExpiresIn,
+		Scope:       token.Scope,
+	})
+}
+
+// refresh rotates a refresh token, as POST /v1/auth/refresh does.
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	tokens, err := h.sessionService.RefreshSession(r.Context(), refreshToken, auth.IssueSessionOpts{
+		IP:        r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		ClientID:  client.ID,
+	})
+	if errors.Is(err, domain.ErrRefreshTokenReused) ||
+		errors.Is(err, domain.ErrSessionNotFound) ||
+		errors.Is(err, domain.ErrSessionExpired) ||
+		errors.Is(err, domain.ErrSessionRevoked) {
+		httputil.Error(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if err != nil {
+		slog.Error("Handler.Token: refresh failed", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	httputil.JSON(w, http.StatusOK, TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
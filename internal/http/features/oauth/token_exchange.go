@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// GrantTypeTokenExchange is the grant_type clients exchange a user's access
+// token for a narrower one with (RFC 8693 section 2.1).
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers of the token exchange grant (RFC 8693 section 3).
+// simple-idm access tokens are JWTs, so subject tokens may be labeled either.
+const (
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangeToken issues a client a token for the user of subject_token,
+// limited to the requested audience and scope, to call another service on
+// their behalf. The client itself is the actor; actor tokens are not
+// accepted.
+func (h *Handler) exchangeToken(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient) {
+	subjectToken := r.PostForm.Get("subject_token")
+	subjectTokenType := r.PostForm.Get("subject_token_type")
+	if subjectToken == "" || subjectTokenType == "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "subject_token and subject_token_type are required")
+		return
+	}
+	if subjectTokenType != tokenTypeAccessToken && subjectTokenType != tokenTypeJWT {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "subject_token must be an access token")
+		return
+	}
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != tokenTypeAccessToken {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "only access tokens can be requested")
+		return
+	}
+	if r.PostForm.Get("actor_token") != "" {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "actor_token is not supported")
+		return
+	}
+	// Services are named by audience or, as URIs, by resource
+	audience := slices.Concat(r.PostForm["audience"], r.PostForm["resource"])
+	if len(audience) == 0 {
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "audience or resource is required")
+		return
+	}
+
+	token, err := h.sessionService.ExchangeToken(r.Context(), client, auth.TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		Audience:     audience,
+		Scopes:       strings.Fields(r.PostForm.Get("scope")),
+	})
+	switch {
+	case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrSessionRevoked):
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "invalid_request", "subject_token is invalid or expired")
+	case errors.Is(err, domain.ErrUnauthorizedClient):
+		httputil.ErrorWithMessage(w, http.StatusBadRequest, "unauthorized_client", "the client may not exchange tokens")
+	case errors.Is(err, domain.ErrInvalidTarget):
+		httputil.Error(w, http.StatusBadRequest, "invalid_target")
+	case errors.Is(err, domain.ErrInvalidScope):
+		httputil.Error(w, http.StatusBadRequest, "invalid_scope")
+	case err != nil:
+		slog.Error("Handler.Token: token exchange failed", "client_id", client.ID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+	default:
+		httputil.JSON(w, http.StatusOK, TokenResponse{
+			AccessToken:     token.AccessToken,
+			IssuedTokenType: tokenTypeAccessToken,
+			TokenType:       "Bearer",
+			ExpiresIn:       token.ExpiresIn,
+			Scope:           token.Scope,
+		})
+	}
+}
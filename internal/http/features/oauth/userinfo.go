@@ -0,0 +1,56 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// UserInfoResponse represents a userinfo response (OpenID Connect Core
+// section 5.3.2).
+type UserInfoResponse struct {
+	Subject           string   `json:"sub"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+}
+
+// UserInfo returns claims about the user a bearer access token was issued
+// to. It must be mounted behind middleware.Auth.
+// GET /v1/oauth/userinfo
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		httputil.Error(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+
+	info, err := h.sessionService.UserInfo(r.Context(), userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		httputil.Error(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+	if err != nil {
+		slog.Error("Handler.UserInfo: failed to load user", "user_id", userID, "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, UserInfoResponse{
+		Subject:           info.Subject,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+		Name:              info.Name,
+		PreferredUsername: info.PreferredUsername,
+		Roles:             info.Roles,
+	})
+}
@@ -3,20 +3,31 @@ package pages
 import (
 	"html/template"
 	"net/http"
+	"net/url"
 	"path/filepath"
+
+	"github.com/tendant/simple-idm-slim/internal/httputil"
 )
 
 // Handler handles authentication page rendering.
 type Handler struct {
-	templates map[string]*template.Template
+	templates      map[string]*template.Template
+	redirects      *httputil.RedirectAllowlist // Checks return_to; nil allows relative paths only
+	externalLogins []ExternalLogin
+}
+
+// ExternalLogin is a provider offered on the login page.
+type ExternalLogin struct {
+	Name     string // Shown as "Sign in with <Name>"
+	StartURL string // Starts the provider's browser login, e.g. /v1/auth/google
 }
 
 // NewHandler creates a new pages handler.
-func NewHandler(templatesDir string) (*Handler, error) {
+func NewHandler(templatesDir string, redirects *httputil.RedirectAllowlist) (*Handler, error) {
 	templates := make(map[string]*template.Template)
 
 	// List of page templates
-	pages := []string{"register", "login", "verify-email", "reset-password", "reset-password-confirm", "request-verification"}
+	pages := []string{"register", "login", "verify-email", "reset-password", "reset-password-confirm", "request-verification", "link-account", "confirm-link", "mfa", "device"}
 
 	layoutPath := filepath.Join(templatesDir, "layout.html")
 
@@ -32,12 +43,22 @@ func NewHandler(templatesDir string) (*Handler, error) {
 
 	return &Handler{
 		templates: templates,
+		redirects: redirects,
 	}, nil
 }
 
+// SetExternalLogins sets the providers the login page offers. Their logins
+// return to the login page, which completes MFA or account linking if needed
+// before going on to return_to.
+func (h *Handler) SetExternalLogins(logins []ExternalLogin) {
+	h.externalLogins = logins
+}
+
 // PageData holds data for template rendering.
 type PageData struct {
-	Title string
+	Title          string
+	ReturnTo       string // Where to go after signing in
+	ExternalLogins []ExternalLogin
 }
 
 // Register renders the registration page.
@@ -46,8 +67,48 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 // Login renders the login page.
+// GET /auth/login?return_to=<url>
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	h.render(w, "login", PageData{Title: "Sign In"})
+	returnTo, ok := h.returnTo(w, r)
+	if !ok {
+		return
+	}
+	// External logins come back here with the outcome in an "auth" parameter
+	loginPage := "/auth/login?return_to=" + url.QueryEscape(returnTo)
+	logins := make([]ExternalLogin, len(h.externalLogins))
+	for i, login := range h.externalLogins {
+		logins[i] = ExternalLogin{
+			Name:     login.Name,
+			StartURL: login.StartURL + "?redirect_uri=" + url.QueryEscape(loginPage),
+		}
+	}
+	h.render(w, "login", PageData{Title: "Sign In", ReturnTo: returnTo, ExternalLogins: logins})
+}
+
+// MFA renders the second step of a login for users who enabled MFA. Password
+// and external logins send users here with their challenge token in the
+// fragment, which the page reads.
+// GET /auth/mfa?return_to=<url>#challenge_token=<token>
+func (h *Handler) MFA(w http.ResponseWriter, r *http.Request) {
+	returnTo, ok := h.returnTo(w, r)
+	if !ok {
+		return
+	}
+	h.render(w, "mfa", PageData{Title: "Two-Factor Authentication", ReturnTo: returnTo})
+}
+
+// returnTo returns the request's allowed return_to, or "/" if there is none.
+// It answers 400 and returns false for targets outside the allowlist.
+func (h *Handler) returnTo(w http.ResponseWriter, r *http.Request) (string, bool) {
+	returnTo := r.URL.Query().Get("return_to")
+	if returnTo == "" {
+		returnTo = "/"
+	}
+	if !h.redirects.Allowed(returnTo) {
+		http.Error(w, "return_to is not allowed", http.StatusBadRequest)
+		return "", false
+	}
+	return returnTo, true
 }
 
 // VerifyEmail renders the email verification page.
@@ -70,6 +131,27 @@ func (h *Handler) RequestVerification(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "request-verification", PageData{Title: "Resend Verification Email"})
 }
 
+// LinkAccount renders the page confirming a pending account link with a
+// password or an emailed link.
+// GET /auth/link-account?link_token=<token>
+func (h *Handler) LinkAccount(w http.ResponseWriter, r *http.Request) {
+	h.render(w, "link-account", PageData{Title: "Link Account"})
+}
+
+// ConfirmLink renders the page opened from an account link email.
+// GET /auth/confirm-link?token=<token>
+func (h *Handler) ConfirmLink(w http.ResponseWriter, r *http.Request) {
+	h.render(w, "confirm-link", PageData{Title: "Link Account"})
+}
+
+// Device renders the page where a signed-in user enters the code shown on a
+// device and approves or denies it. Signed-out users are sent to the login
+// page, which returns here.
+// GET /auth/device?user_code=<code>
+func (h *Handler) Device(w http.ResponseWriter, r *http.Request) {
+	h.render(w, "device", PageData{Title: "Connect a Device"})
+}
+
 func (h *Handler) render(w http.ResponseWriter, templateName string, data PageData) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -0,0 +1,93 @@
+package pages
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLogin_ReturnTo(t *testing.T) {
+	h, err := NewHandler("../../../../web/templates", nil)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login?return_to="+url.QueryEscape("/dashboard"), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `"/dashboard"`) {
+		t.Error("login page does not redirect to return_to")
+	}
+
+	for _, target := range []string{"https://evil.example.com", "//evil.example.com", "javascript:alert(1)"} {
+		rec = httptest.NewRecorder()
+		h.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login?return_to="+url.QueryEscape(target), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("return_to=%s: status = %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestMFA_ReturnTo(t *testing.T) {
+	h, err := NewHandler("../../../../web/templates", nil)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.MFA(rec, httptest.NewRequest(http.MethodGet, "/auth/mfa?challenge_token=abc&return_to="+url.QueryEscape("/dashboard"), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `"/dashboard"`) {
+		t.Error("MFA page does not redirect to return_to")
+	}
+
+	rec = httptest.NewRecorder()
+	h.MFA(rec, httptest.NewRequest(http.MethodGet, "/auth/mfa?challenge_token=abc&return_to="+url.QueryEscape("https://evil.example.com"), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLogin_ExternalLoginsReturnToLoginPage(t *testing.T) {
+	h, err := NewHandler("../../../../web/templates", nil)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	h.SetExternalLogins([]ExternalLogin{{Name: "Google", StartURL: "/v1/auth/google"}})
+
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login?return_to="+url.QueryEscape("/v1/oauth/authorize?client_id=web"), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// The provider returns to the login page, which goes on to return_to
+	loginPage := "/auth/login?return_to=" + url.QueryEscape("/v1/oauth/authorize?client_id=web")
+	want := template.HTMLEscapeString("/v1/auth/google?redirect_uri=" + url.QueryEscape(loginPage))
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("login page does not link to %s", want)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	h, err := NewHandler("../../../../web/templates", nil)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Device(rec, httptest.NewRequest(http.MethodGet, "/auth/device?user_code=WDJB-MJHT", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "/v1/oauth/device/") {
+		t.Error("device page does not approve through the API")
+	}
+}
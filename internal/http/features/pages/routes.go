@@ -8,8 +8,12 @@ import (
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /auth/register", h.Register)
 	mux.HandleFunc("GET /auth/login", h.Login)
+	mux.HandleFunc("GET /auth/mfa", h.MFA)
 	mux.HandleFunc("GET /auth/verify-email", h.VerifyEmail)
 	mux.HandleFunc("GET /auth/reset-password", h.ResetPassword)
 	mux.HandleFunc("GET /auth/reset-password/confirm", h.ResetPasswordConfirm)
 	mux.HandleFunc("GET /auth/request-verification", h.RequestVerification)
+	mux.HandleFunc("GET /auth/link-account", h.LinkAccount)
+	mux.HandleFunc("GET /auth/confirm-link", h.ConfirmLink)
+	mux.HandleFunc("GET /auth/device", h.Device)
 }
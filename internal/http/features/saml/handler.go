@@ -0,0 +1,74 @@
+package saml
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/tendant/simple-idm-slim/internal/http/features/external"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+// Handler handles logins through a SAML identity provider. The browser flow
+// is the external login, with the IdP posting its response to the assertion
+// consumer service; Metadata describes us to the IdP.
+type Handler struct {
+	provider *auth.SAMLProvider
+	login    *external.Handler
+}
+
+// NewHandler creates a new SAML handler that keeps login state in memory.
+func NewHandler(provider *auth.SAMLProvider, sessionService *auth.SessionService) *Handler {
+	return &Handler{
+		provider: provider,
+		login:    external.NewHandler(provider, sessionService),
+	}
+}
+
+// NewHandlerWithStateStore creates a handler that keeps login state in
+// stateStore. The IdP posts its response cross-site, so state cookies need
+// cookieSecure.
+func NewHandlerWithStateStore(provider *auth.SAMLProvider, sessionService *auth.SessionService, stateStore external.StateStore, cookieSecure bool) *Handler {
+	return &Handler{
+		provider: provider,
+		login:    external.NewHandlerWithStateStore(provider, sessionService, stateStore, cookieSecure),
+	}
+}
+
+// SetRedirectAllowlist sets where browsers may be returned to after login.
+func (h *Handler) SetRedirectAllowlist(redirects *httputil.RedirectAllowlist) {
+	h.login.SetRedirectAllowlist(redirects)
+}
+
+// SetMFAService makes users who enabled MFA verify a second factor after
+// signing in with the IdP.
+func (h *Handler) SetMFAService(mfa *auth.MFAService) {
+	h.login.SetMFAService(mfa)
+}
+
+// Start sends the browser to the IdP with an authentication request.
+// GET /v1/auth/saml/{name}?redirect_uri=<app_return_uri>
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
+	h.login.Start(w, r)
+}
+
+// ACS is the assertion consumer service the IdP posts its response to. It
+// signs the user in with cookies and returns to the app like other external
+// logins.
+// POST /v1/auth/saml/{name}/acs (SAMLResponse, RelayState)
+func (h *Handler) ACS(w http.ResponseWriter, r *http.Request) {
+	h.login.Callback(w, r)
+}
+
+// Metadata serves our service provider metadata, for registering with the IdP.
+// GET /v1/auth/saml/{name}/metadata
+func (h *Handler) Metadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.provider.Metadata()
+	if err != nil {
+		slog.Error("SAML: failed to build metadata", "provider", h.provider.Name(), "error", err)
+		httputil.Error(w, http.StatusInternalServerError, "failed to build metadata")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
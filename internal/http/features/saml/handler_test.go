@@ -0,0 +1,106 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+func newTestProvider(t *testing.T) *auth.SAMLProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.acme.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	provider, err := auth.NewSAMLProvider(auth.SAMLConfig{
+		Name:            "acme",
+		EntityID:        "https://idm.example.com/v1/auth/saml/acme/metadata",
+		ACSURL:          "https://idm.example.com/v1/auth/saml/acme/acs",
+		IdPEntityID:     "https://idp.acme.com/saml",
+		IdPSSOURL:       "https://idp.acme.com/saml/sso",
+		IdPCertificates: []*x509.Certificate{cert},
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewSAMLProvider failed: %v", err)
+	}
+	return provider
+}
+
+func TestMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(newTestProvider(t), nil).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/saml/acme/metadata", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/samlmetadata+xml" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `entityID="https://idm.example.com/v1/auth/saml/acme/metadata"`) ||
+		!strings.Contains(body, `Location="https://idm.example.com/v1/auth/saml/acme/acs"`) {
+		t.Errorf("metadata does not describe the service provider:\n%s", body)
+	}
+}
+
+func TestStart_RedirectsToIdP(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(newTestProvider(t), nil).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/auth/saml/acme", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	if location.Host != "idp.acme.com" || location.Query().Get("SAMLRequest") == "" || location.Query().Get("RelayState") == "" {
+		t.Errorf("unexpected redirect %s", location)
+	}
+}
+
+func TestACS_RejectsUnknownRelayState(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(newTestProvider(t), nil).RegisterRoutes(mux)
+
+	form := url.Values{"SAMLResponse": {"PHNhbWxwOlJlc3BvbnNlLz4="}, "RelayState": {"unknown"}}
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/saml/acme/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,13 @@
+package saml
+
+import (
+	"net/http"
+)
+
+// RegisterRoutes registers the SAML login routes of the handler's provider.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	path := "/v1/auth/saml/" + h.provider.Name()
+	mux.HandleFunc("GET "+path, h.Start)
+	mux.HandleFunc("POST "+path+"/acs", h.ACS)
+	mux.HandleFunc("GET "+path+"/metadata", h.Metadata)
+}
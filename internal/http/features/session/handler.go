@@ -46,7 +46,7 @@ type LogoutRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-// Refresh refreshes an access token.
+// Refresh refreshes an access token and rotates the refresh token.
 // POST /v1/auth/refresh
 //
 // For web clients: Reads refresh token from cookie, sets new cookies.
@@ -84,6 +84,14 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	tokens, err := h.sessionService.RefreshSession(r.Context(), refreshToken, opts)
 	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			// The whole session family was revoked; force a fresh login
+			if !httputil.IsMobileClient(r) {
+				httputil.ClearAuthCookies(w, h.cookieConfig)
+			}
+			httputil.Error(w, http.StatusUnauthorized, "refresh token reuse detected")
+			return
+		}
 		if errors.Is(err, domain.ErrSessionNotFound) ||
 			errors.Is(err, domain.ErrSessionExpired) ||
 			errors.Is(err, domain.ErrSessionRevoked) {
@@ -16,4 +16,7 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, sessionService *auth.Sessio
 	// Protected routes
 	authMiddleware := middleware.Auth(sessionService)
 	mux.Handle("POST /v1/auth/logout/all", authMiddleware(http.HandlerFunc(h.LogoutAll)))
+	mux.Handle("GET /v1/me/sessions", authMiddleware(http.HandlerFunc(h.ListSessions)))
+	mux.Handle("DELETE /v1/me/sessions", authMiddleware(http.HandlerFunc(h.RevokeSessions)))
+	mux.Handle("DELETE /v1/me/sessions/{id}", authMiddleware(http.HandlerFunc(h.RevokeSession)))
 }
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// SessionResponse represents one signed-in device.
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// SessionsResponse represents the list of a user's sessions.
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// ListSessions lists the current user's active sessions.
+// GET /v1/me/sessions
+// Requires authentication
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	sessions, err := h.sessionService.ListSessions(r.Context(), userID, currentSessionID(r))
+	if err != nil {
+		httputil.Error(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+
+	resp := SessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, SessionResponse{
+			ID:         s.ID.String(),
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			Current:    s.Current,
+		})
+	}
+
+	httputil.JSON(w, http.StatusOK, resp)
+}
+
+// RevokeSession signs out one of the current user's sessions.
+// DELETE /v1/me/sessions/{id}
+// Requires authentication
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		httputil.Error(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	current := h.sessionService.SessionFamily(r.Context(), userID, currentSessionID(r)) == id
+
+	if err := h.sessionService.RevokeUserSession(r.Context(), userID, id); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			httputil.Error(w, http.StatusNotFound, "session not found")
+			return
+		}
+		httputil.Error(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+
+	// Signing out this device: clear cookies for web clients
+	if current && !httputil.IsMobileClient(r) {
+		httputil.ClearAuthCookies(w, h.cookieConfig)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeSessions signs out all of the current user's other sessions.
+// DELETE /v1/me/sessions?except=current
+// Requires authentication. Use POST /v1/auth/logout/all to include the current session.
+func (h *Handler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		httputil.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if r.URL.Query().Get("except") != "current" {
+		httputil.Error(w, http.StatusBadRequest, "except=current is required")
+		return
+	}
+
+	if err := h.sessionService.RevokeOtherSessions(r.Context(), userID, currentSessionID(r)); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			httputil.Error(w, http.StatusBadRequest, "current session not found")
+			return
+		}
+		httputil.Error(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentSessionID returns the session ID ("jti") of the request's access token,
+// or uuid.Nil if it has none.
+func currentSessionID(r *http.Request) uuid.UUID {
+	claims, ok := middleware.GetClaims(r.Context())
+	if !ok {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
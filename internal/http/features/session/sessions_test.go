@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/internal/http/middleware"
+)
+
+func TestSessionManagement_Validation(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &Handler{sessionService: nil}
+	mux.HandleFunc("GET /v1/me/sessions", handler.ListSessions)
+	mux.HandleFunc("DELETE /v1/me/sessions", handler.RevokeSessions)
+	mux.HandleFunc("DELETE /v1/me/sessions/{id}", handler.RevokeSession)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		authenticated  bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "list without user",
+			method:         http.MethodGet,
+			target:         "/v1/me/sessions",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "revoke without user",
+			method:         http.MethodDelete,
+			target:         "/v1/me/sessions/" + uuid.NewString(),
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "revoke invalid id",
+			method:         http.MethodDelete,
+			target:         "/v1/me/sessions/not-a-uuid",
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid session id",
+		},
+		{
+			name:           "revoke all without except",
+			method:         http.MethodDelete,
+			target:         "/v1/me/sessions",
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "except=current is required",
+		},
+		{
+			name:           "revoke all with unsupported except",
+			method:         http.MethodDelete,
+			target:         "/v1/me/sessions?except=all",
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "except=current is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+			}
+			rec := httptest.NewRecorder()
+
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Validation should have failed before reaching service")
+				}
+			}()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Status code = %d, want %d", rec.Code, tt.expectedStatus)
+			}
+
+			var response map[string]string
+			json.NewDecoder(rec.Body).Decode(&response)
+			if response["error"] != tt.expectedError {
+				t.Errorf("Error = %q, want %q", response["error"], tt.expectedError)
+			}
+		})
+	}
+}
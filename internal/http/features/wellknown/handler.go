@@ -0,0 +1,106 @@
+package wellknown
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tendant/simple-idm-slim/internal/httputil"
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+// discoveryMaxAge is how long clients may cache the key set and the
+// discovery document.
+const discoveryMaxAge = "public, max-age=300"
+
+// Handler serves discovery documents under /.well-known.
+type Handler struct {
+	sessionService *auth.SessionService
+	baseURL        string   // Public URL of the server; empty disables OpenIDConfiguration
+	grantTypes     []string // Grants the token endpoint accepts
+}
+
+// NewHandler creates a new well-known handler.
+func NewHandler(sessionService *auth.SessionService) *Handler {
+	return &Handler{
+		sessionService: sessionService,
+	}
+}
+
+// SetDiscovery enables the OpenID Connect discovery document. Endpoints are
+// listed under baseURL, e.g. "https://idm.example.com", and grantTypes are
+// the grants the token endpoint accepts.
+func (h *Handler) SetDiscovery(baseURL string, grantTypes []string) {
+	h.baseURL = strings.TrimSuffix(baseURL, "/")
+	h.grantTypes = grantTypes
+}
+
+// JWKS publishes the public keys that verify access tokens.
+// GET /.well-known/jwks.json
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", discoveryMaxAge)
+	httputil.JSON(w, http.StatusOK, h.sessionService.JWKS(r.Context()))
+}
+
+// ProviderMetadata is the OpenID Connect discovery document (OpenID Connect
+// Discovery section 3).
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+}
+
+// grantTypeDeviceCode is the grant_type of the device authorization grant,
+// whose endpoint is listed only when the token endpoint accepts it.
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// OpenIDConfiguration publishes the discovery document OpenID Connect
+// libraries configure themselves from. The issuer is the JWT issuer, which
+// clients expect to be the base URL.
+// GET /.well-known/openid-configuration
+func (h *Handler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	if h.baseURL == "" {
+		httputil.Error(w, http.StatusNotFound, "discovery is not enabled")
+		return
+	}
+
+	metadata := ProviderMetadata{
+		Issuer:                            h.sessionService.Issuer(),
+		AuthorizationEndpoint:             h.baseURL + "/v1/oauth/authorize",
+		TokenEndpoint:                     h.baseURL + "/v1/oauth/token",
+		UserInfoEndpoint:                  h.baseURL + "/v1/oauth/userinfo",
+		JWKSURI:                           h.baseURL + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             h.baseURL + "/v1/oauth/introspect",
+		RevocationEndpoint:                h.baseURL + "/v1/oauth/revoke",
+		ScopesSupported:                   []string{"openid", "email", "profile"},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               h.grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  h.sessionService.SigningAlgorithms(r.Context()),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "preferred_username",
+		},
+	}
+	if slices.Contains(h.grantTypes, grantTypeDeviceCode) {
+		metadata.DeviceAuthorizationEndpoint = h.baseURL + "/v1/oauth/device/code"
+	}
+
+	w.Header().Set("Cache-Control", discoveryMaxAge)
+	httputil.JSON(w, http.StatusOK, metadata)
+}
@@ -0,0 +1,110 @@
+package wellknown
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tendant/simple-idm-slim/pkg/auth"
+)
+
+func TestJWKS(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	key, err := auth.NewSigningKey("test-key", privateKey)
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+
+	handler := NewHandler(auth.NewSessionService(auth.SessionConfig{SigningKey: key}, nil, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	handler.JWKS(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Error("Cache-Control header should be set")
+	}
+
+	var set auth.JWKSet
+	if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(set.Keys) != 1 {
+		t.Fatalf("Keys = %d, want 1", len(set.Keys))
+	}
+	if set.Keys[0].KeyID != "test-key" || set.Keys[0].KeyType != "OKP" || set.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("Unexpected key: %+v", set.Keys[0])
+	}
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	key, err := auth.NewSigningKey("test-key", privateKey)
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+
+	handler := NewHandler(auth.NewSessionService(auth.SessionConfig{
+		SigningKey: key,
+		Issuer:     "https://idm.example.com",
+	}, nil, nil))
+
+	rec := httptest.NewRecorder()
+	handler.OpenIDConfiguration(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without discovery: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	handler.SetDiscovery("https://idm.example.com/", []string{"authorization_code", "refresh_token"})
+	rec = httptest.NewRecorder()
+	handler.OpenIDConfiguration(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var metadata ProviderMetadata
+	if err := json.NewDecoder(rec.Body).Decode(&metadata); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if metadata.Issuer != "https://idm.example.com" {
+		t.Errorf("Issuer = %q", metadata.Issuer)
+	}
+	if metadata.JWKSURI != "https://idm.example.com/.well-known/jwks.json" {
+		t.Errorf("JWKSURI = %q", metadata.JWKSURI)
+	}
+	if metadata.UserInfoEndpoint != "https://idm.example.com/v1/oauth/userinfo" {
+		t.Errorf("UserInfoEndpoint = %q", metadata.UserInfoEndpoint)
+	}
+	if len(metadata.GrantTypesSupported) != 2 || metadata.GrantTypesSupported[0] != "authorization_code" {
+		t.Errorf("GrantTypesSupported = %v", metadata.GrantTypesSupported)
+	}
+	if len(metadata.IDTokenSigningAlgValuesSupported) != 1 || metadata.IDTokenSigningAlgValuesSupported[0] != "EdDSA" {
+		t.Errorf("IDTokenSigningAlgValuesSupported = %v", metadata.IDTokenSigningAlgValuesSupported)
+	}
+	if metadata.DeviceAuthorizationEndpoint != "" {
+		t.Errorf("DeviceAuthorizationEndpoint = %q without the device grant", metadata.DeviceAuthorizationEndpoint)
+	}
+
+	handler.SetDiscovery("https://idm.example.com", []string{"authorization_code", grantTypeDeviceCode})
+	rec = httptest.NewRecorder()
+	handler.OpenIDConfiguration(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	metadata = ProviderMetadata{}
+	if err := json.NewDecoder(rec.Body).Decode(&metadata); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if metadata.DeviceAuthorizationEndpoint != "https://idm.example.com/v1/oauth/device/code" {
+		t.Errorf("DeviceAuthorizationEndpoint = %q", metadata.DeviceAuthorizationEndpoint)
+	}
+}
@@ -0,0 +1,9 @@
+package wellknown
+
+import "net/http"
+
+// RegisterRoutes registers well-known discovery routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /.well-known/jwks.json", h.JWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.OpenIDConfiguration)
+}
@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
 	"github.com/tendant/simple-idm-slim/internal/httputil"
 )
 
@@ -18,10 +20,17 @@ const (
 	UserIDKey contextKey = "user_id"
 	// ClaimsKey is the context key for the token claims.
 	ClaimsKey contextKey = "claims"
+	// ClientIDKey is the context key for the client ID of a client
+	// credentials token. Requests with such a token have no user ID.
+	ClientIDKey contextKey = "client_id"
 )
 
-// Auth creates middleware that validates JWT access tokens.
+// Auth creates middleware that validates JWT access tokens of users.
 // Checks Authorization header first, then falls back to cookie for web clients.
+// Tokens whose audience is another service, such as exchanged tokens, are
+// rejected. When the session service has revocation checks enabled, tokens
+// whose session was revoked are rejected as well. Client credentials tokens
+// are rejected; use AuthAllowClients for routes that serve registered clients too.
 func Auth(sessionService *auth.SessionService) func(http.Handler) http.Handler {
 	return AuthWithLogger(sessionService, slog.Default())
 }
@@ -29,6 +38,18 @@ func Auth(sessionService *auth.SessionService) func(http.Handler) http.Handler {
 // AuthWithLogger creates middleware that validates JWT access tokens with custom logger.
 // Checks Authorization header first, then falls back to cookie for web clients.
 func AuthWithLogger(sessionService *auth.SessionService, logger *slog.Logger) func(http.Handler) http.Handler {
+	return authenticate(sessionService, logger, false)
+}
+
+// AuthAllowClients is Auth for routes that also serve registered clients
+// calling on their own behalf with client credentials tokens. GetClientID
+// instead of GetUserID identifies such callers, and their claims hold the
+// client's roles rather than a user's.
+func AuthAllowClients(sessionService *auth.SessionService) func(http.Handler) http.Handler {
+	return authenticate(sessionService, slog.Default(), true)
+}
+
+func authenticate(sessionService *auth.SessionService, logger *slog.Logger, allowClients bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var tokenString string
@@ -93,6 +114,42 @@ func AuthWithLogger(sessionService *auth.SessionService, logger *slog.Logger) fu
 				return
 			}
 
+			// Exchanged tokens are meant for other services
+			if !sessionService.IntendedForIDM(claims) {
+				logger.Warn("auth middleware: token audience is another service",
+					"path", path,
+					"method", method,
+					"client_ip", clientIP,
+					"audience", claims.Audience,
+				)
+				http.Error(w, `{"error":"token is not meant for this service"}`, http.StatusUnauthorized)
+				return
+			}
+
+			// Registered clients calling on their own behalf have no user
+			if claims.IsClient() {
+				if !allowClients {
+					logger.Warn("auth middleware: client token on a user-only route",
+						"path", path,
+						"method", method,
+						"client_ip", clientIP,
+						"client_id", claims.ClientID,
+					)
+					http.Error(w, `{"error":"client tokens are not accepted"}`, http.StatusUnauthorized)
+					return
+				}
+				logger.Debug("auth middleware: client token validated successfully",
+					"path", path,
+					"method", method,
+					"client_ip", clientIP,
+					"client_id", claims.ClientID,
+				)
+				ctx := context.WithValue(r.Context(), ClientIDKey, claims.ClientID)
+				ctx = context.WithValue(ctx, ClaimsKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Parse user ID
 			userID, err := uuid.Parse(claims.Subject)
 			if err != nil {
@@ -107,6 +164,30 @@ func AuthWithLogger(sessionService *auth.SessionService, logger *slog.Logger) fu
 				return
 			}
 
+			// Reject tokens whose session was revoked (only when revocation checks are enabled)
+			if err := sessionService.CheckSession(r.Context(), claims); err != nil {
+				if errors.Is(err, domain.ErrSessionRevoked) {
+					logger.Warn("auth middleware: session revoked",
+						"path", path,
+						"method", method,
+						"client_ip", clientIP,
+						"user_id", userID,
+						"session_id", claims.ID,
+					)
+					http.Error(w, `{"error":"session revoked"}`, http.StatusUnauthorized)
+					return
+				}
+				logger.Error("auth middleware: session lookup failed",
+					"path", path,
+					"method", method,
+					"client_ip", clientIP,
+					"user_id", userID,
+					"error", err,
+				)
+				http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+				return
+			}
+
 			logger.Debug("auth middleware: token validated successfully",
 				"path", path,
 				"method", method,
@@ -130,6 +211,20 @@ func GetUserID(ctx context.Context) (uuid.UUID, bool) {
 	return userID, ok
 }
 
+// GetClientID extracts the client ID from the request context. It is only
+// set behind AuthAllowClients when the caller is a registered client using a
+// client credentials token; GetUserID then returns false.
+func GetClientID(ctx context.Context) (string, bool) {
+	clientID, ok := ctx.Value(ClientIDKey).(string)
+	return clientID, ok
+}
+
+// IsClient reports whether the caller is a registered client rather than a user.
+func IsClient(ctx context.Context) bool {
+	_, ok := GetClientID(ctx)
+	return ok
+}
+
 // GetClaims extracts the token claims from the request context.
 func GetClaims(ctx context.Context) (*auth.AccessTokenClaims, bool) {
 	claims, ok := ctx.Value(ClaimsKey).(*auth.AccessTokenClaims)
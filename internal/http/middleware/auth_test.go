@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +12,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/tendant/simple-idm-slim/pkg/auth"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
 )
 
 func createTestSessionService(secret []byte) *auth.SessionService {
@@ -218,3 +221,135 @@ func TestGetClaims(t *testing.T) {
 		t.Error("GetClaims should return false when claims are not in context")
 	}
 }
+
+func TestAuth_ClientToken(t *testing.T) {
+	// Revocation checks would look client tokens up as sessions
+	sessionService := auth.NewSessionService(auth.SessionConfig{
+		JWTSecret:       []byte("test-secret-key-32-characters-lo"),
+		Issuer:          "test",
+		RevocationCheck: true,
+	}, nil, nil)
+	client := &domain.OAuthClient{ID: uuid.NewString(), Scopes: []string{"jobs"}, Roles: []string{"service"}}
+	token, err := sessionService.IssueClientToken(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+
+	// User-only routes refuse client tokens
+	userOnly := Auth(sessionService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	rec := httptest.NewRecorder()
+	userOnly.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Auth status code = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	handler := AuthAllowClients(sessionService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientID, ok := GetClientID(r.Context()); !ok || clientID != client.ID {
+			t.Errorf("GetClientID = %q, %v; want %q", clientID, ok, client.ID)
+		}
+		if !IsClient(r.Context()) {
+			t.Error("IsClient should be true")
+		}
+		if _, ok := GetUserID(r.Context()); ok {
+			t.Error("User ID should not be set for a client")
+		}
+		if claims, ok := GetClaims(r.Context()); !ok || claims.Scope != "jobs" || len(claims.Roles) != 1 {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	rec = httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAuth_IDToken(t *testing.T) {
+	// ID tokens are signed with the same key as access tokens
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := auth.NewSigningKey("test-key", private)
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+	sessionService := auth.NewSessionService(auth.SessionConfig{SigningKey: key, Issuer: "test"}, nil, nil)
+	idToken, err := sessionService.IssueIDToken(context.Background(), auth.IDTokenInput{
+		User:     &domain.User{ID: uuid.New(), Email: "test@example.com"},
+		ClientID: "dashboard",
+	})
+	if err != nil {
+		t.Fatalf("IssueIDToken: %v", err)
+	}
+
+	handler := Auth(sessionService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Status code = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuth_TokenForAnotherService(t *testing.T) {
+	secret := []byte("test-secret-key-32-characters-lo")
+	sessionService := createTestSessionService(secret)
+	key := auth.NewHMACSigningKey("", secret)
+	tokenFor := func(audience ...string) string {
+		token, err := key.SignAccessToken(auth.AccessTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   uuid.NewString(),
+				Audience:  audience,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+			},
+			Actor: &auth.ActorClaim{Subject: "gateway"},
+		})
+		if err != nil {
+			t.Fatalf("SignAccessToken: %v", err)
+		}
+		return token
+	}
+
+	handler := Auth(sessionService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		audience []string
+		want     int
+	}{
+		{"another service", []string{"orders-api"}, http.StatusUnauthorized},
+		{"this service", []string{"orders-api", "test"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenFor(tt.audience...))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Status code = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
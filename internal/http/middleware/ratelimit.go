@@ -22,20 +22,42 @@ func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
 	return httprate.Limit(
 		cfg.Requests,
 		cfg.Window,
-		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
-			if cfg.Logger != nil {
-				cfg.Logger.Warn("rate limit exceeded",
-					"ip", r.RemoteAddr,
-					"path", r.URL.Path,
-					"method", r.Method,
-					"user_agent", r.UserAgent(),
-				)
+		httprate.WithLimitHandler(limitExceeded(cfg)),
+	)
+}
+
+// UserRateLimit creates a rate limiter middleware that limits each signed-in
+// user, wherever they connect from. It must run behind Auth; requests
+// without a user are limited by IP.
+func UserRateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	return httprate.Limit(
+		cfg.Requests,
+		cfg.Window,
+		httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+			if userID, ok := GetUserID(r.Context()); ok {
+				return "user:" + userID.String(), nil
 			}
-			httputil.Error(w, http.StatusTooManyRequests, "rate limit exceeded. please try again later")
+			return httprate.KeyByIP(r)
 		}),
+		httprate.WithLimitHandler(limitExceeded(cfg)),
 	)
 }
 
+// limitExceeded logs a rejected request and responds 429.
+func limitExceeded(cfg RateLimitConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Logger != nil {
+			cfg.Logger.Warn("rate limit exceeded",
+				"ip", r.RemoteAddr,
+				"path", r.URL.Path,
+				"method", r.Method,
+				"user_agent", r.UserAgent(),
+			)
+		}
+		httputil.Error(w, http.StatusTooManyRequests, "rate limit exceeded. please try again later")
+	}
+}
+
 // NoRateLimit returns a no-op middleware when rate limiting is disabled.
 func NoRateLimit() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -53,6 +75,7 @@ func CreateRateLimiters(cfg config.RateLimitConfig, logger *slog.Logger) map[str
 			"verify":  noOp,
 			"refresh": noOp,
 			"profile": noOp,
+			"device":  noOp,
 		}
 	}
 
@@ -82,5 +105,12 @@ func CreateRateLimiters(cfg config.RateLimitConfig, logger *slog.Logger) map[str
 			Window:   time.Duration(cfg.ProfileWindowMinutes) * time.Minute,
 			Logger:   logger,
 		}),
+		// Per user, so a signed-in user cannot guess device user codes from
+		// many addresses
+		"device": UserRateLimit(RateLimitConfig{
+			Requests: cfg.AuthRequestsPerMinute,
+			Window:   time.Duration(cfg.AuthWindowMinutes) * time.Minute,
+			Logger:   logger,
+		}),
 	}
 }
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/tendant/simple-idm-slim/internal/config"
 )
 
@@ -123,4 +125,34 @@ func TestCreateRateLimiters_Enabled(t *testing.T) {
 	if limiters["profile"] == nil {
 		t.Error("profile limiter should not be nil")
 	}
+	if limiters["device"] == nil {
+		t.Error("device limiter should not be nil")
+	}
+}
+
+func TestUserRateLimit(t *testing.T) {
+	handler := UserRateLimit(RateLimitConfig{Requests: 1, Window: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(userID uuid.UUID, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	user := uuid.New()
+	if code := request(user, "192.168.1.1:12345"); code != http.StatusOK {
+		t.Errorf("First request: got status %d, want %d", code, http.StatusOK)
+	}
+	// The same user is limited from another address
+	if code := request(user, "192.168.1.2:12345"); code != http.StatusTooManyRequests {
+		t.Errorf("Second request: got status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// Other users have their own limit
+	if code := request(uuid.New(), "192.168.1.1:12345"); code != http.StatusOK {
+		t.Errorf("Other user: got status %d, want %d", code, http.StatusOK)
+	}
 }
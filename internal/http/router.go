@@ -3,17 +3,25 @@ package http
 import (
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/tendant/simple-idm-slim/pkg/auth"
 	"github.com/tendant/simple-idm-slim/internal/config"
+	"github.com/tendant/simple-idm-slim/internal/http/features/accountlink"
+	"github.com/tendant/simple-idm-slim/internal/http/features/apple"
 	"github.com/tendant/simple-idm-slim/internal/http/features/email"
 	"github.com/tendant/simple-idm-slim/internal/http/features/google"
+	"github.com/tendant/simple-idm-slim/internal/http/features/identity"
 	"github.com/tendant/simple-idm-slim/internal/http/features/me"
 	"github.com/tendant/simple-idm-slim/internal/http/features/mfa"
+	"github.com/tendant/simple-idm-slim/internal/http/features/oauth"
+	"github.com/tendant/simple-idm-slim/internal/http/features/external"
 	"github.com/tendant/simple-idm-slim/internal/http/features/pages"
 	"github.com/tendant/simple-idm-slim/internal/http/features/password"
+	"github.com/tendant/simple-idm-slim/internal/http/features/saml"
 	"github.com/tendant/simple-idm-slim/internal/http/features/session"
+	"github.com/tendant/simple-idm-slim/internal/http/features/wellknown"
 	"github.com/tendant/simple-idm-slim/internal/http/middleware"
 	"github.com/tendant/simple-idm-slim/internal/httputil"
 	"github.com/tendant/simple-idm-slim/internal/notification"
@@ -25,21 +33,33 @@ type RouterConfig struct {
 	Logger                    *slog.Logger
 	PasswordService           *auth.PasswordService
 	GoogleService             *auth.GoogleService
+	GitHubService             *auth.GitHubService
+	AppleService              *auth.AppleService
+	OIDCProviders             []*auth.OIDCProvider
+	SAMLProviders             []*auth.SAMLProvider
 	SessionService            *auth.SessionService
 	VerificationService       *auth.VerificationService
 	EmailService              *notification.EmailService
 	MFAService                *auth.MFAService
+	ClientService             *auth.ClientService
+	AuthorizationService      *auth.AuthorizationService // Authorization code grant for registered clients
+	DeviceService             *auth.DeviceService        // Device authorization grant for registered clients
+	IdentityService           *auth.IdentityService
+	AccountLinkService        *auth.AccountLinkService // Confirms links under the require-confirmation policy
 	UsersRepo                 *repository.UsersRepository
 	AppBaseURL                string
 	ServeUI                   bool
+	LoginURL                  string // Login page the authorization endpoint sends users to (default: /auth/login)
+	DeviceVerificationURL     string // Page where users enter device codes (default: AppBaseURL + /auth/device)
 	TemplatesDir              string
 	RateLimitConfig           config.RateLimitConfig
 	SecurityHeaders           config.SecurityHeadersConfig
 	Validation                config.ValidationConfig
 	SessionSecurity           config.SessionSecurityConfig
 	EmailVerificationRequired bool
-	OAuthStateSignKey         []byte // Key for signing OAuth state cookies (enables multi-replica support)
-	CookieSecure              bool   // Whether to use Secure flag on cookies (should be true for HTTPS)
+	OAuthStateStore           external.StateStore         // Where OAuth state is kept between login redirect and callback
+	CookieSecure              bool                        // Whether to use Secure flag on cookies (should be true for HTTPS)
+	RedirectAllowlist         *httputil.RedirectAllowlist // Allowed post-login redirect targets
 }
 
 // NewRouter creates a new HTTP router with all routes registered.
@@ -57,6 +77,10 @@ func NewRouter(cfg RouterConfig) http.Handler {
 		httputil.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
+	// Public keys for verifying access tokens
+	wellknownHandler := wellknown.NewHandler(cfg.SessionService)
+	r.Get("/.well-known/jwks.json", wellknownHandler.JWKS)
+
 	// Create rate limiters for different endpoint types
 	rateLimiters := middleware.CreateRateLimiters(cfg.RateLimitConfig, cfg.Logger)
 
@@ -82,20 +106,70 @@ func NewRouter(cfg RouterConfig) http.Handler {
 		r.Post("/v1/auth/password/reset", passwordHandler.ResetPassword)
 	})
 
+	if cfg.OAuthStateStore == nil {
+		cfg.OAuthStateStore = external.NewMemoryStateStore()
+	}
+
 	// Register Google OAuth routes (if configured)
 	if cfg.GoogleService != nil {
-		var googleHandler *google.Handler
-		if len(cfg.OAuthStateSignKey) > 0 {
-			// Use cookie-based state storage (recommended for multi-replica deployments)
-			googleHandler = google.NewHandlerWithCookieState(cfg.GoogleService, cfg.SessionService, cfg.OAuthStateSignKey, cfg.CookieSecure)
-			cfg.Logger.Info("Google OAuth: using cookie-based state storage (multi-replica safe)")
-		} else {
-			// Fall back to in-memory state storage (single replica only)
-			googleHandler = google.NewHandler(cfg.GoogleService, cfg.SessionService)
-			cfg.Logger.Warn("Google OAuth: using in-memory state storage (not safe for multi-replica)")
-		}
+		googleHandler := google.NewHandlerWithStateStore(cfg.GoogleService, cfg.SessionService, cfg.OAuthStateStore, cfg.CookieSecure)
+		googleHandler.SetRedirectAllowlist(cfg.RedirectAllowlist)
+		googleHandler.SetMFAService(cfg.MFAService)
 		r.Get("/v1/auth/google", googleHandler.Start)
 		r.Get("/v1/auth/google/callback", googleHandler.Callback)
+		if cfg.IdentityService != nil {
+			googleHandler.SetIdentityService(cfg.IdentityService)
+			r.With(middleware.Auth(cfg.SessionService)).Get("/v1/me/identities/google/link", googleHandler.StartLink)
+		}
+	}
+
+	// Register GitHub OAuth routes (if configured)
+	if cfg.GitHubService != nil {
+		githubHandler := external.NewHandlerWithStateStore(cfg.GitHubService, cfg.SessionService, cfg.OAuthStateStore, cfg.CookieSecure)
+		githubHandler.SetRedirectAllowlist(cfg.RedirectAllowlist)
+		githubHandler.SetMFAService(cfg.MFAService)
+		r.Get("/v1/auth/github", githubHandler.Start)
+		r.Get("/v1/auth/github/callback", githubHandler.Callback)
+	}
+
+	// Register Sign in with Apple routes (if configured). Apple posts the callback.
+	if cfg.AppleService != nil {
+		appleHandler := apple.NewHandlerWithStateStore(cfg.AppleService, cfg.SessionService, cfg.OAuthStateStore, cfg.CookieSecure)
+		appleHandler.SetRedirectAllowlist(cfg.RedirectAllowlist)
+		appleHandler.SetMFAService(cfg.MFAService)
+		r.Get("/v1/auth/apple", appleHandler.Start)
+		r.Post("/v1/auth/apple/callback", appleHandler.Callback)
+		r.Post("/v1/auth/apple/token", appleHandler.HandleToken)
+	}
+
+	// Register OpenID Connect provider routes, one pair per provider
+	for _, provider := range cfg.OIDCProviders {
+		oidcHandler := external.NewHandlerWithStateStore(provider, cfg.SessionService, cfg.OAuthStateStore, cfg.CookieSecure)
+		oidcHandler.SetRedirectAllowlist(cfg.RedirectAllowlist)
+		oidcHandler.SetMFAService(cfg.MFAService)
+		r.Get("/v1/auth/oidc/"+provider.Name(), oidcHandler.Start)
+		r.Get("/v1/auth/oidc/"+provider.Name()+"/callback", oidcHandler.Callback)
+	}
+
+	// Register SAML routes per identity provider. IdPs post responses to the ACS.
+	for _, provider := range cfg.SAMLProviders {
+		samlHandler := saml.NewHandlerWithStateStore(provider, cfg.SessionService, cfg.OAuthStateStore, cfg.CookieSecure)
+		samlHandler.SetRedirectAllowlist(cfg.RedirectAllowlist)
+		samlHandler.SetMFAService(cfg.MFAService)
+		r.Get("/v1/auth/saml/"+provider.Name(), samlHandler.Start)
+		r.Post("/v1/auth/saml/"+provider.Name()+"/acs", samlHandler.ACS)
+		r.Get("/v1/auth/saml/"+provider.Name()+"/metadata", samlHandler.Metadata)
+	}
+
+	// Confirm pending account links from external logins
+	if cfg.AccountLinkService != nil {
+		linkHandler := accountlink.NewHandler(cfg.Logger, cfg.AccountLinkService, cfg.EmailService, cfg.AppBaseURL)
+		r.Group(func(r chi.Router) {
+			r.Use(rateLimiters["auth"])
+			r.Post("/v1/auth/link/confirm", linkHandler.Confirm)
+			r.Post("/v1/auth/link/verify", linkHandler.Verify)
+		})
+		r.With(rateLimiters["reset"]).Post("/v1/auth/link/email", linkHandler.RequestEmail)
 	}
 
 	// Register session routes
@@ -107,6 +181,50 @@ func NewRouter(cfg RouterConfig) http.Handler {
 	r.Post("/v1/auth/logout", sessionHandler.Logout)
 	r.With(middleware.Auth(cfg.SessionService)).Post("/v1/auth/logout/all", sessionHandler.LogoutAll)
 
+	// Token introspection and revocation for registered backends, client
+	// credentials tokens for backends calling on their own behalf, token
+	// exchange for backends calling on a user's behalf, and the
+	// authorization code and device grants for apps that log users in
+	// through simple-idm
+	if cfg.ClientService != nil {
+		oauthHandler := oauth.NewHandler(cfg.ClientService, cfg.SessionService)
+		r.Post("/v1/oauth/introspect", oauthHandler.Introspect)
+		r.Post("/v1/oauth/revoke", oauthHandler.Revoke)
+		r.With(rateLimiters["auth"]).Post("/v1/oauth/token", oauthHandler.Token)
+		grantTypes := []string{"refresh_token", "client_credentials", oauth.GrantTypeTokenExchange}
+		if cfg.DeviceService != nil {
+			verificationURL := cfg.DeviceVerificationURL
+			if verificationURL == "" {
+				verificationURL = strings.TrimSuffix(cfg.AppBaseURL, "/") + "/auth/device"
+			}
+			oauthHandler.SetDeviceService(cfg.DeviceService, verificationURL)
+			r.With(rateLimiters["auth"]).Post("/v1/oauth/device/code", oauthHandler.DeviceCode)
+			r.Group(func(r chi.Router) {
+				r.Use(rateLimiters["auth"])
+				r.Use(middleware.Auth(cfg.SessionService))
+				r.Use(rateLimiters["device"])
+				r.Get("/v1/oauth/device", oauthHandler.DeviceLookup)
+				r.Post("/v1/oauth/device/approve", oauthHandler.DeviceApprove)
+				r.Post("/v1/oauth/device/deny", oauthHandler.DeviceDeny)
+			})
+			grantTypes = append(grantTypes, oauth.GrantTypeDeviceCode)
+		}
+		if cfg.AuthorizationService != nil {
+			loginURL := cfg.LoginURL
+			if loginURL == "" {
+				loginURL = "/auth/login"
+			}
+			oauthHandler.SetAuthorizationService(cfg.AuthorizationService, loginURL)
+			grantTypes = append([]string{"authorization_code"}, grantTypes...)
+			r.Get("/v1/oauth/authorize", oauthHandler.Authorize)
+
+			// Discovery for OpenID Connect libraries
+			wellknownHandler.SetDiscovery(cfg.AppBaseURL, grantTypes)
+			r.Get("/.well-known/openid-configuration", wellknownHandler.OpenIDConfiguration)
+		}
+		r.With(middleware.Auth(cfg.SessionService)).Get("/v1/oauth/userinfo", oauthHandler.UserInfo)
+	}
+
 	// Register user profile routes
 	meHandler := me.NewHandler(
 		cfg.Logger,
@@ -123,6 +241,14 @@ func NewRouter(cfg RouterConfig) http.Handler {
 		r.Get("/v1/me", meHandler.GetMe)
 		r.Patch("/v1/me", meHandler.UpdateMe)
 		r.Delete("/v1/me", meHandler.DeleteMe)
+		r.Get("/v1/me/sessions", sessionHandler.ListSessions)
+		r.Delete("/v1/me/sessions", sessionHandler.RevokeSessions)
+		r.Delete("/v1/me/sessions/{id}", sessionHandler.RevokeSession)
+		if cfg.IdentityService != nil {
+			identityHandler := identity.NewHandler(cfg.IdentityService)
+			r.Get("/v1/me/identities", identityHandler.ListIdentities)
+			r.Delete("/v1/me/identities/{id}", identityHandler.DeleteIdentity)
+		}
 	})
 
 	// Email verification routes (if email service is configured)
@@ -172,16 +298,40 @@ func NewRouter(cfg RouterConfig) http.Handler {
 
 	// Authentication pages (if UI is enabled)
 	if cfg.ServeUI {
-		pagesHandler, err := pages.NewHandler(cfg.TemplatesDir)
+		pagesHandler, err := pages.NewHandler(cfg.TemplatesDir, cfg.RedirectAllowlist)
 		if err != nil {
 			cfg.Logger.Error("failed to load page templates", "error", err)
 		} else {
+			var logins []pages.ExternalLogin
+			if cfg.GoogleService != nil {
+				logins = append(logins, pages.ExternalLogin{Name: "Google", StartURL: "/v1/auth/google"})
+			}
+			if cfg.GitHubService != nil {
+				logins = append(logins, pages.ExternalLogin{Name: "GitHub", StartURL: "/v1/auth/github"})
+			}
+			if cfg.AppleService != nil {
+				logins = append(logins, pages.ExternalLogin{Name: "Apple", StartURL: "/v1/auth/apple"})
+			}
+			for _, provider := range cfg.OIDCProviders {
+				logins = append(logins, pages.ExternalLogin{Name: provider.Name(), StartURL: "/v1/auth/oidc/" + provider.Name()})
+			}
+			for _, provider := range cfg.SAMLProviders {
+				logins = append(logins, pages.ExternalLogin{Name: provider.Name(), StartURL: "/v1/auth/saml/" + provider.Name()})
+			}
+			pagesHandler.SetExternalLogins(logins)
+
 			r.Get("/auth/register", pagesHandler.Register)
 			r.Get("/auth/login", pagesHandler.Login)
+			r.Get("/auth/mfa", pagesHandler.MFA)
 			r.Get("/auth/verify-email", pagesHandler.VerifyEmail)
 			r.Get("/auth/reset-password", pagesHandler.ResetPassword)
 			r.Get("/auth/reset-password/confirm", pagesHandler.ResetPasswordConfirm)
 			r.Get("/auth/request-verification", pagesHandler.RequestVerification)
+			r.Get("/auth/link-account", pagesHandler.LinkAccount)
+			r.Get("/auth/confirm-link", pagesHandler.ConfirmLink)
+			if cfg.DeviceService != nil {
+				r.Get("/auth/device", pagesHandler.Device)
+			}
 		}
 	}
 
@@ -0,0 +1,113 @@
+package httputil
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RedirectAllowlist decides where browsers may be sent back to after login,
+// so redirect parameters cannot be used as open redirects.
+//
+// Entries are absolute origins ("https://app.example.com"), which allow any
+// path on that origin, or absolute or relative path prefixes
+// ("https://app.example.com/oauth/", "/app/"). A nil allowlist allows
+// relative paths only.
+type RedirectAllowlist struct {
+	origins       map[string]bool
+	prefixes      []redirectPrefix
+	allowRelative bool
+}
+
+// redirectPrefix is a path prefix, on origin or, if origin is empty, relative.
+type redirectPrefix struct {
+	origin string
+	path   string
+}
+
+// NewRedirectAllowlist parses allowlist entries. If allowRelative is set, any
+// relative path on this server is allowed as well.
+func NewRedirectAllowlist(entries []string, allowRelative bool) (*RedirectAllowlist, error) {
+	a := &RedirectAllowlist{
+		origins:       make(map[string]bool),
+		allowRelative: allowRelative,
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "/") {
+			if !isRelativePath(entry) {
+				return nil, fmt.Errorf("invalid redirect allowlist entry %q", entry)
+			}
+			a.prefixes = append(a.prefixes, redirectPrefix{path: entry})
+			continue
+		}
+
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid redirect allowlist entry %q", entry)
+		}
+		origin := strings.ToLower(u.Scheme + "://" + u.Host)
+		if u.Path == "" || u.Path == "/" {
+			a.origins[origin] = true
+		} else {
+			a.prefixes = append(a.prefixes, redirectPrefix{origin: origin, path: u.Path})
+		}
+	}
+	return a, nil
+}
+
+// Allowed reports whether target may be redirected to.
+func (a *RedirectAllowlist) Allowed(target string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.User != nil || hasDotSegment(u.Path) {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		if !isRelativePath(target) {
+			return false
+		}
+		if a == nil || a.allowRelative {
+			return true
+		}
+		return a.prefixAllowed("", u.Path)
+	}
+
+	if a == nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	return a.origins[origin] || a.prefixAllowed(origin, u.Path)
+}
+
+func (a *RedirectAllowlist) prefixAllowed(origin, path string) bool {
+	for _, p := range a.prefixes {
+		if p.origin != origin {
+			continue
+		}
+		// "/app" allows "/app" and "/app/...", not "/application"
+		if path == p.path || strings.HasPrefix(path, strings.TrimSuffix(p.path, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isRelativePath reports whether s is a path on this server. Browsers treat
+// "//host" as another origin.
+func isRelativePath(s string) bool {
+	return strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//")
+}
+
+// hasDotSegment reports whether path has "." or ".." segments, which could
+// step out of an allowed prefix once the browser resolves them.
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package httputil
+
+import "testing"
+
+func TestRedirectAllowlist_Allowed(t *testing.T) {
+	allowlist, err := NewRedirectAllowlist([]string{
+		"https://app.example.com",
+		"https://partner.example.com/oauth/",
+		"http://localhost:3000/",
+	}, true)
+	if err != nil {
+		t.Fatalf("NewRedirectAllowlist: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/dashboard?tab=1", true},
+		{"https://app.example.com", true},
+		{"https://APP.example.com/any/path?x=1", true},
+		{"https://partner.example.com/oauth/done", true},
+		{"https://partner.example.com/oauth", false},
+		{"http://localhost:3000/callback", true},
+		{"", false},
+		{"//evil.example.com", false},
+		{"/\\evil.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://app.example.com.evil.com/", false},
+		{"https://app.example.com@evil.com/", false},
+		{"http://app.example.com", false},
+		{"https://partner.example.com/other", false},
+		{"https://partner.example.com/oauthx", false},
+		{"https://partner.example.com/oauth/../admin", false},
+		{"https://partner.example.com/oauth/%2e%2e/admin", false},
+		{"javascript:alert(1)", false},
+		{"dashboard", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.Allowed(tt.target); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestRedirectAllowlist_Relative(t *testing.T) {
+	// Without an allowlist only relative paths are allowed
+	var none *RedirectAllowlist
+	if !none.Allowed("/dashboard") || none.Allowed("https://app.example.com/") {
+		t.Error("nil allowlist should allow relative paths only")
+	}
+
+	allowlist, err := NewRedirectAllowlist([]string{"/app/"}, false)
+	if err != nil {
+		t.Fatalf("NewRedirectAllowlist: %v", err)
+	}
+	if !allowlist.Allowed("/app/home") {
+		t.Error("Allowed(/app/home) = false, want true")
+	}
+	if allowlist.Allowed("/admin") {
+		t.Error("Allowed(/admin) = true with relative paths disabled")
+	}
+}
+
+func TestNewRedirectAllowlist_Invalid(t *testing.T) {
+	for _, entry := range []string{"app.example.com", "ftp://app.example.com", "//app.example.com", "https://app.example.com/?x=1", "https://user@app.example.com"} {
+		if _, err := NewRedirectAllowlist([]string{entry}, true); err == nil {
+			t.Errorf("NewRedirectAllowlist(%q) should fail", entry)
+		}
+	}
+}
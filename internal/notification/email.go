@@ -2,6 +2,7 @@ package notification
 
 import (
 	"fmt"
+	"html"
 	"net/smtp"
 )
 
@@ -47,6 +48,20 @@ func (s *EmailService) SendPasswordResetEmail(to, resetURL string) error {
 	return s.sendEmail(to, subject, body)
 }
 
+func (s *EmailService) SendAccountLinkEmail(to, provider, confirmURL string) error {
+	subject := "Confirm Linking Your Account"
+	body := fmt.Sprintf(`<html><body>
+		<h2>Confirm Linking Your Account</h2>
+		<p>Someone signed in with a %s account that uses this email address and asked to link it to your account.</p>
+		<p>Once linked, that %s account can sign in to your account.</p>
+		<p><a href="%s">Click here to link the accounts</a></p>
+		<p>Or copy this link to your browser: %s</p>
+		<p>This link will expire in 30 minutes.</p>
+		<p>If this was not you, do not click the link. Your account will not be changed.</p>
+	</body></html>`, html.EscapeString(provider), html.EscapeString(provider), confirmURL, confirmURL)
+	return s.sendEmail(to, subject, body)
+}
+
 func (s *EmailService) sendEmail(to, subject, body string) error {
 	from := s.config.From
 	if s.config.FromName != "" {
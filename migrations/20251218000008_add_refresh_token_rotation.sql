@@ -0,0 +1,24 @@
+-- +goose Up
+-- Migration: 008_add_refresh_token_rotation
+-- Description: Track refresh token rotation chains so reuse of a rotated token can be detected
+
+-- Every refresh token belongs to a family (one login). A rotated token points at its replacement.
+ALTER TABLE sessions
+ADD COLUMN family_id UUID,
+ADD COLUMN rotated_at TIMESTAMPTZ,
+ADD COLUMN replaced_by UUID;
+
+-- Existing sessions become the root of their own family
+UPDATE sessions SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+
+-- Index for revoking and resolving a whole family
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_family_id;
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS replaced_by,
+DROP COLUMN IF EXISTS rotated_at,
+DROP COLUMN IF EXISTS family_id;
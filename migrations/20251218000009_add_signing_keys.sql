@@ -0,0 +1,17 @@
+-- +goose Up
+-- Migration: 009_add_signing_keys
+-- Description: Shared key ring for rotating access token signing keys across replicas
+
+-- A key is staged (activated_at NULL), active (activated_at set) or retired (retire_at passed).
+-- The most recently activated key that is not retired signs new tokens.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    key_encrypted TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    activated_at TIMESTAMPTZ,
+    retire_at TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS signing_keys;
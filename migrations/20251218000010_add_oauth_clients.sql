@@ -0,0 +1,15 @@
+-- +goose Up
+-- Migration: 010_add_oauth_clients
+-- Description: Registered backends allowed to call the OAuth endpoints (introspection, revocation)
+
+-- Secrets are random and high-entropy, so only their SHA-256 hash is stored.
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Migration: 011_add_oauth_states
+-- Description: External logins in progress, for the database OAuth state store
+
+-- Each row is deleted by the callback that uses it, so a state works once
+-- across all replicas. Only the SHA-256 hash of the state parameter is stored.
+CREATE TABLE IF NOT EXISTS oauth_states (
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS oauth_states;
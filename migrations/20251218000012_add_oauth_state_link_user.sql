@@ -0,0 +1,11 @@
+-- +goose Up
+-- Migration: 012_add_oauth_state_link_user
+-- Description: Link external identities to a signed-in user
+
+-- Set when a signed-in user links a provider to their account rather than
+-- logging in with it.
+ALTER TABLE oauth_states
+    ADD COLUMN IF NOT EXISTS link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE oauth_states DROP COLUMN IF EXISTS link_user_id;
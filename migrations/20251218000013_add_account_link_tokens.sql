@@ -0,0 +1,15 @@
+-- +goose Up
+-- Migration: 013_add_account_link_tokens
+-- Description: Pending links of external identities to existing accounts
+
+-- account_link holds an identity waiting for the owner of the matching
+-- account to confirm it; account_link_email is the emailed confirmation.
+ALTER TABLE verification_tokens DROP CONSTRAINT IF EXISTS verification_tokens_kind_check;
+ALTER TABLE verification_tokens ADD CONSTRAINT verification_tokens_kind_check
+    CHECK (kind IN ('email_verification', 'password_reset', 'mfa_challenge', 'account_link', 'account_link_email'));
+
+-- +goose Down
+DELETE FROM verification_tokens WHERE kind IN ('account_link', 'account_link_email');
+ALTER TABLE verification_tokens DROP CONSTRAINT IF EXISTS verification_tokens_kind_check;
+ALTER TABLE verification_tokens ADD CONSTRAINT verification_tokens_kind_check
+    CHECK (kind IN ('email_verification', 'password_reset', 'mfa_challenge'));
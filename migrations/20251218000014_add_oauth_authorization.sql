@@ -0,0 +1,21 @@
+-- +goose Up
+-- Migration: 014_add_oauth_authorization
+-- Description: Redirect URIs of apps that log users in through /oauth/authorize,
+-- and the authorization codes it issues
+
+-- Redirect URIs are matched exactly; a client without any cannot use the
+-- authorization code grant.
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+
+-- oauth_code is an authorization code; its metadata holds the client,
+-- redirect URI and PKCE challenge it was issued for.
+ALTER TABLE verification_tokens DROP CONSTRAINT IF EXISTS verification_tokens_kind_check;
+ALTER TABLE verification_tokens ADD CONSTRAINT verification_tokens_kind_check
+    CHECK (kind IN ('email_verification', 'password_reset', 'mfa_challenge', 'account_link', 'account_link_email', 'oauth_code'));
+
+-- +goose Down
+DELETE FROM verification_tokens WHERE kind = 'oauth_code';
+ALTER TABLE verification_tokens DROP CONSTRAINT IF EXISTS verification_tokens_kind_check;
+ALTER TABLE verification_tokens ADD CONSTRAINT verification_tokens_kind_check
+    CHECK (kind IN ('email_verification', 'password_reset', 'mfa_challenge', 'account_link', 'account_link_email'));
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS redirect_uris;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Migration: 015_add_oauth_client_grants
+-- Description: Scopes and role labels of clients using the client credentials grant
+
+-- Tokens a client gets for itself carry only these; a client without scopes
+-- can still get a token, with no scope.
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS roles;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS scopes;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Migration: 016_add_oauth_device_codes
+-- Description: Device authorization grant (RFC 8628) requests awaiting a user's approval
+
+-- Only hashes of the device code and user code are stored. A row is deleted
+-- when the device redeems it; expired rows are left to the janitor.
+CREATE TABLE IF NOT EXISTS oauth_device_codes (
+    id UUID PRIMARY KEY,
+    device_code_hash TEXT NOT NULL UNIQUE,
+    user_code_hash TEXT NOT NULL,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scope TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied')),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    mfa_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_polled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_device_codes_user_code_hash ON oauth_device_codes(user_code_hash) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_oauth_device_codes_expires_at ON oauth_device_codes(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS oauth_device_codes;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Migration: 017_add_session_replacement_token
+-- Description: Let a concurrent refresh within the grace window get the token the winning refresh got
+
+-- The replacement's refresh token, AES-GCM sealed with a key derived from the
+-- rotated token. Only a client presenting the rotated token can open it.
+ALTER TABLE sessions
+ADD COLUMN replaced_by_token TEXT;
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS replaced_by_token;
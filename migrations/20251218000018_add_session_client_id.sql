@@ -0,0 +1,11 @@
+-- +goose Up
+-- Migration: 018_add_session_client_id
+-- Description: Bind sessions issued through OAuth grants to the client they were issued to
+
+-- NULL for first-party logins. Only the same client can refresh the session.
+ALTER TABLE sessions
+ADD COLUMN client_id TEXT;
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS client_id;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Migration: 019_add_oauth_client_exchange_audiences
+-- Description: Audiences a client may exchange user tokens for with the token exchange grant
+
+-- A client without any may not exchange tokens at all.
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS exchange_audiences TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS exchange_audiences;
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// AccountLinkPolicy decides what an external login does when its identity is
+// unknown but the provider verified the email of an existing user.
+type AccountLinkPolicy string
+
+const (
+	// AccountLinkAuto links the identity to the existing user. This is the
+	// default, and trusts every provider to verify emails properly.
+	AccountLinkAuto AccountLinkPolicy = "auto"
+	// AccountLinkRequireConfirmation links the identity only after the user
+	// proves they own the existing account, with its password or a link
+	// emailed to it. The login fails with a LinkConfirmationRequiredError.
+	AccountLinkRequireConfirmation AccountLinkPolicy = "require-confirmation"
+	// AccountLinkNever refuses the login with domain.ErrAccountLinkNotAllowed.
+	// Users can still link the provider from their account.
+	AccountLinkNever AccountLinkPolicy = "never"
+)
+
+// accountLinkTokenTTL is how long a pending link, and its emailed
+// confirmation, can be confirmed.
+const accountLinkTokenTTL = 30 * time.Minute
+
+// LinkConfirmationRequiredError is returned by an external login whose
+// identity must be confirmed by the owner of the existing account before it
+// is linked. It matches domain.ErrLinkConfirmationRequired.
+type LinkConfirmationRequiredError struct {
+	Provider string
+	Token    string // Pending link token for AccountLinkService
+}
+
+func (e *LinkConfirmationRequiredError) Error() string {
+	return domain.ErrLinkConfirmationRequired.Error()
+}
+
+func (e *LinkConfirmationRequiredError) Unwrap() error {
+	return domain.ErrLinkConfirmationRequired
+}
+
+// pendingLink is the identity waiting to be linked, kept in the metadata of
+// account link tokens.
+type pendingLink struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+}
+
+// requireConfirmation records ext as a pending link to user and returns the
+// LinkConfirmationRequiredError carrying its token.
+func (a *externalAccounts) requireConfirmation(ctx context.Context, user *domain.User, ext *ExternalIdentity) error {
+	rawToken, err := createLinkToken(ctx, a.db, a.tokens, user.ID, domain.TokenKindAccountLink, &pendingLink{
+		Provider: ext.Provider,
+		Subject:  ext.Subject,
+		Email:    ext.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("externalAccounts.authenticate: account link needs confirmation",
+		"user_id", user.ID,
+		"provider", ext.Provider,
+	)
+	return &LinkConfirmationRequiredError{Provider: ext.Provider, Token: rawToken}
+}
+
+// createLinkToken stores a token of kind for the pending link, replacing the
+// user's previous one.
+func createLinkToken(
+	ctx context.Context,
+	db *sql.DB,
+	tokens *repository.VerificationTokensRepository,
+	userID uuid.UUID,
+	kind domain.VerificationTokenKind,
+	link *pendingLink,
+) (string, error) {
+	rawToken, err := GenerateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	metadata, err := json.Marshal(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	now := time.Now()
+	token := &domain.VerificationToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: HashToken(rawToken),
+		Kind:      kind,
+		CreatedAt: now,
+		ExpiresAt: now.Add(accountLinkTokenTTL),
+		Metadata:  metadata,
+	}
+
+	err = repository.Tx(ctx, db, func(tx *sql.Tx) error {
+		if err := tokens.RevokeActiveTokensTx(ctx, tx, userID, kind); err != nil {
+			return fmt.Errorf("failed to revoke active tokens: %w", err)
+		}
+		if err := tokens.CreateTx(ctx, tx, token); err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// AccountLinkService confirms the pending links that external logins create
+// under AccountLinkRequireConfirmation. Confirming only links the identity;
+// the user then logs in with the provider again.
+type AccountLinkService struct {
+	db         *sql.DB
+	users      *repository.UsersRepository
+	identities *repository.IdentitiesRepository
+	tokens     *repository.VerificationTokensRepository
+	passwords  *PasswordService
+}
+
+// NewAccountLinkService creates a new account link service.
+func NewAccountLinkService(
+	db *sql.DB,
+	users *repository.UsersRepository,
+	identities *repository.IdentitiesRepository,
+	tokens *repository.VerificationTokensRepository,
+	passwords *PasswordService,
+) *AccountLinkService {
+	return &AccountLinkService{
+		db:         db,
+		users:      users,
+		identities: identities,
+		tokens:     tokens,
+		passwords:  passwords,
+	}
+}
+
+// LinkConfirmationEmail is an emailed link confirmation to send.
+type LinkConfirmationEmail struct {
+	To       string // Email address of the existing account
+	Provider string
+	Token    string // Goes in the emailed link, for ConfirmByEmail
+}
+
+// ConfirmWithPassword links the pending identity once the password of the
+// existing account is given. Wrong passwords count towards the account's
+// lockout, and return domain.ErrInvalidCredentials.
+func (s *AccountLinkService) ConfirmWithPassword(ctx context.Context, linkToken, password string) (*domain.UserIdentity, error) {
+	token, link, err := s.getToken(ctx, linkToken, domain.TokenKindAccountLink)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := s.passwords.Authenticate(ctx, user.Email, password)
+	if err != nil {
+		return nil, err
+	}
+	if userID != user.ID {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	return s.link(ctx, token, link)
+}
+
+// RequestEmailConfirmation creates the emailed confirmation of a pending link.
+// The caller sends it to the existing account's address.
+func (s *AccountLinkService) RequestEmailConfirmation(ctx context.Context, linkToken string) (*LinkConfirmationEmail, error) {
+	token, link, err := s.getToken(ctx, linkToken, domain.TokenKindAccountLink)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	rawToken, err := createLinkToken(ctx, s.db, s.tokens, user.ID, domain.TokenKindAccountLinkEmail, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkConfirmationEmail{To: user.Email, Provider: link.Provider, Token: rawToken}, nil
+}
+
+// ConfirmByEmail links the pending identity with the token from the
+// confirmation email.
+func (s *AccountLinkService) ConfirmByEmail(ctx context.Context, emailToken string) (*domain.UserIdentity, error) {
+	token, link, err := s.getToken(ctx, emailToken, domain.TokenKindAccountLinkEmail)
+	if err != nil {
+		return nil, err
+	}
+	return s.link(ctx, token, link)
+}
+
+// getToken returns a valid account link token of kind and its pending link.
+func (s *AccountLinkService) getToken(ctx context.Context, rawToken string, kind domain.VerificationTokenKind) (*domain.VerificationToken, *pendingLink, error) {
+	token, err := s.tokens.GetByTokenHash(ctx, HashToken(rawToken), kind)
+	if err != nil {
+		if errors.Is(err, domain.ErrVerificationTokenNotFound) {
+			return nil, nil, domain.ErrVerificationTokenInvalid
+		}
+		return nil, nil, err
+	}
+	if !token.IsValid() {
+		if token.ConsumedAt != nil {
+			return nil, nil, domain.ErrVerificationTokenConsumed
+		}
+		return nil, nil, domain.ErrVerificationTokenExpired
+	}
+
+	var link pendingLink
+	if err := json.Unmarshal(token.Metadata, &link); err != nil || link.Subject == "" {
+		return nil, nil, domain.ErrVerificationTokenInvalid
+	}
+	return token, &link, nil
+}
+
+// link consumes token and links the pending identity to the token's user.
+// Both the pending link and any emailed confirmation of it are used up.
+func (s *AccountLinkService) link(ctx context.Context, token *domain.VerificationToken, link *pendingLink) (*domain.UserIdentity, error) {
+	existing, err := s.identities.GetByProviderSubject(ctx, link.Provider, link.Subject)
+	if err == nil && existing.UserID != token.UserID {
+		return nil, domain.ErrIdentityAlreadyLinked
+	}
+	if err != nil && !errors.Is(err, domain.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	identity := existing
+	if identity == nil {
+		identity = &domain.UserIdentity{
+			ID:              uuid.New(),
+			UserID:          token.UserID,
+			Provider:        link.Provider,
+			ProviderSubject: link.Subject,
+			Email:           &link.Email,
+			CreatedAt:       time.Now(),
+		}
+	}
+
+	err = repository.Tx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.tokens.MarkConsumedTx(ctx, tx, token.ID); err != nil {
+			if errors.Is(err, domain.ErrVerificationTokenNotFound) {
+				return domain.ErrVerificationTokenConsumed
+			}
+			return err
+		}
+		for _, kind := range []domain.VerificationTokenKind{domain.TokenKindAccountLink, domain.TokenKindAccountLinkEmail} {
+			if err := s.tokens.RevokeActiveTokensTx(ctx, tx, token.UserID, kind); err != nil {
+				return err
+			}
+		}
+		if existing != nil {
+			return nil
+		}
+		return s.identities.CreateTx(ctx, tx, identity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("AccountLinkService: identity linked",
+		"user_id", token.UserID,
+		"provider", link.Provider,
+		"identity_id", identity.ID,
+	)
+	return identity, nil
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestLinkConfirmationRequiredError(t *testing.T) {
+	err := fmt.Errorf("login: %w", &LinkConfirmationRequiredError{Provider: "google", Token: "tok"})
+
+	if !errors.Is(err, domain.ErrLinkConfirmationRequired) {
+		t.Error("error does not match domain.ErrLinkConfirmationRequired")
+	}
+	var confirm *LinkConfirmationRequiredError
+	if !errors.As(err, &confirm) || confirm.Token != "tok" {
+		t.Errorf("errors.As() = %v, want the pending link token", confirm)
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	appleIssuer   = "https://appleid.apple.com"
+	appleAuthURL  = "https://appleid.apple.com/auth/authorize"
+	appleTokenURL = "https://appleid.apple.com/auth/token"
+	appleJWKSURL  = "https://appleid.apple.com/auth/keys"
+
+	// appleClientSecretTTL is the lifetime of generated client secrets. Apple
+	// allows up to six months; a fresh one is made for every code exchange.
+	appleClientSecretTTL = 5 * time.Minute
+
+	// AppleRelayDomain is the domain of Apple's private relay ("Hide My Email") addresses.
+	AppleRelayDomain = "privaterelay.appleid.com"
+)
+
+// AppleConfig holds Sign in with Apple configuration.
+type AppleConfig struct {
+	ClientID    string   // Services ID used by the web flow
+	TeamID      string   // Apple Developer team ID
+	KeyID       string   // ID of the Sign in with Apple private key
+	PrivateKey  []byte   // PEM (.p8) private key, signs client secrets with ES256
+	RedirectURI string   // Must be HTTPS; Apple posts the callback to it
+	BundleIDs   []string // App bundle IDs whose identity tokens native apps post
+	JWKSURL     string   // Keys verifying identity tokens (default: Apple's; override in tests)
+
+	AccountLinking AccountLinkPolicy // Linking to existing users by email (default: auto)
+}
+
+// AppleService handles Sign in with Apple. Apple is an OpenID Connect
+// provider with fixed endpoints, but its client secret is a JWT signed with
+// the team's key, and the user's name is only sent once, with the first
+// callback, rather than in the identity token.
+type AppleService struct {
+	config     AppleConfig
+	signingKey *SigningKey
+	provider   *OIDCProvider
+}
+
+// NewAppleService creates a new Apple service. It fails if the private key
+// is not a PEM-encoded P-256 key.
+func NewAppleService(
+	config AppleConfig,
+	db *sql.DB,
+	users *repository.UsersRepository,
+	identities *repository.IdentitiesRepository,
+) (*AppleService, error) {
+	signingKey, err := ParseSigningKeyPEM(config.KeyID, config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Apple private key: %w", err)
+	}
+	if signingKey.Algorithm() != "ES256" {
+		return nil, fmt.Errorf("invalid Apple private key: want a P-256 key, got %s", signingKey.Algorithm())
+	}
+	if config.JWKSURL == "" {
+		config.JWKSURL = appleJWKSURL
+	}
+
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:           domain.ProviderApple,
+		Issuer:         appleIssuer,
+		ClientID:       config.ClientID,
+		RedirectURI:    config.RedirectURI,
+		Scopes:         []string{"name", "email"},
+		ExtraAudiences: config.BundleIDs,
+		// Apple requires form_post when asking for name or email
+		AuthParams:     map[string]string{"response_mode": "form_post"},
+		AccountLinking: config.AccountLinking,
+	}, db, users, identities)
+	provider.setMetadata(&OIDCProviderMetadata{
+		Issuer:                   appleIssuer,
+		AuthorizationEndpoint:    appleAuthURL,
+		TokenEndpoint:            appleTokenURL,
+		JWKSURI:                  config.JWKSURL,
+		IDTokenSigningAlgs:       []string{"RS256"},
+		TokenEndpointAuthMethods: []string{"client_secret_post"},
+	})
+
+	s := &AppleService{
+		config:     config,
+		signingKey: signingKey,
+		provider:   provider,
+	}
+	provider.clientSecret = s.clientSecret
+	return s, nil
+}
+
+// clientSecret returns the ES256-signed JWT Apple expects as client_secret.
+func (s *AppleService) clientSecret() (string, error) {
+	now := time.Now()
+	return s.signingKey.Sign(jwt.RegisteredClaims{
+		Issuer:    s.config.TeamID,
+		Subject:   s.config.ClientID,
+		Audience:  jwt.ClaimStrings{appleIssuer},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(appleClientSecretTTL)),
+	})
+}
+
+// Name returns the provider name stored in user_identities.
+func (s *AppleService) Name() string {
+	return domain.ProviderApple
+}
+
+// AuthURL returns the Apple authorization URL. Apple posts the callback as a
+// form. Apple does not support PKCE, so codeVerifier is not used; the code
+// is still bound to the client by the signed client secret.
+func (s *AppleService) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	return s.provider.AuthURL(ctx, state, nonce, "")
+}
+
+// Identify exchanges the code from a login callback and returns the identity
+// in the verified identity token.
+func (s *AppleService) Identify(ctx context.Context, code, nonce, codeVerifier string) (*ExternalIdentity, error) {
+	return s.provider.Identify(ctx, code, nonce, "")
+}
+
+// ValidateIdentityToken verifies an identity token from a native app.
+// Native apps pass Apple the SHA-256 of their nonce, so if rawNonce is set
+// the token's nonce must be its hex digest.
+func (s *AppleService) ValidateIdentityToken(ctx context.Context, idToken, rawNonce string) (*OIDCIdentity, error) {
+	expectedNonce := ""
+	if rawNonce != "" {
+		digest := sha256.Sum256([]byte(rawNonce))
+		expectedNonce = hex.EncodeToString(digest[:])
+	}
+	return s.provider.ValidateIDToken(ctx, idToken, expectedNonce)
+}
+
+// AppleUser is the user JSON Apple posts with the first callback only.
+type AppleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// ApplyCallbackUser sets the identity's name from the user JSON Apple posts
+// with the first callback. Later callbacks have no user, so a name that is not
+// saved on first login is not sent again.
+func (s *AppleService) ApplyCallbackUser(identity *ExternalIdentity, user string) {
+	if user == "" || identity.Name != "" {
+		return
+	}
+	var u AppleUser
+	if err := json.Unmarshal([]byte(user), &u); err != nil {
+		return
+	}
+	identity.Name = strings.TrimSpace(u.Name.FirstName + " " + u.Name.LastName)
+}
+
+// Authenticate returns the user linked to an Apple identity. It either finds
+// an existing user or creates a new one, as GoogleService.Authenticate does.
+func (s *AppleService) Authenticate(ctx context.Context, identity *ExternalIdentity) (uuid.UUID, error) {
+	return s.provider.Authenticate(ctx, identity)
+}
+
+// IsPrivateRelayEmail reports whether email is an Apple private relay
+// address, which forwards to the user's real address and is unique per app.
+func IsPrivateRelayEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), "@"+AppleRelayDomain)
+}
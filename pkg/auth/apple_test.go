@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestAppleService returns an Apple service with a freshly generated team
+// key, verifying identity tokens against jwks.
+func newTestAppleService(t *testing.T, jwks *testGoogleJWKS) (*AppleService, *ecdsa.PrivateKey) {
+	t.Helper()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	svc, err := NewAppleService(AppleConfig{
+		ClientID:    "com.example.web",
+		TeamID:      "TEAM123456",
+		KeyID:       "KEY1234567",
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		RedirectURI: "https://idm.example.com/v1/auth/apple/callback",
+		BundleIDs:   []string{"com.example.app"},
+		JWKSURL:     jwks.server.URL,
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewAppleService: %v", err)
+	}
+	return svc, ecKey
+}
+
+func appleTestClaims(audience, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":              appleIssuer,
+		"sub":              "001234.abcdef.1234",
+		"aud":              audience,
+		"exp":              time.Now().Add(time.Hour).Unix(),
+		"iat":              time.Now().Unix(),
+		"nonce":            nonce,
+		"email":            "x7k2@privaterelay.appleid.com",
+		"email_verified":   "true", // Apple sends booleans as strings
+		"is_private_email": "true",
+	}
+}
+
+func TestNewAppleService_RejectsNonP256Key(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if _, err := NewAppleService(AppleConfig{KeyID: "KEY1234567", PrivateKey: rsaPEM}, nil, nil, nil); err == nil {
+		t.Error("NewAppleService() should reject an RSA key")
+	}
+	if _, err := NewAppleService(AppleConfig{KeyID: "KEY1234567", PrivateKey: []byte("not a key")}, nil, nil, nil); err == nil {
+		t.Error("NewAppleService() should reject an invalid key")
+	}
+}
+
+func TestAppleService_AuthURL(t *testing.T) {
+	svc, _ := newTestAppleService(t, newTestGoogleJWKS(t))
+
+	authURL, err := svc.AuthURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != appleAuthURL {
+		t.Errorf("endpoint = %q, want %q", got, appleAuthURL)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"client_id":     "com.example.web",
+		"response_type": "code",
+		"response_mode": "form_post",
+		"scope":         "name email",
+		"state":         "state-1",
+		"nonce":         "nonce-1",
+	}
+	for key, value := range want {
+		if q.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), value)
+		}
+	}
+	// Apple does not support PKCE
+	if q.Has("code_challenge") {
+		t.Errorf("unexpected code_challenge %q", q.Get("code_challenge"))
+	}
+}
+
+func TestAppleService_ExchangeCodeSendsClientSecretJWT(t *testing.T) {
+	svc, ecKey := newTestAppleService(t, newTestGoogleJWKS(t))
+
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		_ = json.NewEncoder(w).Encode(OIDCTokenResponse{AccessToken: "at", IDToken: "id-token", TokenType: "Bearer"})
+	}))
+	defer server.Close()
+	metadata := *svc.provider.metadata
+	metadata.TokenEndpoint = server.URL
+	svc.provider.setMetadata(&metadata)
+
+	if _, err := svc.provider.ExchangeCode(context.Background(), "code-1", ""); err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if form.Get("client_id") != "com.example.web" || form.Get("code") != "code-1" {
+		t.Errorf("unexpected token request %v", form)
+	}
+
+	var claims jwt.RegisteredClaims
+	token, err := jwt.ParseWithClaims(form.Get("client_secret"), &claims, func(*jwt.Token) (interface{}, error) {
+		return &ecKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(appleIssuer), jwt.WithIssuer("TEAM123456"), jwt.WithSubject("com.example.web"))
+	if err != nil {
+		t.Fatalf("client_secret is not a valid ES256 JWT: %v", err)
+	}
+	if token.Header["kid"] != "KEY1234567" {
+		t.Errorf("kid = %v, want KEY1234567", token.Header["kid"])
+	}
+	if claims.ExpiresAt == nil || claims.ExpiresAt.After(time.Now().Add(appleClientSecretTTL+time.Minute)) {
+		t.Errorf("exp = %v, want a short-lived secret", claims.ExpiresAt)
+	}
+}
+
+func TestAppleService_ValidateIdentityToken(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	key := jwks.addKey("apple-1")
+	svc, _ := newTestAppleService(t, jwks)
+	ctx := context.Background()
+
+	// Native apps send Apple the SHA-256 of their raw nonce
+	digest := sha256.Sum256([]byte("raw-nonce"))
+	token, err := key.Sign(appleTestClaims("com.example.app", hex.EncodeToString(digest[:])))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	identity, err := svc.ValidateIdentityToken(ctx, token, "raw-nonce")
+	if err != nil {
+		t.Fatalf("ValidateIdentityToken: %v", err)
+	}
+	if identity.Provider != "apple" || identity.Subject != "001234.abcdef.1234" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity.ExternalIdentity)
+	}
+	if !IsPrivateRelayEmail(identity.Email) {
+		t.Errorf("IsPrivateRelayEmail(%q) = false", identity.Email)
+	}
+
+	if _, err := svc.ValidateIdentityToken(ctx, token, "other-nonce"); err == nil {
+		t.Error("ValidateIdentityToken() should fail with the wrong nonce")
+	}
+	other, err := key.Sign(appleTestClaims("com.other.app", ""))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := svc.ValidateIdentityToken(ctx, other, ""); err == nil {
+		t.Error("ValidateIdentityToken() should fail for another app's token")
+	}
+}
+
+func TestAppleService_ApplyCallbackUser(t *testing.T) {
+	svc, _ := newTestAppleService(t, newTestGoogleJWKS(t))
+
+	identity := &ExternalIdentity{}
+	svc.ApplyCallbackUser(identity, `{"name":{"firstName":"Jane","lastName":"Appleseed"},"email":"jane@example.com"}`)
+	if identity.Name != "Jane Appleseed" {
+		t.Errorf("Name = %q, want %q", identity.Name, "Jane Appleseed")
+	}
+
+	// Later logins carry no user; malformed input is ignored
+	identity = &ExternalIdentity{}
+	svc.ApplyCallbackUser(identity, "")
+	svc.ApplyCallbackUser(identity, "{not json")
+	if identity.Name != "" {
+		t.Errorf("Name = %q, want empty", identity.Name)
+	}
+}
+
+func TestIsPrivateRelayEmail(t *testing.T) {
+	tests := map[string]bool{
+		"x7k2@privaterelay.appleid.com":    true,
+		"X7K2@PrivateRelay.AppleID.com":    true,
+		"user@example.com":                 false,
+		"user@notprivaterelay.appleid.com": false,
+	}
+	for email, want := range tests {
+		if got := IsPrivateRelayEmail(email); got != want {
+			t.Errorf("IsPrivateRelayEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
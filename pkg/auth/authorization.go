@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// authorizationCodeTTL is how long an authorization code can be redeemed.
+const authorizationCodeTTL = 5 * time.Minute
+
+// AuthorizationRequest is a validated request to the authorization endpoint.
+type AuthorizationRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scope         string // Space-separated; "openid" adds an ID token
+	Nonce         string
+	CodeChallenge string // PKCE S256 challenge
+}
+
+// AuthorizationTokens are the tokens issued for an authorization code.
+type AuthorizationTokens struct {
+	Tokens  *domain.TokenPair
+	IDToken string // Set if the "openid" scope was requested
+	Scope   string
+}
+
+// authorizationGrant is what an authorization code was issued for, kept in
+// the metadata of its token.
+type authorizationGrant struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	AuthTime      int64  `json:"auth_time"`
+	MFAVerified   bool   `json:"mfa_verified"`
+}
+
+// AuthorizationService implements the authorization code grant with PKCE for
+// registered clients, so apps can log users in through simple-idm as an
+// OpenID Connect provider. Users sign in with the usual login flows; the
+// code is then exchanged for a session from SessionService and an ID token.
+type AuthorizationService struct {
+	clients  *repository.OAuthClientsRepository
+	tokens   *repository.VerificationTokensRepository
+	users    *repository.UsersRepository
+	sessions *SessionService
+}
+
+// NewAuthorizationService creates a new authorization service. It returns
+// domain.ErrSymmetricSigningKey unless sessions signs tokens with an
+// asymmetric key, since clients could not verify its ID tokens otherwise.
+func NewAuthorizationService(
+	clients *repository.OAuthClientsRepository,
+	tokens *repository.VerificationTokensRepository,
+	users *repository.UsersRepository,
+	sessions *SessionService,
+) (*AuthorizationService, error) {
+	if _, err := sessions.idTokenKey(context.Background()); err != nil {
+		return nil, err
+	}
+	return &AuthorizationService{
+		clients:  clients,
+		tokens:   tokens,
+		users:    users,
+		sessions: sessions,
+	}, nil
+}
+
+// ValidateClient returns the client of an authorization request. Unknown and
+// revoked clients return domain.ErrInvalidClient, and redirect URIs the
+// client has not registered return domain.ErrInvalidRedirectURI. Users must
+// not be sent back to the redirect URI in either case.
+func (s *AuthorizationService) ValidateClient(ctx context.Context, clientID, redirectURI string) (*domain.OAuthClient, error) {
+	client, err := s.clients.GetByID(ctx, clientID)
+	if errors.Is(err, domain.ErrOAuthClientNotFound) {
+		return nil, domain.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsActive() {
+		return nil, domain.ErrInvalidClient
+	}
+	if !client.AllowsRedirectURI(redirectURI) {
+		return nil, domain.ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+// CreateCode issues an authorization code for userID, who signed in at
+// authTime. mfaVerified carries over to the session the code is exchanged for.
+func (s *AuthorizationService) CreateCode(ctx context.Context, userID uuid.UUID, req AuthorizationRequest, authTime time.Time, mfaVerified bool) (string, error) {
+	if req.CodeChallenge == "" {
+		return "", errors.New("code challenge is required")
+	}
+
+	rawCode, err := GenerateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	metadata, err := json.Marshal(authorizationGrant{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      authTime.Unix(),
+		MFAVerified:   mfaVerified,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	// Earlier unredeemed codes stay valid: the user may be signing in to
+	// several clients at once, and codes are single-use and short-lived.
+	now := time.Now()
+	token := &domain.VerificationToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: HashToken(rawCode),
+		Kind:      domain.TokenKindOAuthCode,
+		CreatedAt: now,
+		ExpiresAt: now.Add(authorizationCodeTTL),
+		Metadata:  metadata,
+	}
+	if err := s.tokens.Create(ctx, token); err != nil {
+		return "", fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	slog.Info("AuthorizationService.CreateCode: authorization code issued",
+		"client_id", req.ClientID,
+		"user_id", userID,
+	)
+	return rawCode, nil
+}
+
+// ExchangeCode redeems an authorization code for client. The redirect URI
+// must be the one the code was issued for, and codeVerifier must match its
+// PKCE challenge. Codes can be redeemed once; every failure returns
+// domain.ErrInvalidGrant.
+func (s *AuthorizationService) ExchangeCode(ctx context.Context, client *domain.OAuthClient, code, redirectURI, codeVerifier string, opts IssueSessionOpts) (*AuthorizationTokens, error) {
+	token, err := s.tokens.GetByTokenHash(ctx, HashToken(code), domain.TokenKindOAuthCode)
+	if errors.Is(err, domain.ErrVerificationTokenNotFound) {
+		return nil, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var grant authorizationGrant
+	if err := json.Unmarshal(token.Metadata, &grant); err != nil {
+		return nil, domain.ErrInvalidGrant
+	}
+	if !token.IsValid() || grant.ClientID != client.ID || grant.RedirectURI != redirectURI {
+		slog.Warn("AuthorizationService.ExchangeCode: code rejected",
+			"client_id", client.ID,
+			"code_client_id", grant.ClientID,
+			"consumed", token.ConsumedAt != nil,
+		)
+		return nil, domain.ErrInvalidGrant
+	}
+	if codeVerifier == "" || !constantTimeCompare([]byte(CodeChallengeS256(codeVerifier)), []byte(grant.CodeChallenge)) {
+		slog.Warn("AuthorizationService.ExchangeCode: code verifier does not match", "client_id", client.ID)
+		return nil, domain.ErrInvalidGrant
+	}
+
+	if err := s.tokens.MarkConsumed(ctx, token.ID); err != nil {
+		if errors.Is(err, domain.ErrVerificationTokenNotFound) {
+			return nil, domain.ErrInvalidGrant
+		}
+		return nil, err
+	}
+
+	opts.MFAVerified = grant.MFAVerified
+	opts.ClientID = client.ID
+	tokens, err := s.sessions.IssueSession(ctx, token.UserID, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &AuthorizationTokens{Tokens: tokens, Scope: grant.Scope}
+
+	scopes := strings.Fields(grant.Scope)
+	if hasScope(scopes, "openid") {
+		user, err := s.users.GetByID(ctx, token.UserID)
+		if err != nil {
+			return nil, err
+		}
+		result.IDToken, err = s.sessions.IssueIDToken(ctx, IDTokenInput{
+			User:     user,
+			ClientID: client.ID,
+			Nonce:    grant.Nonce,
+			AuthTime: time.Unix(grant.AuthTime, 0),
+			Scopes:   scopes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("AuthorizationService.ExchangeCode: code exchanged",
+		"client_id", client.ID,
+		"user_id", token.UserID,
+		"id_token", result.IDToken != "",
+	)
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestSessionService_IssueClientToken(t *testing.T) {
+	service := NewSessionService(SessionConfig{
+		JWTSecret: []byte("test-secret-key-32-characters-lo"),
+		Issuer:    "https://idm.example.com",
+	}, nil, nil)
+	ctx := context.Background()
+	client := &domain.OAuthClient{
+		ID:     uuid.NewString(),
+		Scopes: []string{"invoices:read", "invoices:write"},
+		Roles:  []string{"billing"},
+	}
+
+	token, err := service.IssueClientToken(ctx, client, []string{"invoices:read"})
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+	if token.Scope != "invoices:read" || token.ExpiresIn != int(DefaultClientTokenTTL.Seconds()) {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	claims, err := service.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if !claims.IsClient() || claims.Subject != client.ID || len(claims.Roles) != 1 || claims.Roles[0] != "billing" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if _, err := service.GetUserIDFromToken(token.AccessToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("GetUserIDFromToken error = %v, want ErrInvalidToken", err)
+	}
+
+	introspection, err := service.IntrospectToken(ctx, token.AccessToken, client.ID)
+	if err != nil {
+		t.Fatalf("IntrospectToken: %v", err)
+	}
+	if !introspection.Active || introspection.ClientID != client.ID || introspection.Scope != "invoices:read" {
+		t.Errorf("unexpected introspection %+v", introspection)
+	}
+
+	// Without a scope parameter, the token gets every allowed scope
+	token, err = service.IssueClientToken(ctx, client, nil)
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+	if token.Scope != "invoices:read invoices:write" {
+		t.Errorf("Scope = %q", token.Scope)
+	}
+
+	if _, err := service.IssueClientToken(ctx, client, []string{"invoices:read", "users:read"}); !errors.Is(err, domain.ErrInvalidScope) {
+		t.Errorf("error = %v, want ErrInvalidScope", err)
+	}
+}
+
+// recordingIssuer signs tokens with key and keeps the last input it got.
+type recordingIssuer struct {
+	key   *SigningKey
+	input AccessTokenIssueInput
+}
+
+func (i *recordingIssuer) IssueAccessToken(ctx context.Context, input AccessTokenIssueInput) (string, error) {
+	i.input = input
+	subject := input.ClientID
+	if input.User != nil {
+		subject = input.User.ID.String()
+	}
+	return i.key.Sign(AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(input.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(input.ExpiresAt),
+			Issuer:    input.Issuer,
+			ID:        input.SessionID.String(),
+		},
+		Roles:    input.Roles,
+		ClientID: input.ClientID,
+		Scope:    input.Scope,
+	})
+}
+
+func TestSessionService_IssueClientTokenWithCustomIssuer(t *testing.T) {
+	secret := []byte("test-secret-key-32-characters-lo")
+	issuer := &recordingIssuer{key: NewHMACSigningKey("", secret)}
+	service := NewSessionService(SessionConfig{JWTSecret: secret, AccessTokenIssuer: issuer}, nil, nil)
+	client := &domain.OAuthClient{
+		ID:     uuid.NewString(),
+		Scopes: []string{"invoices:read"},
+		Roles:  []string{"billing"},
+	}
+
+	token, err := service.IssueClientToken(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+	if issuer.input.ClientID != client.ID || issuer.input.User != nil || issuer.input.Scope != "invoices:read" {
+		t.Errorf("issuer got %+v, want the client's token", issuer.input)
+	}
+
+	claims, err := service.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if !claims.IsClient() || claims.Subject != client.ID {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -29,6 +32,57 @@ func HashToken(token string) string {
 	return base64.URLEncoding.EncodeToString(h[:])
 }
 
+// encryptAESGCM encrypts plaintext with AES-256-GCM and returns base64(nonce || ciphertext).
+func encryptAESGCM(key, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptAESGCM reverses encryptAESGCM.
+func decryptAESGCM(key []byte, encrypted string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
+
 // constantTimeCompare compares two byte slices in constant time.
 func constantTimeCompare(a, b []byte) bool {
 	return subtle.ConstantTimeCompare(a, b) == 1
@@ -78,3 +132,25 @@ func decodeArgon2Hash(encoded string) (hash, salt []byte, time, memory uint32, t
 	hash, err = base64.RawStdEncoding.DecodeString(parts[5])
 	return
 }
+
+// sealReplacementToken encrypts a replacement refresh token with a key derived
+// from the token it replaces, so only a holder of that token can recover it.
+func sealReplacementToken(refreshToken, replacementToken string) (string, error) {
+	return encryptAESGCM(replacementTokenKey(refreshToken), []byte(replacementToken))
+}
+
+// openReplacementToken reverses sealReplacementToken.
+func openReplacementToken(refreshToken, sealed string) (string, error) {
+	plaintext, err := decryptAESGCM(replacementTokenKey(refreshToken), sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// replacementTokenKey derives the AES-256 key for sealReplacementToken. It is
+// domain-separated from HashToken, which is what the database stores.
+func replacementTokenKey(refreshToken string) []byte {
+	key := sha256.Sum256([]byte("simple-idm replacement token:" + refreshToken))
+	return key[:]
+}
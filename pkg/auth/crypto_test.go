@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -185,3 +186,25 @@ func BenchmarkVerifyPassword(b *testing.B) {
 		VerifyPassword(password, hash)
 	}
 }
+
+func TestSealReplacementToken(t *testing.T) {
+	sealed, err := sealReplacementToken("old-token", "new-token")
+	if err != nil {
+		t.Fatalf("sealReplacementToken() error = %v", err)
+	}
+	if strings.Contains(sealed, "new-token") {
+		t.Error("sealed token should not contain the replacement in clear text")
+	}
+
+	opened, err := openReplacementToken("old-token", sealed)
+	if err != nil {
+		t.Fatalf("openReplacementToken() error = %v", err)
+	}
+	if opened != "new-token" {
+		t.Errorf("openReplacementToken() = %q, want %q", opened, "new-token")
+	}
+
+	if _, err := openReplacementToken("other-token", sealed); err == nil {
+		t.Error("openReplacementToken() should fail with a different refresh token")
+	}
+}
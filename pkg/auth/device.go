@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	// deviceCodeTTL is how long a user has to approve a device.
+	deviceCodeTTL = 10 * time.Minute
+
+	// DevicePollInterval is how long devices wait between polls. Faster
+	// polls get domain.ErrSlowDown.
+	DevicePollInterval = 5 * time.Second
+
+	// userCodeAlphabet has no vowels, so user codes never spell words, and
+	// no digits that look like letters (RFC 8628 section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLen      = 8
+)
+
+// DeviceAuthorizationStart is what a device shows its user after starting
+// the device authorization grant.
+type DeviceAuthorizationStart struct {
+	DeviceCode string // Kept by the device to poll with
+	UserCode   string // Entered by the user, e.g. "WDJB-MJHT"
+	ExpiresIn  int    // Seconds
+	Interval   int    // Seconds between polls
+}
+
+// DeviceRequest describes a pending device authorization to the user asked
+// to approve it.
+type DeviceRequest struct {
+	ClientName string
+	Scope      string
+}
+
+// DeviceService implements the device authorization grant (RFC 8628) for
+// registered clients, such as command line tools, that cannot open a
+// browser themselves. The user approves the device in a browser where they
+// are signed in, and the device gets a session from SessionService.
+type DeviceService struct {
+	devices  *repository.OAuthDeviceCodesRepository
+	clients  *repository.OAuthClientsRepository
+	sessions *SessionService
+}
+
+// NewDeviceService creates a new device authorization service.
+func NewDeviceService(
+	devices *repository.OAuthDeviceCodesRepository,
+	clients *repository.OAuthClientsRepository,
+	sessions *SessionService,
+) *DeviceService {
+	return &DeviceService{
+		devices:  devices,
+		clients:  clients,
+		sessions: sessions,
+	}
+}
+
+// Start begins a device authorization for client.
+func (s *DeviceService) Start(ctx context.Context, client *domain.OAuthClient, scope string) (*DeviceAuthorizationStart, error) {
+	deviceCode, err := GenerateToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device code: %w", err)
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate user code: %w", err)
+	}
+
+	now := time.Now()
+	auth := &domain.DeviceAuthorization{
+		ID:             uuid.New(),
+		DeviceCodeHash: HashToken(deviceCode),
+		UserCodeHash:   HashToken(userCode),
+		ClientID:       client.ID,
+		Scope:          scope,
+		Status:         domain.DeviceAuthorizationPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(deviceCodeTTL),
+	}
+	if err := s.devices.Create(ctx, auth); err != nil {
+		return nil, fmt.Errorf("failed to create device authorization: %w", err)
+	}
+
+	slog.Info("DeviceService.Start: device authorization started", "client_id", client.ID)
+	return &DeviceAuthorizationStart{
+		DeviceCode: deviceCode,
+		UserCode:   userCode[:userCodeLen/2] + "-" + userCode[userCodeLen/2:],
+		ExpiresIn:  int(deviceCodeTTL.Seconds()),
+		Interval:   int(DevicePollInterval.Seconds()),
+	}, nil
+}
+
+// Lookup returns the pending request for a user code, so the user can see
+// which client they are approving. Unknown, expired and already resolved
+// codes return domain.ErrDeviceCodeNotFound.
+func (s *DeviceService) Lookup(ctx context.Context, userCode string) (*DeviceRequest, error) {
+	auth, err := s.pending(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.clients.GetByID(ctx, auth.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceRequest{ClientName: client.Name, Scope: auth.Scope}, nil
+}
+
+// Approve lets the device waiting on userCode sign in as userID.
+// mfaVerified carries over to the session the device gets.
+func (s *DeviceService) Approve(ctx context.Context, userCode string, userID uuid.UUID, mfaVerified bool) error {
+	auth, err := s.pending(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	if err := s.devices.Approve(ctx, auth.ID, userID, mfaVerified); err != nil {
+		return err
+	}
+	slog.Info("DeviceService.Approve: device approved",
+		"client_id", auth.ClientID,
+		"user_id", userID,
+	)
+	return nil
+}
+
+// Deny rejects the device waiting on userCode.
+func (s *DeviceService) Deny(ctx context.Context, userCode string) error {
+	auth, err := s.pending(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	if err := s.devices.Deny(ctx, auth.ID); err != nil {
+		return err
+	}
+	slog.Info("DeviceService.Deny: device denied", "client_id", auth.ClientID)
+	return nil
+}
+
+// Exchange is polled by a device with its device code. Until the user acts
+// it returns domain.ErrAuthorizationPending, or domain.ErrSlowDown if the
+// device polls faster than DevicePollInterval; then the session, once, or
+// domain.ErrAccessDenied. Expired codes return domain.ErrExpiredToken, and
+// unknown codes or codes of another client domain.ErrInvalidGrant.
+func (s *DeviceService) Exchange(ctx context.Context, client *domain.OAuthClient, deviceCode string, opts IssueSessionOpts) (*domain.TokenPair, error) {
+	auth, err := s.devices.Poll(ctx, HashToken(deviceCode))
+	if errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		return nil, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	if auth.ClientID != client.ID {
+		slog.Warn("DeviceService.Exchange: device code of another client",
+			"client_id", client.ID,
+			"code_client_id", auth.ClientID,
+		)
+		return nil, domain.ErrInvalidGrant
+	}
+	if auth.IsExpired() {
+		return nil, domain.ErrExpiredToken
+	}
+
+	switch auth.Status {
+	case domain.DeviceAuthorizationPending:
+		if auth.LastPolledAt != nil && time.Since(*auth.LastPolledAt) < DevicePollInterval {
+			return nil, domain.ErrSlowDown
+		}
+		return nil, domain.ErrAuthorizationPending
+	case domain.DeviceAuthorizationDenied:
+		if err := s.devices.Delete(ctx, auth.ID); err != nil && !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+			return nil, err
+		}
+		return nil, domain.ErrAccessDenied
+	}
+
+	// Approved: only one poll gets the session
+	if err := s.devices.Delete(ctx, auth.ID); err != nil {
+		if errors.Is(err, domain.ErrDeviceCodeNotFound) {
+			return nil, domain.ErrInvalidGrant
+		}
+		return nil, err
+	}
+	if auth.UserID == nil {
+		return nil, domain.ErrInvalidGrant
+	}
+
+	opts.MFAVerified = auth.MFAVerified
+	opts.ClientID = client.ID
+	tokens, err := s.sessions.IssueSession(ctx, *auth.UserID, opts)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("DeviceService.Exchange: device signed in",
+		"client_id", client.ID,
+		"user_id", *auth.UserID,
+	)
+	return tokens, nil
+}
+
+// pending returns the pending request for a user code as typed by a user.
+func (s *DeviceService) pending(ctx context.Context, userCode string) (*domain.DeviceAuthorization, error) {
+	normalized := normalizeUserCode(userCode)
+	if len(normalized) != userCodeLen {
+		return nil, domain.ErrDeviceCodeNotFound
+	}
+	return s.devices.GetPendingByUserCode(ctx, HashToken(normalized))
+}
+
+// generateUserCode returns userCodeLen random characters of userCodeAlphabet.
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLen)
+	buf := make([]byte, userCodeLen*2)
+	for len(code) < userCodeLen {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// Rejecting the top of the byte range keeps characters uniform
+			if int(b) >= 256-256%len(userCodeAlphabet) {
+				continue
+			}
+			code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			if len(code) == userCodeLen {
+				break
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode uppercases a user code and drops the dash and any
+// spaces users type along with it.
+func normalizeUserCode(userCode string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(userCode) {
+		if c != '-' && c != ' ' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateUserCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatalf("generateUserCode: %v", err)
+		}
+		if len(code) != userCodeLen {
+			t.Fatalf("len(%q) = %d, want %d", code, len(code), userCodeLen)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("code %q has %q outside the user code alphabet", code, c)
+			}
+		}
+	}
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	tests := map[string]string{
+		"WDJB-MJHT":   "WDJBMJHT",
+		"wdjb-mjht":   "WDJBMJHT",
+		" WDJB MJHT ": "WDJBMJHT",
+		"WDJBMJHT":    "WDJBMJHT",
+	}
+	for input, want := range tests {
+		if got := normalizeUserCode(input); got != want {
+			t.Errorf("normalizeUserCode(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// ExternalIdentity is a user as asserted by an external identity provider.
+type ExternalIdentity struct {
+	Provider      string // user_identities.provider, e.g. "google" or "okta"
+	Subject       string // Stable user ID at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// externalAccounts finds or creates the local user behind an external identity.
+type externalAccounts struct {
+	db         *sql.DB
+	users      *repository.UsersRepository
+	identities *repository.IdentitiesRepository
+	tokens     *repository.VerificationTokensRepository // Pending links
+	policy     AccountLinkPolicy
+}
+
+func newExternalAccounts(db *sql.DB, users *repository.UsersRepository, identities *repository.IdentitiesRepository, policy AccountLinkPolicy) externalAccounts {
+	return externalAccounts{
+		db:         db,
+		users:      users,
+		identities: identities,
+		tokens:     repository.NewVerificationTokensRepository(db),
+		policy:     policy,
+	}
+}
+
+// authenticate returns the user linked to the identity. An unknown identity
+// whose email the provider verified belongs to the user with that email, and
+// is linked to them as the account link policy allows; otherwise a new user
+// is created.
+func (a *externalAccounts) authenticate(ctx context.Context, ext *ExternalIdentity) (uuid.UUID, error) {
+	if ext.Subject == "" {
+		return uuid.Nil, domain.ErrInvalidToken
+	}
+	if ext.Email == "" {
+		return uuid.Nil, domain.ErrInvalidEmail
+	}
+
+	// 1. Check if identity already exists
+	identity, err := a.identities.GetByProviderSubject(ctx, ext.Provider, ext.Subject)
+	if err == nil {
+		// Identity exists, return linked user
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return uuid.Nil, err
+	}
+
+	// 2. Check if user exists by email (for auto-linking)
+	user, err := a.users.GetByEmail(ctx, ext.Email)
+	if err == nil && ext.EmailVerified {
+		switch a.policy {
+		case AccountLinkNever:
+			return uuid.Nil, domain.ErrAccountLinkNotAllowed
+		case AccountLinkRequireConfirmation:
+			return uuid.Nil, a.requireConfirmation(ctx, user, ext)
+		}
+
+		// User exists and the provider verified the email - link identity
+		identity := &domain.UserIdentity{
+			ID:              uuid.New(),
+			UserID:          user.ID,
+			Provider:        ext.Provider,
+			ProviderSubject: ext.Subject,
+			Email:           &ext.Email,
+			CreatedAt:       time.Now(),
+		}
+		if err := a.identities.Create(ctx, identity); err != nil {
+			return uuid.Nil, err
+		}
+		return user.ID, nil
+	}
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return uuid.Nil, err
+	}
+
+	// 3. Create new user and link identity
+	now := time.Now()
+	newUser := &domain.User{
+		ID:            uuid.New(),
+		Email:         ext.Email,
+		EmailVerified: ext.EmailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if ext.Name != "" {
+		newUser.Name = &ext.Name
+	}
+
+	newIdentity := &domain.UserIdentity{
+		ID:              uuid.New(),
+		UserID:          newUser.ID,
+		Provider:        ext.Provider,
+		ProviderSubject: ext.Subject,
+		Email:           &ext.Email,
+		CreatedAt:       now,
+	}
+
+	err = repository.Tx(ctx, a.db, func(tx *sql.Tx) error {
+		if err := a.users.CreateTx(ctx, tx, newUser); err != nil {
+			return err
+		}
+		return a.identities.CreateTx(ctx, tx, newIdentity)
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return newUser.ID, nil
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	githubBaseURL = "https://github.com"
+	githubAPIURL  = "https://api.github.com"
+	githubScopes  = "read:user user:email"
+)
+
+// GitHubConfig holds GitHub OAuth configuration.
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	BaseURL      string // default: https://github.com; set for GitHub Enterprise Server or tests
+	APIURL       string // default: https://api.github.com (GitHub Enterprise Server: <BaseURL>/api/v3)
+
+	AccountLinking AccountLinkPolicy // Linking to existing users by email (default: auto)
+}
+
+// GitHubService handles GitHub OAuth authentication. GitHub is plain OAuth 2.0
+// without ID tokens, so the user is read from the REST API after the code
+// exchange.
+type GitHubService struct {
+	config     GitHubConfig
+	accounts   externalAccounts
+	httpClient *http.Client
+}
+
+// NewGitHubService creates a new GitHub service.
+func NewGitHubService(
+	config GitHubConfig,
+	db *sql.DB,
+	users *repository.UsersRepository,
+	identities *repository.IdentitiesRepository,
+) *GitHubService {
+	if config.BaseURL == "" {
+		config.BaseURL = githubBaseURL
+	}
+	if config.APIURL == "" {
+		config.APIURL = githubAPIURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	config.APIURL = strings.TrimSuffix(config.APIURL, "/")
+	return &GitHubService{
+		config:     config,
+		accounts:   newExternalAccounts(db, users, identities, config.AccountLinking),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the provider name stored in user_identities.
+func (s *GitHubService) Name() string {
+	return domain.ProviderGitHub
+}
+
+// AuthURL returns the GitHub authorization URL with the PKCE challenge for
+// codeVerifier. GitHub has no ID token, so the nonce is not used.
+func (s *GitHubService) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	params := url.Values{
+		"client_id":    {s.config.ClientID},
+		"redirect_uri": {s.config.RedirectURI},
+		"scope":        {githubScopes},
+		"state":        {state},
+	}
+	if codeVerifier != "" {
+		params.Set("code_challenge", CodeChallengeS256(codeVerifier))
+		params.Set("code_challenge_method", "S256")
+	}
+	return s.config.BaseURL + "/login/oauth/authorize?" + params.Encode(), nil
+}
+
+// githubTokenResponse is GitHub's access token response. Errors are reported
+// with status 200 and the error fields set.
+type githubTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeCode exchanges an authorization code for a GitHub access token.
+func (s *GitHubService) ExchangeCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	data := url.Values{
+		"code":          {code},
+		"client_id":     {s.config.ClientID},
+		"client_secret": {s.config.ClientSecret},
+		"redirect_uri":  {s.config.RedirectURI},
+	}
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.config.BaseURL+"/login/oauth/access_token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseBytes))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange failed: %s", string(body))
+	}
+
+	var tokenResp githubTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Error != "" {
+		return "", fmt.Errorf("token exchange failed: %s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", errors.New("token exchange failed: no access token")
+	}
+	return tokenResp.AccessToken, nil
+}
+
+// githubUser is the part of GET /user we use.
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// githubEmail is an entry of GET /user/emails.
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// FetchIdentity reads the user behind an access token from the GitHub API.
+// The email is the account's primary email, which must be verified; the
+// public profile email is not used because GitHub does not verify it.
+func (s *GitHubService) FetchIdentity(ctx context.Context, accessToken string) (*ExternalIdentity, error) {
+	var user githubUser
+	if err := s.getJSON(ctx, accessToken, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("GitHub user has no ID")
+	}
+
+	var emails []githubEmail
+	if err := s.getJSON(ctx, accessToken, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	var primary string
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			primary = e.Email
+			break
+		}
+	}
+	if primary == "" {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	return &ExternalIdentity{
+		Provider:      domain.ProviderGitHub,
+		Subject:       strconv.FormatInt(user.ID, 10), // Logins can be renamed; IDs are stable
+		Email:         primary,
+		EmailVerified: true,
+		Name:          name,
+	}, nil
+}
+
+// getJSON calls a GitHub API endpoint with the user's access token.
+func (s *GitHubService) getJSON(ctx context.Context, accessToken, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "simple-idm")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("GitHub API %s failed with status %d: %s", path, resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// Identify exchanges the code from a login callback and returns the GitHub user.
+func (s *GitHubService) Identify(ctx context.Context, code, nonce, codeVerifier string) (*ExternalIdentity, error) {
+	accessToken, err := s.ExchangeCode(ctx, code, codeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrCodeExchangeFailed, err)
+	}
+	return s.FetchIdentity(ctx, accessToken)
+}
+
+// Authenticate returns the user linked to a GitHub identity. It either finds
+// an existing user or creates a new one, as GoogleService.Authenticate does.
+func (s *GitHubService) Authenticate(ctx context.Context, identity *ExternalIdentity) (uuid.UUID, error) {
+	return s.accounts.authenticate(ctx, identity)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// newTestGitHub serves GitHub's token endpoint and user API with the given emails.
+func newTestGitHub(t *testing.T, emails []githubEmail) *GitHubService {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("client_secret") != "gh-secret" || r.PostForm.Get("code_verifier") != "verifier-1" {
+			// GitHub reports errors with status 200
+			_ = json.NewEncoder(w).Encode(githubTokenResponse{Error: "bad_verification_code"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(githubTokenResponse{AccessToken: "gho_test", TokenType: "bearer"})
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(githubUser{ID: 583231, Login: "octocat"})
+	})
+	mux.HandleFunc("GET /user/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(emails)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return NewGitHubService(GitHubConfig{
+		ClientID:     "gh-client",
+		ClientSecret: "gh-secret",
+		RedirectURI:  "https://idm.example.com/v1/auth/github/callback",
+		BaseURL:      server.URL,
+		APIURL:       server.URL,
+	}, nil, nil, nil)
+}
+
+func TestGitHubService_AuthURL(t *testing.T) {
+	svc := NewGitHubService(GitHubConfig{ClientID: "gh-client", RedirectURI: "https://idm.example.com/cb"}, nil, nil, nil)
+
+	authURL, err := svc.AuthURL(context.Background(), "state-1", "", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Host != "github.com" || u.Path != "/login/oauth/authorize" {
+		t.Errorf("unexpected endpoint %s", authURL)
+	}
+	if q := u.Query(); q.Get("client_id") != "gh-client" || q.Get("state") != "state-1" || q.Get("scope") != githubScopes {
+		t.Errorf("unexpected query %v", q)
+	}
+	if q := u.Query(); q.Get("code_challenge") != CodeChallengeS256("verifier-1") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("missing PKCE challenge in %v", q)
+	}
+}
+
+func TestGitHubService_Identify(t *testing.T) {
+	svc := newTestGitHub(t, []githubEmail{
+		{Email: "octocat@users.noreply.github.com", Verified: true},
+		{Email: "octocat@example.com", Primary: true, Verified: true},
+	})
+
+	identity, err := svc.Identify(context.Background(), "good-code", "", "verifier-1")
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	want := ExternalIdentity{
+		Provider:      domain.ProviderGitHub,
+		Subject:       "583231",
+		Email:         "octocat@example.com",
+		EmailVerified: true,
+		Name:          "octocat",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestGitHubService_IdentifyBadCode(t *testing.T) {
+	svc := newTestGitHub(t, nil)
+
+	_, err := svc.Identify(context.Background(), "bad-code", "", "verifier-1")
+	if !errors.Is(err, domain.ErrCodeExchangeFailed) {
+		t.Errorf("Identify() error = %v, want %v", err, domain.ErrCodeExchangeFailed)
+	}
+}
+
+func TestGitHubService_IdentifyRequiresVerifiedPrimaryEmail(t *testing.T) {
+	svc := newTestGitHub(t, []githubEmail{
+		{Email: "octocat@example.com", Primary: true, Verified: false},
+		{Email: "other@example.com", Verified: true},
+	})
+
+	_, err := svc.Identify(context.Background(), "good-code", "", "verifier-1")
+	if !errors.Is(err, domain.ErrEmailNotVerified) {
+		t.Errorf("Identify() error = %v, want %v", err, domain.ErrEmailNotVerified)
+	}
+}
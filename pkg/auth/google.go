@@ -4,13 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"strings"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -19,19 +14,23 @@ import (
 )
 
 const (
-	googleAuthURL     = "https://accounts.google.com/o/oauth2/v2/auth"
-	googleTokenURL    = "https://oauth2.googleapis.com/token"
-	googleJWKSURL     = "https://www.googleapis.com/oauth2/v3/certs"
-	googleIssuer      = "https://accounts.google.com"
-	googleIssuerAlt   = "accounts.google.com"
+	googleAuthURL   = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL  = "https://oauth2.googleapis.com/token"
+	googleJWKSURL   = "https://www.googleapis.com/oauth2/v3/certs"
+	googleIssuer    = "https://accounts.google.com"
+	googleIssuerAlt = "accounts.google.com"
 )
 
 // GoogleConfig holds Google OAuth configuration.
 type GoogleConfig struct {
-	ClientID       string
-	ClientSecret   string
-	RedirectURI    string
+	ClientID        string
+	ClientSecret    string
+	RedirectURI     string
 	MobileClientIDs []string
+	JWKSURL         string   // Keys verifying ID tokens (default: Google's; override in tests)
+	HostedDomains   []string // Google Workspace domains allowed to log in, matched against the "hd" claim (default: any account)
+
+	AccountLinking AccountLinkPolicy // Linking to existing users by email (default: auto)
 }
 
 // GoogleClaims represents the claims from a Google ID token.
@@ -41,15 +40,15 @@ type GoogleClaims struct {
 	EmailVerified bool   `json:"email_verified"`
 	Name          string `json:"name"`
 	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce,omitempty"`
+	HostedDomain  string `json:"hd,omitempty"` // Workspace domain; empty for consumer accounts
 }
 
-// GoogleService handles Google OAuth authentication.
+// GoogleService handles Google OAuth authentication. Google is an OpenID
+// Connect provider with fixed endpoints, so no discovery is needed.
 type GoogleService struct {
-	config     GoogleConfig
-	db         *sql.DB
-	users      *repository.UsersRepository
-	identities *repository.IdentitiesRepository
-	httpClient *http.Client
+	config   GoogleConfig
+	provider *OIDCProvider
 }
 
 // NewGoogleService creates a new Google service.
@@ -59,193 +58,114 @@ func NewGoogleService(
 	users *repository.UsersRepository,
 	identities *repository.IdentitiesRepository,
 ) *GoogleService {
+	if config.JWKSURL == "" {
+		config.JWKSURL = googleJWKSURL
+	}
+	authParams := map[string]string{
+		"access_type": "offline",
+		"prompt":      "consent",
+	}
+	// hd only narrows Google's account chooser: "*" offers Workspace
+	// accounts of any domain. The claim is what is enforced.
+	switch len(config.HostedDomains) {
+	case 0:
+	case 1:
+		authParams["hd"] = config.HostedDomains[0]
+	default:
+		authParams["hd"] = "*"
+	}
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:           domain.ProviderGoogle,
+		Issuer:         googleIssuer,
+		ClientID:       config.ClientID,
+		ClientSecret:   config.ClientSecret,
+		RedirectURI:    config.RedirectURI,
+		ExtraAudiences: config.MobileClientIDs,
+		AuthParams:     authParams,
+		AccountLinking: config.AccountLinking,
+	}, db, users, identities)
+	provider.issuers = append(provider.issuers, googleIssuerAlt)
+	if len(config.HostedDomains) > 0 {
+		provider.checkClaims = config.checkHostedDomain
+	}
+	provider.setMetadata(&OIDCProviderMetadata{
+		Issuer:                   googleIssuer,
+		AuthorizationEndpoint:    googleAuthURL,
+		TokenEndpoint:            googleTokenURL,
+		JWKSURI:                  config.JWKSURL,
+		IDTokenSigningAlgs:       []string{"RS256"},
+		TokenEndpointAuthMethods: []string{"client_secret_post"},
+	})
 	return &GoogleService{
-		config:     config,
-		db:         db,
-		users:      users,
-		identities: identities,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		config:   config,
+		provider: provider,
 	}
 }
 
-// OAuthState holds state for OAuth flow.
-type OAuthState struct {
-	State       string
-	Nonce       string
-	RedirectURI string
-	ExpiresAt   time.Time
-}
-
-// GenerateAuthURL generates the Google OAuth authorization URL.
-func (s *GoogleService) GenerateAuthURL(state, nonce string) string {
-	params := url.Values{
-		"client_id":     {s.config.ClientID},
-		"redirect_uri":  {s.config.RedirectURI},
-		"response_type": {"code"},
-		"scope":         {"openid email profile"},
-		"state":         {state},
-		"nonce":         {nonce},
-		"access_type":   {"offline"},
-		"prompt":        {"consent"},
+// checkHostedDomain rejects ID tokens whose "hd" claim is not one of the
+// allowed hosted domains. Consumer accounts have no "hd" claim.
+func (c GoogleConfig) checkHostedDomain(claims jwt.MapClaims) error {
+	hd, _ := claims["hd"].(string)
+	for _, allowed := range c.HostedDomains {
+		if hd != "" && strings.EqualFold(hd, allowed) {
+			return nil
+		}
+	}
+	if hd == "" {
+		return fmt.Errorf("%w: not a Google Workspace account", domain.ErrHostedDomainNotAllowed)
 	}
-	return googleAuthURL + "?" + params.Encode()
+	return fmt.Errorf("%w: %s", domain.ErrHostedDomainNotAllowed, hd)
 }
 
-// GoogleTokenResponse represents the response from Google token endpoint.
-type GoogleTokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	IDToken      string `json:"id_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	TokenType    string `json:"token_type"`
+// Provider returns the OpenID Connect provider Google logins go through.
+func (s *GoogleService) Provider() *OIDCProvider {
+	return s.provider
 }
 
-// ExchangeCode exchanges an authorization code for tokens.
-func (s *GoogleService) ExchangeCode(ctx context.Context, code string) (*GoogleTokenResponse, error) {
-	data := url.Values{
-		"code":          {code},
-		"client_id":     {s.config.ClientID},
-		"client_secret": {s.config.ClientSecret},
-		"redirect_uri":  {s.config.RedirectURI},
-		"grant_type":    {"authorization_code"},
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", googleTokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token exchange failed: %s", string(body))
-	}
+// GenerateAuthURL generates the Google OAuth authorization URL with the PKCE
+// challenge for codeVerifier.
+func (s *GoogleService) GenerateAuthURL(state, nonce, codeVerifier string) string {
+	// Google's endpoints are fixed, so this cannot fail
+	authURL, _ := s.provider.AuthURL(context.Background(), state, nonce, codeVerifier)
+	return authURL
+}
 
-	var tokenResp GoogleTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, err
-	}
+// GoogleTokenResponse represents the response from Google token endpoint.
+type GoogleTokenResponse = OIDCTokenResponse
 
-	return &tokenResp, nil
+// ExchangeCode exchanges an authorization code for tokens, proving possession
+// of the PKCE verifier the code was requested with.
+func (s *GoogleService) ExchangeCode(ctx context.Context, code, codeVerifier string) (*GoogleTokenResponse, error) {
+	return s.provider.ExchangeCode(ctx, code, codeVerifier)
 }
 
-// ValidateIDToken validates a Google ID token and extracts claims.
-// Note: For production, you should verify the signature using Google's JWKS.
-// This implementation does basic validation; add signature verification for production.
+// ValidateIDToken verifies a Google ID token's signature against Google's JWKS
+// and checks its issuer, audience, expiry and, if expectedNonce is set, nonce.
 func (s *GoogleService) ValidateIDToken(ctx context.Context, idToken, expectedNonce string) (*GoogleClaims, error) {
-	// Parse without verification first to get claims
-	// In production, use jwt.Parse with proper key func to verify signature
-	token, _, err := jwt.NewParser().ParseUnverified(idToken, &GoogleClaims{})
+	identity, err := s.provider.ValidateIDToken(ctx, idToken, expectedNonce)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ID token: %w", err)
-	}
-
-	claims, ok := token.Claims.(*GoogleClaims)
-	if !ok {
-		return nil, errors.New("invalid claims type")
-	}
-
-	// Validate issuer
-	if claims.Issuer != googleIssuer && claims.Issuer != googleIssuerAlt {
-		return nil, fmt.Errorf("invalid issuer: %s", claims.Issuer)
+		return nil, err
 	}
 
-	// Validate audience (accept web client ID or any mobile client ID)
-	validAudience := false
-	if len(claims.Audience) > 0 {
-		aud := claims.Audience[0]
-		if aud == s.config.ClientID {
-			validAudience = true
-		} else {
-			for _, mobileID := range s.config.MobileClientIDs {
-				if mobileID != "" && aud == mobileID {
-					validAudience = true
-					break
-				}
-			}
-		}
-	}
-	if !validAudience {
-		return nil, errors.New("invalid audience")
+	raw, err := json.Marshal(identity.Claims)
+	if err != nil {
+		return nil, err
 	}
-
-	// Validate expiration
-	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("token expired")
+	var claims GoogleClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
 	}
-
-	return claims, nil
+	return &claims, nil
 }
 
 // Authenticate handles the Google OAuth callback and returns a user ID.
 // It either finds an existing user or creates a new one.
 func (s *GoogleService) Authenticate(ctx context.Context, claims *GoogleClaims) (uuid.UUID, error) {
-	// 1. Check if identity already exists
-	identity, err := s.identities.GetByProviderSubject(ctx, domain.ProviderGoogle, claims.Subject)
-	if err == nil {
-		// Identity exists, return linked user
-		return identity.UserID, nil
-	}
-	if !errors.Is(err, domain.ErrIdentityNotFound) {
-		return uuid.Nil, err
-	}
-
-	// 2. Check if user exists by email (for auto-linking)
-	user, err := s.users.GetByEmail(ctx, claims.Email)
-	if err == nil && claims.EmailVerified {
-		// User exists and Google email is verified - link identity
-		identity := &domain.UserIdentity{
-			ID:              uuid.New(),
-			UserID:          user.ID,
-			Provider:        domain.ProviderGoogle,
-			ProviderSubject: claims.Subject,
-			Email:           &claims.Email,
-			CreatedAt:       time.Now(),
-		}
-		if err := s.identities.Create(ctx, identity); err != nil {
-			return uuid.Nil, err
-		}
-		return user.ID, nil
-	}
-	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
-		return uuid.Nil, err
-	}
-
-	// 3. Create new user and link identity
-	now := time.Now()
-	newUser := &domain.User{
-		ID:            uuid.New(),
+	return s.provider.accounts.authenticate(ctx, &ExternalIdentity{
+		Provider:      domain.ProviderGoogle,
+		Subject:       claims.Subject,
 		Email:         claims.Email,
 		EmailVerified: claims.EmailVerified,
-		Name:          &claims.Name,
-		CreatedAt:     now,
-		UpdatedAt:     now,
-	}
-
-	newIdentity := &domain.UserIdentity{
-		ID:              uuid.New(),
-		UserID:          newUser.ID,
-		Provider:        domain.ProviderGoogle,
-		ProviderSubject: claims.Subject,
-		Email:           &claims.Email,
-		CreatedAt:       now,
-	}
-
-	err = repository.Tx(ctx, s.db, func(tx *sql.Tx) error {
-		if err := s.users.CreateTx(ctx, tx, newUser); err != nil {
-			return err
-		}
-		return s.identities.CreateTx(ctx, tx, newIdentity)
+		Name:          claims.Name,
 	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	return newUser.ID, nil
 }
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// testGoogleJWKS is a local stand-in for Google's JWKS endpoint.
+type testGoogleJWKS struct {
+	t            *testing.T
+	server       *httptest.Server
+	cacheControl string
+	fetches      atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]*SigningKey
+}
+
+func newTestGoogleJWKS(t *testing.T) *testGoogleJWKS {
+	t.Helper()
+	j := &testGoogleJWKS{t: t, keys: map[string]*SigningKey{}, cacheControl: "public, max-age=3600"}
+	j.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.fetches.Add(1)
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		set := JWKSet{Keys: []JWK{}}
+		for _, key := range j.keys {
+			jwk, _ := key.PublicJWK()
+			set.Keys = append(set.Keys, jwk)
+		}
+		w.Header().Set("Cache-Control", j.cacheControl)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(j.server.Close)
+	return j
+}
+
+// addKey publishes a new RSA key and returns it for signing.
+func (j *testGoogleJWKS) addKey(kid string) *SigningKey {
+	j.t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		j.t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	key, err := NewSigningKey(kid, rsaKey)
+	if err != nil {
+		j.t.Fatalf("NewSigningKey: %v", err)
+	}
+	j.mu.Lock()
+	j.keys[kid] = key
+	j.mu.Unlock()
+	return key
+}
+
+func newTestGoogleService(jwksURL string) *GoogleService {
+	return NewGoogleService(GoogleConfig{
+		ClientID:        "web-client",
+		MobileClientIDs: []string{"ios-client"},
+		JWKSURL:         jwksURL,
+	}, nil, nil, nil)
+}
+
+func googleTestClaims(audience, nonce string) GoogleClaims {
+	return GoogleClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    googleIssuer,
+			Subject:   "google-user-1",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Nonce:         nonce,
+	}
+}
+
+func signGoogleTestToken(t *testing.T, key *SigningKey, claims GoogleClaims) string {
+	t.Helper()
+	token, err := key.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func TestGoogleService_ValidateIDToken(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	key := jwks.addKey("google-1")
+	svc := newTestGoogleService(jwks.server.URL)
+	ctx := context.Background()
+
+	claims, err := svc.ValidateIDToken(ctx, signGoogleTestToken(t, key, googleTestClaims("web-client", "n-1")), "n-1")
+	if err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	if claims.Subject != "google-user-1" || claims.Email != "user@example.com" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// Native apps post ID tokens minted for their own client ID, without a nonce
+	if _, err := svc.ValidateIDToken(ctx, signGoogleTestToken(t, key, googleTestClaims("ios-client", "")), ""); err != nil {
+		t.Errorf("ValidateIDToken(mobile audience): %v", err)
+	}
+}
+
+func TestGoogleService_ValidateIDTokenRejects(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	key := jwks.addKey("google-1")
+	svc := newTestGoogleService(jwks.server.URL)
+
+	// Same kid as a published key, but a different private key
+	forger := newTestGoogleJWKS(t).addKey("google-1")
+
+	expired := googleTestClaims("web-client", "")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	wrongIssuer := googleTestClaims("web-client", "")
+	wrongIssuer.Issuer = "https://evil.example.com"
+
+	hmacToken, err := NewHMACSigningKey("google-1", []byte("test-secret-key-at-least-32-chars")).Sign(googleTestClaims("web-client", ""))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, googleTestClaims("web-client", "")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+	}{
+		{"forged signature", signGoogleTestToken(t, forger, googleTestClaims("web-client", "")), ""},
+		{"unsigned", unsigned, ""},
+		{"HMAC signed", hmacToken, ""},
+		{"expired", signGoogleTestToken(t, key, expired), ""},
+		{"wrong issuer", signGoogleTestToken(t, key, wrongIssuer), ""},
+		{"wrong audience", signGoogleTestToken(t, key, googleTestClaims("other-client", "")), ""},
+		{"wrong nonce", signGoogleTestToken(t, key, googleTestClaims("web-client", "n-1")), "n-2"},
+		{"missing nonce", signGoogleTestToken(t, key, googleTestClaims("web-client", "")), "n-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.ValidateIDToken(context.Background(), tt.token, tt.nonce); err == nil {
+				t.Error("ValidateIDToken() should fail")
+			}
+		})
+	}
+}
+
+func TestGoogleService_HostedDomains(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	key := jwks.addKey("google-1")
+	svc := NewGoogleService(GoogleConfig{
+		ClientID:      "web-client",
+		JWKSURL:       jwks.server.URL,
+		HostedDomains: []string{"example.com", "example.org"},
+	}, nil, nil, nil)
+	ctx := context.Background()
+
+	tokenFor := func(hd string) string {
+		claims := googleTestClaims("web-client", "")
+		claims.HostedDomain = hd
+		return signGoogleTestToken(t, key, claims)
+	}
+
+	for _, hd := range []string{"example.com", "Example.ORG"} {
+		if _, err := svc.ValidateIDToken(ctx, tokenFor(hd), ""); err != nil {
+			t.Errorf("hd=%q: ValidateIDToken: %v", hd, err)
+		}
+	}
+	for _, hd := range []string{"", "evil.example.net"} {
+		if _, err := svc.ValidateIDToken(ctx, tokenFor(hd), ""); !errors.Is(err, domain.ErrHostedDomainNotAllowed) {
+			t.Errorf("hd=%q: ValidateIDToken() error = %v, want ErrHostedDomainNotAllowed", hd, err)
+		}
+	}
+
+	// With several domains, the account chooser offers any Workspace account
+	authURL, err := url.Parse(svc.GenerateAuthURL("state", "nonce", ""))
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	if got := authURL.Query().Get("hd"); got != "*" {
+		t.Errorf("hd = %q, want %q", got, "*")
+	}
+
+	single := NewGoogleService(GoogleConfig{ClientID: "web-client", HostedDomains: []string{"example.com"}}, nil, nil, nil)
+	authURL, _ = url.Parse(single.GenerateAuthURL("state", "nonce", ""))
+	if got := authURL.Query().Get("hd"); got != "example.com" {
+		t.Errorf("hd = %q, want %q", got, "example.com")
+	}
+}
+
+func TestGoogleService_ValidateIDTokenCachesKeys(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	key := jwks.addKey("google-1")
+	svc := newTestGoogleService(jwks.server.URL)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.ValidateIDToken(ctx, signGoogleTestToken(t, key, googleTestClaims("web-client", "")), ""); err != nil {
+			t.Fatalf("ValidateIDToken: %v", err)
+		}
+	}
+	if got := jwks.fetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+
+	// Once max-age has passed the set is fetched again
+	svc.provider.keys.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := svc.ValidateIDToken(ctx, signGoogleTestToken(t, key, googleTestClaims("web-client", "")), ""); err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times after expiry, want 2", got)
+	}
+}
+
+func TestGoogleService_ValidateIDTokenRefreshesOnUnknownKID(t *testing.T) {
+	jwks := newTestGoogleJWKS(t)
+	jwks.addKey("google-1")
+	svc := newTestGoogleService(jwks.server.URL)
+	ctx := context.Background()
+	if _, err := svc.provider.keys.lookup(ctx, "google-1"); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+
+	// Google rotates in a new key; the cached set does not have it yet
+	rotated := jwks.addKey("google-2")
+	svc.provider.keys.now = func() time.Time { return time.Now().Add(remoteJWKSMinRefresh) }
+	if _, err := svc.ValidateIDToken(ctx, signGoogleTestToken(t, rotated, googleTestClaims("web-client", "")), ""); err != nil {
+		t.Fatalf("ValidateIDToken with rotated key: %v", err)
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+
+	// Made-up kids do not trigger another fetch within remoteJWKSMinRefresh
+	if _, err := svc.provider.keys.lookup(ctx, "made-up"); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("lookup(made-up) error = %v, want unknown signing key", err)
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times after unknown kid, want 2", got)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"public, max-age=19204, must-revalidate, no-transform", 19204 * time.Second},
+		{"max-age=0", 0},
+		{"no-store", 0},
+		{"private", time.Hour},
+		{"", time.Hour},
+		{"max-age=abc", time.Hour},
+	}
+	for _, tt := range tests {
+		if got := cacheMaxAge(tt.header, time.Hour); got != tt.want {
+			t.Errorf("cacheMaxAge(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestSessionService_IssueIDToken(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := NewSigningKey("id-key", private)
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+	service := &SessionService{
+		config: SessionConfig{
+			SigningKey:     key,
+			Issuer:         "https://idm.example.com",
+			AccessTokenTTL: 15 * time.Minute,
+		},
+	}
+
+	name := "Ada Lovelace"
+	user := &domain.User{ID: uuid.New(), Email: "ada@example.com", EmailVerified: true, Name: &name}
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	parse := func(t *testing.T, token string) *IDTokenClaims {
+		t.Helper()
+		claims := &IDTokenClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return private.Public(), nil },
+			jwt.WithIssuer("https://idm.example.com"),
+			jwt.WithAudience("web-app"),
+		)
+		if err != nil {
+			t.Fatalf("parse ID token: %v", err)
+		}
+		return claims
+	}
+
+	token, err := service.IssueIDToken(context.Background(), IDTokenInput{
+		User:     user,
+		ClientID: "web-app",
+		Nonce:    "n-0S6_WzA2Mj",
+		AuthTime: authTime,
+		Scopes:   []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("IssueIDToken: %v", err)
+	}
+	claims := parse(t, token)
+	if claims.Subject != user.ID.String() || claims.Nonce != "n-0S6_WzA2Mj" || claims.AuthTime != authTime.Unix() {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if claims.Email != "ada@example.com" || claims.EmailVerified == nil || !*claims.EmailVerified || claims.Name != name {
+		t.Errorf("profile claims = (%q, %v, %q), want the user's", claims.Email, claims.EmailVerified, claims.Name)
+	}
+
+	// Without the email and profile scopes only the subject is disclosed
+	token, err = service.IssueIDToken(context.Background(), IDTokenInput{User: user, ClientID: "web-app", Scopes: []string{"openid"}})
+	if err != nil {
+		t.Fatalf("IssueIDToken: %v", err)
+	}
+	claims = parse(t, token)
+	if claims.Email != "" || claims.EmailVerified != nil || claims.Name != "" {
+		t.Errorf("openid scope disclosed profile claims: %+v", claims)
+	}
+}
+
+func TestSessionService_IssueIDTokenRequiresAsymmetricKey(t *testing.T) {
+	// Clients could only verify an HS256 ID token with the server's own secret
+	service := NewSessionService(SessionConfig{JWTSecret: []byte("test-secret-key-32-characters-lo")}, nil, nil)
+
+	_, err := service.IssueIDToken(context.Background(), IDTokenInput{User: &domain.User{ID: uuid.New()}, ClientID: "web-app"})
+	if !errors.Is(err, domain.ErrSymmetricSigningKey) {
+		t.Errorf("IssueIDToken() error = %v, want %v", err, domain.ErrSymmetricSigningKey)
+	}
+	if _, err := NewAuthorizationService(nil, nil, nil, service); !errors.Is(err, domain.ErrSymmetricSigningKey) {
+		t.Errorf("NewAuthorizationService() error = %v, want %v", err, domain.ErrSymmetricSigningKey)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// IdentityService manages the ways a signed-in user can log in: their
+// password and the external identities linked to their account.
+type IdentityService struct {
+	identities  *repository.IdentitiesRepository
+	credentials *repository.CredentialsRepository
+}
+
+// NewIdentityService creates a new identity service.
+func NewIdentityService(identities *repository.IdentitiesRepository, credentials *repository.CredentialsRepository) *IdentityService {
+	return &IdentityService{
+		identities:  identities,
+		credentials: credentials,
+	}
+}
+
+// LoginMethods are the ways a user can log in.
+type LoginMethods struct {
+	HasPassword bool
+	Identities  []*domain.UserIdentity // Newest first
+}
+
+// ListLoginMethods returns the user's password status and linked identities.
+func (s *IdentityService) ListLoginMethods(ctx context.Context, userID uuid.UUID) (*LoginMethods, error) {
+	hasPassword, err := s.credentials.Exists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := s.identities.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginMethods{HasPassword: hasPassword, Identities: identities}, nil
+}
+
+// Link links an external identity to a signed-in user. Unlike login, it does
+// not match users by email: the identity joins the account that asked for it.
+// Linking an identity the user already has is a no-op; an identity linked to
+// another user returns domain.ErrIdentityAlreadyLinked.
+func (s *IdentityService) Link(ctx context.Context, userID uuid.UUID, ext *ExternalIdentity) (*domain.UserIdentity, error) {
+	if ext.Subject == "" {
+		return nil, domain.ErrInvalidToken
+	}
+
+	existing, err := s.identities.GetByProviderSubject(ctx, ext.Provider, ext.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, domain.ErrIdentityAlreadyLinked
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, domain.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	identity := &domain.UserIdentity{
+		ID:              uuid.New(),
+		UserID:          userID,
+		Provider:        ext.Provider,
+		ProviderSubject: ext.Subject,
+		CreatedAt:       time.Now(),
+	}
+	if ext.Email != "" {
+		identity.Email = &ext.Email
+	}
+	if err := s.identities.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	slog.Info("IdentityService.Link: identity linked",
+		"user_id", userID,
+		"provider", ext.Provider,
+		"identity_id", identity.ID,
+	)
+	return identity, nil
+}
+
+// Unlink removes one of the user's identities. It returns
+// domain.ErrIdentityNotFound if the user has no such identity, and
+// domain.ErrLastLoginMethod if it is the only way left to log in.
+func (s *IdentityService) Unlink(ctx context.Context, userID, identityID uuid.UUID) error {
+	if err := s.identities.DeleteForUser(ctx, userID, identityID); err != nil {
+		return err
+	}
+	slog.Info("IdentityService.Unlink: identity removed",
+		"user_id", userID,
+		"identity_id", identityID,
+	)
+	return nil
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// Token types reported by IntrospectToken (RFC 7662 token_type_hint values).
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+// Session statuses reported by IntrospectToken.
+const (
+	SessionStatusActive  = "active"
+	SessionStatusRevoked = "revoked"
+	SessionStatusExpired = "expired"
+	SessionStatusRotated = "rotated"
+)
+
+// TokenIntrospection describes a token as seen by the server. For inactive
+// tokens only Active, and if the token was recognized TokenType, SessionID
+// and SessionStatus, are set.
+type TokenIntrospection struct {
+	Active        bool
+	TokenType     string
+	Subject       string
+	Issuer        string
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
+	Roles         []string
+	SessionID     uuid.UUID // Session family, as returned by ListSessions
+	SessionStatus string
+	ClientID      string // Set for client tokens, which have no session
+	Scope         string
+	Audience      []string    // Set for exchanged tokens
+	Actor         *ActorClaim // The client an exchanged token was issued to
+}
+
+// IntrospectToken reports whether an access or refresh token is currently
+// active. Unlike CheckSession it always consults the database, so a revoked
+// session is reported immediately. clientID is the calling client; refresh
+// tokens issued to another client are reported as unrecognized, since only
+// their own client redeems them. Access tokens are meant for resource
+// servers, so any client may introspect them.
+func (s *SessionService) IntrospectToken(ctx context.Context, token, clientID string) (*TokenIntrospection, error) {
+	if isJWT(token) {
+		return s.introspectAccessToken(ctx, token)
+	}
+	return s.introspectRefreshToken(ctx, token, clientID)
+}
+
+func (s *SessionService) introspectAccessToken(ctx context.Context, token string) (*TokenIntrospection, error) {
+	claims, err := s.ValidateAccessToken(token)
+	if err != nil {
+		return &TokenIntrospection{}, nil
+	}
+	if claims.IsClient() {
+		return tokenIntrospection(claims, &TokenIntrospection{
+			ClientID: claims.ClientID,
+		}), nil
+	}
+	session, err := s.accessTokenSession(ctx, claims)
+	if err != nil || session == nil {
+		return &TokenIntrospection{}, err
+	}
+
+	// Rotating or expiring the refresh token does not end access tokens
+	// issued before it; only revocation does.
+	if session.RevokedAt != nil {
+		return &TokenIntrospection{
+			TokenType:     TokenTypeAccessToken,
+			SessionID:     session.FamilyID,
+			SessionStatus: SessionStatusRevoked,
+		}, nil
+	}
+
+	return tokenIntrospection(claims, &TokenIntrospection{
+		SessionID:     session.FamilyID,
+		SessionStatus: SessionStatusActive,
+	}), nil
+}
+
+// tokenIntrospection fills result in from the claims of an active access token.
+func tokenIntrospection(claims *AccessTokenClaims, result *TokenIntrospection) *TokenIntrospection {
+	result.Active = true
+	result.TokenType = TokenTypeAccessToken
+	result.Subject = claims.Subject
+	result.Issuer = claims.Issuer
+	result.Roles = claims.Roles
+	result.Scope = claims.Scope
+	result.Audience = claims.Audience
+	result.Actor = claims.Actor
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return result
+}
+
+func (s *SessionService) introspectRefreshToken(ctx context.Context, token, clientID string) (*TokenIntrospection, error) {
+	session, err := s.sessions.GetByTokenHash(ctx, HashToken(token))
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return &TokenIntrospection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !session.IssuedToClient(clientID) {
+		return &TokenIntrospection{}, nil
+	}
+
+	inactive := &TokenIntrospection{TokenType: TokenTypeRefreshToken, SessionID: session.FamilyID}
+	now := time.Now()
+	switch {
+	case session.RevokedAt != nil:
+		inactive.SessionStatus = SessionStatusRevoked
+		return inactive, nil
+	case session.IsRotated():
+		inactive.SessionStatus = SessionStatusRotated
+		return inactive, nil
+	case !now.Before(session.ExpiresAt):
+		inactive.SessionStatus = SessionStatusExpired
+		return inactive, nil
+	}
+
+	roles, err := s.getUserRoleNames(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if s.policyFor(roles).violation(session, now) != "" {
+		inactive.SessionStatus = SessionStatusExpired
+		return inactive, nil
+	}
+
+	// LastSeenAt is set whenever a refresh token is issued
+	issuedAt := session.CreatedAt
+	if session.LastSeenAt != nil {
+		issuedAt = *session.LastSeenAt
+	}
+	return &TokenIntrospection{
+		Active:        true,
+		TokenType:     TokenTypeRefreshToken,
+		Subject:       session.UserID.String(),
+		Issuer:        s.config.Issuer,
+		IssuedAt:      issuedAt,
+		ExpiresAt:     session.ExpiresAt,
+		Roles:         roles,
+		SessionID:     session.FamilyID,
+		SessionStatus: SessionStatusActive,
+	}, nil
+}
+
+// RevokeToken revokes the session an access or refresh token belongs to,
+// ending every token issued from the same login. Invalid, expired and unknown
+// tokens are ignored, as RFC 7009 requires. Client tokens have no session
+// and are left to expire. clientID is the calling client; tokens of sessions
+// issued to another client are ignored too (RFC 7009 section 2.1).
+func (s *SessionService) RevokeToken(ctx context.Context, token, clientID string) error {
+	var session *domain.Session
+	tokenType := TokenTypeRefreshToken
+	if isJWT(token) {
+		tokenType = TokenTypeAccessToken
+		claims, err := s.ValidateAccessToken(token)
+		if err != nil {
+			return nil
+		}
+		if session, err = s.accessTokenSession(ctx, claims); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		session, err = s.sessions.GetByTokenHash(ctx, HashToken(token))
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if session == nil || session.RevokedAt != nil {
+		return nil
+	}
+	if !session.IssuedToClient(clientID) {
+		slog.Warn("SessionService.RevokeToken: token of another client's session ignored",
+			"family_id", session.FamilyID,
+			"session_client_id", session.ClientID,
+			"client_id", clientID,
+		)
+		return nil
+	}
+
+	if err := s.sessions.RevokeFamily(ctx, session.FamilyID); err != nil {
+		return err
+	}
+	if s.revocations != nil {
+		s.revocations.forgetUser(session.UserID)
+	}
+
+	slog.Info("SessionService.RevokeToken: session revoked",
+		"family_id", session.FamilyID,
+		"user_id", session.UserID,
+		"token_type", tokenType,
+	)
+	return nil
+}
+
+// accessTokenSession returns the session an access token was issued for, or
+// nil if its "jti" does not name a session.
+func (s *SessionService) accessTokenSession(ctx context.Context, claims *AccessTokenClaims) (*domain.Session, error) {
+	sessionID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, nil
+	}
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return nil, nil
+	}
+	return session, err
+}
+
+// isJWT reports whether a token looks like a JWT. Refresh tokens are
+// base64url-encoded and never contain dots.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
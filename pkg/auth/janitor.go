@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	// DefaultJanitorInterval is how often the janitor runs.
+	DefaultJanitorInterval = time.Hour
+
+	// DefaultJanitorBatchSize is how many rows are deleted per statement.
+	DefaultJanitorBatchSize = 1000
+
+	// DefaultSessionRetention is how long expired or revoked sessions are kept.
+	DefaultSessionRetention = 7 * 24 * time.Hour
+
+	// DefaultVerificationTokenRetention is how long expired or consumed verification tokens are kept.
+	DefaultVerificationTokenRetention = 7 * 24 * time.Hour
+
+	// DefaultRecoveryCodeRetention is how long used MFA recovery codes are kept.
+	DefaultRecoveryCodeRetention = 30 * 24 * time.Hour
+
+	// janitorLockKey is the Postgres advisory lock key that keeps replicas
+	// from cleaning up at the same time.
+	janitorLockKey int64 = 0x73696d706c65 // "simple"
+)
+
+// JanitorConfig holds cleanup configuration.
+type JanitorConfig struct {
+	Interval                   time.Duration
+	BatchSize                  int
+	SessionRetention           time.Duration
+	VerificationTokenRetention time.Duration
+	RecoveryCodeRetention      time.Duration
+}
+
+// CleanupFunc deletes up to limit stale rows older than olderThan and returns how many it deleted.
+type CleanupFunc func(ctx context.Context, olderThan time.Duration, limit int) (int64, error)
+
+// cleanupTask is one table the janitor keeps tidy.
+type cleanupTask struct {
+	name      string
+	retention time.Duration
+	cleanup   CleanupFunc
+}
+
+// Janitor periodically deletes expired sessions, verification tokens and used
+// MFA recovery codes. Only one replica cleans up at a time.
+type Janitor struct {
+	config JanitorConfig
+	db     *sql.DB
+	tasks  []cleanupTask
+}
+
+// NewJanitor creates a janitor for the built-in tables.
+func NewJanitor(
+	config JanitorConfig,
+	db *sql.DB,
+	sessions *repository.SessionsRepository,
+	tokens *repository.VerificationTokensRepository,
+	recoveryCodes *repository.MFARecoveryCodesRepository,
+) *Janitor {
+	if config.Interval == 0 {
+		config.Interval = DefaultJanitorInterval
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = DefaultJanitorBatchSize
+	}
+	if config.SessionRetention == 0 {
+		config.SessionRetention = DefaultSessionRetention
+	}
+	if config.VerificationTokenRetention == 0 {
+		config.VerificationTokenRetention = DefaultVerificationTokenRetention
+	}
+	if config.RecoveryCodeRetention == 0 {
+		config.RecoveryCodeRetention = DefaultRecoveryCodeRetention
+	}
+
+	j := &Janitor{config: config, db: db}
+	j.AddTask("sessions", config.SessionRetention, sessions.DeleteExpiredBatch)
+	j.AddTask("verification_tokens", config.VerificationTokenRetention, tokens.DeleteExpired)
+	j.AddTask("mfa_recovery_codes", config.RecoveryCodeRetention, recoveryCodes.DeleteUsed)
+	return j
+}
+
+// AddTask registers another table to clean up on every run.
+func (j *Janitor) AddTask(name string, retention time.Duration, cleanup CleanupFunc) {
+	j.tasks = append(j.tasks, cleanupTask{name: name, retention: retention, cleanup: cleanup})
+}
+
+// Run cleans up every Interval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Janitor.Run: cleanup failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce cleans up every table once and returns the number of rows deleted per
+// table. If another replica is already cleaning up, it returns a nil map.
+func (j *Janitor) RunOnce(ctx context.Context) (map[string]int64, error) {
+	start := time.Now()
+	deleted := make(map[string]int64, len(j.tasks))
+
+	locked, err := repository.WithAdvisoryLock(ctx, j.db, janitorLockKey, func(ctx context.Context) error {
+		for _, task := range j.tasks {
+			n, err := j.runTask(ctx, task)
+			deleted[task.name] = n
+			if err != nil {
+				slog.Error("Janitor.RunOnce: cleanup task failed",
+					"table", task.name,
+					"deleted", n,
+					"error", err,
+				)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+	if !locked {
+		slog.Info("Janitor.RunOnce: skipped, another replica is cleaning up")
+		return nil, nil
+	}
+
+	attrs := []any{"duration", time.Since(start)}
+	for _, task := range j.tasks {
+		attrs = append(attrs, task.name, deleted[task.name])
+	}
+	slog.Info("Janitor.RunOnce: cleanup finished", attrs...)
+
+	return deleted, nil
+}
+
+// runTask deletes batches until a batch comes back short.
+func (j *Janitor) runTask(ctx context.Context, task cleanupTask) (int64, error) {
+	var total int64
+	for {
+		n, err := task.cleanup(ctx, task.retention, j.config.BatchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(j.config.BatchSize) {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJanitor_RunTaskDeletesInBatches(t *testing.T) {
+	j := &Janitor{config: JanitorConfig{BatchSize: 10}}
+
+	remaining := int64(25)
+	var calls int
+	task := cleanupTask{
+		name:      "rows",
+		retention: time.Hour,
+		cleanup: func(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+			calls++
+			if olderThan != time.Hour {
+				t.Errorf("olderThan = %v, want %v", olderThan, time.Hour)
+			}
+			n := min(remaining, int64(limit))
+			remaining -= n
+			return n, nil
+		},
+	}
+
+	deleted, err := j.runTask(context.Background(), task)
+	if err != nil {
+		t.Fatalf("runTask: %v", err)
+	}
+	if deleted != 25 {
+		t.Errorf("deleted = %d, want 25", deleted)
+	}
+	if calls != 3 {
+		t.Errorf("batches = %d, want 3", calls)
+	}
+}
+
+func TestJanitor_RunTaskStopsOnError(t *testing.T) {
+	j := &Janitor{config: JanitorConfig{BatchSize: 10}}
+	boom := errors.New("boom")
+
+	var calls int
+	task := cleanupTask{
+		name: "rows",
+		cleanup: func(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+			calls++
+			if calls == 2 {
+				return 0, boom
+			}
+			return int64(limit), nil
+		},
+	}
+
+	deleted, err := j.runTask(context.Background(), task)
+	if !errors.Is(err, boom) {
+		t.Errorf("runTask error = %v, want %v", err, boom)
+	}
+	if deleted != 10 {
+		t.Errorf("deleted = %d, want 10", deleted)
+	}
+}
+
+func TestJanitor_RunTaskStopsWhenCancelled(t *testing.T) {
+	j := &Janitor{config: JanitorConfig{BatchSize: 10}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	task := cleanupTask{
+		name: "rows",
+		cleanup: func(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+			cancel()
+			return int64(limit), nil
+		},
+	}
+
+	if _, err := j.runTask(ctx, task); !errors.Is(err, context.Canceled) {
+		t.Errorf("runTask error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewJanitor_Defaults(t *testing.T) {
+	j := NewJanitor(JanitorConfig{}, nil, nil, nil, nil)
+
+	if j.config.Interval != DefaultJanitorInterval || j.config.BatchSize != DefaultJanitorBatchSize {
+		t.Errorf("config = %+v, want default interval and batch size", j.config)
+	}
+
+	want := map[string]time.Duration{
+		"sessions":            DefaultSessionRetention,
+		"verification_tokens": DefaultVerificationTokenRetention,
+		"mfa_recovery_codes":  DefaultRecoveryCodeRetention,
+	}
+	if len(j.tasks) != len(want) {
+		t.Fatalf("tasks = %d, want %d", len(j.tasks), len(want))
+	}
+	for _, task := range j.tasks {
+		if want[task.name] != task.retention {
+			t.Errorf("%s retention = %v, want %v", task.name, task.retention, want[task.name])
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	// DefaultKeyRingRefreshInterval is how often a replica reloads the key ring.
+	DefaultKeyRingRefreshInterval = time.Minute
+
+	// DefaultKeyRingRetireAfter is how long a replaced signing key keeps verifying tokens.
+	DefaultKeyRingRetireAfter = time.Hour
+
+	// keyRingMinReload throttles reloads triggered by tokens with an unknown kid.
+	keyRingMinReload = 5 * time.Second
+
+	// keyRingLockKey is the Postgres advisory lock key that keeps replicas
+	// from generating their first signing key at the same time.
+	keyRingLockKey int64 = 0x6b657972696e67 // "keyring"
+
+	// keyRingBootstrapWait is how long Load waits between checks for the
+	// first key while another replica generates it.
+	keyRingBootstrapWait = 200 * time.Millisecond
+
+	// keyRingBootstrapAttempts bounds how often Load checks before giving up.
+	keyRingBootstrapAttempts = 50
+)
+
+// KeySource supplies the keys that sign and verify access tokens.
+type KeySource interface {
+	// SigningKey returns the key new tokens are signed with.
+	SigningKey(ctx context.Context) (*SigningKey, error)
+	// VerificationKey returns the key for a token's "kid" header ("" if the token has none).
+	VerificationKey(ctx context.Context, kid string) (*SigningKey, error)
+	// PublicKeys returns the asymmetric keys to publish in JWKS.
+	PublicKeys(ctx context.Context) []*SigningKey
+}
+
+// staticKeys is a KeySource with a single key that never rotates.
+type staticKeys struct {
+	key *SigningKey
+}
+
+func (k staticKeys) SigningKey(ctx context.Context) (*SigningKey, error) {
+	return k.key, nil
+}
+
+func (k staticKeys) VerificationKey(ctx context.Context, kid string) (*SigningKey, error) {
+	if kid != "" && k.key.ID != "" && kid != k.key.ID {
+		return nil, domain.ErrSigningKeyNotFound
+	}
+	return k.key, nil
+}
+
+func (k staticKeys) PublicKeys(ctx context.Context) []*SigningKey {
+	if !k.key.IsAsymmetric() {
+		return nil
+	}
+	return []*SigningKey{k.key}
+}
+
+// KeyRingConfig holds key ring configuration.
+type KeyRingConfig struct {
+	// EncryptionKey is a 32-byte AES-256 key protecting key material at rest.
+	EncryptionKey []byte
+	// Algorithm is used for keys generated by Stage and for the first key (default: HS256).
+	Algorithm string
+	// RefreshInterval is how often the ring is reloaded from the database.
+	RefreshInterval time.Duration
+	// RetireAfter is how long a replaced signing key keeps verifying after a promotion.
+	// It should exceed the access token TTL.
+	RetireAfter time.Duration
+	// FallbackKey verifies tokens that carry no "kid" header, such as HS256
+	// tokens issued with JWTSecret before the key ring was enabled (optional).
+	FallbackKey *SigningKey
+}
+
+// KeyRing is a database-backed set of signing keys shared by all replicas.
+// Exactly one key signs (the most recently promoted one); staged keys and
+// previously promoted keys keep verifying until they are retired.
+type KeyRing struct {
+	config KeyRingConfig
+	keys   *repository.SigningKeysRepository
+
+	loadMu    sync.Mutex
+	mu        sync.RWMutex
+	signer    *SigningKey
+	verifiers map[string]*SigningKey
+	loadedAt  time.Time
+}
+
+// NewKeyRing creates a new key ring. Call Load before serving requests.
+func NewKeyRing(config KeyRingConfig, keys *repository.SigningKeysRepository) (*KeyRing, error) {
+	if len(config.EncryptionKey) != 32 {
+		return nil, errors.New("key ring encryption key must be 32 bytes")
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = "HS256"
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = DefaultKeyRingRefreshInterval
+	}
+	if config.RetireAfter == 0 {
+		config.RetireAfter = DefaultKeyRingRetireAfter
+	}
+	return &KeyRing{
+		config:    config,
+		keys:      keys,
+		verifiers: map[string]*SigningKey{},
+	}, nil
+}
+
+// Load reloads the ring from the database. If no key has been promoted yet,
+// a new key is generated and promoted so the ring can sign immediately.
+func (r *KeyRing) Load(ctx context.Context) error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	return r.reload(ctx)
+}
+
+// reload replaces the cached keys. The caller must hold loadMu.
+func (r *KeyRing) reload(ctx context.Context) error {
+	signer, verifiers, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if signer == nil {
+		if signer, verifiers, err = r.bootstrap(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.signer = signer
+	r.verifiers = verifiers
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// bootstrap generates and promotes the first signing key. Only the replica
+// holding keyRingLockKey generates it; the others wait until it shows up.
+func (r *KeyRing) bootstrap(ctx context.Context) (*SigningKey, map[string]*SigningKey, error) {
+	for attempt := 0; attempt < keyRingBootstrapAttempts; attempt++ {
+		var (
+			signer    *SigningKey
+			verifiers map[string]*SigningKey
+		)
+		locked, err := r.keys.WithLock(ctx, keyRingLockKey, func(ctx context.Context) error {
+			// Another replica may have promoted a key before we got the lock.
+			var err error
+			if signer, verifiers, err = r.load(ctx); err != nil || signer != nil {
+				return err
+			}
+
+			slog.Info("KeyRing.Load: no active signing key, generating one", "algorithm", r.config.Algorithm)
+			key, err := r.stage(ctx, r.config.Algorithm)
+			if err != nil {
+				return err
+			}
+			if err := r.keys.Promote(ctx, key.ID, r.config.RetireAfter); err != nil {
+				return err
+			}
+			signer, verifiers, err = r.load(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if !locked {
+			// Another replica is generating the key; pick it up once promoted.
+			if signer, verifiers, err = r.load(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		if signer != nil {
+			return signer, verifiers, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(keyRingBootstrapWait):
+		}
+	}
+	return nil, nil, domain.ErrNoSigningKey
+}
+
+func (r *KeyRing) load(ctx context.Context) (*SigningKey, map[string]*SigningKey, error) {
+	records, err := r.keys.ListUsable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		signer      *SigningKey
+		activatedAt time.Time
+		verifiers   = make(map[string]*SigningKey, len(records))
+	)
+	for _, record := range records {
+		material, err := decryptAESGCM(r.config.EncryptionKey, record.KeyEncrypted)
+		if err != nil {
+			return nil, nil, fmt.Errorf("signing key %s: %w", record.ID, err)
+		}
+		key, err := unmarshalSigningKey(record.ID, record.Algorithm, material)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifiers[key.ID] = key
+
+		if record.ActivatedAt != nil && record.ActivatedAt.After(activatedAt) {
+			signer = key
+			activatedAt = *record.ActivatedAt
+		}
+	}
+
+	return signer, verifiers, nil
+}
+
+// refresh reloads the ring when it is older than the refresh interval, or when
+// force is set and the last load was more than keyRingMinReload ago.
+func (r *KeyRing) refresh(ctx context.Context, force bool) {
+	if !r.stale(force) {
+		return
+	}
+
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	// Another request may have reloaded while we waited for the lock.
+	if !r.stale(force) {
+		return
+	}
+	if err := r.reload(ctx); err != nil {
+		// Keep serving with the keys we already have.
+		slog.Warn("KeyRing.refresh: failed to reload signing keys", "error", err)
+	}
+}
+
+func (r *KeyRing) stale(force bool) bool {
+	r.mu.RLock()
+	age := time.Since(r.loadedAt)
+	r.mu.RUnlock()
+
+	return age >= r.config.RefreshInterval || (force && age >= keyRingMinReload)
+}
+
+// SigningKey returns the key new tokens are signed with.
+func (r *KeyRing) SigningKey(ctx context.Context) (*SigningKey, error) {
+	r.refresh(ctx, false)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.signer == nil {
+		return nil, domain.ErrNoSigningKey
+	}
+	return r.signer, nil
+}
+
+// VerificationKey returns the key with the given ID. Unknown IDs trigger a
+// reload so keys promoted on another replica are picked up right away.
+func (r *KeyRing) VerificationKey(ctx context.Context, kid string) (*SigningKey, error) {
+	if kid == "" {
+		if r.config.FallbackKey == nil {
+			return nil, domain.ErrSigningKeyNotFound
+		}
+		return r.config.FallbackKey, nil
+	}
+
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	r.refresh(ctx, true)
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, domain.ErrSigningKeyNotFound
+}
+
+func (r *KeyRing) lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.verifiers[kid]
+	return key, ok
+}
+
+// PublicKeys returns all asymmetric keys that are staged or active, so
+// verifiers can cache a staged key before it starts signing.
+func (r *KeyRing) PublicKeys(ctx context.Context) []*SigningKey {
+	r.refresh(ctx, false)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(r.verifiers))
+	for _, key := range r.verifiers {
+		if key.IsAsymmetric() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Stage generates a new key that verifies tokens and is published in JWKS,
+// but does not sign until promoted. An empty algorithm uses the configured default.
+func (r *KeyRing) Stage(ctx context.Context, algorithm string) (*SigningKey, error) {
+	if algorithm == "" {
+		algorithm = r.config.Algorithm
+	}
+
+	key, err := r.stage(ctx, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("KeyRing.Stage: signing key staged", "kid", key.ID, "algorithm", key.Algorithm())
+	return key, r.Load(ctx)
+}
+
+func (r *KeyRing) stage(ctx context.Context, algorithm string) (*SigningKey, error) {
+	key, err := GenerateSigningKey("", algorithm)
+	if err != nil {
+		return nil, err
+	}
+	material, err := key.marshalPrivate()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptAESGCM(r.config.EncryptionKey, material)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.keys.Create(ctx, &domain.SigningKey{
+		ID:           key.ID,
+		Algorithm:    key.Algorithm(),
+		KeyEncrypted: encrypted,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Promote makes a staged (or still verifying) key the signing key. The previous
+// signing key keeps verifying tokens for RetireAfter.
+func (r *KeyRing) Promote(ctx context.Context, kid string) error {
+	if err := r.keys.Promote(ctx, kid, r.config.RetireAfter); err != nil {
+		return err
+	}
+	slog.Info("KeyRing.Promote: signing key promoted", "kid", kid, "previous_retire_after", r.config.RetireAfter)
+	return r.Load(ctx)
+}
+
+// Retire stops a key from verifying tokens. The current signing key cannot be retired.
+func (r *KeyRing) Retire(ctx context.Context, kid string) error {
+	if err := r.keys.Retire(ctx, kid); err != nil {
+		return err
+	}
+	slog.Info("KeyRing.Retire: signing key retired", "kid", kid)
+	return r.Load(ctx)
+}
+
+// List returns all keys in the ring, including retired ones.
+func (r *KeyRing) List(ctx context.Context) ([]*domain.SigningKey, error) {
+	return r.keys.List(ctx)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// newLoadedTestKeyRing builds a ring whose cache is already populated, so no
+// database access happens during the test.
+func newLoadedTestKeyRing(t *testing.T, signer *SigningKey, others ...*SigningKey) *KeyRing {
+	t.Helper()
+
+	ring, err := NewKeyRing(KeyRingConfig{
+		EncryptionKey:   make([]byte, 32),
+		RefreshInterval: time.Hour,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+
+	ring.signer = signer
+	ring.verifiers[signer.ID] = signer
+	for _, key := range others {
+		ring.verifiers[key.ID] = key
+	}
+	ring.loadedAt = time.Now()
+	return ring
+}
+
+func mustGenerateSigningKey(t *testing.T, algorithm string) *SigningKey {
+	t.Helper()
+	key, err := GenerateSigningKey("", algorithm)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey(%s): %v", algorithm, err)
+	}
+	return key
+}
+
+func testAccessClaims() AccessTokenClaims {
+	return AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestKeyRing_SignsWithCurrentAndVerifiesPrevious(t *testing.T) {
+	previous := mustGenerateSigningKey(t, "HS256")
+	current := mustGenerateSigningKey(t, "HS256")
+	ring := newLoadedTestKeyRing(t, current, previous)
+
+	svc := NewSessionService(SessionConfig{Keys: ring}, nil, nil)
+	user := &domain.User{ID: uuid.New(), Email: "u@example.com"}
+	now := time.Now()
+
+	token, err := svc.issueAccessToken(context.Background(), user, nil, uuid.New(), now, now.Add(time.Minute), IssueSessionOpts{})
+	if err != nil {
+		t.Fatalf("issueAccessToken: %v", err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &AccessTokenClaims{})
+	if parsed.Header["kid"] != current.ID {
+		t.Errorf("kid header = %v, want %q", parsed.Header["kid"], current.ID)
+	}
+	if _, err := svc.ValidateAccessToken(token); err != nil {
+		t.Errorf("token signed with current key should validate: %v", err)
+	}
+
+	oldToken, err := previous.SignAccessToken(testAccessClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := svc.ValidateAccessToken(oldToken); err != nil {
+		t.Errorf("token signed with previous key should validate: %v", err)
+	}
+}
+
+func TestKeyRing_RejectsUnknownKeys(t *testing.T) {
+	ring := newLoadedTestKeyRing(t, mustGenerateSigningKey(t, "HS256"))
+	svc := NewSessionService(SessionConfig{Keys: ring}, nil, nil)
+
+	retired := mustGenerateSigningKey(t, "HS256")
+	token, _ := retired.SignAccessToken(testAccessClaims())
+	if _, err := svc.ValidateAccessToken(token); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("unknown kid: error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+
+	noKID, _ := NewHMACSigningKey("", []byte("legacy-secret-legacy-secret-legacy")).SignAccessToken(testAccessClaims())
+	if _, err := svc.ValidateAccessToken(noKID); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("missing kid without fallback: error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
+
+func TestKeyRing_FallbackKeyVerifiesTokensWithoutKID(t *testing.T) {
+	legacy := NewHMACSigningKey("", []byte("legacy-secret-legacy-secret-legacy"))
+	ring := newLoadedTestKeyRing(t, mustGenerateSigningKey(t, "HS256"))
+	ring.config.FallbackKey = legacy
+	svc := NewSessionService(SessionConfig{Keys: ring}, nil, nil)
+
+	// Tokens from before access tokens carried the at+jwt type.
+	token, _ := legacy.Sign(testAccessClaims())
+	if _, err := svc.ValidateAccessToken(token); err != nil {
+		t.Errorf("legacy token should validate with fallback key: %v", err)
+	}
+}
+
+func TestKeyRing_PublicKeysSkipHMAC(t *testing.T) {
+	asymmetric := mustGenerateSigningKey(t, "ES256")
+	ring := newLoadedTestKeyRing(t, mustGenerateSigningKey(t, "HS256"), asymmetric)
+
+	keys := ring.PublicKeys(context.Background())
+	if len(keys) != 1 || keys[0].ID != asymmetric.ID {
+		t.Errorf("PublicKeys() should only contain the ES256 key, got %d keys", len(keys))
+	}
+}
+
+func TestKeyRing_NoSigner(t *testing.T) {
+	ring, err := NewKeyRing(KeyRingConfig{EncryptionKey: make([]byte, 32), RefreshInterval: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	ring.loadedAt = time.Now()
+
+	if _, err := ring.SigningKey(context.Background()); !errors.Is(err, domain.ErrNoSigningKey) {
+		t.Errorf("SigningKey() error = %v, want %v", err, domain.ErrNoSigningKey)
+	}
+}
+
+func TestNewKeyRing_RequiresEncryptionKey(t *testing.T) {
+	if _, err := NewKeyRing(KeyRingConfig{EncryptionKey: []byte("short")}, nil); err == nil {
+		t.Error("NewKeyRing should reject an encryption key that is not 32 bytes")
+	}
+}
+
+func TestSigningKey_MarshalRoundTrip(t *testing.T) {
+	encryptionKey := bytes.Repeat([]byte{7}, 32)
+
+	for _, algorithm := range []string{"HS256", "RS256", "ES256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			key := mustGenerateSigningKey(t, algorithm)
+
+			material, err := key.marshalPrivate()
+			if err != nil {
+				t.Fatalf("marshalPrivate: %v", err)
+			}
+			encrypted, err := encryptAESGCM(encryptionKey, material)
+			if err != nil {
+				t.Fatalf("encryptAESGCM: %v", err)
+			}
+			decrypted, err := decryptAESGCM(encryptionKey, encrypted)
+			if err != nil {
+				t.Fatalf("decryptAESGCM: %v", err)
+			}
+			restored, err := unmarshalSigningKey(key.ID, key.Algorithm(), decrypted)
+			if err != nil {
+				t.Fatalf("unmarshalSigningKey: %v", err)
+			}
+
+			token, _ := key.SignAccessToken(testAccessClaims())
+			svc := NewSessionService(SessionConfig{SigningKey: restored}, nil, nil)
+			if _, err := svc.ValidateAccessToken(token); err != nil {
+				t.Errorf("restored key should verify the original key's tokens: %v", err)
+			}
+		})
+	}
+}
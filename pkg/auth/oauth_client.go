@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+// clientSecretLen is the number of random bytes in a client secret.
+const clientSecretLen = 32
+
+// ClientService manages registered OAuth clients: backends that authenticate
+// with a client ID and secret, e.g. to introspect or revoke tokens, to log
+// users in through the authorization endpoint, or to get access tokens of
+// their own with the client credentials grant.
+type ClientService struct {
+	clients *repository.OAuthClientsRepository
+}
+
+// NewClientService creates a new OAuth client service.
+func NewClientService(clients *repository.OAuthClientsRepository) *ClientService {
+	return &ClientService{clients: clients}
+}
+
+// CreateClient registers a client and returns it with its secret. The secret
+// is only stored hashed and cannot be retrieved again.
+func (s *ClientService) CreateClient(ctx context.Context, name string) (*domain.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("client name is required")
+	}
+
+	secret, err := GenerateToken(clientSecretLen)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &domain.OAuthClient{
+		ID:         uuid.NewString(),
+		Name:       name,
+		SecretHash: HashToken(secret),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.clients.Create(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	slog.Info("ClientService.CreateClient: client registered",
+		"client_id", client.ID,
+		"name", client.Name,
+	)
+	return client, secret, nil
+}
+
+// AuthenticateClient checks a client's credentials. Unknown clients, revoked
+// clients and wrong secrets all return domain.ErrInvalidClient.
+func (s *ClientService) AuthenticateClient(ctx context.Context, clientID, secret string) (*domain.OAuthClient, error) {
+	if clientID == "" || secret == "" {
+		return nil, domain.ErrInvalidClient
+	}
+
+	client, err := s.clients.GetByID(ctx, clientID)
+	if errors.Is(err, domain.ErrOAuthClientNotFound) {
+		return nil, domain.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.IsActive() || !constantTimeCompare([]byte(HashToken(secret)), []byte(client.SecretHash)) {
+		slog.Warn("ClientService.AuthenticateClient: client authentication failed",
+			"client_id", clientID,
+			"revoked", !client.IsActive(),
+		)
+		return nil, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// ListClients returns all clients, including revoked ones.
+func (s *ClientService) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	return s.clients.List(ctx)
+}
+
+// SetRedirectURIs replaces the URIs the authorization endpoint may send the
+// client's users back to. Each must be an absolute https URI without a
+// fragment; http is allowed for loopback addresses during development.
+func (s *ClientService) SetRedirectURIs(ctx context.Context, clientID string, uris []string) error {
+	for _, uri := range uris {
+		if err := validateRedirectURI(uri); err != nil {
+			return err
+		}
+	}
+	if err := s.clients.SetRedirectURIs(ctx, clientID, uris); err != nil {
+		return err
+	}
+	slog.Info("ClientService.SetRedirectURIs: redirect URIs updated",
+		"client_id", clientID,
+		"redirect_uris", uris,
+	)
+	return nil
+}
+
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid redirect URI %q", uri)
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("redirect URI %q must not have a fragment", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must use https", uri)
+}
+
+// SetScopes replaces the scopes the client may request with the client
+// credentials grant. Scopes are RFC 6749 scope tokens, e.g. "invoices:read".
+func (s *ClientService) SetScopes(ctx context.Context, clientID string, scopes []string) error {
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	if err := s.clients.SetScopes(ctx, clientID, scopes); err != nil {
+		return err
+	}
+	slog.Info("ClientService.SetScopes: scopes updated",
+		"client_id", clientID,
+		"scopes", scopes,
+	)
+	return nil
+}
+
+// SetRoles replaces the role labels put in the client's own access tokens,
+// which resource servers check as they would a user's roles.
+func (s *ClientService) SetRoles(ctx context.Context, clientID string, roles []string) error {
+	for _, role := range roles {
+		if strings.TrimSpace(role) == "" || strings.ContainsAny(role, " \t\n") {
+			return fmt.Errorf("invalid role %q", role)
+		}
+	}
+	if err := s.clients.SetRoles(ctx, clientID, roles); err != nil {
+		return err
+	}
+	slog.Info("ClientService.SetRoles: roles updated",
+		"client_id", clientID,
+		"roles", roles,
+	)
+	return nil
+}
+
+// SetExchangeAudiences replaces the audiences the client may exchange user
+// tokens for with the token exchange grant. Without any, it cannot exchange
+// tokens at all.
+func (s *ClientService) SetExchangeAudiences(ctx context.Context, clientID string, audiences []string) error {
+	for _, audience := range audiences {
+		if strings.TrimSpace(audience) == "" || strings.ContainsAny(audience, " \t\n") {
+			return fmt.Errorf("invalid audience %q", audience)
+		}
+	}
+	if err := s.clients.SetExchangeAudiences(ctx, clientID, audiences); err != nil {
+		return err
+	}
+	slog.Info("ClientService.SetExchangeAudiences: exchange audiences updated",
+		"client_id", clientID,
+		"audiences", audiences,
+	)
+	return nil
+}
+
+// validScope reports whether scope is a scope token (RFC 6749 section 3.3):
+// printable ASCII other than space, double quote and backslash.
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, c := range scope {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// RevokeClient stops a client from authenticating.
+func (s *ClientService) RevokeClient(ctx context.Context, clientID string) error {
+	if err := s.clients.Revoke(ctx, clientID); err != nil {
+		return err
+	}
+	slog.Info("ClientService.RevokeClient: client revoked", "client_id", clientID)
+	return nil
+}
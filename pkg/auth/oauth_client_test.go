@@ -0,0 +1,41 @@
+package auth
+
+import "testing"
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr bool
+	}{
+		{uri: "https://app.example.com/callback"},
+		{uri: "https://app.example.com/callback?tenant=1"},
+		{uri: "http://localhost:3000/callback"},
+		{uri: "http://127.0.0.1:3000/callback"},
+		{uri: "http://app.example.com/callback", wantErr: true},
+		{uri: "https://app.example.com/callback#token", wantErr: true},
+		{uri: "https://user@app.example.com/callback", wantErr: true},
+		{uri: "/callback", wantErr: true},
+		{uri: "javascript:alert(1)", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validateRedirectURI(tt.uri)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateRedirectURI(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"invoices:read":             true,
+		"https://api.example.com/x": true,
+		"":                          false,
+		"two words":                 false,
+		`quoted"scope`:              false,
+		"caf\u00e9":                 false,
+	} {
+		if got := validScope(scope); got != want {
+			t.Errorf("validScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	// oidcMaxResponseBytes bounds discovery and token endpoint responses.
+	oidcMaxResponseBytes = 1 << 20
+)
+
+// oidcSigningAlgs are the ID token algorithms we accept. Symmetric and "none"
+// algorithms are never accepted, whatever the provider advertises.
+var oidcSigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCClaimMappings names the ID token claims user attributes are read from.
+// Empty fields use the standard claim names.
+type OIDCClaimMappings struct {
+	Subject       string // default "sub"
+	Email         string // default "email"
+	EmailVerified string // default "email_verified"; a boolean or "true"
+	Name          string // default "name"
+}
+
+// OIDCConfig holds the configuration of an OpenID Connect login provider.
+type OIDCConfig struct {
+	Name           string // Provider name stored in user_identities and used in routes, e.g. "okta"
+	Issuer         string
+	DiscoveryURL   string // default: Issuer + "/.well-known/openid-configuration"
+	ClientID       string
+	ClientSecret   string
+	RedirectURI    string
+	Scopes         []string // default: openid email profile
+	ClaimMappings  OIDCClaimMappings
+	ExtraAudiences []string          // Other client IDs accepted as ID token audience (e.g. native apps)
+	AuthParams     map[string]string // Extra authorization request parameters
+	AccountLinking AccountLinkPolicy // Linking to existing users by email (default: auto)
+}
+
+// OIDCProviderMetadata is the part of a provider's discovery document used for login.
+type OIDCProviderMetadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	IDTokenSigningAlgs       []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OIDCTokenResponse represents the response from a provider's token endpoint.
+type OIDCTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// OIDCIdentity is a verified ID token: the identity read through the claim
+// mappings, plus all of the token's claims.
+type OIDCIdentity struct {
+	ExternalIdentity
+	Claims jwt.MapClaims
+}
+
+// OAuthState holds state for OAuth flow.
+type OAuthState struct {
+	State        string
+	Provider     string    // Provider the login was started with
+	LinkUserID   uuid.UUID // Set when linking the provider to a signed-in user
+	Nonce        string
+	CodeVerifier string // PKCE verifier, sent with the code exchange
+	RedirectURI  string
+	ExpiresAt    time.Time
+}
+
+// OIDCProvider logs users in with an OpenID Connect provider using the
+// authorization code flow. Endpoints and keys come from the provider's
+// discovery document, fetched on first use.
+type OIDCProvider struct {
+	config     OIDCConfig
+	issuers    []string // Accepted "iss" values
+	accounts   externalAccounts
+	httpClient *http.Client
+
+	// clientSecret, if set, generates the client secret for each code
+	// exchange instead of using config.ClientSecret (Apple's are JWTs).
+	clientSecret func() (string, error)
+
+	// checkClaims, if set, vets the claims of every verified ID token, for
+	// provider-specific restrictions such as Google's hosted domains.
+	checkClaims func(claims jwt.MapClaims) error
+
+	mu       sync.Mutex
+	metadata *OIDCProviderMetadata
+	keys     *remoteKeySet
+}
+
+// NewOIDCProvider creates a new OpenID Connect provider.
+func NewOIDCProvider(
+	config OIDCConfig,
+	db *sql.DB,
+	users *repository.UsersRepository,
+	identities *repository.IdentitiesRepository,
+) *OIDCProvider {
+	if config.DiscoveryURL == "" {
+		config.DiscoveryURL = strings.TrimSuffix(config.Issuer, "/") + oidcDiscoveryPath
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		config:     config,
+		issuers:    []string{config.Issuer},
+		accounts:   newExternalAccounts(db, users, identities, config.AccountLinking),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// setMetadata configures the provider's endpoints up front, for providers
+// that need no discovery.
+func (p *OIDCProvider) setMetadata(metadata *OIDCProviderMetadata) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metadata = metadata
+	p.keys = newRemoteKeySet(metadata.JWKSURI, p.httpClient)
+}
+
+// Name returns the provider name, e.g. "okta".
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// Metadata returns the provider's discovery document, fetching it on first
+// use. A failed fetch is retried on the next call.
+func (p *OIDCProvider) Metadata(ctx context.Context) (*OIDCProviderMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.config.Name, err)
+	}
+	p.metadata = metadata
+	p.keys = newRemoteKeySet(metadata.JWKSURI, p.httpClient)
+	return metadata, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*OIDCProviderMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.DiscoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var metadata OIDCProviderMetadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&metadata); err != nil {
+		return nil, err
+	}
+
+	// The issuer must match exactly, so a document cannot speak for another issuer
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: got %q, want %q", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	return &metadata, nil
+}
+
+// AuthURL returns the URL to send the browser to for login. If codeVerifier
+// is set, its S256 challenge is sent for PKCE.
+func (p *OIDCProvider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"client_id":     {p.config.ClientID},
+		"redirect_uri":  {p.config.RedirectURI},
+		"response_type": {"code"},
+		"scope":         {strings.Join(p.config.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	if codeVerifier != "" {
+		params.Set("code_challenge", CodeChallengeS256(codeVerifier))
+		params.Set("code_challenge_method", "S256")
+	}
+	for key, value := range p.config.AuthParams {
+		params.Set(key, value)
+	}
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// ExchangeCode exchanges an authorization code for tokens. codeVerifier is the
+// PKCE verifier the code was requested with, if any.
+func (p *OIDCProvider) ExchangeCode(ctx context.Context, code, codeVerifier string) (*OIDCTokenResponse, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURI},
+		"grant_type":   {"authorization_code"},
+	}
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+	clientSecret := p.config.ClientSecret
+	if p.clientSecret != nil {
+		if clientSecret, err = p.clientSecret(); err != nil {
+			return nil, fmt.Errorf("failed to create client secret: %w", err)
+		}
+	}
+
+	// client_secret_basic is the default when the provider does not say (OIDC Discovery §3)
+	useBasic := len(metadata.TokenEndpointAuthMethods) == 0 || slices.Contains(metadata.TokenEndpointAuthMethods, "client_secret_basic")
+	if !useBasic {
+		data.Set("client_id", p.config.ClientID)
+		data.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", metadata.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed: %s", string(body))
+	}
+
+	var tokenResp OIDCTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return &tokenResp, nil
+}
+
+// ValidateIDToken verifies an ID token's signature against the provider's JWKS
+// and checks its issuer, audience, expiry and, if expectedNonce is set, nonce.
+func (p *OIDCProvider) ValidateIDToken(ctx context.Context, idToken, expectedNonce string) (*OIDCIdentity, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	token, err := jwt.ParseWithClaims(idToken, jwt.MapClaims{}, keys.keyFunc(ctx),
+		jwt.WithValidMethods(idTokenSigningMethods(metadata)),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims type")
+	}
+
+	issuer, _ := claims.GetIssuer()
+	if !slices.Contains(p.issuers, issuer) {
+		return nil, fmt.Errorf("invalid issuer: %s", issuer)
+	}
+
+	audience, _ := claims.GetAudience()
+	if !p.validAudience(audience) {
+		return nil, errors.New("invalid audience")
+	}
+
+	// Validate nonce (browser flow only; native apps have none)
+	if expectedNonce != "" {
+		nonce, _ := claims["nonce"].(string)
+		if !constantTimeCompare([]byte(nonce), []byte(expectedNonce)) {
+			return nil, errors.New("invalid nonce")
+		}
+	}
+
+	if p.checkClaims != nil {
+		if err := p.checkClaims(claims); err != nil {
+			return nil, err
+		}
+	}
+
+	identity := &OIDCIdentity{
+		ExternalIdentity: p.config.ClaimMappings.identity(p.config.Name, claims),
+		Claims:           claims,
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	return identity, nil
+}
+
+// validAudience reports whether one of the token's audiences is our client ID
+// or one of the extra audiences.
+func (p *OIDCProvider) validAudience(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		if aud == "" {
+			continue
+		}
+		if aud == p.config.ClientID || slices.Contains(p.config.ExtraAudiences, aud) {
+			return true
+		}
+	}
+	return false
+}
+
+// Identify exchanges the code from a login callback and returns the identity
+// in the verified ID token.
+func (p *OIDCProvider) Identify(ctx context.Context, code, nonce, codeVerifier string) (*ExternalIdentity, error) {
+	tokenResp, err := p.ExchangeCode(ctx, code, codeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrCodeExchangeFailed, err)
+	}
+	identity, err := p.ValidateIDToken(ctx, tokenResp.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &identity.ExternalIdentity, nil
+}
+
+// Authenticate returns the user behind an identity from this provider,
+// linking or creating one on first login.
+func (p *OIDCProvider) Authenticate(ctx context.Context, identity *ExternalIdentity) (uuid.UUID, error) {
+	return p.accounts.authenticate(ctx, identity)
+}
+
+// idTokenSigningMethods returns the asymmetric algorithms the provider
+// advertises for ID tokens, or RS256, which every provider must support.
+func idTokenSigningMethods(metadata *OIDCProviderMetadata) []string {
+	var methods []string
+	for _, alg := range metadata.IDTokenSigningAlgs {
+		if slices.Contains(oidcSigningAlgs, alg) {
+			methods = append(methods, alg)
+		}
+	}
+	if len(methods) == 0 {
+		return []string{"RS256"}
+	}
+	return methods
+}
+
+// identity reads the user attributes from ID token claims.
+func (m OIDCClaimMappings) identity(provider string, claims jwt.MapClaims) ExternalIdentity {
+	return ExternalIdentity{
+		Provider:      provider,
+		Subject:       claimString(claims, m.Subject, "sub"),
+		Email:         claimString(claims, m.Email, "email"),
+		EmailVerified: claimBool(claims, m.EmailVerified, "email_verified"),
+		Name:          claimString(claims, m.Name, "name"),
+	}
+}
+
+func claimString(claims jwt.MapClaims, name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func claimBool(claims jwt.MapClaims, name, fallback string) bool {
+	if name == "" {
+		name = fallback
+	}
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		// Some providers (e.g. Cognito) send booleans as strings
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testOIDCProvider is a local OpenID Connect provider serving discovery,
+// JWKS and a token endpoint that returns idToken.
+type testOIDCProvider struct {
+	*testGoogleJWKS
+	issuer      string
+	authMethods []string
+	idToken     string
+	tokenForm   url.Values
+	basicUser   string
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	t.Helper()
+	p := &testOIDCProvider{testGoogleJWKS: newTestGoogleJWKS(t)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(OIDCProviderMetadata{
+			Issuer:                   p.issuer,
+			AuthorizationEndpoint:    p.issuer + "/authorize",
+			TokenEndpoint:            p.issuer + "/token",
+			JWKSURI:                  p.server.URL,
+			IDTokenSigningAlgs:       []string{"RS256", "HS256", "none"},
+			TokenEndpointAuthMethods: p.authMethods,
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		p.tokenForm = r.PostForm
+		p.basicUser, _, _ = r.BasicAuth()
+		_ = json.NewEncoder(w).Encode(OIDCTokenResponse{AccessToken: "at", IDToken: p.idToken, TokenType: "Bearer"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	p.issuer = server.URL
+	return p
+}
+
+func (p *testOIDCProvider) provider(mappings OIDCClaimMappings) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:          "okta",
+		Issuer:        p.issuer,
+		ClientID:      "okta-client",
+		ClientSecret:  "okta-secret",
+		RedirectURI:   "https://idm.example.com/v1/auth/oidc/okta/callback",
+		ClaimMappings: mappings,
+	}, nil, nil, nil)
+}
+
+func (p *testOIDCProvider) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "00u1",
+		"aud":            "okta-client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+	}
+}
+
+func TestOIDCProvider_AuthURL(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	provider := idp.provider(OIDCClaimMappings{})
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.issuer+"/authorize" {
+		t.Errorf("endpoint = %q, want %q", got, idp.issuer+"/authorize")
+	}
+	q := u.Query()
+	want := map[string]string{
+		"client_id":     "okta-client",
+		"response_type": "code",
+		"scope":         "openid email profile",
+		"state":         "state-1",
+		"nonce":         "nonce-1",
+		// RFC 7636: S256 challenge of the verifier
+		"code_challenge":        CodeChallengeS256("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if q.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), value)
+		}
+	}
+}
+
+func TestOIDCProvider_DiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:         "okta",
+		Issuer:       "https://other.example.com",
+		DiscoveryURL: idp.issuer + oidcDiscoveryPath,
+	}, nil, nil, nil)
+
+	if _, err := provider.Metadata(context.Background()); err == nil {
+		t.Fatal("Metadata() should fail when the document names another issuer")
+	}
+}
+
+func TestOIDCProvider_ExchangeCode(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	idp.idToken = "id-token"
+	ctx := context.Background()
+
+	// No advertised methods means client_secret_basic
+	tokens, err := idp.provider(OIDCClaimMappings{}).ExchangeCode(ctx, "code-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if tokens.IDToken != "id-token" {
+		t.Errorf("IDToken = %q, want %q", tokens.IDToken, "id-token")
+	}
+	if idp.basicUser != "okta-client" || idp.tokenForm.Get("client_secret") != "" {
+		t.Errorf("expected client_secret_basic, got user %q and form %v", idp.basicUser, idp.tokenForm)
+	}
+	if idp.tokenForm.Get("code") != "code-1" || idp.tokenForm.Get("grant_type") != "authorization_code" || idp.tokenForm.Get("code_verifier") != "verifier-1" {
+		t.Errorf("unexpected token request %v", idp.tokenForm)
+	}
+
+	idp.authMethods = []string{"client_secret_post"}
+	if _, err := idp.provider(OIDCClaimMappings{}).ExchangeCode(ctx, "code-2", ""); err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if idp.basicUser != "" || idp.tokenForm.Get("client_secret") != "okta-secret" {
+		t.Errorf("expected client_secret_post, got user %q and form %v", idp.basicUser, idp.tokenForm)
+	}
+}
+
+func TestOIDCProvider_ValidateIDToken(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	key := idp.addKey("okta-1")
+	ctx := context.Background()
+
+	token, err := key.Sign(idp.claims("n-1"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	identity, err := idp.provider(OIDCClaimMappings{}).ValidateIDToken(ctx, token, "n-1")
+	if err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	want := ExternalIdentity{Provider: "okta", Subject: "00u1", Email: "user@example.com", EmailVerified: true, Name: "Test User"}
+	if identity.ExternalIdentity != want {
+		t.Errorf("identity = %+v, want %+v", identity.ExternalIdentity, want)
+	}
+}
+
+func TestOIDCProvider_ValidateIDTokenClaimMappings(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	key := idp.addKey("okta-1")
+
+	claims := idp.claims("")
+	claims["upn"] = "user@corp.example.com"
+	claims["verified"] = "true"
+	claims["oid"] = float64(12345)
+	claims["display_name"] = "Corp User"
+	token, err := key.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	provider := idp.provider(OIDCClaimMappings{Subject: "oid", Email: "upn", EmailVerified: "verified", Name: "display_name"})
+	identity, err := provider.ValidateIDToken(context.Background(), token, "")
+	if err != nil {
+		t.Fatalf("ValidateIDToken: %v", err)
+	}
+	want := ExternalIdentity{Provider: "okta", Subject: "12345", Email: "user@corp.example.com", EmailVerified: true, Name: "Corp User"}
+	if identity.ExternalIdentity != want {
+		t.Errorf("identity = %+v, want %+v", identity.ExternalIdentity, want)
+	}
+}
+
+func TestOIDCProvider_ValidateIDTokenRejects(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	key := idp.addKey("okta-1")
+	provider := idp.provider(OIDCClaimMappings{})
+
+	// The provider advertises HS256 and none; neither may be accepted
+	hmacToken, err := NewHMACSigningKey("okta-1", []byte("okta-secret-at-least-32-characters")).Sign(idp.claims(""))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	wrongIssuer := idp.claims("")
+	wrongIssuer["iss"] = "https://evil.example.com"
+	wrongAudience := idp.claims("")
+	wrongAudience["aud"] = "other-client"
+	noSubject := idp.claims("")
+	delete(noSubject, "sub")
+	noExpiry := idp.claims("")
+	delete(noExpiry, "exp")
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		token  string
+		nonce  string
+	}{
+		{name: "HMAC signed", token: hmacToken},
+		{name: "wrong issuer", claims: wrongIssuer},
+		{name: "wrong audience", claims: wrongAudience},
+		{name: "no subject", claims: noSubject},
+		{name: "no expiry", claims: noExpiry},
+		{name: "wrong nonce", claims: idp.claims("n-1"), nonce: "n-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				if token, err = key.Sign(tt.claims); err != nil {
+					t.Fatalf("Sign: %v", err)
+				}
+			}
+			if _, err := provider.ValidateIDToken(context.Background(), token, tt.nonce); err == nil {
+				t.Error("ValidateIDToken() should fail")
+			}
+		})
+	}
+}
+
+func TestIDTokenSigningMethods(t *testing.T) {
+	got := idTokenSigningMethods(&OIDCProviderMetadata{IDTokenSigningAlgs: []string{"HS256", "ES256", "none"}})
+	if strings.Join(got, ",") != "ES256" {
+		t.Errorf("idTokenSigningMethods() = %v, want [ES256]", got)
+	}
+	if got := idTokenSigningMethods(&OIDCProviderMetadata{}); strings.Join(got, ",") != "RS256" {
+		t.Errorf("idTokenSigningMethods() = %v, want [RS256]", got)
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCodeChallengeS256(t *testing.T) {
+	// RFC 7636 Appendix B
+	got := CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallengeS256() = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	valid := regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		verifier, err := GenerateCodeVerifier()
+		if err != nil {
+			t.Fatalf("GenerateCodeVerifier: %v", err)
+		}
+		if !valid.MatchString(verifier) {
+			t.Errorf("verifier %q is not a valid RFC 7636 code verifier", verifier)
+		}
+		if seen[verifier] {
+			t.Errorf("verifier %q generated twice", verifier)
+		}
+		seen[verifier] = true
+	}
+}
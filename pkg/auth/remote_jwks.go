@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// defaultRemoteJWKSTTL is how long a key set is cached when the response
+	// has no usable Cache-Control max-age.
+	defaultRemoteJWKSTTL = time.Hour
+
+	// remoteJWKSMinRefresh limits refetches triggered by unknown key IDs, so
+	// tokens with made-up kids cannot make us hammer the provider.
+	remoteJWKSMinRefresh = 30 * time.Second
+
+	// remoteJWKSMaxBytes bounds the size of a fetched key set.
+	remoteJWKSMaxBytes = 1 << 20
+)
+
+// remoteKey is a public key from a remote key set.
+type remoteKey struct {
+	key       crypto.PublicKey
+	algorithm string // JWK "alg", may be empty
+}
+
+// remoteKeySet fetches and caches a provider's JWKS, e.g. Google's, to verify
+// ID token signatures. The set is cached as long as the response's
+// Cache-Control allows (but at least remoteJWKSMinRefresh) and refetched when
+// a token names an unknown key.
+type remoteKeySet struct {
+	url        string
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]remoteKey
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+func newRemoteKeySet(url string, httpClient *http.Client) *remoteKeySet {
+	return &remoteKeySet{
+		url:        url,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// keyFunc returns a jwt.Keyfunc that resolves the token's "kid" in the key set.
+func (k *remoteKeySet) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := k.lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.algorithm != "" && key.algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("key %q is for %s, token uses %s", kid, key.algorithm, token.Method.Alg())
+		}
+		if !methodMatchesKey(token.Method, key.key) {
+			return nil, fmt.Errorf("key %q does not match signing method %s", kid, token.Method.Alg())
+		}
+		return key.key, nil
+	}
+}
+
+// lookup returns the key with the given ID, refreshing the set if it has
+// expired or does not contain the key.
+func (k *remoteKeySet) lookup(ctx context.Context, kid string) (remoteKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	key, found := k.keys[kid]
+	fresh := now.Before(k.expiresAt)
+	if found && fresh {
+		return key, nil
+	}
+	// An unknown kid may mean the provider rotated keys, but refetch at most
+	// every remoteJWKSMinRefresh.
+	if !fresh || now.Sub(k.lastFetched) >= remoteJWKSMinRefresh {
+		if err := k.refresh(ctx, now); err != nil {
+			if found {
+				// Keep using a known key if the provider is briefly unavailable
+				slog.Warn("remoteKeySet.lookup: refresh failed, using cached key", "url", k.url, "error", err)
+				return key, nil
+			}
+			return remoteKey{}, err
+		}
+		key, found = k.keys[kid]
+	}
+	if !found {
+		return remoteKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set. The caller must hold mu.
+func (k *remoteKeySet) refresh(ctx context.Context, now time.Time) error {
+	k.lastFetched = now
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, remoteJWKSMaxBytes)).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]remoteKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			slog.Warn("remoteKeySet.refresh: skipping unusable key", "url", k.url, "kid", jwk.KeyID, "error", err)
+			continue
+		}
+		keys[jwk.KeyID] = remoteKey{key: pub, algorithm: jwk.Algorithm}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable keys")
+	}
+
+	k.keys = keys
+	k.expiresAt = now.Add(max(cacheMaxAge(resp.Header.Get("Cache-Control"), defaultRemoteJWKSTTL), remoteJWKSMinRefresh))
+	slog.Debug("remoteKeySet.refresh: fetched JWKS", "url", k.url, "keys", len(keys), "expires_at", k.expiresAt)
+	return nil
+}
+
+// cacheMaxAge returns the max-age of a Cache-Control header, zero for
+// no-store and no-cache, or fallback if neither is present.
+func cacheMaxAge(header string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
+
+// methodMatchesKey reports whether a signing method can be verified with key,
+// so an RSA key is never used to check, say, an HMAC signature.
+func methodMatchesKey(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+const (
+	// DefaultRevocationCacheTTL is how long a session's revocation status is cached.
+	DefaultRevocationCacheTTL = 30 * time.Second
+
+	// revocationCacheMaxEntries bounds the cache; expired entries are swept
+	// when it fills up, and it is cleared if that is not enough.
+	revocationCacheMaxEntries = 10000
+)
+
+// revocationEntry is the cached status of one session.
+type revocationEntry struct {
+	userID    uuid.UUID
+	revoked   bool
+	expiresAt time.Time
+}
+
+// revocationCache caches session revocation lookups in process so the
+// database is not queried on every authenticated request.
+type revocationCache struct {
+	ttl    time.Duration
+	lookup func(ctx context.Context, sessionID uuid.UUID) (*domain.Session, error)
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]revocationEntry
+}
+
+func newRevocationCache(ttl time.Duration, lookup func(ctx context.Context, sessionID uuid.UUID) (*domain.Session, error)) *revocationCache {
+	return &revocationCache{
+		ttl:     ttl,
+		lookup:  lookup,
+		entries: map[uuid.UUID]revocationEntry{},
+	}
+}
+
+// revoked reports whether the session has been revoked. Sessions that no
+// longer exist are treated as revoked.
+func (c *revocationCache) revoked(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[sessionID]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	session, err := c.lookup(ctx, sessionID)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		entry = revocationEntry{revoked: true}
+	} else if err != nil {
+		return false, err
+	} else {
+		entry = revocationEntry{userID: session.UserID, revoked: session.RevokedAt != nil}
+	}
+	entry.expiresAt = now.Add(c.ttl)
+
+	c.mu.Lock()
+	if len(c.entries) >= revocationCacheMaxEntries {
+		c.sweep(now)
+	}
+	c.entries[sessionID] = entry
+	c.mu.Unlock()
+
+	return entry.revoked, nil
+}
+
+// sweep drops expired entries, or everything if the cache is still full.
+// The caller must hold mu.
+func (c *revocationCache) sweep(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) >= revocationCacheMaxEntries {
+		c.entries = map[uuid.UUID]revocationEntry{}
+	}
+}
+
+// forgetUser drops cached entries for a user so revocations made by this
+// process take effect immediately rather than after the TTL.
+func (c *revocationCache) forgetUser(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// CheckSession returns domain.ErrSessionRevoked if the session an access token
+// was issued for (its "jti" claim) has been revoked. It does nothing unless
+// SessionConfig.RevocationCheck is enabled, and for client tokens, which have
+// no session.
+func (s *SessionService) CheckSession(ctx context.Context, claims *AccessTokenClaims) error {
+	if s.revocations == nil || claims.IsClient() {
+		return nil
+	}
+
+	sessionID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return domain.ErrSessionRevoked
+	}
+
+	revoked, err := s.revocations.revoked(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return domain.ErrSessionRevoked
+	}
+	return nil
+}
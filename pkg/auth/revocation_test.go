@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// stubSessionLookup serves sessions from a map and counts lookups.
+type stubSessionLookup struct {
+	sessions map[uuid.UUID]*domain.Session
+	calls    int
+	err      error
+}
+
+func (s *stubSessionLookup) get(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func newRevocationTestService(t *testing.T, ttl time.Duration, lookup *stubSessionLookup) *SessionService {
+	t.Helper()
+	svc := NewSessionService(SessionConfig{
+		JWTSecret:          []byte("test-secret"),
+		RevocationCheck:    true,
+		RevocationCacheTTL: ttl,
+	}, nil, nil)
+	svc.revocations.lookup = lookup.get
+	return svc
+}
+
+func sessionClaims(sessionID uuid.UUID) *AccessTokenClaims {
+	return &AccessTokenClaims{RegisteredClaims: jwt.RegisteredClaims{ID: sessionID.String()}}
+}
+
+func TestCheckSession_DisabledByDefault(t *testing.T) {
+	svc := NewSessionService(SessionConfig{JWTSecret: []byte("test-secret")}, nil, nil)
+
+	if err := svc.CheckSession(context.Background(), &AccessTokenClaims{}); err != nil {
+		t.Errorf("CheckSession() without revocation checks = %v, want nil", err)
+	}
+}
+
+func TestCheckSession(t *testing.T) {
+	now := time.Now()
+	active := &domain.Session{ID: uuid.New(), UserID: uuid.New()}
+	revoked := &domain.Session{ID: uuid.New(), UserID: uuid.New(), RevokedAt: &now}
+	rotated := &domain.Session{ID: uuid.New(), UserID: uuid.New(), RotatedAt: &now}
+
+	lookup := &stubSessionLookup{sessions: map[uuid.UUID]*domain.Session{
+		active.ID:  active,
+		revoked.ID: revoked,
+		rotated.ID: rotated,
+	}}
+	svc := newRevocationTestService(t, time.Minute, lookup)
+
+	tests := []struct {
+		name    string
+		claims  *AccessTokenClaims
+		wantErr error
+	}{
+		{"active session", sessionClaims(active.ID), nil},
+		{"rotated session", sessionClaims(rotated.ID), nil},
+		{"revoked session", sessionClaims(revoked.ID), domain.ErrSessionRevoked},
+		{"deleted session", sessionClaims(uuid.New()), domain.ErrSessionRevoked},
+		{"missing jti", &AccessTokenClaims{}, domain.ErrSessionRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.CheckSession(context.Background(), tt.claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckSession() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSession_CachesLookups(t *testing.T) {
+	now := time.Now()
+	session := &domain.Session{ID: uuid.New(), UserID: uuid.New()}
+	lookup := &stubSessionLookup{sessions: map[uuid.UUID]*domain.Session{session.ID: session}}
+	svc := newRevocationTestService(t, time.Minute, lookup)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := svc.CheckSession(ctx, sessionClaims(session.ID)); err != nil {
+			t.Fatalf("CheckSession() = %v", err)
+		}
+	}
+	if lookup.calls != 1 {
+		t.Errorf("lookups = %d, want 1", lookup.calls)
+	}
+
+	// A revocation elsewhere is only seen once the entry expires.
+	session.RevokedAt = &now
+	if err := svc.CheckSession(ctx, sessionClaims(session.ID)); err != nil {
+		t.Errorf("cached entry should still be active, got %v", err)
+	}
+
+	// A revocation through this service drops the user's entries immediately.
+	svc.revocations.forgetUser(session.UserID)
+	if err := svc.CheckSession(ctx, sessionClaims(session.ID)); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("CheckSession() after forgetUser = %v, want %v", err, domain.ErrSessionRevoked)
+	}
+}
+
+func TestCheckSession_EntriesExpire(t *testing.T) {
+	now := time.Now()
+	session := &domain.Session{ID: uuid.New(), UserID: uuid.New()}
+	lookup := &stubSessionLookup{sessions: map[uuid.UUID]*domain.Session{session.ID: session}}
+	svc := newRevocationTestService(t, time.Millisecond, lookup)
+	ctx := context.Background()
+
+	if err := svc.CheckSession(ctx, sessionClaims(session.ID)); err != nil {
+		t.Fatalf("CheckSession() = %v", err)
+	}
+	session.RevokedAt = &now
+	time.Sleep(5 * time.Millisecond)
+
+	if err := svc.CheckSession(ctx, sessionClaims(session.ID)); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("CheckSession() after TTL = %v, want %v", err, domain.ErrSessionRevoked)
+	}
+}
+
+func TestCheckSession_LookupErrorNotCached(t *testing.T) {
+	session := &domain.Session{ID: uuid.New(), UserID: uuid.New()}
+	lookup := &stubSessionLookup{
+		sessions: map[uuid.UUID]*domain.Session{session.ID: session},
+		err:      errors.New("connection refused"),
+	}
+	svc := newRevocationTestService(t, time.Minute, lookup)
+	ctx := context.Background()
+
+	err := svc.CheckSession(ctx, sessionClaims(session.ID))
+	if err == nil || errors.Is(err, domain.ErrSessionRevoked) {
+		t.Fatalf("CheckSession() = %v, want the lookup error", err)
+	}
+
+	lookup.err = nil
+	if err := svc.CheckSession(ctx, sessionClaims(session.ID)); err != nil {
+		t.Errorf("CheckSession() after recovery = %v, want nil", err)
+	}
+}
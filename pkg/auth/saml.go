@@ -0,0 +1,479 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"github.com/tendant/simple-idm-slim/pkg/repository"
+)
+
+const (
+	samlProtocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadataNS  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	samlHTTPPostBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlNameIDEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	// samlMaxResponseBytes bounds the decoded SAMLResponse.
+	samlMaxResponseBytes = 1 << 20
+
+	// samlClockSkew is how far the IdP's clock may be off from ours.
+	samlClockSkew = 3 * time.Minute
+)
+
+// Attribute names common IdPs (Azure AD and ADFS, Okta, Shibboleth) send
+// emails and names in, used when no mapping is configured.
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"name", "displayName",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+// SAMLAttributeMappings names the assertion attributes user attributes are
+// read from. Empty fields use the NameID as subject, and the attribute names
+// common IdPs use for emails and names.
+type SAMLAttributeMappings struct {
+	Subject string // default: the NameID, which should be persistent
+	Email   string // default: a common email attribute, or an emailAddress NameID
+	Name    string
+}
+
+// SAMLConfig holds the configuration of a SAML 2.0 identity provider that
+// users log in with.
+type SAMLConfig struct {
+	Name              string              // Route segment, e.g. "acme"
+	EntityID          string              // Our entity ID at the IdP, usually the metadata URL
+	ACSURL            string              // Assertion consumer service the IdP posts responses to
+	IdPEntityID       string              // Issuer of the IdP's assertions
+	IdPSSOURL         string              // IdP's single sign-on service (HTTP-Redirect binding)
+	IdPCertificates   []*x509.Certificate // Certificates the IdP signs assertions with
+	AttributeMappings SAMLAttributeMappings
+	TrustEmail        bool              // Treat emails from the IdP as verified, so logins link to existing users
+	AccountLinking    AccountLinkPolicy // Linking to existing users by email (default: auto)
+}
+
+// SAMLProvider logs users in with a SAML 2.0 identity provider, acting as a
+// service provider with the Web Browser SSO profile. Authentication requests
+// go out with the HTTP-Redirect binding and responses come back with
+// HTTP-POST; only responses to our own requests are accepted, and their
+// assertions must be signed with one of the IdP's certificates. Identities
+// are stored under the provider "saml:<IdP entity ID>".
+type SAMLProvider struct {
+	config     SAMLConfig
+	validation *dsig.ValidationContext
+	accounts   externalAccounts
+}
+
+// NewSAMLProvider creates a new SAML provider. It fails if the IdP's entity
+// ID, single sign-on URL or certificates, or our entity ID or ACS URL are
+// missing.
+func NewSAMLProvider(
+	config SAMLConfig,
+	db *sql.DB,
+	users *repository.UsersRepository,
+	identities *repository.IdentitiesRepository,
+) (*SAMLProvider, error) {
+	if config.EntityID == "" || config.ACSURL == "" {
+		return nil, errors.New("SAML provider needs an entity ID and ACS URL")
+	}
+	if config.IdPEntityID == "" || config.IdPSSOURL == "" {
+		return nil, errors.New("SAML provider needs the IdP's entity ID and single sign-on URL")
+	}
+	if len(config.IdPCertificates) == 0 {
+		return nil, errors.New("SAML provider needs the IdP's signing certificate")
+	}
+	return &SAMLProvider{
+		config:     config,
+		validation: dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: config.IdPCertificates}),
+		accounts:   newExternalAccounts(db, users, identities, config.AccountLinking),
+	}, nil
+}
+
+// ParseSAMLCertificates parses the IdP signing certificates in data, either
+// PEM blocks or the base64 DER found in IdP metadata.
+func ParseSAMLCertificates(data string) ([]*x509.Certificate, error) {
+	data = strings.TrimSpace(data)
+	if !strings.Contains(data, "-----BEGIN") {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certs, nil
+}
+
+// Name returns the provider name, e.g. "acme".
+func (p *SAMLProvider) Name() string {
+	return p.config.Name
+}
+
+// Metadata returns our service provider metadata, for registering with the IdP.
+func (p *SAMLProvider) Metadata() ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	entity := doc.CreateElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", samlMetadataNS)
+	entity.CreateAttr("entityID", p.config.EntityID)
+
+	sp := entity.CreateElement("md:SPSSODescriptor")
+	sp.CreateAttr("AuthnRequestsSigned", "false")
+	sp.CreateAttr("WantAssertionsSigned", "true")
+	sp.CreateAttr("protocolSupportEnumeration", samlProtocolNS)
+	acs := sp.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", samlHTTPPostBinding)
+	acs.CreateAttr("Location", p.config.ACSURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// AuthURL returns the IdP's single sign-on URL with an authentication
+// request. The state comes back as RelayState, and the response must be to
+// the request derived from nonce. SAML has no PKCE, so codeVerifier is
+// unused.
+func (p *SAMLProvider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	doc := etree.NewDocument()
+	req := doc.CreateElement("samlp:AuthnRequest")
+	req.CreateAttr("xmlns:samlp", samlProtocolNS)
+	req.CreateAttr("xmlns:saml", samlAssertionNS)
+	req.CreateAttr("ID", samlRequestID(nonce))
+	req.CreateAttr("Version", "2.0")
+	req.CreateAttr("IssueInstant", time.Now().UTC().Format(time.RFC3339))
+	req.CreateAttr("Destination", p.config.IdPSSOURL)
+	req.CreateAttr("AssertionConsumerServiceURL", p.config.ACSURL)
+	req.CreateAttr("ProtocolBinding", samlHTTPPostBinding)
+	req.CreateElement("saml:Issuer").SetText(p.config.EntityID)
+	req.CreateElement("samlp:NameIDPolicy").CreateAttr("AllowCreate", "true")
+
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+	// The HTTP-Redirect binding deflates the request (SAML Bindings 3.4.4.1)
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())},
+		"RelayState":  {state},
+	}
+	sep := "?"
+	if strings.Contains(p.config.IdPSSOURL, "?") {
+		sep = "&"
+	}
+	return p.config.IdPSSOURL + sep + params.Encode(), nil
+}
+
+// CallbackFields returns the form fields the IdP posts the response and
+// state in.
+func (p *SAMLProvider) CallbackFields() (code, state string) {
+	return "SAMLResponse", "RelayState"
+}
+
+// ApplyCallbackUser does nothing: all user attributes are in the assertion.
+func (p *SAMLProvider) ApplyCallbackUser(identity *ExternalIdentity, user string) {}
+
+// Identify verifies a base64 SAMLResponse posted to the ACS in response to
+// the request derived from nonce, and returns the identity in its assertion.
+func (p *SAMLProvider) Identify(ctx context.Context, samlResponse, nonce, codeVerifier string) (*ExternalIdentity, error) {
+	assertion, err := p.verifyResponse(samlResponse, samlRequestID(nonce), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response from %s: %w", p.config.Name, err)
+	}
+	return p.identity(assertion)
+}
+
+// Authenticate returns the user behind an identity from this provider,
+// linking or creating one on first login.
+func (p *SAMLProvider) Authenticate(ctx context.Context, identity *ExternalIdentity) (uuid.UUID, error) {
+	return p.accounts.authenticate(ctx, identity)
+}
+
+// samlRequestID turns a login nonce into an AuthnRequest ID, which must be
+// an XML name: it may not start with a digit or contain "=".
+func samlRequestID(nonce string) string {
+	return "_" + strings.TrimRight(nonce, "=")
+}
+
+type samlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Destination  string   `xml:"Destination,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+}
+
+type samlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				InResponseTo string    `xml:"InResponseTo,attr"`
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Audiences    []string  `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction>Audience"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Attributes []samlAttribute `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement>Attribute"`
+}
+
+type samlAttribute struct {
+	Name         string   `xml:"Name,attr"`
+	FriendlyName string   `xml:"FriendlyName,attr"`
+	Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+}
+
+// verifyResponse decodes a SAMLResponse and returns its assertion once its
+// signature, issuer, audience, validity period and subject confirmation
+// check out. Only the signed assertion is read; the response around it is
+// not signed.
+func (p *SAMLProvider) verifyResponse(encoded, requestID string, now time.Time) (*samlAssertion, error) {
+	if base64.StdEncoding.DecodedLen(len(encoded)) > samlMaxResponseBytes {
+		return nil, errors.New("response too large")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != samlProtocolNS {
+		return nil, errors.New("not a SAML response")
+	}
+
+	var response samlResponse
+	if err := xml.Unmarshal(raw, &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if status := response.Status.StatusCode.Value; status != samlStatusSuccess {
+		return nil, fmt.Errorf("IdP returned status %s", status)
+	}
+	if response.Destination != "" && response.Destination != p.config.ACSURL {
+		return nil, fmt.Errorf("response is for %s", response.Destination)
+	}
+	if response.InResponseTo != requestID {
+		return nil, errors.New("response is not to our request")
+	}
+
+	var assertionEl *etree.Element
+	for _, el := range root.ChildElements() {
+		if el.NamespaceURI() != samlAssertionNS {
+			continue
+		}
+		switch el.Tag {
+		case "EncryptedAssertion":
+			return nil, errors.New("encrypted assertions are not supported")
+		case "Assertion":
+			if assertionEl != nil {
+				return nil, errors.New("response has more than one assertion")
+			}
+			assertionEl = el
+		}
+	}
+	if assertionEl == nil {
+		return nil, errors.New("response has no assertion")
+	}
+
+	// The assertion is verified on its own, with the namespaces it inherits
+	ctx, err := etreeutils.NSBuildParentContext(assertionEl)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(ctx, assertionEl)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := p.validation.Validate(detached)
+	if err != nil {
+		return nil, fmt.Errorf("assertion signature: %w", err)
+	}
+	verifiedDoc := etree.NewDocument()
+	verifiedDoc.SetRoot(verified)
+	verifiedXML, err := verifiedDoc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	var assertion samlAssertion
+	if err := xml.Unmarshal(verifiedXML, &assertion); err != nil {
+		return nil, fmt.Errorf("invalid assertion: %w", err)
+	}
+
+	if assertion.Issuer != p.config.IdPEntityID {
+		return nil, fmt.Errorf("assertion issued by %s", assertion.Issuer)
+	}
+	if err := p.checkConditions(&assertion, now); err != nil {
+		return nil, err
+	}
+	if !p.confirmed(&assertion, requestID, now) {
+		return nil, errors.New("assertion has no valid bearer subject confirmation")
+	}
+	return &assertion, nil
+}
+
+// checkConditions checks that the assertion is meant for us and valid now.
+func (p *SAMLProvider) checkConditions(assertion *samlAssertion, now time.Time) error {
+	conditions := assertion.Conditions
+	if conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+	if !conditions.NotBefore.IsZero() && now.Add(samlClockSkew).Before(conditions.NotBefore) {
+		return errors.New("assertion is not yet valid")
+	}
+	if !conditions.NotOnOrAfter.IsZero() && !now.Add(-samlClockSkew).Before(conditions.NotOnOrAfter) {
+		return errors.New("assertion has expired")
+	}
+	for _, audience := range conditions.Audiences {
+		if audience == p.config.EntityID {
+			return nil
+		}
+	}
+	return errors.New("assertion is not for this service provider")
+}
+
+// confirmed reports whether the assertion's subject may be trusted as the
+// browser that posted it: a bearer confirmation for our ACS, in response to
+// our request and not yet expired (SAML Profiles 4.1.4.2).
+func (p *SAMLProvider) confirmed(assertion *samlAssertion, requestID string, now time.Time) bool {
+	for _, confirmation := range assertion.Subject.Confirmations {
+		data := confirmation.Data
+		if confirmation.Method == samlBearer &&
+			data.Recipient == p.config.ACSURL &&
+			data.InResponseTo == requestID &&
+			now.Add(-samlClockSkew).Before(data.NotOnOrAfter) {
+			return true
+		}
+	}
+	return false
+}
+
+// identity reads the user attributes from a verified assertion.
+func (p *SAMLProvider) identity(assertion *samlAssertion) (*ExternalIdentity, error) {
+	mappings := p.config.AttributeMappings
+	nameID := assertion.Subject.NameID
+
+	subject := strings.TrimSpace(nameID.Value)
+	if mappings.Subject != "" {
+		subject = samlAttributeValue(assertion.Attributes, mappings.Subject)
+	}
+	if subject == "" {
+		return nil, errors.New("SAML assertion has no subject")
+	}
+
+	var email string
+	if mappings.Email != "" {
+		email = samlAttributeValue(assertion.Attributes, mappings.Email)
+	} else {
+		email = samlAttributeValue(assertion.Attributes, samlEmailAttributes...)
+		if email == "" && nameID.Format == samlNameIDEmail {
+			email = strings.TrimSpace(nameID.Value)
+		}
+	}
+
+	var name string
+	if mappings.Name != "" {
+		name = samlAttributeValue(assertion.Attributes, mappings.Name)
+	} else {
+		name = samlAttributeValue(assertion.Attributes, samlNameAttributes...)
+	}
+
+	return &ExternalIdentity{
+		Provider:      "saml:" + p.config.IdPEntityID,
+		Subject:       subject,
+		Email:         NormalizeEmail(email),
+		EmailVerified: p.config.TrustEmail,
+		Name:          name,
+	}, nil
+}
+
+// samlAttributeValue returns the first value of the first attribute whose
+// name or friendly name is one of names.
+func samlAttributeValue(attributes []samlAttribute, names ...string) string {
+	for _, name := range names {
+		for _, attr := range attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0])
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlTestIdPEntityID = "https://idp.example.com/metadata"
+	samlTestEntityID    = "https://idm.example.com/v1/auth/saml/acme/metadata"
+	samlTestACSURL      = "https://idm.example.com/v1/auth/saml/acme/acs"
+	samlTestNonce       = "bm9uY2UtMQ=="
+)
+
+// testSAMLIdP signs assertions with a locally generated certificate.
+type testSAMLIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestSAMLIdP(t *testing.T) *testSAMLIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return &testSAMLIdP{key: key, cert: cert}
+}
+
+func (idp *testSAMLIdP) provider(t *testing.T, mappings SAMLAttributeMappings) *SAMLProvider {
+	t.Helper()
+	provider, err := NewSAMLProvider(SAMLConfig{
+		Name:              "acme",
+		EntityID:          samlTestEntityID,
+		ACSURL:            samlTestACSURL,
+		IdPEntityID:       samlTestIdPEntityID,
+		IdPSSOURL:         "https://idp.example.com/sso",
+		IdPCertificates:   []*x509.Certificate{idp.cert},
+		AttributeMappings: mappings,
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewSAMLProvider: %v", err)
+	}
+	return provider
+}
+
+// samlTestResponse describes a response to build; the zero value is a valid
+// response to samlTestNonce.
+type samlTestResponse struct {
+	status       string
+	issuer       string
+	audience     string
+	recipient    string
+	inResponseTo string
+	notOnOrAfter time.Time
+	attributes   map[string]string
+
+	unsigned    bool
+	signWith    *testSAMLIdP                   // Another IdP's key
+	afterSign   func(assertion *etree.Element) // Tampers with the signed assertion
+	extraBefore bool                           // Adds an unsigned assertion before the signed one
+}
+
+func (idp *testSAMLIdP) response(t *testing.T, r samlTestResponse) string {
+	t.Helper()
+	if r.status == "" {
+		r.status = samlStatusSuccess
+	}
+	if r.issuer == "" {
+		r.issuer = samlTestIdPEntityID
+	}
+	if r.audience == "" {
+		r.audience = samlTestEntityID
+	}
+	if r.recipient == "" {
+		r.recipient = samlTestACSURL
+	}
+	if r.inResponseTo == "" {
+		r.inResponseTo = samlRequestID(samlTestNonce)
+	}
+	if r.notOnOrAfter.IsZero() {
+		r.notOnOrAfter = time.Now().Add(5 * time.Minute)
+	}
+	if r.attributes == nil {
+		r.attributes = map[string]string{
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "Jane@Example.com",
+			"http://schemas.microsoft.com/identity/claims/displayname":           "Jane Doe",
+		}
+	}
+	now := time.Now().UTC()
+
+	doc := etree.NewDocument()
+	resp := doc.CreateElement("samlp:Response")
+	resp.CreateAttr("xmlns:samlp", samlProtocolNS)
+	resp.CreateAttr("xmlns:saml", samlAssertionNS)
+	resp.CreateAttr("ID", "_response-1")
+	resp.CreateAttr("Version", "2.0")
+	resp.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	resp.CreateAttr("Destination", samlTestACSURL)
+	resp.CreateAttr("InResponseTo", r.inResponseTo)
+	resp.CreateElement("saml:Issuer").SetText(r.issuer)
+	resp.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", r.status)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", samlAssertionNS)
+	assertion.CreateAttr("ID", "_assertion-1")
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	assertion.CreateElement("saml:Issuer").SetText(r.issuer)
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent")
+	nameID.SetText("jane-1")
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", samlBearer)
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("InResponseTo", r.inResponseTo)
+	data.CreateAttr("NotOnOrAfter", r.notOnOrAfter.UTC().Format(time.RFC3339))
+	data.CreateAttr("Recipient", r.recipient)
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", now.Add(-time.Minute).Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", r.notOnOrAfter.UTC().Format(time.RFC3339))
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(r.audience)
+	statement := assertion.CreateElement("saml:AttributeStatement")
+	for name, value := range r.attributes {
+		attr := statement.CreateElement("saml:Attribute")
+		attr.CreateAttr("Name", name)
+		attr.CreateElement("saml:AttributeValue").SetText(value)
+	}
+
+	if r.extraBefore {
+		forged := assertion.Copy()
+		forged.FindElement("./Subject/NameID").SetText("admin")
+		resp.AddChild(forged)
+	}
+	if !r.unsigned {
+		signer := idp
+		if r.signWith != nil {
+			signer = r.signWith
+		}
+		ctx, err := dsig.NewSigningContext(signer.key, [][]byte{signer.cert.Raw})
+		if err != nil {
+			t.Fatalf("NewSigningContext: %v", err)
+		}
+		ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+		if assertion, err = ctx.SignEnveloped(assertion); err != nil {
+			t.Fatalf("SignEnveloped: %v", err)
+		}
+	}
+	if r.afterSign != nil {
+		r.afterSign(assertion)
+	}
+	resp.AddChild(assertion)
+
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("WriteToBytes: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestNewSAMLProvider_RequiresIdPCertificate(t *testing.T) {
+	_, err := NewSAMLProvider(SAMLConfig{
+		Name:        "acme",
+		EntityID:    samlTestEntityID,
+		ACSURL:      samlTestACSURL,
+		IdPEntityID: samlTestIdPEntityID,
+		IdPSSOURL:   "https://idp.example.com/sso",
+	}, nil, nil, nil)
+	if err == nil {
+		t.Error("NewSAMLProvider() should fail without IdP certificates")
+	}
+}
+
+func TestParseSAMLCertificates(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	inputs := map[string]string{
+		"PEM":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.cert.Raw})),
+		"base64 DER":  base64.StdEncoding.EncodeToString(idp.cert.Raw),
+		"wrapped DER": strings.Join(strings.SplitAfter(base64.StdEncoding.EncodeToString(idp.cert.Raw), "A"), "\n  "),
+	}
+	for name, input := range inputs {
+		certs, err := ParseSAMLCertificates(input)
+		if err != nil {
+			t.Errorf("%s: ParseSAMLCertificates: %v", name, err)
+			continue
+		}
+		if len(certs) != 1 || !certs[0].Equal(idp.cert) {
+			t.Errorf("%s: got %d certificates", name, len(certs))
+		}
+	}
+
+	if _, err := ParseSAMLCertificates("not a certificate"); err == nil {
+		t.Error("ParseSAMLCertificates() should fail on garbage")
+	}
+}
+
+func TestSAMLProvider_Metadata(t *testing.T) {
+	provider := newTestSAMLIdP(t).provider(t, SAMLAttributeMappings{})
+
+	metadata, err := provider.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(metadata); err != nil {
+		t.Fatalf("ReadFromBytes: %v", err)
+	}
+	if got := doc.Root().SelectAttrValue("entityID", ""); got != samlTestEntityID {
+		t.Errorf("entityID = %q", got)
+	}
+	acs := doc.FindElement("//AssertionConsumerService")
+	if acs == nil || acs.SelectAttrValue("Location", "") != samlTestACSURL || acs.SelectAttrValue("Binding", "") != samlHTTPPostBinding {
+		t.Errorf("AssertionConsumerService = %v", acs)
+	}
+}
+
+func TestSAMLProvider_AuthURL(t *testing.T) {
+	provider := newTestSAMLIdP(t).provider(t, SAMLAttributeMappings{})
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", samlTestNonce, "verifier")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if u.Host != "idp.example.com" || u.Path != "/sso" {
+		t.Errorf("AuthURL() = %s", authURL)
+	}
+	if got := u.Query().Get("RelayState"); got != "state-1" {
+		t.Errorf("RelayState = %q", got)
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("decode SAMLRequest: %v", err)
+	}
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("inflate SAMLRequest: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		t.Fatalf("ReadFromBytes: %v", err)
+	}
+	req := doc.Root()
+	if req.Tag != "AuthnRequest" || req.NamespaceURI() != samlProtocolNS {
+		t.Fatalf("root = %s", req.FullTag())
+	}
+	if got := req.SelectAttrValue("ID", ""); got != "_bm9uY2UtMQ" {
+		t.Errorf("ID = %q", got)
+	}
+	if got := req.SelectAttrValue("AssertionConsumerServiceURL", ""); got != samlTestACSURL {
+		t.Errorf("AssertionConsumerServiceURL = %q", got)
+	}
+	if issuer := req.FindElement("./Issuer"); issuer == nil || issuer.Text() != samlTestEntityID {
+		t.Errorf("Issuer = %v", issuer)
+	}
+}
+
+func TestSAMLProvider_Identify(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	provider := idp.provider(t, SAMLAttributeMappings{})
+
+	identity, err := provider.Identify(context.Background(), idp.response(t, samlTestResponse{}), samlTestNonce, "")
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	if identity.Provider != "saml:"+samlTestIdPEntityID {
+		t.Errorf("Provider = %q", identity.Provider)
+	}
+	if identity.Subject != "jane-1" || identity.Email != "jane@example.com" || identity.Name != "Jane Doe" {
+		t.Errorf("identity = %+v", identity)
+	}
+	if identity.EmailVerified {
+		t.Error("EmailVerified should be false unless the IdP's emails are trusted")
+	}
+}
+
+func TestSAMLProvider_IdentifyAttributeMappings(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	provider := idp.provider(t, SAMLAttributeMappings{Subject: "employeeID", Email: "upn", Name: "cn"})
+
+	response := idp.response(t, samlTestResponse{attributes: map[string]string{
+		"employeeID": "E123",
+		"upn":        "jane@corp.example.com",
+		"cn":         "Jane D.",
+		"email":      "ignored@example.com",
+	}})
+	identity, err := provider.Identify(context.Background(), response, samlTestNonce, "")
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	if identity.Subject != "E123" || identity.Email != "jane@corp.example.com" || identity.Name != "Jane D." {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestSAMLProvider_IdentifyRejects(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	provider := idp.provider(t, SAMLAttributeMappings{})
+
+	tests := []struct {
+		name     string
+		response samlTestResponse
+		nonce    string
+	}{
+		{name: "unsigned", response: samlTestResponse{unsigned: true}},
+		{name: "signed by another key", response: samlTestResponse{signWith: newTestSAMLIdP(t)}},
+		{name: "tampered", response: samlTestResponse{afterSign: func(assertion *etree.Element) {
+			assertion.FindElement("./Subject/NameID").SetText("admin")
+		}}},
+		{name: "wrapped", response: samlTestResponse{extraBefore: true}},
+		{name: "failure status", response: samlTestResponse{status: "urn:oasis:names:tc:SAML:2.0:status:Responder"}},
+		{name: "wrong issuer", response: samlTestResponse{issuer: "https://evil.example.com"}},
+		{name: "wrong audience", response: samlTestResponse{audience: "https://other.example.com"}},
+		{name: "wrong recipient", response: samlTestResponse{recipient: "https://other.example.com/acs"}},
+		{name: "expired", response: samlTestResponse{notOnOrAfter: time.Now().Add(-time.Hour)}},
+		{name: "other request", response: samlTestResponse{}, nonce: "b3RoZXI="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = samlTestNonce
+			}
+			if _, err := provider.Identify(context.Background(), idp.response(t, tt.response), nonce, ""); err == nil {
+				t.Error("Identify() should fail")
+			}
+		})
+	}
+}
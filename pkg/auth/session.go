@@ -3,8 +3,11 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -20,25 +23,56 @@ const (
 	// Default token lifetimes
 	DefaultAccessTokenTTL  = 15 * time.Minute
 	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+	// DefaultRefreshReuseGrace is how long a rotated refresh token is still
+	// accepted from the same client, to tolerate concurrent refreshes.
+	DefaultRefreshReuseGrace = 10 * time.Second
+
+	// DefaultClientTokenTTL is the lifetime of access tokens clients get for
+	// themselves. They cannot be refreshed or revoked, so it is kept short.
+	DefaultClientTokenTTL = 5 * time.Minute
+
+	// DefaultExchangedTokenTTL is the longest lifetime of access tokens
+	// clients exchange a user's token for. They never outlive that token.
+	DefaultExchangedTokenTTL = 5 * time.Minute
 )
 
 // SessionConfig holds session configuration.
 type SessionConfig struct {
 	AccessTokenTTL     time.Duration
 	RefreshTokenTTL    time.Duration
+	ClientTokenTTL     time.Duration // Client credentials tokens (default: 5m)
+	ExchangedTokenTTL  time.Duration // Token exchange tokens (default: 5m)
+	RefreshReuseGrace  time.Duration
 	JWTSecret          []byte
+	SigningKey         *SigningKey // Overrides JWTSecret, e.g. for RS256/ES256/EdDSA signing
+	Keys               KeySource   // Rotating key ring; overrides SigningKey and JWTSecret
 	Issuer             string
 	FingerprintEnabled bool
 	DetectReuseEnabled bool
 	AccessTokenIssuer  AccessTokenIssuer
+
+	// IdleTimeout ends sessions that have not been refreshed for this long (0 = no limit).
+	IdleTimeout time.Duration
+	// MaxLifetime ends sessions this long after login, even if they stay active (0 = no limit).
+	MaxLifetime time.Duration
+	// RolePolicies override IdleTimeout and MaxLifetime for users with a role.
+	// The strictest limit among the defaults and the user's roles applies.
+	RolePolicies map[string]SessionPolicy
+
+	// RevocationCheck makes CheckSession reject access tokens whose session
+	// has been revoked, instead of trusting them until they expire.
+	RevocationCheck    bool
+	RevocationCacheTTL time.Duration // How long lookups are cached (default: 30s)
 }
 
 // SessionService handles session management (the IssueSession function from the design).
 type SessionService struct {
-	config   SessionConfig
-	sessions *repository.SessionsRepository
-	users    *repository.UsersRepository
-	roles    *repository.RolesRepository
+	config      SessionConfig
+	sessions    *repository.SessionsRepository
+	users       *repository.UsersRepository
+	roles       *repository.RolesRepository
+	revocations *revocationCache
 }
 
 // NewSessionService creates a new session service (no role claims).
@@ -54,12 +88,28 @@ func NewSessionServiceWithRoles(config SessionConfig, sessions *repository.Sessi
 	if config.RefreshTokenTTL == 0 {
 		config.RefreshTokenTTL = DefaultRefreshTokenTTL
 	}
-	return &SessionService{
+	if config.RefreshReuseGrace == 0 {
+		config.RefreshReuseGrace = DefaultRefreshReuseGrace
+	}
+	if config.ClientTokenTTL == 0 {
+		config.ClientTokenTTL = DefaultClientTokenTTL
+	}
+	if config.ExchangedTokenTTL == 0 {
+		config.ExchangedTokenTTL = DefaultExchangedTokenTTL
+	}
+	if config.RevocationCacheTTL == 0 {
+		config.RevocationCacheTTL = DefaultRevocationCacheTTL
+	}
+	s := &SessionService{
 		config:   config,
 		sessions: sessions,
 		users:    users,
 		roles:    roles,
 	}
+	if config.RevocationCheck {
+		s.revocations = newRevocationCache(config.RevocationCacheTTL, sessions.GetByID)
+	}
+	return s
 }
 
 // AccessTokenTTL returns the access token TTL.
@@ -72,6 +122,11 @@ func (s *SessionService) RefreshTokenTTL() time.Duration {
 	return s.config.RefreshTokenTTL
 }
 
+// Issuer returns the issuer claim of the tokens the service signs.
+func (s *SessionService) Issuer() string {
+	return s.config.Issuer
+}
+
 // IssueSessionOpts holds options for session issuance.
 type IssueSessionOpts struct {
 	// IP address of the client
@@ -82,6 +137,9 @@ type IssueSessionOpts struct {
 	Request *http.Request
 	// MFAVerified indicates whether MFA was verified for this session
 	MFAVerified bool
+	// ClientID is the OAuth client the session is issued to or refreshed by.
+	// A session issued to a client can only be refreshed by that client.
+	ClientID string
 }
 
 // AccessTokenIssueInput provides context for custom access token issuance.
@@ -93,9 +151,22 @@ type AccessTokenIssueInput struct {
 	ExpiresAt   time.Time
 	Issuer      string
 	MFAVerified bool
+
+	// Set when a client exchanges a token (see ExchangeToken). Issuers must
+	// put them in the token, or it is not narrowed.
+	Audience []string
+	Scope    string
+	Actor    *ActorClaim
+
+	// ClientID is set, and User is nil, when a client gets a token for itself
+	// with the client credentials grant (see IssueClientToken). Issuers must
+	// use it as both the subject and the "client_id" claim, and add Scope.
+	ClientID string
 }
 
 // AccessTokenIssuer issues access tokens, allowing custom implementations.
+// Tokens this service validates itself must not carry the "nonce" or
+// "auth_time" claims, which mark ID tokens.
 type AccessTokenIssuer interface {
 	IssueAccessToken(ctx context.Context, input AccessTokenIssueInput) (string, error)
 }
@@ -103,11 +174,43 @@ type AccessTokenIssuer interface {
 // AccessTokenClaims represents the claims in an access token.
 type AccessTokenClaims struct {
 	jwt.RegisteredClaims
-	Email         string   `json:"email,omitempty"`
-	EmailVerified bool     `json:"email_verified,omitempty"`
-	Name          string   `json:"name,omitempty"`
-	Roles         []string `json:"roles,omitempty"`
-	MFAVerified   bool     `json:"mfa_verified,omitempty"`
+	Email         string      `json:"email,omitempty"`
+	EmailVerified bool        `json:"email_verified,omitempty"`
+	Name          string      `json:"name,omitempty"`
+	Roles         []string    `json:"roles,omitempty"`
+	MFAVerified   bool        `json:"mfa_verified,omitempty"`
+	ClientID      string      `json:"client_id,omitempty"` // Set on client credentials tokens
+	Scope         string      `json:"scope,omitempty"`
+	Actor         *ActorClaim `json:"act,omitempty"` // Set on exchanged tokens
+}
+
+// ActorClaim identifies the client a token was exchanged by (RFC 8693
+// section 4.1). A token exchanged again nests the earlier actor.
+type ActorClaim struct {
+	Subject string      `json:"sub"`
+	Actor   *ActorClaim `json:"act,omitempty"`
+}
+
+// IsClient reports whether the token was issued to a registered client for
+// itself, with the client credentials grant. Its subject is then the client
+// ID rather than a user ID.
+func (c *AccessTokenClaims) IsClient() bool {
+	return c.ClientID != "" && c.Subject == c.ClientID
+}
+
+// IntendedForIDM reports whether an access token may be used on this
+// service's own routes: it has no audience, or its audience names the issuer.
+// Exchanged tokens are meant for the services in their audience instead.
+func (s *SessionService) IntendedForIDM(claims *AccessTokenClaims) bool {
+	return len(claims.Audience) == 0 || (s.config.Issuer != "" && slices.Contains(claims.Audience, s.config.Issuer))
+}
+
+// accessTokenValidation parses an access token along with the ID token
+// claims that must not appear in one.
+type accessTokenValidation struct {
+	AccessTokenClaims
+	Nonce    *string `json:"nonce,omitempty"`
+	AuthTime *int64  `json:"auth_time,omitempty"`
 }
 
 // IssueSession creates a new session and returns access/refresh tokens.
@@ -133,6 +236,19 @@ func (s *SessionService) IssueSession(ctx context.Context, userID uuid.UUID, opt
 		"email", user.Email,
 	)
 
+	// Roles are injected into the access token and select the session policy.
+	// We deliberately fail-hard here: if roles cannot be loaded we abort
+	// issuance rather than mint a token with missing roles, so a token always
+	// reflects the user's true roles.
+	roles, err := s.getUserRoleNames(ctx, user.ID)
+	if err != nil {
+		slog.Error("SessionService.IssueSession: failed to get user roles",
+			"user_id", user.ID,
+			"error", err,
+		)
+		return nil, err
+	}
+
 	now := time.Now()
 
 	// Generate refresh token (opaque, stored hashed)
@@ -149,11 +265,14 @@ func (s *SessionService) IssueSession(ctx context.Context, userID uuid.UUID, opt
 	// Create session in database
 	sessionID := uuid.New()
 	session := &domain.Session{
-		ID:        sessionID,
-		UserID:    userID,
-		TokenHash: refreshTokenHash,
-		CreatedAt: now,
-		ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+		ID:         sessionID,
+		UserID:     userID,
+		FamilyID:   sessionID,
+		TokenHash:  refreshTokenHash,
+		CreatedAt:  now,
+		ExpiresAt:  s.policyFor(roles).expiresAt(now, now, s.config.RefreshTokenTTL),
+		LastSeenAt: &now,
+		ClientID:   opts.ClientID,
 	}
 
 	slog.Debug("SessionService.IssueSession: creating session record",
@@ -195,20 +314,8 @@ func (s *SessionService) IssueSession(ctx context.Context, userID uuid.UUID, opt
 		"user_id", userID,
 	)
 
-	// Roles are injected into the access token. We deliberately fail-hard here:
-	// if roles cannot be loaded we abort issuance rather than mint a token with
-	// missing roles, so a token always reflects the user's true roles.
 	// Generate access token (JWT)
-	roles, err := s.getUserRoleNames(ctx, user.ID)
-	if err != nil {
-		slog.Error("SessionService.IssueSession: failed to get user roles",
-			"session_id", sessionID,
-			"user_id", user.ID,
-			"error", err,
-		)
-		return nil, err
-	}
-	accessTokenExpiry := now.Add(s.config.AccessTokenTTL)
+	accessTokenExpiry := accessTokenExpiresAt(now, s.config.AccessTokenTTL, session.ExpiresAt)
 	accessToken, err := s.issueAccessToken(ctx, user, roles, sessionID, now, accessTokenExpiry, opts)
 	if err != nil {
 		slog.Error("SessionService.IssueSession: failed to sign access token",
@@ -229,12 +336,17 @@ func (s *SessionService) IssueSession(ctx context.Context, userID uuid.UUID, opt
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+		ExpiresIn:    int(accessTokenExpiry.Sub(now).Seconds()),
 		ExpiresAt:    accessTokenExpiry,
 	}, nil
 }
 
-// RefreshSession refreshes an access token using a refresh token.
+// RefreshSession exchanges a refresh token for a new access/refresh token pair.
+// Every refresh rotates the refresh token: the presented token is marked as
+// rotated and a new token in the same family is returned. Presenting a token
+// that was already rotated revokes the whole family and returns
+// domain.ErrRefreshTokenReused, unless it comes from the same client within
+// the RefreshReuseGrace window (concurrent refreshes).
 func (s *SessionService) RefreshSession(ctx context.Context, refreshToken string, opts IssueSessionOpts) (*domain.TokenPair, error) {
 	tokenHash := HashToken(refreshToken)
 
@@ -243,7 +355,124 @@ func (s *SessionService) RefreshSession(ctx context.Context, refreshToken string
 	if err != nil {
 		return nil, err
 	}
+	if session.ClientID != opts.ClientID {
+		slog.Warn("SessionService.RefreshSession: refresh token presented by another client",
+			"session_id", session.ID,
+			"session_client_id", session.ClientID,
+			"client_id", opts.ClientID,
+		)
+		return nil, domain.ErrSessionNotFound
+	}
+
+	// A concurrent refresh may win the rotation race between our read and our
+	// write; retry once against the family's current token in that case.
+	for attempt := 0; ; attempt++ {
+		if session.IsRotated() {
+			return s.resolveRotatedSession(ctx, session, refreshToken, opts)
+		}
+
+		tokens, err := s.rotateSession(ctx, session, refreshToken, opts)
+		if errors.Is(err, domain.ErrSessionRotated) && attempt == 0 {
+			session, err = s.sessions.GetByID(ctx, session.ID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return tokens, err
+	}
+}
 
+// resolveRotatedSession handles a refresh token that has already been rotated.
+// Within the grace window and from the same client, the refresh token the
+// rotation already issued is returned again with a new access token, so
+// concurrent refreshes all end up holding the family's current token.
+// Otherwise the token is treated as stolen and the whole family is revoked.
+func (s *SessionService) resolveRotatedSession(ctx context.Context, session *domain.Session, refreshToken string, opts IssueSessionOpts) (*domain.TokenPair, error) {
+	if s.config.RefreshReuseGrace > 0 &&
+		time.Since(*session.RotatedAt) <= s.config.RefreshReuseGrace &&
+		isSameClient(session, opts) &&
+		session.ReplacedBy != nil && session.ReplacementToken != "" {
+		tokens, err := s.reissueReplacement(ctx, session, refreshToken, opts)
+		if err == nil {
+			slog.Debug("SessionService.RefreshSession: rotated token reused within grace window",
+				"session_id", session.ID,
+				"replaced_by", *session.ReplacedBy,
+				"family_id", session.FamilyID,
+			)
+			return tokens, nil
+		}
+		if !errors.Is(err, errReplacementUnavailable) {
+			return nil, err
+		}
+	}
+
+	slog.Warn("SessionService.RefreshSession: refresh token reuse detected, revoking session family",
+		"session_id", session.ID,
+		"family_id", session.FamilyID,
+		"user_id", session.UserID,
+		"client_ip", opts.IP,
+	)
+	if err := s.sessions.RevokeFamily(ctx, session.FamilyID); err != nil {
+		slog.Error("SessionService.RefreshSession: failed to revoke session family",
+			"family_id", session.FamilyID,
+			"error", err,
+		)
+		return nil, err
+	}
+	return nil, domain.ErrRefreshTokenReused
+}
+
+// errReplacementUnavailable reports that a rotated session's replacement can
+// no longer be handed out, e.g. because it was itself rotated or revoked.
+var errReplacementUnavailable = errors.New("session replacement unavailable")
+
+// reissueReplacement returns the refresh token that rotating session produced,
+// together with a new access token for the replacement session.
+func (s *SessionService) reissueReplacement(ctx context.Context, session *domain.Session, refreshToken string, opts IssueSessionOpts) (*domain.TokenPair, error) {
+	replacementToken, err := openReplacementToken(refreshToken, session.ReplacementToken)
+	if err != nil {
+		return nil, errReplacementUnavailable
+	}
+	next, err := s.sessions.GetByID(ctx, *session.ReplacedBy)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return nil, errReplacementUnavailable
+		}
+		return nil, err
+	}
+	if next.IsRotated() || !next.IsValid() || next.TokenHash != HashToken(replacementToken) {
+		return nil, errReplacementUnavailable
+	}
+
+	user, err := s.users.GetByID(ctx, next.UserID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.getUserRoleNames(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessTokenExpiry := accessTokenExpiresAt(now, s.config.AccessTokenTTL, next.ExpiresAt)
+	accessToken, err := s.issueAccessToken(ctx, user, roles, next.ID, now, accessTokenExpiry, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: replacementToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenExpiry.Sub(now).Seconds()),
+		ExpiresAt:    accessTokenExpiry,
+	}, nil
+}
+
+// rotateSession validates the current session of a family, replaces it with a
+// new session holding a fresh refresh token and issues a new access token.
+func (s *SessionService) rotateSession(ctx context.Context, session *domain.Session, currentToken string, opts IssueSessionOpts) (*domain.TokenPair, error) {
 	// Check if session is valid
 	if !session.IsValid() {
 		if session.RevokedAt != nil {
@@ -252,27 +481,26 @@ func (s *SessionService) RefreshSession(ctx context.Context, refreshToken string
 		return nil, domain.ErrSessionExpired
 	}
 
+	var metadata domain.SessionMetadata
+	if len(session.Metadata) > 0 {
+		_ = json.Unmarshal(session.Metadata, &metadata)
+	}
+
 	// Validate fingerprint if enabled
-	if s.config.FingerprintEnabled && opts.Request != nil && len(session.Metadata) > 0 {
-		var metadata domain.SessionMetadata
-		if err := json.Unmarshal(session.Metadata, &metadata); err == nil && metadata.FingerprintHash != "" {
-			currentFp := GenerateFingerprint(opts.Request)
-
-			// Check if fingerprint matches
-			if metadata.FingerprintHash != currentFp.Hash {
-				// Fingerprint mismatch - possible token theft
-				if s.config.DetectReuseEnabled {
-					// Revoke the session for security
-					_ = s.sessions.Revoke(ctx, session.ID)
-					return nil, domain.ErrSessionFingerprint
-				}
+	if s.config.FingerprintEnabled && opts.Request != nil && metadata.FingerprintHash != "" {
+		currentFp := GenerateFingerprint(opts.Request)
+
+		// Check if fingerprint matches
+		if metadata.FingerprintHash != currentFp.Hash {
+			// Fingerprint mismatch - possible token theft
+			if s.config.DetectReuseEnabled {
+				// Revoke the session family for security
+				_ = s.sessions.RevokeFamily(ctx, session.FamilyID)
+				return nil, domain.ErrSessionFingerprint
 			}
 		}
 	}
 
-	// Update last seen
-	_ = s.sessions.UpdateLastSeen(ctx, session.ID)
-
 	// Get user for new access token
 	user, err := s.users.GetByID(ctx, session.UserID)
 	if err != nil {
@@ -289,31 +517,234 @@ func (s *SessionService) RefreshSession(ctx context.Context, refreshToken string
 		)
 		return nil, err
 	}
+
+	// Enforce idle timeout and maximum lifetime for the user's roles
 	now := time.Now()
-	accessTokenExpiry := now.Add(s.config.AccessTokenTTL)
-	accessToken, err := s.issueAccessToken(ctx, user, roles, session.ID, now, accessTokenExpiry, opts)
+	policy := s.policyFor(roles)
+	if reason := policy.violation(session, now); reason != "" {
+		slog.Info("SessionService.RefreshSession: session ended by policy",
+			"session_id", session.ID,
+			"family_id", session.FamilyID,
+			"user_id", user.ID,
+			"reason", reason,
+		)
+		if err := s.sessions.RevokeFamily(ctx, session.FamilyID); err != nil {
+			return nil, err
+		}
+		if s.revocations != nil {
+			s.revocations.forgetUser(user.ID)
+		}
+		return nil, domain.ErrSessionExpired
+	}
+
+	refreshToken, err := GenerateToken(refreshTokenLen)
 	if err != nil {
 		return nil, err
 	}
 
+	// Fingerprint data is carried over from the original login; the latest
+	// client address and user agent replace the previous ones.
+	if opts.IP != "" {
+		metadata.IP = opts.IP
+	}
+	if opts.UserAgent != "" {
+		metadata.UserAgent = opts.UserAgent
+	}
+	metadataJSON := session.Metadata
+	if opts.IP != "" || opts.UserAgent != "" {
+		metadataJSON, _ = json.Marshal(metadata)
+	}
+
+	// CreatedAt is carried over so it always reflects the original login;
+	// LastSeenAt records this refresh.
+	next := &domain.Session{
+		ID:         uuid.New(),
+		UserID:     session.UserID,
+		FamilyID:   session.FamilyID,
+		TokenHash:  HashToken(refreshToken),
+		CreatedAt:  session.CreatedAt,
+		ExpiresAt:  policy.expiresAt(session.CreatedAt, now, s.config.RefreshTokenTTL),
+		LastSeenAt: &now,
+		ClientID:   session.ClientID,
+		Metadata:   metadataJSON,
+	}
+	sealed, err := sealReplacementToken(currentToken, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Rotate(ctx, session.ID, next, sealed); err != nil {
+		return nil, err
+	}
+
+	accessTokenExpiry := accessTokenExpiresAt(now, s.config.AccessTokenTTL, next.ExpiresAt)
+	accessToken, err := s.issueAccessToken(ctx, user, roles, next.ID, now, accessTokenExpiry, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("SessionService.RefreshSession: refresh token rotated",
+		"session_id", next.ID,
+		"previous_session_id", session.ID,
+		"family_id", session.FamilyID,
+	)
+
 	return &domain.TokenPair{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken, // Return same refresh token
+		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+		ExpiresIn:    int(accessTokenExpiry.Sub(now).Seconds()),
 		ExpiresAt:    accessTokenExpiry,
 	}, nil
 }
 
-// RevokeSession revokes a session by refresh token.
+// isSameClient reports whether a refresh comes from the client recorded on the session.
+// Ports are ignored since concurrent requests typically use separate connections.
+func isSameClient(session *domain.Session, opts IssueSessionOpts) bool {
+	var metadata domain.SessionMetadata
+	if len(session.Metadata) == 0 || json.Unmarshal(session.Metadata, &metadata) != nil {
+		return false
+	}
+	return metadata.UserAgent == opts.UserAgent && hostOnly(metadata.IP) == hostOnly(opts.IP)
+}
+
+// hostOnly strips the port from an "IP:port" address.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// RevokeSession revokes the session family a refresh token belongs to.
 func (s *SessionService) RevokeSession(ctx context.Context, refreshToken string) error {
 	tokenHash := HashToken(refreshToken)
+	if s.revocations != nil {
+		// Look the session up first; revoked sessions are not returned by hash.
+		if session, err := s.sessions.GetByTokenHash(ctx, tokenHash); err == nil {
+			defer s.revocations.forgetUser(session.UserID)
+		}
+	}
 	return s.sessions.RevokeByTokenHash(ctx, tokenHash)
 }
 
 // RevokeAllSessions revokes all sessions for a user.
 func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
-	return s.sessions.RevokeAllByUserID(ctx, userID)
+	if err := s.sessions.RevokeAllByUserID(ctx, userID); err != nil {
+		return err
+	}
+	if s.revocations != nil {
+		s.revocations.forgetUser(userID)
+	}
+	return nil
+}
+
+// DeviceSession describes one signed-in device of a user.
+type DeviceSession struct {
+	// ID is the session family ID, which stays the same across refresh token rotation.
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	LastSeenAt *time.Time
+	IP         string
+	UserAgent  string
+	// Current is true for the session the request was made with.
+	Current bool
+}
+
+// ListSessions returns a user's active sessions, newest first.
+// currentSessionID is the "jti" of the caller's access token and may be uuid.Nil.
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]DeviceSession, error) {
+	sessions, err := s.sessions.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	currentFamily := s.SessionFamily(ctx, userID, currentSessionID)
+
+	devices := make([]DeviceSession, 0, len(sessions))
+	for _, session := range sessions {
+		var metadata domain.SessionMetadata
+		if len(session.Metadata) > 0 {
+			_ = json.Unmarshal(session.Metadata, &metadata)
+		}
+		devices = append(devices, DeviceSession{
+			ID:         session.FamilyID,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			IP:         hostOnly(metadata.IP),
+			UserAgent:  metadata.UserAgent,
+			Current:    currentFamily != uuid.Nil && session.FamilyID == currentFamily,
+		})
+	}
+	return devices, nil
+}
+
+// RevokeUserSession revokes one of a user's sessions by its DeviceSession ID.
+// Returns domain.ErrSessionNotFound if the session is not active or belongs to another user.
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	session, err := s.sessions.GetActiveByFamilyID(ctx, familyID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return domain.ErrSessionNotFound
+	}
+	if err := s.sessions.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	if s.revocations != nil {
+		s.revocations.forgetUser(userID)
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes all of a user's sessions except the one the
+// current access token was issued for.
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) error {
+	currentFamily := s.SessionFamily(ctx, userID, currentSessionID)
+	if currentFamily == uuid.Nil {
+		return domain.ErrSessionNotFound
+	}
+	if err := s.sessions.RevokeAllByUserIDExcept(ctx, userID, currentFamily); err != nil {
+		return err
+	}
+	if s.revocations != nil {
+		s.revocations.forgetUser(userID)
+	}
+	return nil
+}
+
+// SessionFamily returns the DeviceSession ID that a user's session (such as an
+// access token's "jti") belongs to, or uuid.Nil if it is unknown.
+func (s *SessionService) SessionFamily(ctx context.Context, userID, sessionID uuid.UUID) uuid.UUID {
+	if sessionID == uuid.Nil {
+		return uuid.Nil
+	}
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		return uuid.Nil
+	}
+	return session.FamilyID
+}
+
+// AuthTime returns when the user signed in to the session an access token
+// belongs to. Refreshes do not change it: rotated sessions keep the family's
+// original CreatedAt.
+func (s *SessionService) AuthTime(ctx context.Context, claims *AccessTokenClaims) (time.Time, error) {
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return time.Time{}, domain.ErrSessionNotFound
+	}
+	sessionID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return time.Time{}, domain.ErrSessionNotFound
+	}
+	session, err := s.sessions.GetByID(ctx, sessionID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if session.UserID != userID {
+		return time.Time{}, domain.ErrSessionNotFound
+	}
+	return session.CreatedAt, nil
 }
 
 // ValidateAccessToken validates an access token and returns the claims.
@@ -328,14 +759,20 @@ func (s *SessionService) ValidateAccessToken(tokenString string) (*AccessTokenCl
 		"token_prefix", maskedToken,
 	)
 
-	token, err := jwt.ParseWithClaims(tokenString, &AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			slog.Warn("SessionService.ValidateAccessToken: unexpected signing method",
-				"method", token.Header["alg"],
-			)
-			return nil, domain.ErrInvalidToken
+	token, err := jwt.ParseWithClaims(tokenString, &accessTokenValidation{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := s.keySource().VerificationKey(context.Background(), kid)
+		if err == nil {
+			var verifyKey interface{}
+			if verifyKey, err = key.verificationKey(token); err == nil {
+				return verifyKey, nil
+			}
 		}
-		return s.config.JWTSecret, nil
+		slog.Warn("SessionService.ValidateAccessToken: token not signed by a known key",
+			"method", token.Header["alg"],
+			"kid", token.Header["kid"],
+		)
+		return nil, domain.ErrInvalidToken
 	})
 	if err != nil {
 		slog.Debug("SessionService.ValidateAccessToken: token parsing failed",
@@ -344,26 +781,40 @@ func (s *SessionService) ValidateAccessToken(tokenString string) (*AccessTokenCl
 		return nil, domain.ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(*AccessTokenClaims)
+	claims, ok := token.Claims.(*accessTokenValidation)
 	if !ok || !token.Valid {
 		slog.Warn("SessionService.ValidateAccessToken: invalid token claims")
 		return nil, domain.ErrInvalidToken
 	}
 
+	// ID tokens are signed with the same keys. Access tokens from custom
+	// issuers or older releases may lack the "typ" header, so tell them
+	// apart by the claims only ID tokens carry.
+	if claims.Nonce != nil || claims.AuthTime != nil {
+		slog.Debug("SessionService.ValidateAccessToken: ID token used as access token",
+			"subject", claims.Subject,
+		)
+		return nil, domain.ErrInvalidToken
+	}
+
 	slog.Debug("SessionService.ValidateAccessToken: token valid",
 		"subject", claims.Subject,
 		"expires_at", claims.ExpiresAt,
 	)
 
-	return claims, nil
+	return &claims.AccessTokenClaims, nil
 }
 
-// GetUserIDFromToken extracts the user ID from an access token.
+// GetUserIDFromToken extracts the user ID from an access token. Client
+// tokens have no user and return domain.ErrInvalidToken.
 func (s *SessionService) GetUserIDFromToken(tokenString string) (uuid.UUID, error) {
 	claims, err := s.ValidateAccessToken(tokenString)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	if claims.IsClient() {
+		return uuid.Nil, domain.ErrInvalidToken
+	}
 
 	return uuid.Parse(claims.Subject)
 }
@@ -408,8 +859,56 @@ func (s *SessionService) issueAccessToken(
 		MFAVerified:   !user.MFAEnabled || opts.MFAVerified,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.config.JWTSecret)
+	key, err := s.keySource().SigningKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return key.SignAccessToken(claims)
+}
+
+// keySource returns the configured keys, falling back to HS256 with JWTSecret.
+func (s *SessionService) keySource() KeySource {
+	if s.config.Keys != nil {
+		return s.config.Keys
+	}
+	if s.config.SigningKey != nil {
+		return staticKeys{key: s.config.SigningKey}
+	}
+	return staticKeys{key: NewHMACSigningKey("", s.config.JWTSecret)}
+}
+
+// JWKS returns the public keys that verify access tokens.
+// The set is empty when tokens are signed with a shared HS256 secret.
+func (s *SessionService) JWKS(ctx context.Context) JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keySource().PublicKeys(ctx) {
+		if jwk, ok := key.PublicJWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// SigningAlgorithms returns the algorithms tokens are currently signed with:
+// that of the active key and of any published keys.
+func (s *SessionService) SigningAlgorithms(ctx context.Context) []string {
+	var algorithms []string
+	add := func(algorithm string) {
+		for _, a := range algorithms {
+			if a == algorithm {
+				return
+			}
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+
+	if key, err := s.keySource().SigningKey(ctx); err == nil {
+		add(key.Algorithm())
+	}
+	for _, key := range s.keySource().PublicKeys(ctx) {
+		add(key.Algorithm())
+	}
+	return algorithms
 }
 
 func (s *SessionService) getUserRoleNames(ctx context.Context, userID uuid.UUID) ([]string, error) {
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// SessionPolicy limits how long a session stays usable, on top of the sliding
+// RefreshTokenTTL. Zero values mean no limit.
+type SessionPolicy struct {
+	// IdleTimeout ends a session that has not been refreshed for this long.
+	// It should be longer than the access token TTL.
+	IdleTimeout time.Duration
+	// MaxLifetime ends a session this long after login, however active it is.
+	MaxLifetime time.Duration
+}
+
+// policyFor returns the policy for a user with the given roles: for each limit,
+// the strictest of the default policy and the policies of the user's roles.
+func (s *SessionService) policyFor(roles []string) SessionPolicy {
+	policy := SessionPolicy{
+		IdleTimeout: s.config.IdleTimeout,
+		MaxLifetime: s.config.MaxLifetime,
+	}
+	for _, role := range roles {
+		rolePolicy, ok := s.config.RolePolicies[role]
+		if !ok {
+			continue
+		}
+		policy.IdleTimeout = stricter(policy.IdleTimeout, rolePolicy.IdleTimeout)
+		policy.MaxLifetime = stricter(policy.MaxLifetime, rolePolicy.MaxLifetime)
+	}
+	return policy
+}
+
+// stricter returns the shorter of two limits, treating zero as no limit.
+func stricter(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// expiresAt returns when a refresh token issued at now expires: after ttl,
+// but no later than the idle timeout or the session's maximum lifetime.
+func (p SessionPolicy) expiresAt(loginAt, now time.Time, ttl time.Duration) time.Time {
+	expiresAt := now.Add(ttl)
+	if p.IdleTimeout > 0 && now.Add(p.IdleTimeout).Before(expiresAt) {
+		expiresAt = now.Add(p.IdleTimeout)
+	}
+	if p.MaxLifetime > 0 && loginAt.Add(p.MaxLifetime).Before(expiresAt) {
+		expiresAt = loginAt.Add(p.MaxLifetime)
+	}
+	return expiresAt
+}
+
+// violation returns why the policy no longer allows refreshing the session,
+// or "" if it does. Sessions without a recorded last_seen_at (issued before it
+// was tracked) are not subject to the idle timeout.
+func (p SessionPolicy) violation(session *domain.Session, now time.Time) string {
+	if p.MaxLifetime > 0 && now.Sub(session.CreatedAt) > p.MaxLifetime {
+		return "max_lifetime"
+	}
+	if p.IdleTimeout > 0 && session.LastSeenAt != nil && now.Sub(*session.LastSeenAt) > p.IdleTimeout {
+		return "idle_timeout"
+	}
+	return ""
+}
+
+// accessTokenExpiresAt returns when an access token issued at now expires:
+// after ttl, but never after the session it belongs to.
+func accessTokenExpiresAt(now time.Time, ttl time.Duration, sessionExpiresAt time.Time) time.Time {
+	expiresAt := now.Add(ttl)
+	if sessionExpiresAt.Before(expiresAt) {
+		return sessionExpiresAt
+	}
+	return expiresAt
+}
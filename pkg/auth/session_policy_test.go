@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestSessionService_PolicyForUsesStrictestLimits(t *testing.T) {
+	svc := &SessionService{config: SessionConfig{
+		IdleTimeout: 24 * time.Hour,
+		RolePolicies: map[string]SessionPolicy{
+			"admin":   {IdleTimeout: 30 * time.Minute, MaxLifetime: 8 * time.Hour},
+			"support": {IdleTimeout: time.Hour, MaxLifetime: 4 * time.Hour},
+		},
+	}}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  SessionPolicy
+	}{
+		{"no roles", nil, SessionPolicy{IdleTimeout: 24 * time.Hour}},
+		{"unknown role", []string{"editor"}, SessionPolicy{IdleTimeout: 24 * time.Hour}},
+		{"admin", []string{"admin"}, SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: 8 * time.Hour}},
+		{"admin and support", []string{"support", "admin"}, SessionPolicy{IdleTimeout: 30 * time.Minute, MaxLifetime: 4 * time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.policyFor(tt.roles); got != tt.want {
+				t.Errorf("policyFor(%v) = %+v, want %+v", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionPolicy_ExpiresAt(t *testing.T) {
+	login := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	now := login.Add(6 * time.Hour)
+	ttl := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name   string
+		policy SessionPolicy
+		want   time.Time
+	}{
+		{"no limits", SessionPolicy{}, now.Add(ttl)},
+		{"idle timeout", SessionPolicy{IdleTimeout: time.Hour}, now.Add(time.Hour)},
+		{"max lifetime", SessionPolicy{MaxLifetime: 8 * time.Hour}, login.Add(8 * time.Hour)},
+		{"both", SessionPolicy{IdleTimeout: 4 * time.Hour, MaxLifetime: 8 * time.Hour}, login.Add(8 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.expiresAt(login, now, ttl); !got.Equal(tt.want) {
+				t.Errorf("expiresAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionPolicy_Violation(t *testing.T) {
+	now := time.Now()
+	lastSeen := now.Add(-2 * time.Hour)
+	session := &domain.Session{CreatedAt: now.Add(-10 * time.Hour), LastSeenAt: &lastSeen}
+
+	tests := []struct {
+		name    string
+		policy  SessionPolicy
+		session *domain.Session
+		want    string
+	}{
+		{"no limits", SessionPolicy{}, session, ""},
+		{"within limits", SessionPolicy{IdleTimeout: 3 * time.Hour, MaxLifetime: 12 * time.Hour}, session, ""},
+		{"idle", SessionPolicy{IdleTimeout: time.Hour}, session, "idle_timeout"},
+		{"too old", SessionPolicy{IdleTimeout: time.Hour, MaxLifetime: 8 * time.Hour}, session, "max_lifetime"},
+		{"legacy session without last seen", SessionPolicy{IdleTimeout: time.Hour}, &domain.Session{CreatedAt: session.CreatedAt}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.violation(tt.session, now); got != tt.want {
+				t.Errorf("violation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTokenExpiresAt_CappedBySession(t *testing.T) {
+	now := time.Now()
+
+	if got := accessTokenExpiresAt(now, 15*time.Minute, now.Add(time.Hour)); !got.Equal(now.Add(15 * time.Minute)) {
+		t.Errorf("accessTokenExpiresAt() = %v, want access token TTL", got)
+	}
+	if got := accessTokenExpiresAt(now, 15*time.Minute, now.Add(5*time.Minute)); !got.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("accessTokenExpiresAt() = %v, want session expiry", got)
+	}
+}
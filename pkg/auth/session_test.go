@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -115,6 +116,53 @@ func TestSessionService_ValidateAccessToken_WrongSecret(t *testing.T) {
 	}
 }
 
+func TestSessionService_ValidateAccessToken_LegacyToken(t *testing.T) {
+	secret := []byte("test-secret-key-32-characters-lo")
+	service := &SessionService{config: SessionConfig{JWTSecret: secret}}
+
+	// Tokens issued before access tokens carried typ at+jwt, or by custom
+	// issuers, may have no "typ" header at all.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+		},
+	})
+	delete(token.Header, "typ")
+	tokenString, _ := token.SignedString(secret)
+
+	if _, err := service.ValidateAccessToken(tokenString); err != nil {
+		t.Errorf("ValidateAccessToken should accept a token without typ: %v", err)
+	}
+}
+
+func TestSessionService_ValidateAccessToken_IDTokenClaims(t *testing.T) {
+	secret := []byte("test-secret-key-32-characters-lo")
+	service := &SessionService{config: SessionConfig{JWTSecret: secret}}
+	registered := jwt.RegisteredClaims{
+		Subject:   uuid.New().String(),
+		Audience:  jwt.ClaimStrings{"client-id"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+	}
+
+	tests := []struct {
+		name   string
+		claims IDTokenClaims
+	}{
+		{"nonce", IDTokenClaims{RegisteredClaims: registered, Nonce: "n-0S6_WzA2Mj"}},
+		{"auth_time", IDTokenClaims{RegisteredClaims: registered, AuthTime: time.Now().Unix()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Signed as an access token, so only the claims give it away.
+			tokenString, _ := NewHMACSigningKey("", secret).SignAccessToken(tt.claims)
+			if _, err := service.ValidateAccessToken(tokenString); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("ValidateAccessToken() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
 func TestSessionService_ValidateAccessToken_InvalidFormat(t *testing.T) {
 	service := &SessionService{
 		config: SessionConfig{
@@ -181,6 +229,48 @@ func TestNewSessionService_Defaults(t *testing.T) {
 	}
 }
 
+func TestNewSessionService_DefaultRefreshReuseGrace(t *testing.T) {
+	service := NewSessionService(SessionConfig{
+		JWTSecret: []byte("test"),
+	}, nil, nil)
+
+	if service.config.RefreshReuseGrace != DefaultRefreshReuseGrace {
+		t.Errorf("RefreshReuseGrace should default to %v, got %v", DefaultRefreshReuseGrace, service.config.RefreshReuseGrace)
+	}
+}
+
+func TestIsSameClient(t *testing.T) {
+	metadata, _ := json.Marshal(domain.SessionMetadata{
+		IP:        "203.0.113.7:51234",
+		UserAgent: "Mozilla/5.0",
+	})
+	session := &domain.Session{ID: uuid.New(), Metadata: metadata}
+
+	tests := []struct {
+		name string
+		opts IssueSessionOpts
+		want bool
+	}{
+		{"same ip and user agent", IssueSessionOpts{IP: "203.0.113.7:51234", UserAgent: "Mozilla/5.0"}, true},
+		{"different port", IssueSessionOpts{IP: "203.0.113.7:60000", UserAgent: "Mozilla/5.0"}, true},
+		{"ip without port", IssueSessionOpts{IP: "203.0.113.7", UserAgent: "Mozilla/5.0"}, true},
+		{"different ip", IssueSessionOpts{IP: "198.51.100.1:51234", UserAgent: "Mozilla/5.0"}, false},
+		{"different user agent", IssueSessionOpts{IP: "203.0.113.7:51234", UserAgent: "curl/8.0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSameClient(session, tt.opts); got != tt.want {
+				t.Errorf("isSameClient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if isSameClient(&domain.Session{}, IssueSessionOpts{}) {
+		t.Error("session without metadata should never match")
+	}
+}
+
 func TestNewSessionService_CustomTTL(t *testing.T) {
 	customAccess := 30 * time.Minute
 	customRefresh := 24 * time.Hour
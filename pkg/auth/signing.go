@@ -0,0 +1,414 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// minRSAKeyBits is the smallest RSA modulus accepted for signing.
+	minRSAKeyBits = 2048
+
+	// hmacKeyLen is the length of generated HS256 secrets.
+	hmacKeyLen = 32
+
+	// AccessTokenType is the "typ" header of access tokens (RFC 9068).
+	AccessTokenType = "at+jwt"
+)
+
+// SigningKey signs and verifies access tokens.
+// HMAC keys use a shared secret; asymmetric keys (RS256, ES256, EdDSA)
+// keep the private key local and publish the public key via JWKS.
+type SigningKey struct {
+	// ID is the key identifier written to the JWT "kid" header.
+	ID string
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACSigningKey creates an HS256 signing key from a shared secret.
+// The ID may be empty, in which case tokens carry no "kid" header.
+func NewHMACSigningKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// NewSigningKey creates an asymmetric signing key from a private key.
+// The algorithm is derived from the key type: RSA keys sign with RS256,
+// ECDSA keys with ES256/ES384/ES512 depending on the curve, and Ed25519 keys
+// with EdDSA. If id is empty, the RFC 7638 thumbprint of the public key is used.
+func NewSigningKey(id string, privateKey crypto.Signer) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA signing key must be at least %d bits", minRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported ECDSA curve for signing key")
+		}
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", privateKey)
+	}
+
+	k := &SigningKey{
+		ID:        id,
+		method:    method,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+	}
+
+	if k.ID == "" {
+		jwk, _ := k.PublicJWK()
+		thumbprint, err := jwk.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		k.ID = thumbprint
+	}
+
+	return k, nil
+}
+
+// ParseSigningKeyPEM parses a PEM-encoded private key (PKCS#8, PKCS#1 or SEC 1)
+// and creates an asymmetric signing key from it.
+func ParseSigningKeyPEM(id string, pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("signing key: no PEM data found")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signing key: unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key: unsupported key type %T", key)
+	}
+
+	return NewSigningKey(id, signer)
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm
+// (HS256, RS256, ES256 or EdDSA). If id is empty, HS256 keys get a random ID
+// and asymmetric keys use their RFC 7638 thumbprint.
+func GenerateSigningKey(id, algorithm string) (*SigningKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		secret := make([]byte, hmacKeyLen)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		if id == "" {
+			b := make([]byte, 12)
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			id = base64.RawURLEncoding.EncodeToString(b)
+		}
+		return NewHMACSigningKey(id, secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	case jwt.SigningMethodES256.Alg():
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(id, signer)
+}
+
+// marshalPrivate serializes the secret half of the key: the raw HMAC secret
+// or a PKCS#8 private key.
+func (k *SigningKey) marshalPrivate() ([]byte, error) {
+	if secret, ok := k.signKey.([]byte); ok {
+		return secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(k.signKey)
+}
+
+// unmarshalSigningKey reverses marshalPrivate.
+func unmarshalSigningKey(id, algorithm string, data []byte) (*SigningKey, error) {
+	if algorithm == jwt.SigningMethodHS256.Alg() {
+		return NewHMACSigningKey(id, data), nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", id, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s: unsupported key type %T", id, key)
+	}
+
+	k, err := NewSigningKey(id, signer)
+	if err != nil {
+		return nil, err
+	}
+	if k.Algorithm() != algorithm {
+		return nil, fmt.Errorf("signing key %s: stored algorithm %s does not match key type", id, algorithm)
+	}
+	return k, nil
+}
+
+// Algorithm returns the JWT "alg" value used by this key.
+func (k *SigningKey) Algorithm() string {
+	return k.method.Alg()
+}
+
+// IsAsymmetric reports whether the key uses a public/private key pair.
+func (k *SigningKey) IsAsymmetric() bool {
+	_, ok := k.method.(*jwt.SigningMethodHMAC)
+	return !ok
+}
+
+// Sign creates a signed JWT with the given claims and the key's "kid" header.
+func (k *SigningKey) Sign(claims jwt.Claims) (string, error) {
+	return k.sign(claims, "")
+}
+
+// SignAccessToken is Sign for access tokens. It sets the "typ" header to
+// AccessTokenType, which ValidateAccessToken requires, so that ID tokens
+// signed with the same key are not accepted as access tokens.
+func (k *SigningKey) SignAccessToken(claims jwt.Claims) (string, error) {
+	return k.sign(claims, AccessTokenType)
+}
+
+func (k *SigningKey) sign(claims jwt.Claims, typ string) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(k.signKey)
+}
+
+// verificationKey returns the key to verify a parsed token with, or an error
+// if the token was not signed by this key.
+func (k *SigningKey) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	if kid, ok := token.Header["kid"].(string); ok && k.ID != "" && kid != k.ID {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return k.verifyKey, nil
+}
+
+// PublicJWK returns the public half of the key as a JWK.
+// The second return value is false for HMAC keys, which must never be published.
+func (k *SigningKey) PublicJWK() (JWK, bool) {
+	jwk := JWK{
+		Use:       "sig",
+		KeyID:     k.ID,
+		Algorithm: k.method.Alg(),
+	}
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, false
+		}
+		// Uncompressed point: 0x04 || X || Y, each coordinate padded to the curve size.
+		raw := point.Bytes()[1:]
+		size := len(raw) / 2
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[:size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[size:])
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// JWK is a JSON Web Key (RFC 7517) holding a public signing key.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA public key members
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP public key members
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set as served from /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of the key.
+func (j JWK) Thumbprint() (string, error) {
+	// Required members only, in lexicographic order.
+	var members interface{}
+	switch j.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Curve, j.KeyType, j.X, j.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicKey decodes the public key held by the JWK.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return pub, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch j.Curve {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Curve)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		// Uncompressed point: 0x04 || X || Y; ecdh rejects points not on the curve.
+		if _, err := ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid EC point: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func generateTestSigners(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+
+	return map[string]crypto.Signer{
+		"RS256": rsaKey,
+		"ES256": ecKey,
+		"EdDSA": edKey,
+	}
+}
+
+func TestSigningKey_AsymmetricRoundTrip(t *testing.T) {
+	for alg, signer := range generateTestSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(signer)
+			if err != nil {
+				t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+			}
+			pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+			key, err := ParseSigningKeyPEM("", pemData)
+			if err != nil {
+				t.Fatalf("ParseSigningKeyPEM: %v", err)
+			}
+			if key.Algorithm() != alg {
+				t.Errorf("Algorithm() = %q, want %q", key.Algorithm(), alg)
+			}
+			if key.ID == "" {
+				t.Error("ID should default to the key thumbprint")
+			}
+
+			svc := NewSessionService(SessionConfig{SigningKey: key, Issuer: "test-issuer"}, nil, nil)
+			user := &domain.User{ID: uuid.New(), Email: "u@example.com"}
+			now := time.Now()
+
+			token, err := svc.issueAccessToken(context.Background(), user, nil, uuid.New(), now, now.Add(time.Minute), IssueSessionOpts{})
+			if err != nil {
+				t.Fatalf("issueAccessToken: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &AccessTokenClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if parsed.Header["kid"] != key.ID {
+				t.Errorf("kid header = %v, want %q", parsed.Header["kid"], key.ID)
+			}
+
+			claims, err := svc.ValidateAccessToken(token)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken: %v", err)
+			}
+			if claims.Subject != user.ID.String() {
+				t.Errorf("Subject = %q, want %q", claims.Subject, user.ID.String())
+			}
+
+			jwks := svc.JWKS(context.Background())
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS should contain 1 key, got %d", len(jwks.Keys))
+			}
+			if jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Algorithm != alg {
+				t.Errorf("JWKS key = %+v, want kid %q alg %q", jwks.Keys[0], key.ID, alg)
+			}
+		})
+	}
+}
+
+func TestSigningKey_RejectsOtherKeys(t *testing.T) {
+	signers := generateTestSigners(t)
+
+	key, err := NewSigningKey("key-1", signers["ES256"])
+	if err != nil {
+		t.Fatalf("NewSigningKey: %v", err)
+	}
+	svc := NewSessionService(SessionConfig{SigningKey: key}, nil, nil)
+
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+
+	otherKey, _ := NewSigningKey("key-1", signers["RS256"])
+	wrongKID, _ := NewSigningKey("key-2", signers["ES256"])
+
+	tests := []struct {
+		name string
+		key  *SigningKey
+	}{
+		{"HS256 with public key material", NewHMACSigningKey("key-1", []byte("test-secret-test-secret-test-secret"))},
+		{"different algorithm", otherKey},
+		{"unknown kid", wrongKID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.key.SignAccessToken(claims)
+			if err != nil {
+				t.Fatalf("SignAccessToken: %v", err)
+			}
+			if _, err := svc.ValidateAccessToken(token); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("ValidateAccessToken() error = %v, want %v", err, domain.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestSigningKey_HMACNotPublished(t *testing.T) {
+	svc := NewSessionService(SessionConfig{JWTSecret: []byte("test-secret")}, nil, nil)
+
+	jwks := svc.JWKS(context.Background())
+	if jwks.Keys == nil || len(jwks.Keys) != 0 {
+		t.Errorf("JWKS should be an empty set for HS256, got %+v", jwks.Keys)
+	}
+}
+
+func TestNewSigningKey_RejectsWeakRSA(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	if _, err := NewSigningKey("", weak); err == nil {
+		t.Error("NewSigningKey should reject RSA keys under 2048 bits")
+	}
+}
+
+func TestJWK_Thumbprint(t *testing.T) {
+	// RFC 7638 section 3.1 example key.
+	jwk := JWK{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+	}
+
+	got, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Thumbprint() = %q, want %q", got, want)
+	}
+}
+
+func TestJWK_PublicKeyRoundTrip(t *testing.T) {
+	for alg, signer := range generateTestSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			key, err := NewSigningKey("kid-1", signer)
+			if err != nil {
+				t.Fatalf("NewSigningKey: %v", err)
+			}
+			jwk, ok := key.PublicJWK()
+			if !ok {
+				t.Fatal("PublicJWK() not published")
+			}
+
+			pub, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey: %v", err)
+			}
+			if !signer.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(pub) {
+				t.Errorf("PublicKey() does not match the signer's public key")
+			}
+		})
+	}
+}
+
+func TestJWK_PublicKeyRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unknown type", JWK{KeyType: "oct"}},
+		{"unknown curve", JWK{KeyType: "EC", Curve: "secp256k1"}},
+		{"point not on curve", JWK{KeyType: "EC", Curve: "P-256", X: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", Y: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}},
+		{"short RSA key", JWK{KeyType: "RSA", N: "AQAB", E: "AQAB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.jwk.PublicKey(); err == nil {
+				t.Error("PublicKey() should fail")
+			}
+		})
+	}
+}
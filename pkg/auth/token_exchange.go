@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// TokenExchangeRequest asks for a narrower access token for a user, to call
+// another service on their behalf.
+type TokenExchangeRequest struct {
+	SubjectToken string   // The user's access token
+	Audience     []string // Services the new token is for
+	Scopes       []string // Optional; see ExchangeToken
+}
+
+// ExchangedToken is an access token a client got in exchange for a user's.
+type ExchangedToken struct {
+	AccessToken string
+	ExpiresIn   int // Seconds
+	Scope       string
+}
+
+// ExchangeToken issues an access token for the user of a subject token, as
+// the token exchange grant (RFC 8693) does. Clients without exchange
+// audiences get domain.ErrUnauthorizedClient. The new token is limited to the
+// requested audience, which must be among the client's exchange audiences
+// and within the subject token's if it has one, or domain.ErrInvalidTarget
+// is returned. Requested scopes must all be
+// allowed for the client and within the subject token's scope, or
+// domain.ErrInvalidScope is returned; without any, the token gets the
+// client's scopes that are. It only keeps the user's roles that the client
+// has as well. Its act claim names the client, and it lasts at most
+// ExchangedTokenTTL and never longer than the subject token.
+//
+// The token belongs to the subject token's session, so revoking the session
+// ends it too. Invalid subject tokens and client tokens return
+// domain.ErrInvalidToken, and tokens of revoked sessions
+// domain.ErrSessionRevoked.
+func (s *SessionService) ExchangeToken(ctx context.Context, client *domain.OAuthClient, req TokenExchangeRequest) (*ExchangedToken, error) {
+	if len(client.ExchangeAudiences) == 0 {
+		return nil, domain.ErrUnauthorizedClient
+	}
+
+	subject, err := s.ValidateAccessToken(req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+	if subject.IsClient() {
+		return nil, domain.ErrInvalidToken
+	}
+	if err := s.CheckSession(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	if len(req.Audience) == 0 {
+		return nil, domain.ErrInvalidTarget
+	}
+	for _, audience := range req.Audience {
+		if !client.AllowsExchangeAudience(audience) {
+			return nil, domain.ErrInvalidTarget
+		}
+		if len(subject.Audience) > 0 && !slices.Contains(subject.Audience, audience) {
+			return nil, domain.ErrInvalidTarget
+		}
+	}
+
+	subjectScopes := strings.Fields(subject.Scope)
+	withinSubject := func(scope string) bool {
+		return len(subjectScopes) == 0 || slices.Contains(subjectScopes, scope)
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		for _, scope := range client.Scopes {
+			if withinSubject(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	// A token with no scope would not be narrowed at all
+	if len(scopes) == 0 {
+		return nil, domain.ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !client.AllowsScope(scope) || !withinSubject(scope) {
+			return nil, domain.ErrInvalidScope
+		}
+	}
+
+	// The client cannot pass on more of the user's roles than it holds itself
+	var roles []string
+	for _, role := range subject.Roles {
+		if slices.Contains(client.Roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.config.ExchangedTokenTTL)
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject.Subject,
+			Audience:  req.Audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Issuer:    s.config.Issuer,
+			ID:        subject.ID,
+		},
+		Email:         subject.Email,
+		EmailVerified: subject.EmailVerified,
+		Name:          subject.Name,
+		Roles:         roles,
+		MFAVerified:   subject.MFAVerified,
+		Scope:         strings.Join(scopes, " "),
+		Actor:         &ActorClaim{Subject: client.ID, Actor: subject.Actor},
+	}
+
+	token, err := s.signExchangedToken(ctx, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("SessionService.ExchangeToken: token exchanged",
+		"client_id", client.ID,
+		"user_id", subject.Subject,
+		"audience", req.Audience,
+		"scope", claims.Scope,
+	)
+	return &ExchangedToken{
+		AccessToken: token,
+		ExpiresIn:   int(expiresAt.Sub(now).Seconds()),
+		Scope:       claims.Scope,
+	}, nil
+}
+
+// signExchangedToken signs claims, or has the configured AccessTokenIssuer
+// issue a token for the same user, session, audience, scope and actor.
+func (s *SessionService) signExchangedToken(ctx context.Context, claims *AccessTokenClaims) (string, error) {
+	if s.config.AccessTokenIssuer == nil {
+		key, err := s.keySource().SigningKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		return key.SignAccessToken(claims)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return "", domain.ErrInvalidToken
+	}
+	sessionID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return "", domain.ErrInvalidToken
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return "", domain.ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.config.AccessTokenIssuer.IssueAccessToken(ctx, AccessTokenIssueInput{
+		User:        user,
+		Roles:       claims.Roles,
+		SessionID:   sessionID,
+		IssuedAt:    claims.IssuedAt.Time,
+		ExpiresAt:   claims.ExpiresAt.Time,
+		Issuer:      claims.Issuer,
+		MFAVerified: claims.MFAVerified,
+		Audience:    claims.Audience,
+		Scope:       claims.Scope,
+		Actor:       claims.Actor,
+	})
+}
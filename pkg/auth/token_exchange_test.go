@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestSessionService_ExchangeToken(t *testing.T) {
+	service := NewSessionService(SessionConfig{
+		JWTSecret: []byte("test-secret-key-32-characters-lo"),
+		Issuer:    "https://idm.example.com",
+	}, nil, nil)
+	ctx := context.Background()
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read", "orders:write"}, Roles: []string{"support"}, ExchangeAudiences: []string{"orders-api"}}
+	userID := uuid.New()
+	sessionID := uuid.NewString()
+	subjectToken := signTestClaims(t, service, AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        sessionID,
+		},
+		Email: "user@example.com",
+		Roles: []string{"admin", "support"},
+	})
+
+	token, err := service.ExchangeToken(ctx, gateway, TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		Audience:     []string{"orders-api"},
+		Scopes:       []string{"orders:read"},
+	})
+	if err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	if token.Scope != "orders:read" || token.ExpiresIn > int(DefaultExchangedTokenTTL.Seconds()) {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	claims, err := service.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Subject != userID.String() || claims.ID != sessionID || claims.Email != "user@example.com" {
+		t.Errorf("user claims not carried over: %+v", claims)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "support" {
+		t.Errorf("Roles = %v, want only the role the client shares with the user", claims.Roles)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "orders-api" || claims.Scope != "orders:read" {
+		t.Errorf("aud = %v, scope = %q", claims.Audience, claims.Scope)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "gateway" || claims.Actor.Actor != nil {
+		t.Errorf("act = %+v, want gateway", claims.Actor)
+	}
+	if claims.IsClient() {
+		t.Error("exchanged token should be a user token")
+	}
+
+	// Exchanging again narrows further and nests the earlier actor
+	orders := &domain.OAuthClient{ID: "orders", Scopes: []string{"orders:read", "orders:write"}, ExchangeAudiences: []string{"orders-api"}}
+	again, err := service.ExchangeToken(ctx, orders, TokenExchangeRequest{
+		SubjectToken: token.AccessToken,
+		Audience:     []string{"orders-api"},
+	})
+	if err != nil {
+		t.Fatalf("ExchangeToken again: %v", err)
+	}
+	if again.Scope != "orders:read" {
+		t.Errorf("Scope = %q, want the subject token's orders:read", again.Scope)
+	}
+	claims, err = service.ValidateAccessToken(again.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "orders" || claims.Actor.Actor == nil || claims.Actor.Actor.Subject != "gateway" {
+		t.Errorf("act = %+v, want orders acting for gateway", claims.Actor)
+	}
+	if len(claims.Roles) != 0 {
+		t.Errorf("Roles = %v, want none for a client without roles", claims.Roles)
+	}
+}
+
+func TestSessionService_ExchangeTokenNeverOutlivesSubject(t *testing.T) {
+	service := NewSessionService(SessionConfig{JWTSecret: []byte("test-secret-key-32-characters-lo")}, nil, nil)
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read"}, ExchangeAudiences: []string{"orders-api"}}
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	subjectToken := signTestClaims(t, service, AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        uuid.NewString(),
+		},
+	})
+
+	token, err := service.ExchangeToken(context.Background(), gateway, TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		Audience:     []string{"orders-api"},
+	})
+	if err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	claims, err := service.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if !claims.ExpiresAt.Time.Equal(expiresAt) || token.ExpiresIn > 60 {
+		t.Errorf("exp = %v, expires_in = %d, want the subject token's %v", claims.ExpiresAt.Time, token.ExpiresIn, expiresAt)
+	}
+}
+
+func TestSessionService_ExchangeTokenRejects(t *testing.T) {
+	service := NewSessionService(SessionConfig{JWTSecret: []byte("test-secret-key-32-characters-lo")}, nil, nil)
+	ctx := context.Background()
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read", "orders:write"}, ExchangeAudiences: []string{"orders-api", "billing-api"}}
+	userClaims := func(audience []string, scope string) AccessTokenClaims {
+		return AccessTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   uuid.NewString(),
+				Audience:  audience,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+				ID:        uuid.NewString(),
+			},
+			Scope: scope,
+		}
+	}
+	userToken := signTestClaims(t, service, userClaims(nil, ""))
+	clientToken, err := service.IssueClientToken(ctx, gateway, nil)
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+	otherService := NewSessionService(SessionConfig{JWTSecret: []byte("another-secret-key-32-characters")}, nil, nil)
+
+	tests := []struct {
+		name    string
+		client  *domain.OAuthClient
+		req     TokenExchangeRequest
+		wantErr error
+	}{
+		{
+			name:    "invalid subject token",
+			req:     TokenExchangeRequest{SubjectToken: "not-a-token", Audience: []string{"orders-api"}},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "subject token of another issuer",
+			req:     TokenExchangeRequest{SubjectToken: signTestClaims(t, otherService, userClaims(nil, "")), Audience: []string{"orders-api"}},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "client token",
+			req:     TokenExchangeRequest{SubjectToken: clientToken.AccessToken, Audience: []string{"orders-api"}},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "no audience",
+			req:     TokenExchangeRequest{SubjectToken: userToken},
+			wantErr: domain.ErrInvalidTarget,
+		},
+		{
+			name:    "audience outside the subject token's",
+			req:     TokenExchangeRequest{SubjectToken: signTestClaims(t, service, userClaims([]string{"orders-api"}, "")), Audience: []string{"billing-api"}},
+			wantErr: domain.ErrInvalidTarget,
+		},
+		{
+			name:    "scope not allowed for the client",
+			req:     TokenExchangeRequest{SubjectToken: userToken, Audience: []string{"orders-api"}, Scopes: []string{"users:write"}},
+			wantErr: domain.ErrInvalidScope,
+		},
+		{
+			name:    "scope outside the subject token's",
+			req:     TokenExchangeRequest{SubjectToken: signTestClaims(t, service, userClaims(nil, "orders:read")), Audience: []string{"orders-api"}, Scopes: []string{"orders:write"}},
+			wantErr: domain.ErrInvalidScope,
+		},
+		{
+			name:    "audience not allowed for the client",
+			req:     TokenExchangeRequest{SubjectToken: userToken, Audience: []string{"users-api"}},
+			wantErr: domain.ErrInvalidTarget,
+		},
+		{
+			name:    "client without scopes",
+			client:  &domain.OAuthClient{ID: "legacy", ExchangeAudiences: []string{"orders-api"}},
+			req:     TokenExchangeRequest{SubjectToken: userToken, Audience: []string{"orders-api"}},
+			wantErr: domain.ErrInvalidScope,
+		},
+		{
+			name:    "client without exchange audiences",
+			client:  &domain.OAuthClient{ID: "billing", Scopes: []string{"orders:read"}},
+			req:     TokenExchangeRequest{SubjectToken: userToken, Audience: []string{"orders-api"}},
+			wantErr: domain.ErrUnauthorizedClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.client
+			if client == nil {
+				client = gateway
+			}
+			if _, err := service.ExchangeToken(ctx, client, tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionService_ExchangeTokenOfRevokedSession(t *testing.T) {
+	now := time.Now()
+	revoked := &domain.Session{ID: uuid.New(), UserID: uuid.New(), RevokedAt: &now}
+	service := newRevocationTestService(t, time.Minute, &stubSessionLookup{
+		sessions: map[uuid.UUID]*domain.Session{revoked.ID: revoked},
+	})
+	gateway := &domain.OAuthClient{ID: "gateway", Scopes: []string{"orders:read"}, ExchangeAudiences: []string{"orders-api"}}
+	subjectToken := signTestClaims(t, service, AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   revoked.UserID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+			ID:        revoked.ID.String(),
+		},
+	})
+
+	_, err := service.ExchangeToken(context.Background(), gateway, TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		Audience:     []string{"orders-api"},
+	})
+	if !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("error = %v, want ErrSessionRevoked", err)
+	}
+}
+
+// signTestClaims signs claims with the service's key, as if it had issued them.
+func signTestClaims(t *testing.T, service *SessionService, claims AccessTokenClaims) string {
+	t.Helper()
+	key, err := service.keySource().SigningKey(context.Background())
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	token, err := key.SignAccessToken(claims)
+	if err != nil {
+		t.Fatalf("SignAccessToken: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// UserInfo holds the OpenID Connect standard claims about a user, as returned
+// by the userinfo endpoint.
+type UserInfo struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Roles             []string // Empty unless the service was created with a roles repository
+}
+
+// UserInfo returns the current claims about a user. Unlike the claims of an
+// access token, they reflect profile changes made since it was issued.
+func (s *SessionService) UserInfo(ctx context.Context, userID uuid.UUID) (*UserInfo, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.getUserRoleNames(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	info := &UserInfo{
+		Subject:       user.ID.String(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Roles:         roles,
+	}
+	if user.Name != nil {
+		info.Name = *user.Name
+	}
+	if user.Username != nil {
+		info.PreferredUsername = *user.Username
+	}
+	return info, nil
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device authorization statuses.
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization is a device authorization grant request (RFC 8628): a
+// device without a browser waits, polling with the device code, while its
+// user approves the user code in a browser.
+type DeviceAuthorization struct {
+	ID             uuid.UUID
+	DeviceCodeHash string
+	UserCodeHash   string
+	ClientID       string
+	Scope          string
+	Status         string
+	UserID         *uuid.UUID // Set once approved
+	MFAVerified    bool       // Whether the approving session completed MFA
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LastPolledAt   *time.Time
+}
+
+// IsExpired reports whether the request can no longer be approved or redeemed.
+func (d *DeviceAuthorization) IsExpired() bool {
+	return time.Now().After(d.ExpiresAt)
+}
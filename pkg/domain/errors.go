@@ -13,9 +13,12 @@ var (
 	ErrSessionExpired            = errors.New("session expired")
 	ErrSessionRevoked            = errors.New("session revoked")
 	ErrSessionFingerprint        = errors.New("session fingerprint mismatch - possible token theft")
+	ErrSessionRotated            = errors.New("session refresh token already rotated")
+	ErrRefreshTokenReused        = errors.New("refresh token reuse detected - session family revoked")
 	ErrInvalidToken              = errors.New("invalid token")
 	ErrIdentityNotFound          = errors.New("identity not found")
 	ErrIdentityAlreadyLinked     = errors.New("identity already linked to another user")
+	ErrLastLoginMethod           = errors.New("cannot remove the last login method")
 	ErrVerificationTokenNotFound = errors.New("verification token not found")
 	ErrVerificationTokenExpired  = errors.New("verification token expired")
 	ErrVerificationTokenConsumed = errors.New("verification token already used")
@@ -25,6 +28,54 @@ var (
 	ErrRoleAlreadyExists         = errors.New("role already exists")
 )
 
+// Signing key errors
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyInUse    = errors.New("signing key is currently used for signing")
+	ErrNoSigningKey       = errors.New("no active signing key")
+	// ID tokens must be verifiable by clients through the JWKS, which an
+	// HS256 secret cannot offer
+	ErrSymmetricSigningKey = errors.New("ID tokens need an asymmetric signing key (RS256, ES256 or EdDSA)")
+)
+
+// OAuth client errors
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidRedirectURI  = errors.New("redirect URI is not registered for the client")
+	// An authorization code or refresh token is unknown, expired, used, or
+	// was issued to another client or redirect URI
+	ErrInvalidGrant = errors.New("invalid authorization grant")
+	// A client requested a scope it is not allowed
+	ErrInvalidScope = errors.New("scope is not allowed for the client")
+	// A client asked to exchange a token for an audience it cannot have
+	ErrInvalidTarget = errors.New("audience is not allowed for the token")
+	// A client used a grant it is not allowed, such as token exchange
+	ErrUnauthorizedClient = errors.New("grant is not allowed for the client")
+)
+
+// Device authorization errors, named after the RFC 8628 error codes the
+// token endpoint returns while a device polls
+var (
+	ErrDeviceCodeNotFound   = errors.New("device authorization not found")
+	ErrAuthorizationPending = errors.New("device authorization is pending")
+	ErrSlowDown             = errors.New("device is polling too frequently")
+	ErrAccessDenied         = errors.New("device authorization was denied")
+	ErrExpiredToken         = errors.New("device code has expired")
+)
+
+// External login errors
+var (
+	ErrCodeExchangeFailed = errors.New("authorization code exchange failed")
+	ErrOAuthStateNotFound = errors.New("oauth state not found")
+	// The account's domain (Google's "hd" claim) is not allowed to log in
+	ErrHostedDomainNotAllowed = errors.New("account is not in an allowed hosted domain")
+	// An unknown identity matched an existing user's email, and the account
+	// link policy does not link them automatically
+	ErrAccountLinkNotAllowed    = errors.New("an account with this email already exists")
+	ErrLinkConfirmationRequired = errors.New("account link confirmation required")
+)
+
 // Validation errors
 var (
 	ErrInvalidEmail     = errors.New("invalid email address")
@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+// OAuthClient is a registered backend that authenticates with a client ID and
+// secret to call the OAuth endpoints.
+type OAuthClient struct {
+	ID                string // client_id
+	Name              string
+	SecretHash        string
+	RedirectURIs      []string // Where /oauth/authorize may send users back to; empty disables it
+	Scopes            []string // Scopes the client may request with the client credentials grant
+	Roles             []string // Role labels put in the client's own access tokens
+	ExchangeAudiences []string // Audiences the client may exchange user tokens for; empty disables it
+	CreatedAt         time.Time
+	RevokedAt         *time.Time
+}
+
+// IsActive reports whether the client may still authenticate.
+func (c *OAuthClient) IsActive() bool {
+	return c.RevokedAt == nil
+}
+
+// AllowsRedirectURI reports whether uri is one of the client's redirect URIs.
+// URIs are compared exactly, as OpenID Connect requires.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsExchangeAudience reports whether the client may exchange a user's
+// token for one meant for audience.
+func (c *OAuthClient) AllowsExchangeAudience(audience string) bool {
+	for _, allowed := range c.ExchangeAudiences {
+		if audience == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope reports whether the client may request scope for itself.
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, allowed := range c.Scopes {
+		if scope == allowed {
+			return true
+		}
+	}
+	return false
+}
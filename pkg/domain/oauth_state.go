@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthState is an external login in progress, kept from the redirect to the
+// provider until its callback. It is stored under the hash of the state
+// parameter and deleted when the callback uses it.
+type OAuthState struct {
+	StateHash    string
+	Provider     string
+	LinkUserID   *uuid.UUID // Set when linking the provider to a signed-in user
+	Nonce        string
+	CodeVerifier string
+	RedirectURI  string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
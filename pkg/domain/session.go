@@ -8,15 +8,26 @@ import (
 )
 
 // Session represents an authentication session.
+// Each refresh token is stored as its own row; rows issued from the same login
+// share a FamilyID and are chained through ReplacedBy as tokens are rotated.
 type Session struct {
 	ID         uuid.UUID
 	UserID     uuid.UUID
+	FamilyID   uuid.UUID
 	TokenHash  string
 	CreatedAt  time.Time
 	ExpiresAt  time.Time
 	RevokedAt  *time.Time
 	LastSeenAt *time.Time
-	Metadata   json.RawMessage
+	RotatedAt  *time.Time
+	ReplacedBy *uuid.UUID
+	// ReplacementToken is the replacement's refresh token, sealed with this
+	// session's refresh token, so a concurrent refresh can be given it too.
+	ReplacementToken string
+	// ClientID is the OAuth client the session was issued to, if any.
+	// Only that client can refresh, introspect or revoke its refresh token.
+	ClientID string
+	Metadata json.RawMessage
 }
 
 // SessionMetadata holds optional session context.
@@ -36,6 +47,17 @@ func (s *Session) IsValid() bool {
 	return time.Now().Before(s.ExpiresAt)
 }
 
+// IsRotated returns true if the session's refresh token has been exchanged for a newer one.
+func (s *Session) IsRotated() bool {
+	return s.RotatedAt != nil
+}
+
+// IssuedToClient reports whether an OAuth client may introspect or revoke the
+// session's tokens: the session was issued to it, or to no client at all.
+func (s *Session) IssuedToClient(clientID string) bool {
+	return s.ClientID == "" || s.ClientID == clientID
+}
+
 // TokenPair represents the access and refresh token pair.
 type TokenPair struct {
 	AccessToken  string    `json:"access_token"`
@@ -81,3 +81,43 @@ func TestSession_IsValid_EdgeCases(t *testing.T) {
 		t.Error("Session expiring at current time should be invalid")
 	}
 }
+
+func TestSession_IsRotated(t *testing.T) {
+	session := Session{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+	}
+
+	if session.IsRotated() {
+		t.Error("Fresh session should not be rotated")
+	}
+
+	now := time.Now()
+	session.RotatedAt = &now
+
+	if !session.IsRotated() {
+		t.Error("Session with RotatedAt set should be rotated")
+	}
+}
+
+func TestSession_IssuedToClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  Session
+		clientID string
+		expected bool
+	}{
+		{"session without a client", Session{}, "dashboard", true},
+		{"session of the client", Session{ClientID: "dashboard"}, "dashboard", true},
+		{"session of another client", Session{ClientID: "dashboard"}, "billing", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.session.IssuedToClient(tt.clientID); got != tt.expected {
+				t.Errorf("IssuedToClient(%q) = %v, want %v", tt.clientID, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// SigningKeyStatus describes where a signing key is in its rotation lifecycle.
+type SigningKeyStatus string
+
+const (
+	// SigningKeyStaged keys verify tokens and are published in JWKS, but do not sign yet.
+	SigningKeyStaged SigningKeyStatus = "staged"
+	// SigningKeyActive keys have been promoted. The most recently promoted one signs;
+	// older active keys keep verifying until their retirement time.
+	SigningKeyActive SigningKeyStatus = "active"
+	// SigningKeyRetired keys no longer verify anything.
+	SigningKeyRetired SigningKeyStatus = "retired"
+)
+
+// SigningKey is a persisted access token signing key, shared by all replicas.
+type SigningKey struct {
+	ID           string // JWT "kid"
+	Algorithm    string // JWT "alg", e.g. HS256, RS256, ES256, EdDSA
+	KeyEncrypted string // AES-256-GCM encrypted secret (HMAC) or PKCS#8 private key
+	CreatedAt    time.Time
+	ActivatedAt  *time.Time
+	RetireAt     *time.Time
+}
+
+// Status returns the lifecycle status of the key at the given time.
+func (k *SigningKey) Status(now time.Time) SigningKeyStatus {
+	if k.RetireAt != nil && !k.RetireAt.After(now) {
+		return SigningKeyRetired
+	}
+	if k.ActivatedAt != nil {
+		return SigningKeyActive
+	}
+	return SigningKeyStaged
+}
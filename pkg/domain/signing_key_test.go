@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigningKey_Status(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		key      SigningKey
+		expected SigningKeyStatus
+	}{
+		{"staged", SigningKey{ID: "k"}, SigningKeyStaged},
+		{"active", SigningKey{ID: "k", ActivatedAt: &past}, SigningKeyActive},
+		{"active until retirement", SigningKey{ID: "k", ActivatedAt: &past, RetireAt: &future}, SigningKeyActive},
+		{"retired", SigningKey{ID: "k", ActivatedAt: &past, RetireAt: &past}, SigningKeyRetired},
+		{"retired before promotion", SigningKey{ID: "k", RetireAt: &past}, SigningKeyRetired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.Status(now); got != tt.expected {
+				t.Errorf("Status() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
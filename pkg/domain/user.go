@@ -49,4 +49,6 @@ type UserIdentity struct {
 // IdentityProvider constants
 const (
 	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderApple  = "apple"
 )
@@ -12,6 +12,9 @@ const (
 	TokenKindEmailVerification VerificationTokenKind = "email_verification"
 	TokenKindPasswordReset     VerificationTokenKind = "password_reset"
 	TokenKindMFAChallenge      VerificationTokenKind = "mfa_challenge"
+	TokenKindAccountLink       VerificationTokenKind = "account_link"       // Pending link of an external identity
+	TokenKindAccountLinkEmail  VerificationTokenKind = "account_link_email" // Emailed confirmation of a pending link
+	TokenKindOAuthCode         VerificationTokenKind = "oauth_code"         // Authorization code from /oauth/authorize
 )
 
 type VerificationToken struct {
@@ -108,3 +108,39 @@ func (r *IdentitiesRepository) DeleteByUserID(ctx context.Context, userID uuid.U
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+// DeleteForUser deletes one of the user's identities. It refuses with
+// ErrLastLoginMethod if the user has no password and no other identity. The
+// user's row is locked so concurrent deletes cannot remove every login method.
+func (r *IdentitiesRepository) DeleteForUser(ctx context.Context, userID, id uuid.UUID) error {
+	return Tx(ctx, r.db, func(tx *sql.Tx) error {
+		var lockedID uuid.UUID
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&lockedID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			SELECT
+				EXISTS(SELECT 1 FROM user_identities WHERE id = $2 AND user_id = $1),
+				EXISTS(SELECT 1 FROM user_password WHERE user_id = $1)
+					OR EXISTS(SELECT 1 FROM user_identities WHERE user_id = $1 AND id <> $2)
+		`
+		var owned, otherLogins bool
+		if err := tx.QueryRowContext(ctx, query, userID, id).Scan(&owned, &otherLogins); err != nil {
+			return err
+		}
+		if !owned {
+			return domain.ErrIdentityNotFound
+		}
+		if !otherLogins {
+			return domain.ErrLastLoginMethod
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_identities WHERE id = $1`, id)
+		return err
+	})
+}
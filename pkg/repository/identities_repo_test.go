@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestIdentitiesRepository_DeleteForUserKeepsLastLoginMethod(t *testing.T) {
+	db := openRolesTestDB(t)
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+	ctx := context.Background()
+
+	schema := "identities_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `CREATE TABLE users (id UUID PRIMARY KEY)`)
+	execRolesTestSQL(t, db, `CREATE TABLE user_password (user_id UUID PRIMARY KEY REFERENCES users(id))`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE user_identities (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id),
+			provider TEXT NOT NULL,
+			provider_subject TEXT NOT NULL,
+			email TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			UNIQUE(provider, provider_subject)
+		)`)
+
+	repo := NewIdentitiesRepository(db)
+	userID := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	google := &domain.UserIdentity{ID: uuid.New(), UserID: userID, Provider: "google", ProviderSubject: "g-1", CreatedAt: time.Now()}
+	github := &domain.UserIdentity{ID: uuid.New(), UserID: userID, Provider: "github", ProviderSubject: "gh-1", CreatedAt: time.Now()}
+	for _, identity := range []*domain.UserIdentity{google, github} {
+		if err := repo.Create(ctx, identity); err != nil {
+			t.Fatalf("create identity: %v", err)
+		}
+	}
+
+	if err := repo.DeleteForUser(ctx, uuid.New(), google.ID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("DeleteForUser(other user) error = %v, want ErrUserNotFound", err)
+	}
+	if err := repo.DeleteForUser(ctx, userID, uuid.New()); !errors.Is(err, domain.ErrIdentityNotFound) {
+		t.Errorf("DeleteForUser(unknown identity) error = %v, want ErrIdentityNotFound", err)
+	}
+	if err := repo.DeleteForUser(ctx, userID, google.ID); err != nil {
+		t.Fatalf("DeleteForUser(google) error = %v", err)
+	}
+	if err := repo.DeleteForUser(ctx, userID, github.ID); !errors.Is(err, domain.ErrLastLoginMethod) {
+		t.Fatalf("DeleteForUser(last identity) error = %v, want ErrLastLoginMethod", err)
+	}
+
+	// With a password, the last identity can go
+	if _, err := db.Exec(`INSERT INTO user_password (user_id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("insert password: %v", err)
+	}
+	if err := repo.DeleteForUser(ctx, userID, github.ID); err != nil {
+		t.Errorf("DeleteForUser(with password) error = %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tendant/simple-idm-slim/pkg/domain"
@@ -138,3 +139,22 @@ func (r *MFARecoveryCodesRepository) DeleteAllByUserID(ctx context.Context, user
 	}
 	return nil
 }
+
+// DeleteUsed removes up to limit recovery codes that were used more than
+// olderThan ago, and returns how many were deleted. Unused codes are kept.
+func (r *MFARecoveryCodesRepository) DeleteUsed(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM mfa_recovery_codes
+		WHERE id IN (
+			SELECT id FROM mfa_recovery_codes
+			WHERE used_at IS NOT NULL AND used_at < $1
+			LIMIT $2
+		)
+	`
+	cutoff := time.Now().Add(-olderThan)
+	result, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete used recovery codes: %w", err)
+	}
+	return result.RowsAffected()
+}
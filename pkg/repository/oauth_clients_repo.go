@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// OAuthClientsRepository handles persistence of registered OAuth clients.
+type OAuthClientsRepository struct {
+	db *sql.DB
+}
+
+// NewOAuthClientsRepository creates a new OAuth clients repository.
+func NewOAuthClientsRepository(db *sql.DB) *OAuthClientsRepository {
+	return &OAuthClientsRepository{db: db}
+}
+
+// Create stores a new client.
+func (r *OAuthClientsRepository) Create(ctx context.Context, client *domain.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, roles, exchange_audiences, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		client.ID,
+		client.Name,
+		client.SecretHash,
+		stringArray(client.RedirectURIs),
+		stringArray(client.Scopes),
+		stringArray(client.Roles),
+		stringArray(client.ExchangeAudiences),
+		client.CreatedAt,
+	)
+	return err
+}
+
+// GetByID retrieves a client by its client ID, including revoked clients.
+func (r *OAuthClientsRepository) GetByID(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	query := `
+		SELECT id, name, secret_hash, redirect_uris, scopes, roles, exchange_audiences, created_at, revoked_at
+		FROM oauth_clients
+		WHERE id = $1
+	`
+	client, err := scanOAuthClient(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrOAuthClientNotFound
+	}
+	return client, err
+}
+
+// List returns all clients, including revoked ones, oldest first.
+func (r *OAuthClientsRepository) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, secret_hash, redirect_uris, scopes, roles, exchange_audiences, created_at, revoked_at
+		FROM oauth_clients
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*domain.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// SetRedirectURIs replaces the redirect URIs of an active client.
+func (r *OAuthClientsRepository) SetRedirectURIs(ctx context.Context, id string, uris []string) error {
+	return r.setList(ctx, id, "redirect_uris", uris)
+}
+
+// SetScopes replaces the scopes an active client may request for itself.
+func (r *OAuthClientsRepository) SetScopes(ctx context.Context, id string, scopes []string) error {
+	return r.setList(ctx, id, "scopes", scopes)
+}
+
+// SetRoles replaces the role labels of an active client.
+func (r *OAuthClientsRepository) SetRoles(ctx context.Context, id string, roles []string) error {
+	return r.setList(ctx, id, "roles", roles)
+}
+
+// SetExchangeAudiences replaces the audiences an active client may exchange user tokens for.
+func (r *OAuthClientsRepository) SetExchangeAudiences(ctx context.Context, id string, audiences []string) error {
+	return r.setList(ctx, id, "exchange_audiences", audiences)
+}
+
+// setList replaces one of the TEXT[] columns of an active client. column is
+// never user input.
+func (r *OAuthClientsRepository) setList(ctx context.Context, id, column string, values []string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE oauth_clients
+		SET `+column+` = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id, stringArray(values))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// Revoke stops a client from authenticating.
+func (r *OAuthClientsRepository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE oauth_clients
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// stringArray passes values as a TEXT[] parameter. A nil slice becomes an
+// empty array rather than NULL.
+func stringArray(values []string) interface{} {
+	if values == nil {
+		values = []string{}
+	}
+	return pq.Array(values)
+}
+
+func scanOAuthClient(row rowScanner) (*domain.OAuthClient, error) {
+	client := &domain.OAuthClient{}
+	err := row.Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		pq.Array(&client.Roles),
+		pq.Array(&client.ExchangeAudiences),
+		&client.CreatedAt,
+		&client.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
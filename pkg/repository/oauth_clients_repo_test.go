@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestOAuthClientsRepository_Lifecycle(t *testing.T) {
+	db := openRolesTestDB(t)
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+	ctx := context.Background()
+
+	schema := "oauth_clients_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE oauth_clients (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			secret_hash TEXT NOT NULL,
+			redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			roles TEXT[] NOT NULL DEFAULT '{}',
+			exchange_audiences TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			revoked_at TIMESTAMPTZ
+		)`)
+
+	repo := NewOAuthClientsRepository(db)
+	if err := repo.Create(ctx, &domain.OAuthClient{ID: "billing", Name: "Billing", SecretHash: "hash", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	client, err := repo.GetByID(ctx, "billing")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if client.Name != "Billing" || client.SecretHash != "hash" || !client.IsActive() || len(client.RedirectURIs) != 0 {
+		t.Fatalf("unexpected client %#v", client)
+	}
+
+	if err := repo.SetRedirectURIs(ctx, "billing", []string{"https://billing.example.com/callback"}); err != nil {
+		t.Fatalf("set redirect URIs: %v", err)
+	}
+	client, err = repo.GetByID(ctx, "billing")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !client.AllowsRedirectURI("https://billing.example.com/callback") || client.AllowsRedirectURI("https://billing.example.com/") {
+		t.Fatalf("unexpected redirect URIs %v", client.RedirectURIs)
+	}
+
+	if err := repo.SetScopes(ctx, "billing", []string{"invoices:read"}); err != nil {
+		t.Fatalf("set scopes: %v", err)
+	}
+	if err := repo.SetRoles(ctx, "billing", []string{"service"}); err != nil {
+		t.Fatalf("set roles: %v", err)
+	}
+	if err := repo.SetExchangeAudiences(ctx, "billing", []string{"ledger-api"}); err != nil {
+		t.Fatalf("set exchange audiences: %v", err)
+	}
+	client, err = repo.GetByID(ctx, "billing")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !client.AllowsScope("invoices:read") || client.AllowsScope("invoices:write") || len(client.Roles) != 1 || client.Roles[0] != "service" {
+		t.Fatalf("unexpected scopes %v and roles %v", client.Scopes, client.Roles)
+	}
+	if !client.AllowsExchangeAudience("ledger-api") || client.AllowsExchangeAudience("orders-api") {
+		t.Fatalf("unexpected exchange audiences %v", client.ExchangeAudiences)
+	}
+
+	if err := repo.Revoke(ctx, "billing"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := repo.Revoke(ctx, "billing"); !errors.Is(err, domain.ErrOAuthClientNotFound) {
+		t.Fatalf("second revoke: expected ErrOAuthClientNotFound, got %v", err)
+	}
+	if err := repo.SetScopes(ctx, "billing", nil); !errors.Is(err, domain.ErrOAuthClientNotFound) {
+		t.Fatalf("set scopes of revoked client: expected ErrOAuthClientNotFound, got %v", err)
+	}
+
+	clients, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(clients) != 1 || clients[0].IsActive() {
+		t.Fatalf("expected one revoked client, got %d", len(clients))
+	}
+
+	if _, err := repo.GetByID(ctx, "missing"); !errors.Is(err, domain.ErrOAuthClientNotFound) {
+		t.Fatalf("expected ErrOAuthClientNotFound, got %v", err)
+	}
+}
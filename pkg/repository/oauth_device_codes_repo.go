@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// OAuthDeviceCodesRepository handles persistence of device authorization requests.
+type OAuthDeviceCodesRepository struct {
+	db *sql.DB
+}
+
+// NewOAuthDeviceCodesRepository creates a new device codes repository.
+func NewOAuthDeviceCodesRepository(db *sql.DB) *OAuthDeviceCodesRepository {
+	return &OAuthDeviceCodesRepository{db: db}
+}
+
+// Create stores a new pending request.
+func (r *OAuthDeviceCodesRepository) Create(ctx context.Context, auth *domain.DeviceAuthorization) error {
+	query := `
+		INSERT INTO oauth_device_codes (id, device_code_hash, user_code_hash, client_id, scope, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		auth.ID, auth.DeviceCodeHash, auth.UserCodeHash, auth.ClientID, auth.Scope,
+		auth.Status, auth.CreatedAt, auth.ExpiresAt,
+	)
+	return err
+}
+
+// GetPendingByUserCode retrieves the pending, unexpired request with the
+// given user code hash.
+func (r *OAuthDeviceCodesRepository) GetPendingByUserCode(ctx context.Context, userCodeHash string) (*domain.DeviceAuthorization, error) {
+	query := `
+		SELECT ` + deviceCodeColumns + `
+		FROM oauth_device_codes
+		WHERE user_code_hash = $1 AND status = 'pending' AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	auth, err := scanDeviceAuthorization(r.db.QueryRowContext(ctx, query, userCodeHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrDeviceCodeNotFound
+	}
+	return auth, err
+}
+
+// Poll records that the device polled with the given device code hash, and
+// returns its request. LastPolledAt is the time of the poll before this one.
+func (r *OAuthDeviceCodesRepository) Poll(ctx context.Context, deviceCodeHash string) (*domain.DeviceAuthorization, error) {
+	query := `
+		UPDATE oauth_device_codes d
+		SET last_polled_at = NOW()
+		FROM (
+			SELECT id, last_polled_at FROM oauth_device_codes
+			WHERE device_code_hash = $1
+			FOR UPDATE
+		) previous
+		WHERE d.id = previous.id
+		RETURNING d.id, d.device_code_hash, d.user_code_hash, d.client_id, d.scope, d.status,
+			d.user_id, d.mfa_verified, d.created_at, d.expires_at, previous.last_polled_at
+	`
+	auth, err := scanDeviceAuthorization(r.db.QueryRowContext(ctx, query, deviceCodeHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrDeviceCodeNotFound
+	}
+	return auth, err
+}
+
+// Approve marks a pending, unexpired request as approved by userID.
+func (r *OAuthDeviceCodesRepository) Approve(ctx context.Context, id, userID uuid.UUID, mfaVerified bool) error {
+	return r.resolve(ctx, `
+		UPDATE oauth_device_codes
+		SET status = 'approved', user_id = $2, mfa_verified = $3
+		WHERE id = $1 AND status = 'pending' AND expires_at > NOW()
+	`, id, userID, mfaVerified)
+}
+
+// Deny marks a pending, unexpired request as denied.
+func (r *OAuthDeviceCodesRepository) Deny(ctx context.Context, id uuid.UUID) error {
+	return r.resolve(ctx, `
+		UPDATE oauth_device_codes
+		SET status = 'denied'
+		WHERE id = $1 AND status = 'pending' AND expires_at > NOW()
+	`, id)
+}
+
+// Delete removes a request. Of concurrent callers only one succeeds; the
+// others get ErrDeviceCodeNotFound.
+func (r *OAuthDeviceCodesRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.resolve(ctx, `DELETE FROM oauth_device_codes WHERE id = $1`, id)
+}
+
+// resolve runs a statement changing a single request, returning
+// ErrDeviceCodeNotFound if it changed none.
+func (r *OAuthDeviceCodesRepository) resolve(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+// DeleteExpired deletes up to limit requests that expired more than
+// olderThan ago, and returns how many were deleted.
+func (r *OAuthDeviceCodesRepository) DeleteExpired(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM oauth_device_codes
+		WHERE id IN (
+			SELECT id FROM oauth_device_codes
+			WHERE expires_at < $1
+			LIMIT $2
+		)
+	`
+	cutoff := time.Now().Add(-olderThan)
+	result, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deviceCodeColumns = `id, device_code_hash, user_code_hash, client_id, scope, status,
+			user_id, mfa_verified, created_at, expires_at, last_polled_at`
+
+func scanDeviceAuthorization(row rowScanner) (*domain.DeviceAuthorization, error) {
+	auth := &domain.DeviceAuthorization{}
+	err := row.Scan(
+		&auth.ID,
+		&auth.DeviceCodeHash,
+		&auth.UserCodeHash,
+		&auth.ClientID,
+		&auth.Scope,
+		&auth.Status,
+		&auth.UserID,
+		&auth.MFAVerified,
+		&auth.CreatedAt,
+		&auth.ExpiresAt,
+		&auth.LastPolledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestOAuthDeviceCodesRepository_Lifecycle(t *testing.T) {
+	db := openRolesTestDB(t)
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+	ctx := context.Background()
+
+	schema := "oauth_device_codes_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE oauth_device_codes (
+			id UUID PRIMARY KEY,
+			device_code_hash TEXT NOT NULL UNIQUE,
+			user_code_hash TEXT NOT NULL,
+			client_id TEXT NOT NULL,
+			scope TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'pending',
+			user_id UUID,
+			mfa_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL,
+			last_polled_at TIMESTAMPTZ
+		)`)
+
+	repo := NewOAuthDeviceCodesRepository(db)
+	now := time.Now()
+	auth := &domain.DeviceAuthorization{
+		ID:             uuid.New(),
+		DeviceCodeHash: "device-1",
+		UserCodeHash:   "user-1",
+		ClientID:       "cli",
+		Status:         domain.DeviceAuthorizationPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(10 * time.Minute),
+	}
+	if err := repo.Create(ctx, auth); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// Each poll returns the time of the one before
+	polled, err := repo.Poll(ctx, "device-1")
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if polled.LastPolledAt != nil || polled.Status != domain.DeviceAuthorizationPending {
+		t.Fatalf("first poll = %#v", polled)
+	}
+	polled, err = repo.Poll(ctx, "device-1")
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if polled.LastPolledAt == nil {
+		t.Fatal("second poll has no previous poll time")
+	}
+
+	pending, err := repo.GetPendingByUserCode(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("get pending: %v", err)
+	}
+	userID := uuid.New()
+	if err := repo.Approve(ctx, pending.ID, userID, true); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if _, err := repo.GetPendingByUserCode(ctx, "user-1"); !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		t.Fatalf("get approved by user code: err = %v, want ErrDeviceCodeNotFound", err)
+	}
+	if err := repo.Deny(ctx, pending.ID); !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		t.Fatalf("deny approved: err = %v, want ErrDeviceCodeNotFound", err)
+	}
+
+	approved, err := repo.Poll(ctx, "device-1")
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if approved.Status != domain.DeviceAuthorizationApproved || approved.UserID == nil || *approved.UserID != userID || !approved.MFAVerified {
+		t.Fatalf("approved = %#v", approved)
+	}
+
+	// Redeeming is single use
+	if err := repo.Delete(ctx, approved.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repo.Delete(ctx, approved.ID); !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		t.Fatalf("second delete: err = %v, want ErrDeviceCodeNotFound", err)
+	}
+	if _, err := repo.Poll(ctx, "device-1"); !errors.Is(err, domain.ErrDeviceCodeNotFound) {
+		t.Fatalf("poll redeemed: err = %v, want ErrDeviceCodeNotFound", err)
+	}
+
+	expired := *auth
+	expired.ID = uuid.New()
+	expired.DeviceCodeHash = "device-2"
+	expired.ExpiresAt = now.Add(-time.Hour)
+	if err := repo.Create(ctx, &expired); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deleted, err := repo.DeleteExpired(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d requests, want 1", deleted)
+	}
+}
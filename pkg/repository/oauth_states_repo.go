@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// OAuthStatesRepository handles persistence of external logins in progress.
+type OAuthStatesRepository struct {
+	db *sql.DB
+}
+
+// NewOAuthStatesRepository creates a new OAuth states repository.
+func NewOAuthStatesRepository(db *sql.DB) *OAuthStatesRepository {
+	return &OAuthStatesRepository{db: db}
+}
+
+// Create stores a new state.
+func (r *OAuthStatesRepository) Create(ctx context.Context, state *domain.OAuthState) error {
+	query := `
+		INSERT INTO oauth_states (state_hash, provider, link_user_id, nonce, code_verifier, redirect_uri, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		state.StateHash, state.Provider, state.LinkUserID, state.Nonce, state.CodeVerifier,
+		state.RedirectURI, state.CreatedAt, state.ExpiresAt,
+	)
+	return err
+}
+
+// Take deletes the state with the given hash and returns it. Of concurrent
+// callers only one gets the state; the others get ErrOAuthStateNotFound.
+func (r *OAuthStatesRepository) Take(ctx context.Context, stateHash string) (*domain.OAuthState, error) {
+	query := `
+		DELETE FROM oauth_states
+		WHERE state_hash = $1
+		RETURNING state_hash, provider, link_user_id, nonce, code_verifier, redirect_uri, created_at, expires_at
+	`
+	state := &domain.OAuthState{}
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(
+		&state.StateHash, &state.Provider, &state.LinkUserID, &state.Nonce, &state.CodeVerifier,
+		&state.RedirectURI, &state.CreatedAt, &state.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrOAuthStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeleteExpired deletes up to limit states that expired more than olderThan
+// ago, and returns how many were deleted.
+func (r *OAuthStatesRepository) DeleteExpired(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM oauth_states
+		WHERE state_hash IN (
+			SELECT state_hash FROM oauth_states
+			WHERE expires_at < $1
+			LIMIT $2
+		)
+	`
+	cutoff := time.Now().Add(-olderThan)
+	result, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
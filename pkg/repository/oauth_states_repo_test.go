@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestOAuthStatesRepository_TakeIsSingleUse(t *testing.T) {
+	db := openRolesTestDB(t)
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+	ctx := context.Background()
+
+	schema := "oauth_states_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE oauth_states (
+			state_hash TEXT PRIMARY KEY,
+			provider TEXT NOT NULL,
+			link_user_id UUID,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			redirect_uri TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL
+		)`)
+
+	repo := NewOAuthStatesRepository(db)
+	now := time.Now()
+	state := &domain.OAuthState{
+		StateHash:    "hash-1",
+		Provider:     "google",
+		Nonce:        "nonce",
+		CodeVerifier: "verifier",
+		RedirectURI:  "/dashboard",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(10 * time.Minute),
+	}
+	if err := repo.Create(ctx, state); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// Concurrent callbacks with the same state: exactly one wins
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := repo.Take(ctx, "hash-1")
+			if err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+				if got.Provider != "google" || got.CodeVerifier != "verifier" || got.RedirectURI != "/dashboard" {
+					t.Errorf("unexpected state %#v", got)
+				}
+			} else if !errors.Is(err, domain.ErrOAuthStateNotFound) {
+				t.Errorf("take: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.Fatalf("state taken %d times, want 1", taken)
+	}
+
+	expired := *state
+	expired.StateHash = "hash-2"
+	expired.ExpiresAt = now.Add(-time.Hour)
+	if err := repo.Create(ctx, &expired); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	deleted, err := repo.DeleteExpired(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d states, want 1", deleted)
+	}
+}
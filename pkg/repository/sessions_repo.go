@@ -22,14 +22,22 @@ func NewSessionsRepository(db *sql.DB) *SessionsRepository {
 }
 
 // Create creates a new session.
+// A session without a family starts a new one rooted at itself.
 func (r *SessionsRepository) Create(ctx context.Context, session *domain.Session) error {
+	return r.createTx(ctx, r.db, session)
+}
+
+func (r *SessionsRepository) createTx(ctx context.Context, q Querier, session *domain.Session) error {
+	if session.FamilyID == uuid.Nil {
+		session.FamilyID = session.ID
+	}
 	query := `
-		INSERT INTO sessions (id, user_id, token_hash, created_at, expires_at, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO sessions (id, user_id, family_id, token_hash, created_at, expires_at, last_seen_at, client_id, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		session.ID, session.UserID, session.TokenHash,
-		session.CreatedAt, session.ExpiresAt, session.Metadata,
+	_, err := q.ExecContext(ctx, query,
+		session.ID, session.UserID, session.FamilyID, session.TokenHash,
+		session.CreatedAt, session.ExpiresAt, session.LastSeenAt, session.ClientID, session.Metadata,
 	)
 	return err
 }
@@ -37,16 +45,11 @@ func (r *SessionsRepository) Create(ctx context.Context, session *domain.Session
 // GetByID retrieves a session by ID.
 func (r *SessionsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
 	query := `
-		SELECT id, user_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, metadata
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, rotated_at, replaced_by, COALESCE(replaced_by_token, ''), COALESCE(client_id, ''), metadata
 		FROM sessions
 		WHERE id = $1
 	`
-	session := &domain.Session{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&session.ID, &session.UserID, &session.TokenHash,
-		&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
-		&session.LastSeenAt, &session.Metadata,
-	)
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrSessionNotFound
 	}
@@ -59,16 +62,11 @@ func (r *SessionsRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain
 // GetByTokenHash retrieves a session by token hash.
 func (r *SessionsRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.Session, error) {
 	query := `
-		SELECT id, user_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, metadata
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, rotated_at, replaced_by, COALESCE(replaced_by_token, ''), COALESCE(client_id, ''), metadata
 		FROM sessions
 		WHERE token_hash = $1 AND revoked_at IS NULL
 	`
-	session := &domain.Session{}
-	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
-		&session.ID, &session.UserID, &session.TokenHash,
-		&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
-		&session.LastSeenAt, &session.Metadata,
-	)
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, tokenHash))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrSessionNotFound
 	}
@@ -79,11 +77,12 @@ func (r *SessionsRepository) GetByTokenHash(ctx context.Context, tokenHash strin
 }
 
 // GetByUserID retrieves all active sessions for a user.
+// Only the current (unrotated) token of each family is returned.
 func (r *SessionsRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
 	query := `
-		SELECT id, user_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, metadata
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, rotated_at, replaced_by, COALESCE(replaced_by_token, ''), COALESCE(client_id, ''), metadata
 		FROM sessions
-		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
 		ORDER BY created_at DESC
 	`
 	rows, err := r.db.QueryContext(ctx, query, userID)
@@ -94,12 +93,7 @@ func (r *SessionsRepository) GetByUserID(ctx context.Context, userID uuid.UUID)
 
 	var sessions []*domain.Session
 	for rows.Next() {
-		session := &domain.Session{}
-		err := rows.Scan(
-			&session.ID, &session.UserID, &session.TokenHash,
-			&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
-			&session.LastSeenAt, &session.Metadata,
-		)
+		session, err := scanSession(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -129,17 +123,74 @@ func (r *SessionsRepository) Revoke(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// RevokeByTokenHash revokes a session by token hash.
+// RevokeByTokenHash revokes the session family that the given token hash belongs to.
 func (r *SessionsRepository) RevokeByTokenHash(ctx context.Context, tokenHash string) error {
 	query := `
 		UPDATE sessions
 		SET revoked_at = NOW()
-		WHERE token_hash = $1 AND revoked_at IS NULL
+		WHERE family_id IN (SELECT family_id FROM sessions WHERE token_hash = $1)
+		  AND revoked_at IS NULL
 	`
 	_, err := r.db.ExecContext(ctx, query, tokenHash)
 	return err
 }
 
+// GetActiveByFamilyID retrieves the current (unrotated, unrevoked) session of a family.
+func (r *SessionsRepository) GetActiveByFamilyID(ctx context.Context, familyID uuid.UUID) (*domain.Session, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, last_seen_at, rotated_at, replaced_by, COALESCE(replaced_by_token, ''), COALESCE(client_id, ''), metadata
+		FROM sessions
+		WHERE family_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, familyID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Rotate marks the parent session as rotated and creates its replacement in one transaction.
+// replacementToken is stored on the parent as domain.Session.ReplacementToken.
+// Returns domain.ErrSessionRotated if the parent was already rotated or revoked,
+// which happens when two refreshes race for the same token.
+func (r *SessionsRepository) Rotate(ctx context.Context, parentID uuid.UUID, next *domain.Session, replacementToken string) error {
+	return Tx(ctx, r.db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE sessions
+			SET rotated_at = NOW(), replaced_by = $2, replaced_by_token = $3, last_seen_at = NOW()
+			WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+		`
+		result, err := tx.ExecContext(ctx, query, parentID, next.ID, replacementToken)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return domain.ErrSessionRotated
+		}
+		return r.createTx(ctx, tx, next)
+	})
+}
+
+// RevokeFamily revokes every session in a family.
+func (r *SessionsRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
 // RevokeAllByUserID revokes all sessions for a user.
 func (r *SessionsRepository) RevokeAllByUserID(ctx context.Context, userID uuid.UUID) error {
 	query := `
@@ -151,6 +202,17 @@ func (r *SessionsRepository) RevokeAllByUserID(ctx context.Context, userID uuid.
 	return err
 }
 
+// RevokeAllByUserIDExcept revokes all sessions for a user except those in the given family.
+func (r *SessionsRepository) RevokeAllByUserIDExcept(ctx context.Context, userID, familyID uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, familyID)
+	return err
+}
+
 // UpdateLastSeen updates the last_seen_at timestamp.
 func (r *SessionsRepository) UpdateLastSeen(ctx context.Context, id uuid.UUID) error {
 	query := `
@@ -186,3 +248,36 @@ func (r *SessionsRepository) DeleteExpired(ctx context.Context, olderThan time.D
 	}
 	return result.RowsAffected()
 }
+
+// DeleteExpiredBatch deletes up to limit sessions that expired or were revoked
+// more than olderThan ago, and returns how many were deleted.
+func (r *SessionsRepository) DeleteExpiredBatch(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE id IN (
+			SELECT id FROM sessions
+			WHERE expires_at < $1 OR (revoked_at IS NOT NULL AND revoked_at < $1)
+			LIMIT $2
+		)
+	`
+	cutoff := time.Now().Add(-olderThan)
+	result, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanSession(row rowScanner) (*domain.Session, error) {
+	session := &domain.Session{}
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.FamilyID, &session.TokenHash,
+		&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
+		&session.LastSeenAt, &session.RotatedAt, &session.ReplacedBy, &session.ReplacementToken,
+		&session.ClientID, &session.Metadata,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func setupSessionsTestSchema(t *testing.T, db *sql.DB) {
+	t.Helper()
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+
+	schema := "sessions_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE sessions (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL,
+			family_id UUID NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL,
+			revoked_at TIMESTAMPTZ,
+			last_seen_at TIMESTAMPTZ,
+			rotated_at TIMESTAMPTZ,
+			replaced_by UUID,
+			replaced_by_token TEXT,
+			client_id TEXT,
+			metadata JSONB
+		)`)
+}
+
+func TestSessionsRepository_RevokeAllByUserIDExcept(t *testing.T) {
+	db := openRolesTestDB(t)
+	setupSessionsTestSchema(t, db)
+	ctx := context.Background()
+	repo := NewSessionsRepository(db)
+
+	userID := uuid.New()
+	now := time.Now()
+	newSession := func(user uuid.UUID) *domain.Session {
+		id := uuid.New()
+		session := &domain.Session{
+			ID:         id,
+			UserID:     user,
+			TokenHash:  id.String(),
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(time.Hour),
+			LastSeenAt: &now,
+		}
+		if err := repo.Create(ctx, session); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		return session
+	}
+
+	current := newSession(userID)
+	newSession(userID)
+	newSession(userID)
+	other := newSession(uuid.New())
+
+	// Rotate the current session so the family spans two rows
+	next := &domain.Session{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  current.FamilyID,
+		TokenHash: uuid.NewString(),
+		CreatedAt: current.CreatedAt,
+		ExpiresAt: now.Add(time.Hour),
+		ClientID:  "dashboard",
+	}
+	if err := repo.Rotate(ctx, current.ID, next, "sealed-token"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	rotated, err := repo.GetByID(ctx, current.ID)
+	if err != nil {
+		t.Fatalf("get rotated session: %v", err)
+	}
+	if rotated.ReplacedBy == nil || *rotated.ReplacedBy != next.ID || rotated.ReplacementToken != "sealed-token" {
+		t.Errorf("rotated session should point at its replacement, got %v %q", rotated.ReplacedBy, rotated.ReplacementToken)
+	}
+
+	sessions, err := repo.GetByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 active sessions before revocation, got %d", len(sessions))
+	}
+
+	if err := repo.RevokeAllByUserIDExcept(ctx, userID, current.FamilyID); err != nil {
+		t.Fatalf("revoke others: %v", err)
+	}
+
+	sessions, err = repo.GetByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != next.ID {
+		t.Fatalf("expected only the current family's newest session to remain, got %d sessions", len(sessions))
+	}
+	if sessions[0].ClientID != "dashboard" {
+		t.Errorf("ClientID = %q, want %q", sessions[0].ClientID, "dashboard")
+	}
+	if current.ClientID != "" || rotated.ClientID != "" {
+		t.Error("sessions created without a client should have no ClientID")
+	}
+
+	otherSession, err := repo.GetByID(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("get other user's session: %v", err)
+	}
+	if otherSession.RevokedAt != nil {
+		t.Error("another user's session should not be revoked")
+	}
+	if otherSession.LastSeenAt == nil {
+		t.Error("Create should store LastSeenAt")
+	}
+}
+
+func TestSessionsRepository_DeleteExpiredBatch(t *testing.T) {
+	db := openRolesTestDB(t)
+	setupSessionsTestSchema(t, db)
+	ctx := context.Background()
+	repo := NewSessionsRepository(db)
+
+	now := time.Now()
+	longAgo := now.Add(-48 * time.Hour)
+	create := func(expiresAt time.Time, revokedAt *time.Time) uuid.UUID {
+		id := uuid.New()
+		err := repo.Create(ctx, &domain.Session{
+			ID:        id,
+			UserID:    uuid.New(),
+			TokenHash: id.String(),
+			CreatedAt: longAgo,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		if revokedAt != nil {
+			execRolesTestSQL(t, db, `UPDATE sessions SET revoked_at = '`+revokedAt.Format(time.RFC3339)+`' WHERE id = '`+id.String()+`'`)
+		}
+		return id
+	}
+
+	for i := 0; i < 3; i++ {
+		create(longAgo, nil) // expired long ago
+	}
+	create(now.Add(time.Hour), &longAgo)         // revoked long ago
+	recent := create(now.Add(-time.Minute), nil) // expired, but within retention
+	active := create(now.Add(time.Hour), nil)    // still active
+
+	deleted, err := repo.DeleteExpiredBatch(ctx, 24*time.Hour, 3)
+	if err != nil {
+		t.Fatalf("delete batch: %v", err)
+	}
+	if deleted != 3 {
+		t.Fatalf("first batch deleted %d, want 3", deleted)
+	}
+	deleted, err = repo.DeleteExpiredBatch(ctx, 24*time.Hour, 3)
+	if err != nil {
+		t.Fatalf("delete batch: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("second batch deleted %d, want 1", deleted)
+	}
+
+	for _, id := range []uuid.UUID{recent, active} {
+		if _, err := repo.GetByID(ctx, id); err != nil {
+			t.Errorf("session %s should be kept: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+// SigningKeysRepository handles persistence of access token signing keys.
+type SigningKeysRepository struct {
+	db *sql.DB
+}
+
+// NewSigningKeysRepository creates a new signing keys repository.
+func NewSigningKeysRepository(db *sql.DB) *SigningKeysRepository {
+	return &SigningKeysRepository{db: db}
+}
+
+// Create stores a new staged signing key.
+func (r *SigningKeysRepository) Create(ctx context.Context, key *domain.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (id, algorithm, key_encrypted, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.db.ExecContext(ctx, query, key.ID, key.Algorithm, key.KeyEncrypted, key.CreatedAt)
+	return err
+}
+
+// GetByID retrieves a signing key by its key ID.
+func (r *SigningKeysRepository) GetByID(ctx context.Context, id string) (*domain.SigningKey, error) {
+	query := `
+		SELECT id, algorithm, key_encrypted, created_at, activated_at, retire_at
+		FROM signing_keys
+		WHERE id = $1
+	`
+	key, err := scanSigningKey(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrSigningKeyNotFound
+	}
+	return key, err
+}
+
+// List returns all signing keys, including retired ones, oldest first.
+func (r *SigningKeysRepository) List(ctx context.Context) ([]*domain.SigningKey, error) {
+	return r.list(ctx, `
+		SELECT id, algorithm, key_encrypted, created_at, activated_at, retire_at
+		FROM signing_keys
+		ORDER BY created_at ASC
+	`)
+}
+
+// ListUsable returns staged and active keys that have not reached their retirement time.
+func (r *SigningKeysRepository) ListUsable(ctx context.Context) ([]*domain.SigningKey, error) {
+	return r.list(ctx, `
+		SELECT id, algorithm, key_encrypted, created_at, activated_at, retire_at
+		FROM signing_keys
+		WHERE retire_at IS NULL OR retire_at > NOW()
+		ORDER BY created_at ASC
+	`)
+}
+
+func (r *SigningKeysRepository) list(ctx context.Context, query string) ([]*domain.SigningKey, error) {
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*domain.SigningKey{}
+	for rows.Next() {
+		key, err := scanSigningKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// WithLock runs fn while holding the advisory lock with the given key on this
+// repository's database. If another connection holds it, fn is not run and
+// false is returned.
+func (r *SigningKeysRepository) WithLock(ctx context.Context, key int64, fn func(ctx context.Context) error) (bool, error) {
+	return WithAdvisoryLock(ctx, r.db, key, fn)
+}
+
+// Promote makes a key the signing key. Previously promoted keys keep verifying
+// tokens for retireAfter and are then retired.
+func (r *SigningKeysRepository) Promote(ctx context.Context, id string, retireAfter time.Duration) error {
+	return Tx(ctx, r.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE signing_keys
+			SET activated_at = NOW(), retire_at = NULL
+			WHERE id = $1 AND (retire_at IS NULL OR retire_at > NOW())
+		`, id)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return domain.ErrSigningKeyNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE signing_keys
+			SET retire_at = NOW() + make_interval(secs => $2)
+			WHERE id <> $1 AND activated_at IS NOT NULL AND retire_at IS NULL
+		`, id, retireAfter.Seconds())
+		return err
+	})
+}
+
+// Retire stops a key from verifying tokens immediately.
+// The current signing key cannot be retired; promote a replacement first.
+func (r *SigningKeysRepository) Retire(ctx context.Context, id string) error {
+	key, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.Status(time.Now()) == domain.SigningKeyRetired {
+		return nil
+	}
+
+	var signerID string
+	err = r.db.QueryRowContext(ctx, `
+		SELECT id FROM signing_keys
+		WHERE activated_at IS NOT NULL AND (retire_at IS NULL OR retire_at > NOW())
+		ORDER BY activated_at DESC
+		LIMIT 1
+	`).Scan(&signerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if signerID == id {
+		return domain.ErrSigningKeyInUse
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE signing_keys SET retire_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func scanSigningKey(row rowScanner) (*domain.SigningKey, error) {
+	key := &domain.SigningKey{}
+	err := row.Scan(
+		&key.ID,
+		&key.Algorithm,
+		&key.KeyEncrypted,
+		&key.CreatedAt,
+		&key.ActivatedAt,
+		&key.RetireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/tendant/simple-idm-slim/pkg/domain"
+)
+
+func TestSigningKeysRepository_Lifecycle(t *testing.T) {
+	db := openRolesTestDB(t)
+	db.SetMaxOpenConns(1) // keep search_path on a single connection
+	ctx := context.Background()
+
+	schema := "signing_keys_repo_test_" + uuid.NewString()
+	execRolesTestSQL(t, db, `CREATE SCHEMA `+pq.QuoteIdentifier(schema))
+	t.Cleanup(func() {
+		execRolesTestSQL(t, db, `DROP SCHEMA IF EXISTS `+pq.QuoteIdentifier(schema)+` CASCADE`)
+	})
+	execRolesTestSQL(t, db, `SET search_path TO `+pq.QuoteIdentifier(schema)+`, public`)
+	execRolesTestSQL(t, db, `
+		CREATE TABLE signing_keys (
+			id TEXT PRIMARY KEY,
+			algorithm TEXT NOT NULL,
+			key_encrypted TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			activated_at TIMESTAMPTZ,
+			retire_at TIMESTAMPTZ
+		)`)
+
+	repo := NewSigningKeysRepository(db)
+	for _, id := range []string{"k1", "k2"} {
+		if err := repo.Create(ctx, &domain.SigningKey{ID: id, Algorithm: "HS256", KeyEncrypted: "x", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+
+	// Staged keys are usable for verification but not active
+	k1, err := repo.GetByID(ctx, "k1")
+	if err != nil {
+		t.Fatalf("get k1: %v", err)
+	}
+	if k1.Status(time.Now()) != domain.SigningKeyStaged {
+		t.Fatalf("expected staged, got %s", k1.Status(time.Now()))
+	}
+
+	// Promote k1, then k2: k1 keeps verifying until its retirement time
+	if err := repo.Promote(ctx, "k1", time.Hour); err != nil {
+		t.Fatalf("promote k1: %v", err)
+	}
+	if err := repo.Promote(ctx, "k2", time.Hour); err != nil {
+		t.Fatalf("promote k2: %v", err)
+	}
+	k1, _ = repo.GetByID(ctx, "k1")
+	if k1.RetireAt == nil || k1.Status(time.Now()) != domain.SigningKeyActive {
+		t.Fatalf("expected k1 active with retirement time, got %#v", k1)
+	}
+
+	// The signing key cannot be retired
+	if err := repo.Retire(ctx, "k2"); !errors.Is(err, domain.ErrSigningKeyInUse) {
+		t.Fatalf("expected ErrSigningKeyInUse, got %v", err)
+	}
+
+	// Retiring k1 removes it from the usable set
+	if err := repo.Retire(ctx, "k1"); err != nil {
+		t.Fatalf("retire k1: %v", err)
+	}
+	usable, err := repo.ListUsable(ctx)
+	if err != nil {
+		t.Fatalf("list usable: %v", err)
+	}
+	if len(usable) != 1 || usable[0].ID != "k2" {
+		t.Fatalf("expected only k2 usable, got %d keys", len(usable))
+	}
+
+	// Retired keys cannot be promoted again
+	if err := repo.Promote(ctx, "k1", time.Hour); !errors.Is(err, domain.ErrSigningKeyNotFound) {
+		t.Fatalf("expected ErrSigningKeyNotFound, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, "missing"); !errors.Is(err, domain.ErrSigningKeyNotFound) {
+		t.Fatalf("expected ErrSigningKeyNotFound, got %v", err)
+	}
+}
+
+func TestSigningKeysRepository_WithLock(t *testing.T) {
+	db := openRolesTestDB(t)
+	ctx := context.Background()
+	repo := NewSigningKeysRepository(db)
+	key := int64(uuid.New().ID())
+
+	ran := false
+	locked, err := repo.WithLock(ctx, key, func(ctx context.Context) error {
+		ran = true
+		// A second holder, as another replica would be, does not get the lock
+		innerLocked, err := repo.WithLock(ctx, key, func(context.Context) error {
+			t.Error("fn should not run while the lock is held elsewhere")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if innerLocked {
+			t.Error("expected the lock to be held")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("with lock: %v", err)
+	}
+	if !locked || !ran {
+		t.Fatal("expected fn to run under the lock")
+	}
+}
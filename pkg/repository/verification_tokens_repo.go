@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tendant/simple-idm-slim/pkg/domain"
@@ -99,3 +100,22 @@ func (r *VerificationTokensRepository) RevokeActiveTokensTx(ctx context.Context,
 	_, err := q.ExecContext(ctx, query, userID, kind)
 	return err
 }
+
+// DeleteExpired deletes up to limit tokens that expired or were consumed more
+// than olderThan ago, and returns how many were deleted.
+func (r *VerificationTokensRepository) DeleteExpired(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM verification_tokens
+		WHERE id IN (
+			SELECT id FROM verification_tokens
+			WHERE expires_at < $1 OR (consumed_at IS NOT NULL AND consumed_at < $1)
+			LIMIT $2
+		)
+	`
+	cutoff := time.Now().Add(-olderThan)
+	result, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}